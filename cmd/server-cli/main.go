@@ -8,6 +8,7 @@ import (
 	"time"
 
 	server_api "github.com/Yeuoly/kisara/src/api"
+	"github.com/Yeuoly/kisara/src/controller"
 	"github.com/Yeuoly/kisara/src/helper"
 	"github.com/Yeuoly/kisara/src/router/server"
 	synergy_server "github.com/Yeuoly/kisara/src/routine/synergy/server"
@@ -16,7 +17,9 @@ import (
 )
 
 func setupRouter() *gin.Engine {
-	r := gin.Default()
+	r := gin.New()
+	// requests are logged with tokens redacted
+	r.Use(controller.RequestLogger(), gin.Recovery())
 
 	server.Setup(r)
 
@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 
+	"github.com/Yeuoly/kisara/src/controller"
 	"github.com/Yeuoly/kisara/src/helper"
 	"github.com/Yeuoly/kisara/src/router/server"
 	synergy_server "github.com/Yeuoly/kisara/src/routine/synergy/server"
@@ -10,7 +11,9 @@ import (
 )
 
 func setupRouter() *gin.Engine {
-	r := gin.Default()
+	r := gin.New()
+	// requests are logged with tokens redacted
+	r.Use(controller.RequestLogger(), gin.Recovery())
 
 	server.Setup(r)
 
@@ -81,7 +81,7 @@ func testService() {
 		}
 	}
 
-	service_resp, err := client.CreateService(service)
+	service_resp, err := client.CreateService(service, nil, types.ImageRefresh{})
 	if err != nil {
 		panic(err)
 	}
@@ -39,7 +39,7 @@ func testService() {
 	defer client.Stop()
 
 	for i := 0; i < 100; i++ {
-		service_resp, err := client.CreateService(service)
+		service_resp, err := client.CreateService(service, nil, types.ImageRefresh{})
 		if err != nil {
 			panic(err)
 		}
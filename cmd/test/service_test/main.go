@@ -74,7 +74,7 @@ func testService() {
 	client := docker.NewDocker()
 	defer client.Stop()
 
-	service_resp, err := client.CreateService(service)
+	service_resp, err := client.CreateService(service, nil, types.ImageRefresh{})
 	if err != nil {
 		panic(err)
 	}
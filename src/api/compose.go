@@ -7,26 +7,64 @@ package api
 */
 
 import (
+	"archive/tar"
+	"bytes"
 	"errors"
 	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/Yeuoly/kisara/src/helper"
+	log "github.com/Yeuoly/kisara/src/routine/log"
 	"github.com/Yeuoly/kisara/src/types"
 )
 
-// convert docker-compose file into kisara config
+/*
+	convert docker-compose file into kisara config, ipv4_address of services and subnet of networks
+	are kept as they are, if random_network is set, networks get random CIDR and ipv4_address
+	is converted into host_offset inside the subnet declared in docker-compose,
+	keys which are not supported are logged and dropped, see ConvertFromComposeWithWarnings
+*/
 func ConvertFromCompose(compose_file *types.DockerComposeFile, random_network bool) (*types.ServiceConfig, error) {
+	config, warnings, err := ConvertFromComposeWithWarnings(compose_file, random_network)
+	for _, warning := range warnings {
+		log.Warn("[Compose] %s", warning)
+	}
+	return config, err
+}
+
+/*
+	ConvertFromComposeWithWarnings works like ConvertFromCompose, but returns what was dropped,
+	contexts of services with build should be packed by PackBuildContexts and sent in RequestLaunchService
+*/
+func ConvertFromComposeWithWarnings(compose_file *types.DockerComposeFile, random_network bool) (*types.ServiceConfig, []string, error) {
+	config, warnings, err := convertFromCompose(compose_file, random_network)
+	sort.Strings(warnings)
+	return config, warnings, err
+}
+
+func convertFromCompose(compose_file *types.DockerComposeFile, random_network bool) (*types.ServiceConfig, []string, error) {
 	networks := compose_file.Networks
 	services := compose_file.Services
+	warnings := []string{}
+
+	for key := range compose_file.Extra {
+		if key != "version" && key != "name" {
+			warnings = append(warnings, fmt.Sprintf("top-level key %v is not supported, ignored", key))
+		}
+	}
 
 	result_config := types.ServiceConfig{}
 	result_config.NetworkCount = len(networks)
 	result_config_networks := []types.ServiceConfigContainerNetwork{}
 
 	if result_config.NetworkCount > 26 {
-		return nil, errors.New("network count should less then 27")
+		return nil, warnings, errors.New("network count should less then 27")
 	}
 
 	generate_network_name := func() string {
@@ -34,78 +72,212 @@ func ConvertFromCompose(compose_file *types.DockerComposeFile, random_network bo
 	}
 
 	if result_config.NetworkCount == 0 {
-		return nil, fmt.Errorf("shoud contains at least one network")
+		return nil, warnings, fmt.Errorf("shoud contains at least one network")
 	}
 
 	// map docker-compose network name to kisara network
 	network_map := make(map[string]string)
+	// subnet declared in docker-compose
+	subnet_map := make(map[string]string)
 
 	if result_config.NetworkCount != 0 {
-		for name, network := range networks {
+		// networks are sorted so that they are named in a stable order
+		network_names := []string{}
+		for name := range networks {
+			network_names = append(network_names, name)
+		}
+		sort.Strings(network_names)
+
+		for _, name := range network_names {
+			network := networks[name]
+			for key := range network.Extra {
+				warnings = append(warnings, fmt.Sprintf("network %v: key %v is not supported, ignored", name, key))
+			}
+
 			if !network.IPAM.Internal {
-				return nil, fmt.Errorf("network %v shoud be internal", name)
+				return nil, warnings, fmt.Errorf("network %v shoud be internal", name)
 			}
 
 			if !network.IPAM.Attachable {
-				return nil, fmt.Errorf("network %v shoud be attachable", name)
+				return nil, warnings, fmt.Errorf("network %v shoud be attachable", name)
 			}
 
-			if random_network {
-				if network_map[name] == "" {
-					result_network := types.ServiceConfigContainerNetwork{
-						Network:    generate_network_name(),
-						RandomCIDR: true,
-					}
-					result_config_networks = append(result_config_networks, result_network)
-					network_map[name] = result_network.Network
+			for _, config := range network.IPAM.Config {
+				if config.Subnet != "" {
+					subnet_map[name] = config.Subnet
+					break
 				}
-			} else {
-				return nil, fmt.Errorf("only supports random CIDR currently")
+			}
+
+			if !random_network && subnet_map[name] == "" {
+				return nil, warnings, fmt.Errorf("network %v should have a subnet if random network is disabled", name)
+			}
+
+			if network_map[name] == "" {
+				result_network := types.ServiceConfigContainerNetwork{
+					Network:    generate_network_name(),
+					RandomCIDR: random_network,
+				}
+				if !random_network {
+					result_network.Subnet = subnet_map[name]
+				}
+				result_config_networks = append(result_config_networks, result_network)
+				network_map[name] = result_network.Network
 			}
 		}
 	}
 
 	containers := []types.ServiceConfigContainer{}
 
-	for service_name, service := range services {
-		if service.Build != "" {
-			return nil, fmt.Errorf("do not support build image in docker-compose, found build config in service %v", service_name)
+	// services which should be healthy before those depending on them are launched
+	healthy_required := make(map[string]bool)
+
+	// services are sorted to make the result stable
+	service_names := []string{}
+	for service_name := range services {
+		service_names = append(service_names, service_name)
+	}
+	sort.Strings(service_names)
+
+	for _, service_name := range service_names {
+		service := services[service_name]
+		for key := range service.Extra {
+			warnings = append(warnings, fmt.Sprintf("service %v: key %v is not supported, ignored", service_name, key))
 		}
 
 		if len(service.Networks) == 0 {
-			return nil, fmt.Errorf("every service %v should connect to at least 1 network", service_name)
+			return nil, warnings, fmt.Errorf("every service %v should connect to at least 1 network", service_name)
+		}
+
+		image := service.Image
+		if service.Build != nil {
+			if service.Build.Context == "" {
+				return nil, warnings, fmt.Errorf("service %v has build without context", service_name)
+			}
+			// image of build is tagged on the node with a hash of the build, image only names its repository
 		}
 
-		if service.Image == "" {
-			return nil, fmt.Errorf("service %v has no image config", service_name)
+		if image == "" && service.Build == nil {
+			return nil, warnings, fmt.Errorf("service %v has no image config", service_name)
 		}
 
 		container := types.ServiceConfigContainer{
-			Image: service.Image,
+			Name:       service_name,
+			Image:      image,
+			Env:        service.Environment,
+			Command:    service.Command.Args(),
+			Entrypoint: service.Entrypoint.Args(),
+			CapAdd:     service.CapAdd,
+			DependsOn:  service.DependsOn.Names(),
 		}
 
+		if service.Build != nil {
+			container.Build = &types.ServiceConfigContainerBuild{
+				Context:    service.Build.Context,
+				Dockerfile: service.Build.Dockerfile,
+				Args:       service.Build.Args,
+			}
+		}
+
+		for _, volume := range service.Volumes {
+			switch volume.Type {
+			case "volume", "":
+				container.Volumes = append(container.Volumes, types.ServiceConfigContainerVolume{
+					Source:   volume.Source,
+					Target:   volume.Target,
+					ReadOnly: volume.ReadOnly,
+				})
+			default:
+				warnings = append(warnings, fmt.Sprintf("service %v: %v volume %v is not supported, ignored, use a named volume or build it into image", service_name, volume.Type, volume.Source))
+			}
+		}
+
+		for name, condition := range service.DependsOn {
+			switch condition {
+			case "service_started":
+			case "service_healthy":
+				healthy_required[name] = true
+			default:
+				warnings = append(warnings, fmt.Sprintf("service %v: condition %v of depends_on %v is treated as service_started", service_name, condition, name))
+			}
+		}
+
+		container.Readiness = service.Readiness
+
+		if service.Healthcheck != nil && !service.Healthcheck.Disable && len(service.Healthcheck.Test) > 0 {
+			healthcheck := &types.ServiceConfigContainerHealthcheck{
+				Test:    service.Healthcheck.Test,
+				Retries: service.Healthcheck.Retries,
+			}
+			for _, duration := range []struct {
+				text  string
+				value *int
+			}{
+				{service.Healthcheck.Interval, &healthcheck.Interval},
+				{service.Healthcheck.Timeout, &healthcheck.Timeout},
+				{service.Healthcheck.StartPeriod, &healthcheck.StartPeriod},
+			} {
+				if duration.text == "" {
+					continue
+				}
+				d, err := time.ParseDuration(duration.text)
+				if err != nil {
+					return nil, warnings, fmt.Errorf("service %v has invalid healthcheck duration %v", service_name, duration.text)
+				}
+				*duration.value = int(d.Seconds())
+			}
+			container.Healthcheck = healthcheck
+		}
+
+		service_network_names := []string{}
 		for network_name := range service.Networks {
+			service_network_names = append(service_network_names, network_name)
+		}
+		sort.Strings(service_network_names)
+
+		for _, network_name := range service_network_names {
+			service_network := service.Networks[network_name]
 			// check if network_name is declared in networks
 			kisara_network := network_map[network_name]
 			if kisara_network == "" {
-				return nil, fmt.Errorf("service %v try to connect to a undeclared network %v", service_name, network_name)
+				return nil, warnings, fmt.Errorf("service %v try to connect to a undeclared network %v", service_name, network_name)
 			}
 
-			container.Networks = append(container.Networks, types.ServiceConfigContainerNetwork{
+			container_network := types.ServiceConfigContainerNetwork{
 				Network:    kisara_network,
-				RandomCIDR: true,
-			})
+				RandomCIDR: random_network,
+			}
+
+			if service_network.Ipv4Address != "" {
+				if random_network {
+					if subnet_map[network_name] == "" {
+						return nil, warnings, fmt.Errorf("service %v has ipv4_address in network %v which has no subnet", service_name, network_name)
+					}
+					offset, err := types.GetHostOffset(subnet_map[network_name], service_network.Ipv4Address)
+					if err != nil {
+						return nil, warnings, fmt.Errorf("service %v: %v", service_name, err)
+					}
+					container_network.HostOffset = offset
+				} else {
+					container_network.Subnet = subnet_map[network_name]
+					container_network.IPv4Address = service_network.Ipv4Address
+				}
+			} else if !random_network {
+				container_network.Subnet = subnet_map[network_name]
+			}
+
+			container.Networks = append(container.Networks, container_network)
 		}
 
 		ports := service.Ports
 		for _, port := range ports {
 			port_parts := strings.Split(port, ":")
 			if len(port_parts) > 2 {
-				return nil, fmt.Errorf("service %v's port %v format error", service_name, port)
+				return nil, warnings, fmt.Errorf("service %v's port %v format error", service_name, port)
 			}
 
 			if len(port_parts) == 0 {
-				return nil, fmt.Errorf("service %v has a empty port", service_name)
+				return nil, warnings, fmt.Errorf("service %v has a empty port", service_name)
 			}
 
 			lport := 0
@@ -114,12 +286,12 @@ func ConvertFromCompose(compose_file *types.DockerComposeFile, random_network bo
 			if len(port_parts) == 1 {
 				lport, err = strconv.Atoi(port_parts[0])
 				if err != nil {
-					return nil, fmt.Errorf("service %v has a wrong port %v", service_name, port_parts[0])
+					return nil, warnings, fmt.Errorf("service %v has a wrong port %v", service_name, port_parts[0])
 				}
 			} else {
 				lport, err = strconv.Atoi(port_parts[1])
 				if err != nil {
-					return nil, fmt.Errorf("service %v has a wrong port %v", service_name, port_parts[1])
+					return nil, warnings, fmt.Errorf("service %v has a wrong port %v", service_name, port_parts[1])
 				}
 			}
 
@@ -133,9 +305,36 @@ func ConvertFromCompose(compose_file *types.DockerComposeFile, random_network bo
 		containers = append(containers, container)
 	}
 
+	// service_healthy waits for healthcheck unless the service has its own readiness probe
+	for i := range containers {
+		if !healthy_required[containers[i].Name] || containers[i].Readiness != nil {
+			continue
+		}
+		if containers[i].Healthcheck == nil {
+			warnings = append(warnings, fmt.Sprintf("service %v: depended on with service_healthy but has no healthcheck, treated as service_started", containers[i].Name))
+			continue
+		}
+		containers[i].Readiness = &types.ServiceConfigContainerProbe{
+			Type: types.PROBE_HEALTHCHECK,
+		}
+		// let the probe wait as long as docker would take to give up
+		healthcheck := containers[i].Healthcheck
+		interval := healthcheck.Interval
+		if interval == 0 {
+			interval = 30
+		}
+		retries := healthcheck.Retries
+		if retries == 0 {
+			retries = 3
+		}
+		if timeout := healthcheck.StartPeriod + interval*(retries+1); timeout > 60 {
+			containers[i].Readiness.Timeout = timeout
+		}
+	}
+
 	result_config.Containers = containers
 
-	return &result_config, nil
+	return &result_config, warnings, nil
 }
 
 // convert docker-compose file text into kisara config
@@ -149,6 +348,90 @@ func ConvertFromComposeText(text string, random_network bool) (*types.ServiceCon
 	return ConvertFromCompose(compose, random_network)
 }
 
+// convert docker-compose file text into kisara config, warnings are returned instead of logged
+func ConvertFromComposeTextWithWarnings(text string, random_network bool) (*types.ServiceConfig, []string, error) {
+	compose := &types.DockerComposeFile{}
+	err := compose.FromYaml(text)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return ConvertFromComposeWithWarnings(compose, random_network)
+}
+
+/*
+	PackBuildContexts packs contexts of containers with build into tar archives, context paths are
+	relative to base_dir which is usually the directory of docker-compose.yaml, the result is meant
+	to be RequestLaunchService.BuildContexts
+*/
+func PackBuildContexts(config *types.ServiceConfig, base_dir string) (map[string][]byte, error) {
+	contexts := make(map[string][]byte)
+	for _, container := range config.Containers {
+		if container.Build == nil || contexts[container.Build.Context] != nil {
+			continue
+		}
+		dir := container.Build.Context
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(base_dir, dir)
+		}
+		context, err := packDirectory(dir)
+		if err != nil {
+			return nil, fmt.Errorf("pack build context %s failed: %s", container.Build.Context, err.Error())
+		}
+		contexts[container.Build.Context] = context
+	}
+	return contexts, nil
+}
+
+func packDirectory(dir string) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	writer := tar.NewWriter(buf)
+
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil || rel == "." {
+			return err
+		}
+
+		link := ""
+		if info.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(path); err != nil {
+				return err
+			}
+		}
+		header, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(rel)
+		if err := writer.WriteHeader(header); err != nil {
+			return err
+		}
+
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		_, err = io.Copy(writer, file)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
 // convert kisara service config into docker-compose
 func ConvertToCompose(kisara_config *types.ServiceConfig) (*types.DockerComposeFile, error) {
 	compose := &types.DockerComposeFile{}
@@ -157,12 +440,62 @@ func ConvertToCompose(kisara_config *types.ServiceConfig) (*types.DockerComposeF
 	network_map := make(map[string]types.DockerComposeFileNetwork)
 
 	services := make(map[string]types.DockerComposeFileService)
+	volumes := make(map[string]struct{})
 
 	for _, container := range kisara_config.Containers {
 		// check how many network the container should connect to
 		service := types.DockerComposeFileService{
-			Image:    container.Image,
-			Networks: make(map[string]types.DockerComposeFileServiceNetwork),
+			Image:       container.Image,
+			Networks:    make(map[string]types.DockerComposeFileServiceNetwork),
+			Environment: container.Env,
+			Command:     container.Command,
+			Entrypoint:  container.Entrypoint,
+			CapAdd:      container.CapAdd,
+		}
+
+		if container.Build != nil {
+			service.Build = &types.DockerComposeFileServiceBuild{
+				Context:    container.Build.Context,
+				Dockerfile: container.Build.Dockerfile,
+				Args:       container.Build.Args,
+			}
+		}
+
+		for _, volume := range container.Volumes {
+			service.Volumes = append(service.Volumes, types.DockerComposeFileServiceVolume{
+				Type:     "volume",
+				Source:   volume.Source,
+				Target:   volume.Target,
+				ReadOnly: volume.ReadOnly,
+			})
+			if volume.Source != "" {
+				volumes[volume.Source] = struct{}{}
+			}
+		}
+
+		if len(container.DependsOn) > 0 {
+			service.DependsOn = make(types.ComposeDependsOn)
+			for _, name := range container.DependsOn {
+				service.DependsOn[name] = "service_started"
+			}
+		}
+
+		service.Readiness = container.Readiness
+
+		if container.Healthcheck != nil {
+			seconds := func(n int) string {
+				if n == 0 {
+					return ""
+				}
+				return strconv.Itoa(n) + "s"
+			}
+			service.Healthcheck = &types.DockerComposeFileServiceHealthcheck{
+				Test:        container.Healthcheck.Test,
+				Interval:    seconds(container.Healthcheck.Interval),
+				Timeout:     seconds(container.Healthcheck.Timeout),
+				StartPeriod: seconds(container.Healthcheck.StartPeriod),
+				Retries:     container.Healthcheck.Retries,
+			}
 		}
 
 		for _, port := range container.Ports {
@@ -171,24 +504,38 @@ func ConvertToCompose(kisara_config *types.ServiceConfig) (*types.DockerComposeF
 
 		for _, network := range container.Networks {
 			if _, ok := network_map[network.Network]; !ok {
+				config := []types.DockerComposeFileNetworkIPAMConfig{}
+				if !network.RandomCIDR && network.Subnet != "" {
+					config = append(config, types.DockerComposeFileNetworkIPAMConfig{
+						Subnet: network.Subnet,
+					})
+				}
 				network_map[network.Network] = types.DockerComposeFileNetwork{
 					IPAM: types.DockerComposeFileNetworkIPAM{
 						Driver:     "overlay",
 						Attachable: true,
 						Internal:   true,
-						Config:     []types.DockerComposeFileNetworkIPAMConfig{},
+						Config:     config,
 					},
 				}
 			}
 
-			service.Networks[network.Network] = types.DockerComposeFileServiceNetwork{}
+			// host_offset of random CIDR could not be expressed in docker-compose
+			service.Networks[network.Network] = types.DockerComposeFileServiceNetwork{
+				Ipv4Address: network.IPv4Address,
+			}
 		}
 
-		services[helper.RandomStr(8)] = service
+		name := container.Name
+		if name == "" {
+			name = helper.RandomStr(8)
+		}
+		services[name] = service
 	}
 
 	compose.Networks = network_map
 	compose.Services = services
+	compose.Volumes = volumes
 
 	return compose, nil
 }
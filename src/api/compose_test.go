@@ -0,0 +1,183 @@
+package api
+
+import (
+	"encoding/json"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Yeuoly/kisara/src/types"
+)
+
+func loadComposeFixture(t *testing.T, name string) *types.DockerComposeFile {
+	text, err := os.ReadFile("testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compose := &types.DockerComposeFile{}
+	if err := compose.FromYaml(string(text)); err != nil {
+		t.Fatal(err)
+	}
+	return compose
+}
+
+// expectedComposeService is testdata/compose-service.yaml converted, networks are given by the caller
+func expectedComposeService(db_networks []types.ServiceConfigContainerNetwork, web_networks []types.ServiceConfigContainerNetwork) *types.ServiceConfig {
+	return &types.ServiceConfig{
+		NetworkCount:   2,
+		ContainerCount: 2,
+		Containers: []types.ServiceConfigContainer{
+			{
+				Name:      "db",
+				Image:     "mysql:5.7",
+				Networks:  db_networks,
+				DependsOn: []string{},
+				Healthcheck: &types.ServiceConfigContainerHealthcheck{
+					Test:     []string{"CMD", "mysqladmin", "ping"},
+					Interval: 5,
+					Timeout:  3,
+					Retries:  3,
+				},
+				// web depends on it with service_healthy
+				Readiness: &types.ServiceConfigContainerProbe{Type: types.PROBE_HEALTHCHECK},
+			},
+			{
+				Name:  "web",
+				Image: "",
+				Build: &types.ServiceConfigContainerBuild{Context: "./web"},
+				Ports: []types.ServiceConfigContainerPortMapping{
+					{Port: 80, Protocol: "tcp"},
+					{Port: 22, Protocol: "tcp"},
+				},
+				Networks: web_networks,
+				Env:      map[string]string{"FLAG": "flag{test}"},
+				Command:  []string{"python", "app.py"},
+				Volumes: []types.ServiceConfigContainerVolume{
+					{Source: "data", Target: "/data", ReadOnly: true},
+				},
+				DependsOn: []string{"db"},
+			},
+		},
+	}
+}
+
+func TestConvertFromCompose(t *testing.T) {
+	warnings := []string{
+		"network front: key driver is not supported, ignored",
+		"service web: bind volume ./static is not supported, ignored, use a named volume or build it into image",
+		"service web: key restart is not supported, ignored",
+		"top-level key x-meta is not supported, ignored",
+	}
+
+	cases := []struct {
+		name           string
+		random_network bool
+		expected       *types.ServiceConfig
+	}{
+		{
+			"fixed subnet",
+			false,
+			expectedComposeService(
+				[]types.ServiceConfigContainerNetwork{
+					{Network: "A", Subnet: "10.10.0.0/24", IPv4Address: "10.10.0.10"},
+				},
+				[]types.ServiceConfigContainerNetwork{
+					{Network: "A", Subnet: "10.10.0.0/24"},
+					{Network: "B", Subnet: "10.20.0.0/24"},
+				},
+			),
+		},
+		{
+			"random network",
+			true,
+			expectedComposeService(
+				[]types.ServiceConfigContainerNetwork{
+					{Network: "A", RandomCIDR: true, HostOffset: 10},
+				},
+				[]types.ServiceConfigContainerNetwork{
+					{Network: "A", RandomCIDR: true},
+					{Network: "B", RandomCIDR: true},
+				},
+			),
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			config, got_warnings, err := ConvertFromComposeWithWarnings(loadComposeFixture(t, "compose-service.yaml"), c.random_network)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(config, c.expected) {
+				got, _ := json.MarshalIndent(config, "", "  ")
+				expected, _ := json.MarshalIndent(c.expected, "", "  ")
+				t.Errorf("expected %s\ngot %s", expected, got)
+			}
+			if !reflect.DeepEqual(got_warnings, warnings) {
+				t.Errorf("expected warnings %#v, got %#v", warnings, got_warnings)
+			}
+		})
+	}
+}
+
+func TestConvertFromComposeErrors(t *testing.T) {
+	const network = `
+networks:
+  net:
+    ipam:
+      internal: true
+      attachable: true
+      config:
+        - subnet: 10.10.0.0/24
+`
+	cases := []struct {
+		name           string
+		text           string
+		random_network bool
+		err            string
+	}{
+		{"no network", "services:\n  a:\n    image: nginx\n", false, "at least one network"},
+		{"external network", `
+services:
+  a:
+    image: nginx
+    networks: [net]
+networks:
+  net:
+    ipam:
+      attachable: true
+`, false, "shoud be internal"},
+		{"no subnet", `
+services:
+  a:
+    image: nginx
+    networks: [net]
+networks:
+  net:
+    ipam:
+      internal: true
+      attachable: true
+`, false, "should have a subnet"},
+		{"service without network", "services:\n  a:\n    image: nginx\n" + network, false, "at least 1 network"},
+		{"undeclared network", "services:\n  a:\n    image: nginx\n    networks: [other]\n" + network, false, "undeclared network other"},
+		{"no image", "services:\n  a:\n    networks: [net]\n" + network, false, "has no image"},
+		{"invalid port", "services:\n  a:\n    image: nginx\n    networks: [net]\n    ports: [\"1:2:3\"]\n" + network, false, "format error"},
+		{"wrong port", "services:\n  a:\n    image: nginx\n    networks: [net]\n    ports: [\"http\"]\n" + network, false, "wrong port"},
+		{"address out of subnet", "services:\n  a:\n    image: nginx\n    networks:\n      net:\n        ipv4_address: 10.20.0.1\n" + network, true, "service a"},
+		{"invalid healthcheck", "services:\n  a:\n    image: nginx\n    networks: [net]\n    healthcheck:\n      test: true\n      interval: soon\n" + network, false, "invalid healthcheck duration"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			compose := &types.DockerComposeFile{}
+			if err := compose.FromYaml(c.text); err != nil {
+				t.Fatal(err)
+			}
+			_, _, err := convertFromCompose(compose, c.random_network)
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("expected error containing %q, got %v", c.err, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,188 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"time"
+
+	"github.com/Yeuoly/kisara/src/helper"
+	"github.com/Yeuoly/kisara/src/router"
+	server "github.com/Yeuoly/kisara/src/routine/synergy/server"
+	"github.com/Yeuoly/kisara/src/types"
+)
+
+// copyClient finds the client of the container if client id is not set
+func copyClient(client_id string, container_id string) (*types.Client, error) {
+	if client_id == "" {
+		_, id, err := server.GetContainer(container_id)
+		if err != nil {
+			return nil, err
+		}
+		client_id = id
+	}
+
+	client := server.GetClient(client_id)
+	if client == nil {
+		return nil, errors.New("client not found")
+	}
+	return client, nil
+}
+
+/*
+	openTimedStream opens a stream to uri of client through its channel, it's closed once timeout
+	passes, finish should be called with the result of the transfer, it stops the timer, closes the
+	stream and tells whether it timed out
+*/
+func openTimedStream(client_id string, uri string, payload interface{}, timeout time.Duration) (*types.ChannelStream, func(error) error, error) {
+	stream, err := server.OpenChannelStream(client_id, uri, payload)
+	if err != nil {
+		return nil, nil, err
+	}
+	timer := time.AfterFunc(timeout, stream.Close)
+	return stream, func(err error) error {
+		stream.Close()
+		if !timer.Stop() {
+			return errors.New("timeout")
+		}
+		return err
+	}, nil
+}
+
+// copyToContainerByChannel sends tar as chunks of a stream, the client answers with the last chunk after extracting it
+func copyToContainerByChannel(req types.RequestCopyToContainer, tar io.Reader, timeout time.Duration) (int64, error) {
+	stream, finish, err := openTimedStream(req.ClientID, router.URI_CLIENT_COPY_TO_CONTAINER, req, timeout)
+	if err != nil {
+		return 0, err
+	}
+
+	size, err := io.Copy(stream.Writer(""), tar)
+	if err == nil {
+		err = stream.Finish(nil)
+	}
+	// the client closes the stream early when it rejects the archive, its answer tells why
+	if _, read_err := io.Copy(io.Discard, stream.Reader()); read_err != nil {
+		err = read_err
+	}
+	return size, finish(err)
+}
+
+// copyToContainerByHttp uploads tar as a multipart file
+func copyToContainerByHttp(client *types.Client, req types.RequestCopyToContainer, tar io.Reader, timeout time.Duration) (int64, error) {
+	resp, err := helper.SendPostAndParse[types.KisaraResponseWrap[types.ResponseCopyToContainer]](
+		client.GenerateClientURI(router.URI_CLIENT_COPY_TO_CONTAINER),
+		helper.HttpTimeout(timeout.Milliseconds()),
+		helper.HttpPyloadMultipart(
+			map[string]string{
+				"client_id":    req.ClientID,
+				"container_id": req.ContainerID,
+				"path":         req.Path,
+			},
+			helper.HttpPayloadMultipartFile("archive.tar", tar),
+		),
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	if resp.Code != 0 {
+		return 0, errors.New(resp.Message)
+	}
+
+	return resp.Data.Size, nil
+}
+
+/*
+	CopyToContainer extracts tar, a tar archive, to req.Path in the container, the path should be an
+	existing directory, the archive is sent through the channel of the client, or uploaded as a
+	multipart file if it has none, and rejected if it's larger than kisaraClient.copy_max_size of the
+	client or has entries out of the path
+*/
+func CopyToContainer(req types.RequestCopyToContainer, tar io.Reader, timeout time.Duration) (_ types.ResponseCopyToContainer, err error) {
+	defer observeAPI("CopyToContainer", time.Now(), &err)
+	client, err := copyClient(req.ClientID, req.ContainerID)
+	if err != nil {
+		return types.ResponseCopyToContainer{}, err
+	}
+	req.ClientID = client.ClientID
+
+	var size int64
+	if server.HasChannel(client.ClientID) {
+		size, err = copyToContainerByChannel(req, tar, timeout)
+	} else {
+		size, err = copyToContainerByHttp(client, req, tar, timeout)
+	}
+	if err != nil {
+		return types.ResponseCopyToContainer{}, err
+	}
+
+	return types.ResponseCopyToContainer{
+		ClientID:    req.ClientID,
+		ContainerID: req.ContainerID,
+		Path:        req.Path,
+		Size:        size,
+	}, nil
+}
+
+// copyFromContainerByChannel receives the archive as chunks of a stream
+func copyFromContainerByChannel(req types.RequestCopyFromContainer, writer io.Writer, timeout time.Duration) (int64, error) {
+	stream, finish, err := openTimedStream(req.ClientID, router.URI_CLIENT_COPY_FROM_CONTAINER, req, timeout)
+	if err != nil {
+		return 0, err
+	}
+	size, err := io.Copy(writer, stream.Reader())
+	return size, finish(err)
+}
+
+// copyFromContainerByHttp downloads the archive, which is sent after it's spooled on the client
+func copyFromContainerByHttp(client *types.Client, req types.RequestCopyFromContainer, writer io.Writer, timeout time.Duration) (int64, error) {
+	var size int64
+	// client answers errors in json, only a tar is copied
+	err := helper.SendGetStream(
+		client.GenerateClientURI(router.URI_CLIENT_COPY_FROM_CONTAINER),
+		"application/x-tar",
+		func(body io.ReadCloser, header *helper.ResponseHeader) error {
+			var err error
+			size, err = io.Copy(writer, body)
+			return err
+		},
+		helper.HttpParams(map[string]string{
+			"client_id":    req.ClientID,
+			"container_id": req.ContainerID,
+			"path":         req.Path,
+		}),
+		helper.HttpTimeout(timeout.Milliseconds()),
+		helper.HttpSign(helper.GetConfigString("kisara.token")),
+	)
+	return size, err
+}
+
+/*
+	CopyFromContainer writes req.Path in the container to writer as a tar archive, through the channel
+	of the client if it has one, it fails if the archive is larger than kisaraClient.copy_max_size of
+	the client
+*/
+func CopyFromContainer(req types.RequestCopyFromContainer, writer io.Writer, timeout time.Duration) (_ types.ResponseCopyFromContainer, err error) {
+	defer observeAPI("CopyFromContainer", time.Now(), &err)
+	client, err := copyClient(req.ClientID, req.ContainerID)
+	if err != nil {
+		return types.ResponseCopyFromContainer{}, err
+	}
+	req.ClientID = client.ClientID
+
+	var size int64
+	if server.HasChannel(client.ClientID) {
+		size, err = copyFromContainerByChannel(req, writer, timeout)
+	} else {
+		size, err = copyFromContainerByHttp(client, req, writer, timeout)
+	}
+	if err != nil {
+		return types.ResponseCopyFromContainer{}, err
+	}
+
+	return types.ResponseCopyFromContainer{
+		ClientID:    req.ClientID,
+		ContainerID: req.ContainerID,
+		Path:        req.Path,
+		Size:        size,
+	}, nil
+}
@@ -16,13 +16,25 @@ import (
 	"github.com/Yeuoly/kisara/src/types"
 )
 
-func LaunchContainer(req types.RequestLaunchContainer, timeout time.Duration) (types.ResponseFinalLaunchStatus, error) {
+func LaunchContainer(req types.RequestLaunchContainer, timeout time.Duration) (_ types.ResponseFinalLaunchStatus, err error) {
+	defer observeAPI("LaunchContainer", time.Now(), &err)
 	start := time.Now()
 	var client types.Client
-	var err error
-	// if client id is not set, then fetch the lowest demand client
+	if req.Registry != nil {
+		req.RegistryAuth, err = sealRegistry(req.Registry)
+		if err != nil {
+			return types.ResponseFinalLaunchStatus{}, err
+		}
+		req.Registry = nil
+	}
+	// if client id is not set, then let scheduler choose one
 	if req.ClientID == "" {
-		client, err = server.FetchLowestDemandClient()
+		client, err = server.Schedule(server.ScheduleRequest{
+			Policy:   req.Policy,
+			Selector: req.NodeSelector,
+			Affinity: req.NodeAffinity,
+			Images:   []string{req.Image},
+		})
 		if err != nil {
 			return types.ResponseFinalLaunchStatus{}, err
 		}
@@ -35,6 +47,34 @@ func LaunchContainer(req types.RequestLaunchContainer, timeout time.Duration) (t
 		client = *tmp
 	}
 
+	// launch through control channel if client has one, no polling is needed
+	if server.HasChannel(client.ClientID) {
+		resp, err := server.RequestChannel[types.ResponseCheckLaunchStatus](
+			client.ClientID,
+			"POST",
+			router.URI_CLIENT_LAUNCH_CONTAINER,
+			req,
+			timeout,
+			nil,
+		)
+		if err != nil {
+			return types.ResponseFinalLaunchStatus{}, err
+		}
+		if resp.Code != 0 {
+			return types.ResponseFinalLaunchStatus{}, errors.New(resp.Message)
+		}
+		if resp.Data.Error != "" {
+			return types.ResponseFinalLaunchStatus{}, errors.New(resp.Data.Error)
+		}
+		container := resp.Data.Container
+		server.AddContainer(container.Id, client.ClientID, &container)
+		server.SetContainerRequest(container.Id, req)
+		return types.ResponseFinalLaunchStatus{
+			ClientID:  client.ClientID,
+			Container: container,
+		}, nil
+	}
+
 	resp, err := helper.SendPostAndParse[types.KisaraResponseWrap[types.ResponseLaunchContainer]](
 		client.GenerateClientURI(router.URI_CLIENT_LAUNCH_CONTAINER),
 		helper.HttpTimeout(timeout.Milliseconds()),
@@ -88,6 +128,7 @@ func LaunchContainer(req types.RequestLaunchContainer, timeout time.Duration) (t
 			}
 			container := resp.Data.Container
 			server.AddContainer(resp.Data.Container.Id, client.ClientID, &container)
+			server.SetContainerRequest(container.Id, req)
 			return types.ResponseFinalLaunchStatus{
 				ClientID:  client.ClientID,
 				Container: resp.Data.Container,
@@ -96,7 +137,8 @@ func LaunchContainer(req types.RequestLaunchContainer, timeout time.Duration) (t
 	}
 }
 
-func StopContainer(req types.RequestStopContainer, timeout time.Duration) (types.ResponseStopContainer, error) {
+func StopContainer(req types.RequestStopContainer, timeout time.Duration) (_ types.ResponseStopContainer, err error) {
+	defer observeAPI("StopContainer", time.Now(), &err)
 	if req.ClientID == "" {
 		// try to find the client
 		_, client_id, err := server.GetContainer(req.ContainerID)
@@ -111,10 +153,12 @@ func StopContainer(req types.RequestStopContainer, timeout time.Duration) (types
 		return types.ResponseStopContainer{}, errors.New("client not found")
 	}
 
-	resp, err := helper.SendPostAndParse[types.KisaraResponseWrap[types.ResponseStopContainer]](
-		client.GenerateClientURI(router.URI_CLIENT_STOP_CONTAINER),
-		helper.HttpTimeout(timeout.Milliseconds()),
-		helper.HttpPayloadJson(req),
+	resp, err := server.RequestClient[types.ResponseStopContainer](
+		client.ClientID,
+		"POST",
+		router.URI_CLIENT_STOP_CONTAINER,
+		req,
+		timeout,
 	)
 	if err != nil {
 		return types.ResponseStopContainer{}, err
@@ -133,7 +177,99 @@ func StopContainer(req types.RequestStopContainer, timeout time.Duration) (types
 	}, nil
 }
 
-func RemoveContainer(req types.RequestRemoveContainer, timeout time.Duration) (types.ResponseRemoveContainer, error) {
+// ExtendContainer renews the expiry of a container launched with TTL or ExpireAt
+func ExtendContainer(req types.RequestExtendContainer, timeout time.Duration) (_ types.ResponseExtendContainer, err error) {
+	defer observeAPI("ExtendContainer", time.Now(), &err)
+	if req.ClientID == "" {
+		// try to find the client
+		_, client_id, err := server.GetContainer(req.ContainerID)
+		if err != nil {
+			return types.ResponseExtendContainer{}, err
+		}
+		req.ClientID = client_id
+	}
+
+	client := server.GetClient(req.ClientID)
+	if client == nil {
+		return types.ResponseExtendContainer{}, errors.New("client not found")
+	}
+
+	// expiry is computed here, so that the time spent on the way does not shorten it
+	req.ExpireAt = req.GetExpireAt()
+
+	resp, err := server.RequestClient[types.ResponseExtendContainer](
+		client.ClientID,
+		"POST",
+		router.URI_CLIENT_EXTEND_CONTAINER,
+		req,
+		timeout,
+	)
+	if err != nil {
+		return types.ResponseExtendContainer{}, err
+	}
+
+	if resp.Code != 0 {
+		return types.ResponseExtendContainer{}, errors.New(resp.Message)
+	}
+
+	if err := server.SetContainerExpire(req.ContainerID, resp.Data.ExpireAt); err != nil {
+		log.Warn("[Kisara-API] container %s is not known by server: %s", req.ContainerID, err.Error())
+	}
+
+	return types.ResponseExtendContainer{
+		ClientID: client.ClientID,
+		ExpireAt: resp.Data.ExpireAt,
+	}, nil
+}
+
+/*
+	RotateServiceFlags writes a fresh flag for every flag of a running service, the returned flags
+	are the complete list after rotation, flags in Failed keep their old value
+*/
+func RotateServiceFlags(req types.RequestRotateServiceFlags, timeout time.Duration) (_ types.ResponseRotateServiceFlags, err error) {
+	defer observeAPI("RotateServiceFlags", time.Now(), &err)
+	if req.ClientID == "" {
+		// try to find the client
+		_, client_id, err := server.GetService(req.ServiceID)
+		if err != nil {
+			return types.ResponseRotateServiceFlags{}, err
+		}
+		req.ClientID = client_id
+	}
+
+	client := server.GetClient(req.ClientID)
+	if client == nil {
+		return types.ResponseRotateServiceFlags{}, errors.New("client not found")
+	}
+
+	resp, err := server.RequestClient[types.ResponseRotateServiceFlags](
+		client.ClientID,
+		"POST",
+		router.URI_CLIENT_ROTATE_SERVICE_FLAGS,
+		req,
+		timeout,
+	)
+	if err != nil {
+		return types.ResponseRotateServiceFlags{}, err
+	}
+
+	if resp.Code != 0 {
+		return types.ResponseRotateServiceFlags{}, errors.New(resp.Message)
+	}
+
+	if err := server.SetServiceFlags(req.ServiceID, resp.Data.Flags, resp.Data.Failed); err != nil {
+		log.Warn("[Kisara-API] service %s is not known by server: %s", req.ServiceID, err.Error())
+	}
+
+	return types.ResponseRotateServiceFlags{
+		ClientID: client.ClientID,
+		Flags:    resp.Data.Flags,
+		Failed:   resp.Data.Failed,
+	}, nil
+}
+
+func RemoveContainer(req types.RequestRemoveContainer, timeout time.Duration) (_ types.ResponseRemoveContainer, err error) {
+	defer observeAPI("RemoveContainer", time.Now(), &err)
 	if req.ClientID == "" {
 		// try to find the client
 		_, client_id, err := server.GetContainer(req.ContainerID)
@@ -148,10 +284,12 @@ func RemoveContainer(req types.RequestRemoveContainer, timeout time.Duration) (t
 		return types.ResponseRemoveContainer{}, errors.New("client not found")
 	}
 
-	resp, err := helper.SendPostAndParse[types.KisaraResponseWrap[types.ResponseRemoveContainer]](
-		client.GenerateClientURI(router.URI_CLIENT_REMOVE_CONTAINER),
-		helper.HttpTimeout(timeout.Milliseconds()),
-		helper.HttpPayloadJson(req),
+	resp, err := server.RequestClient[types.ResponseRemoveContainer](
+		client.ClientID,
+		"POST",
+		router.URI_CLIENT_REMOVE_CONTAINER,
+		req,
+		timeout,
 	)
 	if err != nil {
 		return types.ResponseRemoveContainer{}, err
@@ -170,7 +308,8 @@ func RemoveContainer(req types.RequestRemoveContainer, timeout time.Duration) (t
 	}, nil
 }
 
-func ListContainer(req types.RequestListContainer, timeout time.Duration) (types.ResponseListContainer, error) {
+func ListContainer(req types.RequestListContainer, timeout time.Duration) (_ types.ResponseListContainer, err error) {
+	defer observeAPI("ListContainer", time.Now(), &err)
 	clients := []string{}
 
 	if req.ClientID == "" {
@@ -178,6 +317,8 @@ func ListContainer(req types.RequestListContainer, timeout time.Duration) (types
 		for _, node := range nodes {
 			clients = append(clients, node.ClientID)
 		}
+	} else {
+		clients = []string{req.ClientID}
 	}
 
 	containers := []types.Container{}
@@ -189,12 +330,14 @@ func ListContainer(req types.RequestListContainer, timeout time.Duration) (types
 			continue
 		}
 
-		resp, err := helper.SendGetAndParse[types.KisaraResponseWrap[types.ResponseListContainer]](
-			client.GenerateClientURI(router.URI_CLIENT_LIST_CONTAINER),
-			helper.HttpTimeout(timeout.Milliseconds()),
-			helper.HttpPayloadJson(types.RequestListContainer{
+		resp, err := server.RequestClient[types.ResponseListContainer](
+			client.ClientID,
+			"GET",
+			router.URI_CLIENT_LIST_CONTAINER,
+			types.RequestListContainer{
 				ClientID: client.ClientID,
-			}),
+			},
+			timeout,
 		)
 		if err != nil {
 			log.Warn("[Kisara-API] client %s list container error: %s", client_id, err.Error())
@@ -211,10 +354,7 @@ func ListContainer(req types.RequestListContainer, timeout time.Duration) (types
 			continue
 		}
 
-		server.FlushContainer(client_id)
-		for _, container := range resp.Data.Containers {
-			server.AddContainer(container.Id, client_id, &container)
-		}
+		server.ReconcileContainers(client_id, resp.Data.Containers)
 
 		containers = append(containers, resp.Data.Containers...)
 	}
@@ -225,7 +365,8 @@ func ListContainer(req types.RequestListContainer, timeout time.Duration) (types
 	}, nil
 }
 
-func ExecContainer(req types.RequestExecContainer, timeout time.Duration) (types.ResponseExecContainer, error) {
+func ExecContainer(req types.RequestExecContainer, timeout time.Duration) (_ types.ResponseExecContainer, err error) {
+	defer observeAPI("ExecContainer", time.Now(), &err)
 	if req.ClientID == "" {
 		// try to find the client
 		_, client_id, err := server.GetContainer(req.ContainerID)
@@ -240,10 +381,12 @@ func ExecContainer(req types.RequestExecContainer, timeout time.Duration) (types
 		return types.ResponseExecContainer{}, errors.New("client not found")
 	}
 
-	resp, err := helper.SendPostAndParse[types.KisaraResponseWrap[types.ResponseExecContainer]](
-		client.GenerateClientURI(router.URI_CLIENT_EXEC_CONTAINER),
-		helper.HttpTimeout(timeout.Milliseconds()),
-		helper.HttpPayloadJson(req),
+	resp, err := server.RequestClient[types.ResponseExecContainer](
+		client.ClientID,
+		"POST",
+		router.URI_CLIENT_EXEC_CONTAINER,
+		req,
+		timeout,
 	)
 	if err != nil {
 		return types.ResponseExecContainer{}, err
@@ -259,10 +402,14 @@ func ExecContainer(req types.RequestExecContainer, timeout time.Duration) (types
 
 	return types.ResponseExecContainer{
 		ClientID: client.ClientID,
+		Stdout:   resp.Data.Stdout,
+		Stderr:   resp.Data.Stderr,
+		ExitCode: resp.Data.ExitCode,
 	}, nil
 }
 
-func InspectContainer(req types.RequestInspectContainer, timeout time.Duration) (types.ResponseInspectContainer, error) {
+func InspectContainer(req types.RequestInspectContainer, timeout time.Duration) (_ types.ResponseInspectContainer, err error) {
+	defer observeAPI("InspectContainer", time.Now(), &err)
 	var node []struct {
 		ClientId   string
 		Containers []string
@@ -305,16 +452,19 @@ func InspectContainer(req types.RequestInspectContainer, timeout time.Duration)
 		client := server.GetClient(n.ClientId)
 		if client == nil {
 			log.Warn("[Kisara-API] client %s not found", n.ClientId)
+			continue
 		}
 
-		resp, err := helper.SendPostAndParse[types.KisaraResponseWrap[types.ResponseInspectContainer]](
-			client.GenerateClientURI(router.URI_CLIENT_INSPECT_CONTAINER),
-			helper.HttpTimeout(timeout.Milliseconds()),
-			helper.HttpPayloadJson(types.RequestInspectContainer{
+		resp, err := server.RequestClient[types.ResponseInspectContainer](
+			client.ClientID,
+			"POST",
+			router.URI_CLIENT_INSPECT_CONTAINER,
+			types.RequestInspectContainer{
 				ClientID:     n.ClientId,
 				ContainerIDs: n.Containers,
 				HasState:     true,
-			}),
+			},
+			timeout,
 		)
 		if err != nil {
 			log.Warn("[Kisara-API] client %s inspect container error: %s", n.ClientId, err.Error())
@@ -341,7 +491,8 @@ func InspectContainer(req types.RequestInspectContainer, timeout time.Duration)
 }
 
 // create a new network on target node
-func CreateNetwork(req types.RequestCreateNetwork, timeout time.Duration) (types.ResponseCreateNetwork, error) {
+func CreateNetwork(req types.RequestCreateNetwork, timeout time.Duration) (_ types.ResponseCreateNetwork, err error) {
+	defer observeAPI("CreateNetwork", time.Now(), &err)
 	if req.ClientID == "" {
 		return types.ResponseCreateNetwork{}, errors.New("client id is empty")
 	}
@@ -351,10 +502,12 @@ func CreateNetwork(req types.RequestCreateNetwork, timeout time.Duration) (types
 		return types.ResponseCreateNetwork{}, errors.New("client not found")
 	}
 
-	resp, err := helper.SendPostAndParse[types.KisaraResponseWrap[types.ResponseCreateNetwork]](
-		client.GenerateClientURI(router.URI_CLIENT_CREATE_NETWORK),
-		helper.HttpTimeout(timeout.Milliseconds()),
-		helper.HttpPayloadJson(req),
+	resp, err := server.RequestClient[types.ResponseCreateNetwork](
+		client.ClientID,
+		"POST",
+		router.URI_CLIENT_CREATE_NETWORK,
+		req,
+		timeout,
 	)
 	if err != nil {
 		return types.ResponseCreateNetwork{}, err
@@ -373,7 +526,8 @@ func CreateNetwork(req types.RequestCreateNetwork, timeout time.Duration) (types
 	}, nil
 }
 
-func ListNetwork(req types.RequestListNetwork, timeout time.Duration) (types.ResponseListNetwork, error) {
+func ListNetwork(req types.RequestListNetwork, timeout time.Duration) (_ types.ResponseListNetwork, err error) {
+	defer observeAPI("ListNetwork", time.Now(), &err)
 	clients := []string{}
 
 	if req.ClientID == "" {
@@ -394,12 +548,14 @@ func ListNetwork(req types.RequestListNetwork, timeout time.Duration) (types.Res
 			continue
 		}
 
-		resp, err := helper.SendGetAndParse[types.KisaraResponseWrap[types.ResponseListNetwork]](
-			client.GenerateClientURI(router.URI_CLIENT_LIST_NETWORK),
-			helper.HttpTimeout(timeout.Milliseconds()),
-			helper.HttpPayloadJson(types.RequestListNetwork{
+		resp, err := server.RequestClient[types.ResponseListNetwork](
+			client.ClientID,
+			"GET",
+			router.URI_CLIENT_LIST_NETWORK,
+			types.RequestListNetwork{
 				ClientID: client.ClientID,
-			}),
+			},
+			timeout,
 		)
 		if err != nil {
 			log.Warn("[Kisara-API] client %s list network error: %s", client_id, err.Error())
@@ -425,7 +581,8 @@ func ListNetwork(req types.RequestListNetwork, timeout time.Duration) (types.Res
 	}, nil
 }
 
-func RemoveNetwork(req types.RequestRemoveNetwork, timeout time.Duration) (types.ResponseRemoveNetwork, error) {
+func RemoveNetwork(req types.RequestRemoveNetwork, timeout time.Duration) (_ types.ResponseRemoveNetwork, err error) {
+	defer observeAPI("RemoveNetwork", time.Now(), &err)
 	if req.ClientID == "" {
 		return types.ResponseRemoveNetwork{}, errors.New("client id is empty")
 	}
@@ -435,10 +592,12 @@ func RemoveNetwork(req types.RequestRemoveNetwork, timeout time.Duration) (types
 		return types.ResponseRemoveNetwork{}, errors.New("client not found")
 	}
 
-	resp, err := helper.SendPostAndParse[types.KisaraResponseWrap[types.ResponseRemoveNetwork]](
-		client.GenerateClientURI(router.URI_CLIENT_REMOVE_NETWORK),
-		helper.HttpTimeout(timeout.Milliseconds()),
-		helper.HttpPayloadJson(req),
+	resp, err := server.RequestClient[types.ResponseRemoveNetwork](
+		client.ClientID,
+		"POST",
+		router.URI_CLIENT_REMOVE_NETWORK,
+		req,
+		timeout,
 	)
 	if err != nil {
 		return types.ResponseRemoveNetwork{}, err
@@ -457,7 +616,8 @@ func RemoveNetwork(req types.RequestRemoveNetwork, timeout time.Duration) (types
 	}, nil
 }
 
-func ListImage(req types.RequestListImage, timeout time.Duration) (types.ResponseListImage, error) {
+func ListImage(req types.RequestListImage, timeout time.Duration) (_ types.ResponseListImage, err error) {
+	defer observeAPI("ListImage", time.Now(), &err)
 	clients := []string{}
 
 	if req.ClientID == "" {
@@ -465,6 +625,8 @@ func ListImage(req types.RequestListImage, timeout time.Duration) (types.Respons
 		for _, node := range nodes {
 			clients = append(clients, node.ClientID)
 		}
+	} else {
+		clients = []string{req.ClientID}
 	}
 
 	images := []types.Image{}
@@ -476,12 +638,14 @@ func ListImage(req types.RequestListImage, timeout time.Duration) (types.Respons
 			continue
 		}
 
-		resp, err := helper.SendGetAndParse[types.KisaraResponseWrap[types.ResponseListImage]](
-			client.GenerateClientURI(router.URI_CLIENT_LIST_IMAGE),
-			helper.HttpTimeout(timeout.Milliseconds()),
-			helper.HttpPayloadJson(types.RequestListImage{
+		resp, err := server.RequestClient[types.ResponseListImage](
+			client.ClientID,
+			"GET",
+			router.URI_CLIENT_LIST_IMAGE,
+			types.RequestListImage{
 				ClientID: client.ClientID,
-			}),
+			},
+			timeout,
 		)
 		if err != nil {
 			log.Warn("[Kisara-API] client %s list image error: %s", client_id, err.Error())
@@ -507,7 +671,8 @@ func ListImage(req types.RequestListImage, timeout time.Duration) (types.Respons
 	}, nil
 }
 
-func PullImage(req types.RequestPullImage, timeout time.Duration, message_callback func(string)) (types.ResponseFinalPullImageStatus, error) {
+func PullImage(req types.RequestPullImage, timeout time.Duration, message_callback func(string)) (_ types.ResponseFinalPullImageStatus, err error) {
+	defer observeAPI("PullImage", time.Now(), &err)
 	if req.ClientID == "" {
 		return types.ResponseFinalPullImageStatus{}, errors.New("client id is empty")
 	}
@@ -520,6 +685,46 @@ func PullImage(req types.RequestPullImage, timeout time.Duration, message_callba
 		}, errors.New("client not found")
 	}
 
+	if req.Registry != nil {
+		sealed, err := sealRegistry(req.Registry)
+		if err != nil {
+			return types.ResponseFinalPullImageStatus{
+				ClientID: req.ClientID,
+				Error:    err.Error(),
+			}, err
+		}
+		req.RegistryAuth = sealed
+		req.Registry = nil
+	}
+
+	// pull through control channel if client has one, progress is streamed
+	if server.HasChannel(client.ClientID) {
+		resp, err := server.RequestChannel[types.ResponseCheckPullImage](
+			client.ClientID,
+			"POST",
+			router.URI_CLIENT_PULL_IMAGE,
+			req,
+			timeout,
+			message_callback,
+		)
+		if err != nil {
+			return types.ResponseFinalPullImageStatus{
+				ClientID: req.ClientID,
+				Error:    err.Error(),
+			}, err
+		}
+		if resp.Code != 0 {
+			return types.ResponseFinalPullImageStatus{
+				ClientID: req.ClientID,
+				Error:    resp.Message,
+			}, errors.New(resp.Message)
+		}
+		server.PublishEvent(types.EVENT_IMAGE_PULL, req.ClientID, types.EventImage{ImageName: req.ImageName})
+		return types.ResponseFinalPullImageStatus{
+			ClientID: req.ClientID,
+		}, nil
+	}
+
 	start := time.Now()
 
 	resp, err := helper.SendPostAndParse[types.KisaraResponseWrap[types.ResponsePullImage]](
@@ -582,6 +787,7 @@ func PullImage(req types.RequestPullImage, timeout time.Duration, message_callba
 			if !resp.Data.Finished {
 				continue
 			}
+			server.PublishEvent(types.EVENT_IMAGE_PULL, req.ClientID, types.EventImage{ImageName: req.ImageName})
 			return types.ResponseFinalPullImageStatus{
 				ClientID: req.ClientID,
 				Error:    "",
@@ -590,7 +796,8 @@ func PullImage(req types.RequestPullImage, timeout time.Duration, message_callba
 	}
 }
 
-func DeleteImage(req types.RequestDeleteImage, timeout time.Duration) (types.ResponseDeleteImage, error) {
+func DeleteImage(req types.RequestDeleteImage, timeout time.Duration) (_ types.ResponseDeleteImage, err error) {
+	defer observeAPI("DeleteImage", time.Now(), &err)
 	if req.ClientID == "" {
 		return types.ResponseDeleteImage{}, errors.New("client id is empty")
 	}
@@ -603,10 +810,12 @@ func DeleteImage(req types.RequestDeleteImage, timeout time.Duration) (types.Res
 		}, errors.New("client not found")
 	}
 
-	resp, err := helper.SendPostAndParse[types.KisaraResponseWrap[types.ResponseDeleteImage]](
-		client.GenerateClientURI(router.URI_CLIENT_DELETE_IMAGE),
-		helper.HttpTimeout(timeout.Milliseconds()),
-		helper.HttpPayloadJson(req),
+	resp, err := server.RequestClient[types.ResponseDeleteImage](
+		client.ClientID,
+		"POST",
+		router.URI_CLIENT_DELETE_IMAGE,
+		req,
+		timeout,
 	)
 	if err != nil {
 		return types.ResponseDeleteImage{
@@ -626,6 +835,7 @@ func DeleteImage(req types.RequestDeleteImage, timeout time.Duration) (types.Res
 		}, errors.New(resp.Data.Error)
 	}
 
+	server.PublishEvent(types.EVENT_IMAGE_DELETE, req.ClientID, types.EventImage{ImageId: req.ImageID})
 	return types.ResponseDeleteImage{
 		ClientID: req.ClientID,
 	}, nil
@@ -636,13 +846,22 @@ func GetNodes() ([]server.ClientItem, error) {
 	return clients, nil
 }
 
-func LaunchService(req types.RequestLaunchService, message_callback func(string), timeout time.Duration) (types.ResponseFinalLaunchServiceStatus, error) {
+func LaunchService(req types.RequestLaunchService, message_callback func(string), timeout time.Duration) (_ types.ResponseFinalLaunchServiceStatus, err error) {
+	defer observeAPI("LaunchService", time.Now(), &err)
 	start := time.Now()
 	var client types.Client
-	var err error
-	// if client id is not set, then fetch the lowest demand client
+	// if client id is not set, then let scheduler choose one
 	if req.ClientID == "" {
-		client, err = server.FetchLowestDemandClient()
+		var images []string
+		if config, err := req.ServiceConfig.GetConfig(); err == nil {
+			images = config.GetImages()
+		}
+		client, err = server.Schedule(server.ScheduleRequest{
+			Policy:   req.Policy,
+			Selector: req.NodeSelector,
+			Affinity: req.NodeAffinity,
+			Images:   images,
+		})
 		if err != nil {
 			return types.ResponseFinalLaunchServiceStatus{}, err
 		}
@@ -655,6 +874,38 @@ func LaunchService(req types.RequestLaunchService, message_callback func(string)
 		client = *tmp
 	}
 
+	// launch through control channel if client has one, progress is streamed
+	if server.HasChannel(client.ClientID) {
+		resp, err := server.RequestChannel[types.ResponseCheckLaunchService](
+			client.ClientID,
+			"POST",
+			router.URI_CLIENT_LAUNCH_SERVICE,
+			req,
+			timeout,
+			message_callback,
+		)
+		if err != nil {
+			return types.ResponseFinalLaunchServiceStatus{}, err
+		}
+		if resp.Code != 0 {
+			return types.ResponseFinalLaunchServiceStatus{}, errors.New(resp.Message)
+		}
+		if resp.Data.Error != "" {
+			return types.ResponseFinalLaunchServiceStatus{}, errors.New(resp.Data.Error)
+		}
+		service := resp.Data.Service
+		for i := range service.Containers {
+			v := service.Containers[i]
+			server.AddContainer(v.Id, client.ClientID, &v)
+		}
+		server.AddService(service.Id, client.ClientID, &service)
+		server.SetServiceRequest(service.Id, req)
+		return types.ResponseFinalLaunchServiceStatus{
+			ClientID: client.ClientID,
+			Service:  service,
+		}, nil
+	}
+
 	resp, err := helper.SendPostAndParse[types.KisaraResponseWrap[types.ResponseLaunchService]](
 		client.GenerateClientURI(router.URI_CLIENT_LAUNCH_SERVICE),
 		helper.HttpTimeout(timeout.Milliseconds()),
@@ -717,10 +968,12 @@ func LaunchService(req types.RequestLaunchService, message_callback func(string)
 				continue
 			}
 			service := resp.Data.Service
-			for _, v := range service.Containers {
+			for i := range service.Containers {
+				v := service.Containers[i]
 				server.AddContainer(v.Id, client.ClientID, &v)
 			}
 			server.AddService(service.Id, client.ClientID, &service)
+			server.SetServiceRequest(service.Id, req)
 			return types.ResponseFinalLaunchServiceStatus{
 				ClientID: client.ClientID,
 				Service:  resp.Data.Service,
@@ -729,10 +982,10 @@ func LaunchService(req types.RequestLaunchService, message_callback func(string)
 	}
 }
 
-func StopService(req types.RequestStopService, timeout time.Duration) (types.ResponseStopContainer, error) {
+func StopService(req types.RequestStopService, timeout time.Duration) (_ types.ResponseStopContainer, err error) {
+	defer observeAPI("StopService", time.Now(), &err)
 	start := time.Now()
 	var client types.Client
-	var err error
 	// if client id is not set, then fetch the lowest demand client
 	if req.ClientID == "" {
 		// try to find the client
@@ -741,12 +994,44 @@ func StopService(req types.RequestStopService, timeout time.Duration) (types.Res
 			return types.ResponseStopContainer{}, err
 		}
 		req.ClientID = client_id
-		client_temp := server.GetClient(client_id)
-		if client_temp == nil {
-			return types.ResponseStopContainer{}, errors.New("client not found")
-		}
+	}
 
-		client = *client_temp
+	client_temp := server.GetClient(req.ClientID)
+	if client_temp == nil {
+		return types.ResponseStopContainer{}, errors.New("client not found")
+	}
+	client = *client_temp
+
+	// stop through control channel if client has one, no polling is needed
+	if server.HasChannel(client.ClientID) {
+		resp, err := server.RequestChannel[types.ResponseCheckStopService](
+			client.ClientID,
+			"POST",
+			router.URI_CLIENT_STOP_SERVICE,
+			req,
+			timeout,
+			nil,
+		)
+		if err != nil {
+			return types.ResponseStopContainer{}, err
+		}
+		if resp.Code != 0 {
+			return types.ResponseStopContainer{}, errors.New(resp.Message)
+		}
+		if resp.Data.Error != "" {
+			return types.ResponseStopContainer{}, errors.New(resp.Data.Error)
+		}
+		service, _, err := server.GetService(req.ServiceID)
+		if err != nil {
+			return types.ResponseStopContainer{}, err
+		}
+		for _, v := range service.Containers {
+			server.DeleteContainer(v.Id)
+		}
+		server.DeleteService(req.ServiceID)
+		return types.ResponseStopContainer{
+			ClientID: client.ClientID,
+		}, nil
 	}
 
 	resp, err := helper.SendPostAndParse[types.KisaraResponseWrap[types.ResponseStopService]](
@@ -811,6 +1096,7 @@ func StopService(req types.RequestStopService, timeout time.Duration) (types.Res
 			for _, v := range service.Containers {
 				server.DeleteContainer(v.Id)
 			}
+			server.DeleteService(req.ServiceID)
 			return types.ResponseStopContainer{
 				ClientID: client.ClientID,
 				Error:    "",
@@ -819,7 +1105,8 @@ func StopService(req types.RequestStopService, timeout time.Duration) (types.Res
 	}
 }
 
-func ListServices(req types.RequestListService, timeout time.Duration) (types.ResponseListService, error) {
+func ListServices(req types.RequestListService, timeout time.Duration) (_ types.ResponseListService, err error) {
+	defer observeAPI("ListServices", time.Now(), &err)
 	clients := []string{}
 
 	if req.ClientID == "" {
@@ -827,6 +1114,8 @@ func ListServices(req types.RequestListService, timeout time.Duration) (types.Re
 		for _, node := range nodes {
 			clients = append(clients, node.ClientID)
 		}
+	} else {
+		clients = []string{req.ClientID}
 	}
 
 	containers := []types.Service{}
@@ -838,10 +1127,12 @@ func ListServices(req types.RequestListService, timeout time.Duration) (types.Re
 		}
 
 		req.ClientID = client_id
-		resp, err := helper.SendPostAndParse[types.KisaraResponseWrap[types.ResponseListService]](
-			client.GenerateClientURI(router.URI_CLIENT_LIST_SERVICE),
-			helper.HttpTimeout(timeout.Milliseconds()),
-			helper.HttpPayloadJson(req),
+		resp, err := server.RequestClient[types.ResponseListService](
+			client.ClientID,
+			"GET",
+			router.URI_CLIENT_LIST_SERVICE,
+			req,
+			timeout,
 		)
 		if err != nil {
 			return types.ResponseListService{}, err
@@ -852,6 +1143,7 @@ func ListServices(req types.RequestListService, timeout time.Duration) (types.Re
 		if resp.Data.Error != "" {
 			return types.ResponseListService{}, errors.New(resp.Data.Error)
 		}
+		server.ReconcileServices(client_id, resp.Data.Services)
 		containers = append(containers, resp.Data.Services...)
 	}
 
@@ -0,0 +1,16 @@
+package api
+
+import (
+	"github.com/Yeuoly/kisara/src/routine/synergy/server"
+	"github.com/Yeuoly/kisara/src/types"
+)
+
+// SubscribeEvents subscribes cluster events, see server.SubscribeEvents, close it when it's no longer needed
+func SubscribeEvents(filter []string, last_id uint64) *server.EventSubscription {
+	return server.SubscribeEvents(filter, last_id)
+}
+
+// GetEvents returns kept events after last_id
+func GetEvents(filter []string, last_id uint64) []types.KisaraEvent {
+	return server.GetEvents(filter, last_id)
+}
@@ -0,0 +1,182 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Yeuoly/kisara/src/helper"
+	"github.com/Yeuoly/kisara/src/router"
+	server "github.com/Yeuoly/kisara/src/routine/synergy/server"
+	"github.com/Yeuoly/kisara/src/types"
+	"github.com/gorilla/websocket"
+)
+
+// execIOConn carries ExecIOMessage of an exec, over a websocket or a stream of channel
+type execIOConn interface {
+	WriteMessage(message interface{}) error
+	ReadMessage(message *types.ExecIOMessage) error
+	Close()
+}
+
+type websocketExecIO struct {
+	conn *websocket.Conn
+	lock sync.Mutex
+}
+
+func (w *websocketExecIO) WriteMessage(message interface{}) error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	return w.conn.WriteJSON(message)
+}
+
+func (w *websocketExecIO) ReadMessage(message *types.ExecIOMessage) error {
+	return w.conn.ReadJSON(message)
+}
+
+func (w *websocketExecIO) Close() {
+	w.conn.Close()
+}
+
+type channelExecIO struct {
+	stream *types.ChannelStream
+}
+
+func (c *channelExecIO) WriteMessage(message interface{}) error {
+	return c.stream.Send(message)
+}
+
+func (c *channelExecIO) ReadMessage(message *types.ExecIOMessage) error {
+	return c.stream.Recv(message)
+}
+
+func (c *channelExecIO) Close() {
+	c.stream.Close()
+}
+
+// dialExecIO opens an exec to client through its channel if there is one, otherwise by websocket
+func dialExecIO(client *types.Client, req types.RequestExecContainerIO) (execIOConn, error) {
+	if server.HasChannel(client.ClientID) {
+		stream, err := server.OpenChannelStream(client.ClientID, router.URI_CLIENT_EXEC_CONTAINER_IO, req)
+		if err != nil {
+			return nil, err
+		}
+		return &channelExecIO{stream: stream}, nil
+	}
+
+	header := http.Header{}
+	if token := helper.GetConfigString("kisara.token"); token != "" {
+		for k, v := range helper.SignedHeaders(token, "GET", router.URI_CLIENT_EXEC_CONTAINER_IO, []byte{}) {
+			header.Set(k, v)
+		}
+	}
+
+	dialer := websocket.Dialer{HandshakeTimeout: 5 * time.Second}
+	ws, _, err := dialer.Dial(client.GenerateClientWebsocketURI(router.URI_CLIENT_EXEC_CONTAINER_IO), header)
+	if err != nil {
+		return nil, err
+	}
+
+	conn := &websocketExecIO{conn: ws}
+	if err := conn.WriteMessage(req); err != nil {
+		ws.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+/*
+	ExecContainerIO runs an interactive command in container and blocks until it exits,
+	stdin is forwarded until EOF, a value from resize changes the tty size, stderr is merged
+	into stdout when req.Tty is set, the exit code is returned in response, it goes through
+	the control channel of the client if there is one
+*/
+func ExecContainerIO(req types.RequestExecContainerIO, stdin io.Reader, stdout io.Writer, stderr io.Writer, resize <-chan types.ExecIOResize) (_ types.ResponseExecContainerIO, err error) {
+	defer observeAPI("ExecContainerIO", time.Now(), &err)
+	if req.ClientID == "" {
+		// try to find the client
+		_, client_id, err := server.GetContainer(req.ContainerID)
+		if err != nil {
+			return types.ResponseExecContainerIO{}, err
+		}
+		req.ClientID = client_id
+	}
+
+	client := server.GetClient(req.ClientID)
+	if client == nil {
+		return types.ResponseExecContainerIO{}, errors.New("client not found")
+	}
+
+	conn, err := dialExecIO(client, req)
+	if err != nil {
+		return types.ResponseExecContainerIO{}, err
+	}
+	defer conn.Close()
+	write := conn.WriteMessage
+
+	done := make(chan bool)
+	defer close(done)
+
+	if stdin != nil {
+		go func() {
+			buf := make([]byte, 4096)
+			for {
+				n, err := stdin.Read(buf)
+				if n > 0 {
+					data := make([]byte, n)
+					copy(data, buf[:n])
+					if write(types.ExecIOMessage{Type: types.EXEC_IO_STDIN, Data: data}) != nil {
+						return
+					}
+				}
+				if err != nil {
+					write(types.ExecIOMessage{Type: types.EXEC_IO_STDIN_CLOSE})
+					return
+				}
+			}
+		}()
+	}
+
+	if resize != nil {
+		go func() {
+			for {
+				select {
+				case <-done:
+					return
+				case size, ok := <-resize:
+					if !ok {
+						return
+					}
+					write(types.ExecIOMessage{Type: types.EXEC_IO_RESIZE, Rows: size.Rows, Cols: size.Cols})
+				}
+			}
+		}()
+	}
+
+	for {
+		var message types.ExecIOMessage
+		if err := conn.ReadMessage(&message); err != nil {
+			return types.ResponseExecContainerIO{}, err
+		}
+		switch message.Type {
+		case types.EXEC_IO_STDOUT:
+			if stdout != nil {
+				stdout.Write(message.Data)
+			}
+		case types.EXEC_IO_STDERR:
+			if stderr != nil {
+				stderr.Write(message.Data)
+			}
+		case types.EXEC_IO_EXIT:
+			return types.ResponseExecContainerIO{
+				ClientID: client.ClientID,
+				ExitCode: message.ExitCode,
+			}, nil
+		case types.EXEC_IO_ERROR:
+			return types.ResponseExecContainerIO{}, errors.New(message.Error)
+		}
+	}
+}
@@ -0,0 +1,512 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	log "github.com/Yeuoly/kisara/src/routine/log"
+	server "github.com/Yeuoly/kisara/src/routine/synergy/server"
+	"github.com/Yeuoly/kisara/src/types"
+	uuid "github.com/satori/go.uuid"
+)
+
+/*
+	a game launches one service for every team from a template and plays rounds on its own,
+	every round flags of all teams are rotated and the checker script is run against every
+	container of the team on the checker network, games and their results are saved by the
+	store of server, games not stopped keep playing after server restarts
+*/
+
+type game struct {
+	// lock guards info and rounds
+	lock sync.Mutex
+	// play is held while a round is being played
+	play sync.Mutex
+	// save is held while the game is being saved, so an older state never overwrites a newer one
+	save    sync.Mutex
+	info    types.Game
+	req     types.RequestStartGame
+	rounds  []types.GameRound
+	stop    chan struct{}
+	timeout time.Duration
+}
+
+var games sync.Map // game id -> *game
+
+var slaRank = map[string]int{
+	types.SLA_UP:     0,
+	types.SLA_MUMBLE: 1,
+	types.SLA_DOWN:   2,
+}
+
+/*
+	StartGame launches a service for every team, and a checker on its network if req.Checker
+	is set, then plays the first round immediately and one more every req.RoundInterval
+	seconds, everything launched is stopped if any team fails to launch, timeout is applied
+	to each request sent to clients
+*/
+func StartGame(req types.RequestStartGame, timeout time.Duration) (_ types.Game, err error) {
+	defer observeAPI("StartGame", time.Now(), &err)
+	if len(req.Teams) == 0 {
+		return types.Game{}, errors.New("no team")
+	}
+	if req.RoundInterval <= 0 {
+		return types.Game{}, errors.New("round interval should be positive")
+	}
+	names := make(map[string]bool)
+	for _, name := range req.Teams {
+		if name == "" {
+			return types.Game{}, errors.New("team name is empty")
+		}
+		if names[name] {
+			return types.Game{}, fmt.Errorf("duplicated team: %s", name)
+		}
+		names[name] = true
+	}
+
+	config, err := req.Service.GetConfig()
+	if err != nil {
+		return types.Game{}, err
+	}
+
+	// networks of a launched service are in the same order as GetNetworks
+	network_index := -1
+	if len(req.Checker) > 0 {
+		if req.CheckerScript == "" {
+			return types.Game{}, errors.New("checker script is empty")
+		}
+		for i, network := range config.GetNetworks() {
+			if req.CheckerNetwork == "" || network.Network == req.CheckerNetwork {
+				network_index = i
+				break
+			}
+		}
+		if network_index == -1 {
+			return types.Game{}, fmt.Errorf("checker network %s not found in service", req.CheckerNetwork)
+		}
+	}
+
+	teams := make([]types.GameTeam, 0, len(req.Teams))
+	rollback := func() {
+		for _, team := range teams {
+			stopGameTeam(team, timeout)
+		}
+	}
+
+	for _, name := range req.Teams {
+		launched, err := LaunchService(types.RequestLaunchService{
+			ServiceConfig: req.Service,
+			Policy:        req.Policy,
+			NodeSelector:  req.NodeSelector,
+		}, func(string) {}, timeout)
+		if err != nil {
+			rollback()
+			return types.Game{}, fmt.Errorf("launch service for team %s: %s", name, err.Error())
+		}
+
+		team := types.GameTeam{
+			Name:      name,
+			ClientID:  launched.ClientID,
+			ServiceId: launched.Service.Id,
+		}
+		teams = append(teams, team)
+
+		if network_index == -1 {
+			continue
+		}
+
+		if network_index >= len(launched.Service.Networks) {
+			rollback()
+			return types.Game{}, fmt.Errorf("checker network of team %s not found", name)
+		}
+
+		monitor, err := RunNetworkMonitor(types.RequestNetworkMonitorRun{
+			ClientID:    launched.ClientID,
+			Context:     bytes.NewReader(req.Checker),
+			NetworkName: launched.Service.Networks[network_index].Name,
+		}, timeout, func(string) {})
+		if err != nil {
+			rollback()
+			return types.Game{}, fmt.Errorf("run checker for team %s: %s", name, err.Error())
+		}
+		teams[len(teams)-1].CheckerContainerId = monitor.NetworkMonitorContainerId
+	}
+
+	g := &game{
+		info: types.Game{
+			Id:            uuid.NewV4().String(),
+			Name:          req.Name,
+			Status:        types.GAME_STATUS_RUNNING,
+			RoundInterval: req.RoundInterval,
+			Teams:         teams,
+			StartedAt:     time.Now().Unix(),
+		},
+		req:     req,
+		rounds:  []types.GameRound{},
+		stop:    make(chan struct{}),
+		timeout: timeout,
+	}
+	games.Store(g.info.Id, g)
+	g.store()
+
+	log.Info("[Kisara-API] game %s started with %d teams", g.info.Id, len(teams))
+	server.PublishEvent(types.EVENT_GAME_START, "", g.getInfo())
+
+	go g.run(true)
+
+	return g.getInfo(), nil
+}
+
+// PauseGame stops playing new rounds of a running game, the round being played is finished
+func PauseGame(game_id string) error {
+	g, err := getGame(game_id)
+	if err != nil {
+		return err
+	}
+	return g.setStatus(types.GAME_STATUS_RUNNING, types.GAME_STATUS_PAUSED, types.EVENT_GAME_PAUSE)
+}
+
+// ResumeGame plays rounds of a paused game again from the next tick
+func ResumeGame(game_id string) error {
+	g, err := getGame(game_id)
+	if err != nil {
+		return err
+	}
+	return g.setStatus(types.GAME_STATUS_PAUSED, types.GAME_STATUS_RUNNING, types.EVENT_GAME_RESUME)
+}
+
+// StopGame stops the game and all services and checkers of it, results are kept
+func StopGame(game_id string, timeout time.Duration) (err error) {
+	defer observeAPI("StopGame", time.Now(), &err)
+	g, err := getGame(game_id)
+	if err != nil {
+		return err
+	}
+
+	g.lock.Lock()
+	if g.info.Status == types.GAME_STATUS_STOPPED {
+		g.lock.Unlock()
+		return errors.New("game is already stopped")
+	}
+	g.info.Status = types.GAME_STATUS_STOPPED
+	close(g.stop)
+	g.lock.Unlock()
+
+	// wait for the round being played
+	g.play.Lock()
+	defer g.play.Unlock()
+
+	for _, team := range g.info.Teams {
+		stopGameTeam(team, timeout)
+	}
+	g.store()
+
+	log.Info("[Kisara-API] game %s stopped", game_id)
+	server.PublishEvent(types.EVENT_GAME_STOP, "", g.getInfo())
+	return nil
+}
+
+// GetGame returns the current state of a game
+func GetGame(game_id string) (types.Game, error) {
+	g, err := getGame(game_id)
+	if err != nil {
+		return types.Game{}, err
+	}
+	return g.getInfo(), nil
+}
+
+// ListGames returns all games including stopped ones
+func ListGames() []types.Game {
+	result := make([]types.Game, 0)
+	games.Range(func(key, value interface{}) bool {
+		result = append(result, value.(*game).getInfo())
+		return true
+	})
+	return result
+}
+
+// GetRoundResults returns results of rounds played since round from, flags included
+func GetRoundResults(game_id string, from int) ([]types.GameRound, error) {
+	g, err := getGame(game_id)
+	if err != nil {
+		return nil, err
+	}
+
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	result := make([]types.GameRound, 0)
+	for _, round := range g.rounds {
+		if round.Round >= from {
+			result = append(result, round)
+		}
+	}
+	return result, nil
+}
+
+func init() {
+	server.SetGameRestorer(restoreGame)
+}
+
+/*
+	restoreGame rebuilds a game saved before server restarted, a game which was not stopped
+	plays its next round after a round interval, so that clients have time to reconnect
+*/
+func restoreGame(info types.Game, req types.RequestStartGame, timeout time.Duration, rounds []types.GameRound) {
+	g := &game{
+		info:    info,
+		req:     req,
+		rounds:  rounds,
+		stop:    make(chan struct{}),
+		timeout: timeout,
+	}
+	if len(rounds) > 0 && rounds[len(rounds)-1].Round > g.info.Round {
+		g.info.Round = rounds[len(rounds)-1].Round
+	}
+	games.Store(info.Id, g)
+
+	if info.Status == types.GAME_STATUS_STOPPED {
+		close(g.stop)
+		return
+	}
+	go g.run(false)
+}
+
+func getGame(game_id string) (*game, error) {
+	g, ok := games.Load(game_id)
+	if !ok {
+		return nil, errors.New("game not found")
+	}
+	return g.(*game), nil
+}
+
+func stopGameTeam(team types.GameTeam, timeout time.Duration) {
+	if team.CheckerContainerId != "" {
+		_, err := StopNetworkMonitor(types.RequestNetworkMonitorStop{
+			ClientID:                  team.ClientID,
+			NetworkMonitorContainerId: team.CheckerContainerId,
+		}, timeout)
+		if err != nil {
+			log.Warn("[Kisara-API] failed to stop checker of team %s: %s", team.Name, err.Error())
+		}
+	}
+
+	_, err := StopService(types.RequestStopService{
+		ClientID:  team.ClientID,
+		ServiceID: team.ServiceId,
+	}, timeout)
+	if err != nil {
+		log.Warn("[Kisara-API] failed to stop service of team %s: %s", team.Name, err.Error())
+	}
+}
+
+func (g *game) getInfo() types.Game {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	info := g.info
+	info.Teams = append([]types.GameTeam{}, g.info.Teams...)
+	return info
+}
+
+func (g *game) setStatus(from string, to string, event string) error {
+	g.lock.Lock()
+	if g.info.Status != from {
+		status := g.info.Status
+		g.lock.Unlock()
+		return fmt.Errorf("game is %s", status)
+	}
+	g.info.Status = to
+	g.lock.Unlock()
+	g.store()
+
+	server.PublishEvent(event, "", g.getInfo())
+	return nil
+}
+
+// store saves the current state of the game
+func (g *game) store() {
+	g.save.Lock()
+	defer g.save.Unlock()
+	server.StoreGame(g.getInfo(), g.req, g.timeout)
+}
+
+// run plays rounds until the game is stopped, the first one at once if immediately is set
+func (g *game) run(immediately bool) {
+	ticker := time.NewTicker(time.Duration(g.req.RoundInterval) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		if immediately && g.getInfo().Status == types.GAME_STATUS_RUNNING {
+			g.playRound()
+		}
+		immediately = true
+
+		select {
+		case <-ticker.C:
+		case <-g.stop:
+			return
+		}
+	}
+}
+
+func (g *game) playRound() {
+	g.play.Lock()
+	defer g.play.Unlock()
+
+	// stopped while waiting for the lock
+	select {
+	case <-g.stop:
+		return
+	default:
+	}
+
+	info := g.getInfo()
+	round := types.GameRound{
+		GameId:    info.Id,
+		Round:     info.Round + 1,
+		StartedAt: time.Now().Unix(),
+		Teams:     make([]types.GameRoundTeam, len(info.Teams)),
+	}
+
+	var wg sync.WaitGroup
+	for i := range info.Teams {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			round.Teams[i] = g.playTeam(info.Teams[i])
+		}(i)
+	}
+	wg.Wait()
+	round.FinishedAt = time.Now().Unix()
+
+	g.lock.Lock()
+	g.info.Round = round.Round
+	g.rounds = append(g.rounds, round)
+	g.lock.Unlock()
+	server.StoreGameRound(round)
+	g.store()
+
+	// flags are not published
+	event := round
+	event.Teams = make([]types.GameRoundTeam, len(round.Teams))
+	for i, team := range round.Teams {
+		team.Flags = nil
+		event.Teams[i] = team
+	}
+	server.PublishEvent(types.EVENT_GAME_ROUND, "", event)
+}
+
+/*
+	playTeam rotates flags of the team and checks every container of it, the team is down if
+	its flags could not be rotated at all, without a checker it's up as long as they could
+*/
+func (g *game) playTeam(team types.GameTeam) types.GameRoundTeam {
+	result := types.GameRoundTeam{
+		Team:        team.Name,
+		ServiceId:   team.ServiceId,
+		Status:      types.SLA_DOWN,
+		FlagsFailed: []types.ServiceFlagFailure{},
+		Checks:      []types.GameCheck{},
+	}
+
+	rotated, err := RotateServiceFlags(types.RequestRotateServiceFlags{
+		ClientID:  team.ClientID,
+		ServiceID: team.ServiceId,
+	}, g.timeout)
+	if err != nil {
+		log.Warn("[Kisara-API] failed to rotate flags of team %s: %s", team.Name, err.Error())
+		result.Error = err.Error()
+		return result
+	}
+	result.Flags = rotated.Flags
+	result.FlagsFailed = rotated.Failed
+
+	if team.CheckerContainerId == "" {
+		result.Status = types.SLA_UP
+		return result
+	}
+
+	service, _, err := server.GetService(team.ServiceId)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	flags := make(map[string]string)
+	for _, flag := range rotated.Flags {
+		if _, ok := flags[flag.ContainerId]; !ok {
+			flags[flag.ContainerId] = flag.Flag
+		}
+	}
+
+	for _, container := range service.Containers {
+		if check := g.check(team, container.Id, flags[container.Id]); check != nil {
+			result.Checks = append(result.Checks, *check)
+		}
+	}
+
+	result.Status, result.Error = teamStatus(result.Checks)
+	return result
+}
+
+// teamStatus is the worst status of checks, the team is down if no container was checked
+func teamStatus(checks []types.GameCheck) (string, string) {
+	if len(checks) == 0 {
+		return types.SLA_DOWN, "no container is reachable by the checker"
+	}
+
+	status := types.SLA_UP
+	for _, check := range checks {
+		if slaRank[check.Status] > slaRank[status] {
+			status = check.Status
+		}
+	}
+	return status, ""
+}
+
+// check runs the checker script against a container, nil if it's not on the checker network
+func (g *game) check(team types.GameTeam, container_id string, flag string) *types.GameCheck {
+	resp, err := RunNetworkMonitorScript(types.RequestNetworkMonitorRunScript{
+		ClientID: team.ClientID,
+		Containers: types.KisaraNetworkTestSet{
+			Containers: []types.KisaraNetworkTest{{
+				ContainerId:     container_id,
+				TestContainerId: team.CheckerContainerId,
+				Script:          g.req.CheckerScript,
+				Flag:            flag,
+			}},
+		},
+	}, g.timeout)
+	if err != nil {
+		return &types.GameCheck{
+			ContainerId: container_id,
+			Status:      types.SLA_DOWN,
+			Error:       err.Error(),
+		}
+	}
+
+	return checkResult(container_id, resp.Result.Results)
+}
+
+// checkResult maps the exit code of the checker script to a status, nil if nothing was tested
+func checkResult(container_id string, results []types.KisaraNetworkTestResult) *types.GameCheck {
+	if len(results) == 0 {
+		return nil
+	}
+
+	test := results[0]
+	check := &types.GameCheck{
+		ContainerId: container_id,
+		Status:      types.SLA_DOWN,
+		Output:      string(test.Result),
+	}
+	switch test.ExitCode {
+	case types.GAME_CHECKER_EXIT_UP:
+		check.Status = types.SLA_UP
+	case types.GAME_CHECKER_EXIT_MUMBLE:
+		check.Status = types.SLA_MUMBLE
+	}
+	return check
+}
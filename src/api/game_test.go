@@ -0,0 +1,105 @@
+package api
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Yeuoly/kisara/src/types"
+)
+
+func TestCheckResult(t *testing.T) {
+	cases := []struct {
+		name     string
+		results  []types.KisaraNetworkTestResult
+		expected *types.GameCheck
+	}{
+		{
+			name:     "container not on the checker network",
+			results:  nil,
+			expected: nil,
+		},
+		{
+			name:     "exit 0 is up",
+			results:  []types.KisaraNetworkTestResult{{ExitCode: 0, Result: []byte("ok")}},
+			expected: &types.GameCheck{ContainerId: "c", Status: types.SLA_UP, Output: "ok"},
+		},
+		{
+			name:     "exit 1 is mumble",
+			results:  []types.KisaraNetworkTestResult{{ExitCode: 1, Result: []byte("wrong flag")}},
+			expected: &types.GameCheck{ContainerId: "c", Status: types.SLA_MUMBLE, Output: "wrong flag"},
+		},
+		{
+			name:     "other exit codes are down",
+			results:  []types.KisaraNetworkTestResult{{ExitCode: 2}},
+			expected: &types.GameCheck{ContainerId: "c", Status: types.SLA_DOWN},
+		},
+		{
+			name:     "timed out is down",
+			results:  []types.KisaraNetworkTestResult{{ExitCode: -1}},
+			expected: &types.GameCheck{ContainerId: "c", Status: types.SLA_DOWN},
+		},
+	}
+
+	for _, c := range cases {
+		if check := checkResult("c", c.results); !reflect.DeepEqual(check, c.expected) {
+			t.Errorf("%s: unexpected check %+v", c.name, check)
+		}
+	}
+}
+
+func TestTeamStatus(t *testing.T) {
+	checks := func(status ...string) []types.GameCheck {
+		result := []types.GameCheck{}
+		for _, s := range status {
+			result = append(result, types.GameCheck{Status: s})
+		}
+		return result
+	}
+
+	cases := []struct {
+		name     string
+		checks   []types.GameCheck
+		status   string
+		hasError bool
+	}{
+		{name: "all up", checks: checks(types.SLA_UP, types.SLA_UP), status: types.SLA_UP},
+		{name: "a mumble makes the team mumble", checks: checks(types.SLA_UP, types.SLA_MUMBLE), status: types.SLA_MUMBLE},
+		{name: "down is worse than mumble", checks: checks(types.SLA_MUMBLE, types.SLA_DOWN, types.SLA_UP), status: types.SLA_DOWN},
+		{name: "nothing checked is down", checks: checks(), status: types.SLA_DOWN, hasError: true},
+	}
+
+	for _, c := range cases {
+		status, err := teamStatus(c.checks)
+		if status != c.status || (err != "") != c.hasError {
+			t.Errorf("%s: unexpected status %s, error %q", c.name, status, err)
+		}
+	}
+}
+
+func TestRestoreGame(t *testing.T) {
+	info := types.Game{Id: "restored", Status: types.GAME_STATUS_STOPPED, Round: 1, RoundInterval: 60}
+	rounds := []types.GameRound{
+		{GameId: "restored", Round: 1},
+		{GameId: "restored", Round: 2},
+	}
+	restoreGame(info, types.RequestStartGame{}, time.Second, rounds)
+	defer games.Delete("restored")
+
+	// a round saved after the game takes the round number of the game further
+	game, err := GetGame("restored")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if game.Round != 2 || game.Status != types.GAME_STATUS_STOPPED {
+		t.Fatalf("unexpected game %+v", game)
+	}
+
+	results, err := GetRoundResults("restored", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Round != 2 {
+		t.Fatalf("unexpected rounds %+v", results)
+	}
+}
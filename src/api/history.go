@@ -0,0 +1,164 @@
+package api
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Yeuoly/kisara/src/router"
+	log "github.com/Yeuoly/kisara/src/routine/log"
+	server "github.com/Yeuoly/kisara/src/routine/synergy/server"
+	"github.com/Yeuoly/kisara/src/types"
+)
+
+func requestResourceHistory(client_id string, req types.RequestResourceHistory, timeout time.Duration) (types.ResponseResourceHistory, error) {
+	req.ClientID = client_id
+	resp, err := server.RequestClient[types.ResponseResourceHistory](
+		client_id,
+		"POST",
+		router.URI_CLIENT_RESOURCE_HISTORY,
+		req,
+		timeout,
+	)
+	if err != nil {
+		return types.ResponseResourceHistory{}, err
+	}
+
+	if resp.Code != 0 {
+		return types.ResponseResourceHistory{}, errors.New(resp.Message)
+	}
+
+	return resp.Data, nil
+}
+
+/*
+	GetResourceHistory returns cpu, memory, network I/O and block I/O history in [From, To) by Step,
+	of req.ContainerID if it's set, its node is located by server or every node is asked if it has
+	been removed, otherwise of node req.ClientID, with its containers if AllContainers is set, if
+	neither is set every node is asked and an aggregate of the cluster with empty ClientID is
+	appended, cpu usage of the aggregate is the average of nodes and the others are sums
+*/
+func GetResourceHistory(req types.RequestResourceHistory, timeout time.Duration) (_ types.ResponseResourceHistory, err error) {
+	defer observeAPI("GetResourceHistory", time.Now(), &err)
+	// nodes raise step to their sampling intervals
+	req.Normalize(time.Now().Unix(), 0)
+
+	if req.ClientID != "" {
+		return requestResourceHistory(req.ClientID, req, timeout)
+	}
+
+	if req.ContainerID != "" {
+		_, client_id, err := server.GetContainer(req.ContainerID)
+		if err == nil {
+			return requestResourceHistory(client_id, req, timeout)
+		}
+
+		for _, node := range server.GetNodes() {
+			resp, err := requestResourceHistory(node.ClientID, req, timeout)
+			if err != nil {
+				continue
+			}
+			return resp, nil
+		}
+		return types.ResponseResourceHistory{}, errors.New("no history of container")
+	}
+
+	nodes := server.GetNodes()
+	responses := make([]*types.ResponseResourceHistory, len(nodes))
+
+	query := func(indexes []int, req types.RequestResourceHistory) {
+		var wg sync.WaitGroup
+		for _, i := range indexes {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				resp, err := requestResourceHistory(nodes[i].ClientID, req, timeout)
+				if err != nil {
+					log.Warn("[Kisara-API] client %s get resource history error: %s", nodes[i].ClientID, err.Error())
+					responses[i] = nil
+					return
+				}
+				responses[i] = &resp
+			}(i)
+		}
+		wg.Wait()
+	}
+
+	all := make([]int, len(nodes))
+	for i := range nodes {
+		all[i] = i
+	}
+	query(all, req)
+
+	// nodes sampling less often answer with larger steps, the others are asked again with the largest
+	// one so that their samples line up in the aggregate
+	step := req.Step
+	for _, resp := range responses {
+		if resp != nil && resp.Step > step {
+			step = resp.Step
+		}
+	}
+	mismatched := []int{}
+	for i, resp := range responses {
+		if resp != nil && resp.Step != step {
+			mismatched = append(mismatched, i)
+		}
+	}
+	if len(mismatched) > 0 {
+		req.Step = step
+		query(mismatched, req)
+	}
+
+	result := types.ResponseResourceHistory{
+		Step:   step,
+		Series: []types.ResourceSeries{},
+	}
+	node_series := []types.ResourceSeries{}
+	for _, resp := range responses {
+		if resp == nil {
+			continue
+		}
+		for _, series := range resp.Series {
+			if series.ContainerID == "" {
+				node_series = append(node_series, series)
+			}
+		}
+		result.Series = append(result.Series, resp.Series...)
+	}
+	result.Series = append(result.Series, aggregateResourceSeries(node_series))
+
+	return result, nil
+}
+
+// aggregateResourceSeries sums samples of nodes at the same time, cpu usage is averaged
+func aggregateResourceSeries(node_series []types.ResourceSeries) types.ResourceSeries {
+	sums := make(map[int64]*types.ResourceSample)
+	counts := make(map[int64]int)
+	for _, series := range node_series {
+		for _, sample := range series.Samples {
+			sum, ok := sums[sample.Time]
+			if !ok {
+				sum = &types.ResourceSample{Time: sample.Time}
+				sums[sample.Time] = sum
+			}
+			sum.CPUUsage += sample.CPUUsage
+			sum.MemUsage += sample.MemUsage
+			sum.NetRx += sample.NetRx
+			sum.NetTx += sample.NetTx
+			sum.BlkRead += sample.BlkRead
+			sum.BlkWrite += sample.BlkWrite
+			counts[sample.Time]++
+		}
+	}
+
+	aggregate := types.ResourceSeries{Samples: []types.ResourceSample{}}
+	for sample_time, sum := range sums {
+		sum.CPUUsage /= float64(counts[sample_time])
+		aggregate.Samples = append(aggregate.Samples, *sum)
+	}
+	sort.Slice(aggregate.Samples, func(i, j int) bool {
+		return aggregate.Samples[i].Time < aggregate.Samples[j].Time
+	})
+	return aggregate
+}
@@ -0,0 +1,44 @@
+package api
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/Yeuoly/kisara/src/types"
+)
+
+func TestAggregateResourceSeries(t *testing.T) {
+	node_series := []types.ResourceSeries{
+		{
+			ClientID: "a",
+			Samples: []types.ResourceSample{
+				{Time: 110, CPUUsage: 40, MemUsage: 100, NetRx: 10, NetTx: 1, BlkRead: 5, BlkWrite: 2},
+				{Time: 100, CPUUsage: 20, MemUsage: 100, NetRx: 10},
+			},
+		},
+		{
+			ClientID: "b",
+			Samples: []types.ResourceSample{
+				{Time: 120, CPUUsage: 90, MemUsage: 300},
+				{Time: 110, CPUUsage: 60, MemUsage: 200, NetRx: 30, NetTx: 3, BlkRead: 5, BlkWrite: 4},
+			},
+		},
+	}
+
+	// samples are summed at the same time and sorted by it, cpu usage is averaged over nodes having a sample
+	expected := types.ResourceSeries{
+		Samples: []types.ResourceSample{
+			{Time: 100, CPUUsage: 20, MemUsage: 100, NetRx: 10},
+			{Time: 110, CPUUsage: 50, MemUsage: 300, NetRx: 40, NetTx: 4, BlkRead: 10, BlkWrite: 6},
+			{Time: 120, CPUUsage: 90, MemUsage: 300},
+		},
+	}
+	if aggregate := aggregateResourceSeries(node_series); !reflect.DeepEqual(aggregate, expected) {
+		t.Fatalf("unexpected aggregate %+v", aggregate)
+	}
+
+	// an aggregate of no nodes has no samples instead of nil ones
+	if aggregate := aggregateResourceSeries(nil); aggregate.Samples == nil || len(aggregate.Samples) != 0 {
+		t.Fatalf("unexpected aggregate of no nodes %+v", aggregate)
+	}
+}
@@ -32,6 +32,18 @@ func RegisterOnNodeStopService(f server.KisaraOnServiceStop) {
 	server.RegisterOnServiceStop(f)
 }
 
+func RegisterOnNodeEvent(f server.KisaraOnChannelEvent) {
+	server.RegisterOnChannelEvent(f)
+}
+
+func RegisterOnNodeDrainContainer(f server.KisaraOnNodeDrainContainer) {
+	server.RegisterOnNodeDrainContainer(f)
+}
+
+func RegisterOnNodeDrainService(f server.KisaraOnNodeDrainService) {
+	server.RegisterOnNodeDrainService(f)
+}
+
 func UnsetOnNodeConnect() {
 	server.UnsetOnNodeConnect()
 }
@@ -59,3 +71,15 @@ func UnsetOnNodeLaunchService() {
 func UnsetOnNodeStopService() {
 	server.UnsetOnServiceStop()
 }
+
+func UnsetOnNodeEvent() {
+	server.UnsetOnChannelEvent()
+}
+
+func UnsetOnNodeDrainContainer() {
+	server.UnsetOnNodeDrainContainer()
+}
+
+func UnsetOnNodeDrainService() {
+	server.UnsetOnNodeDrainService()
+}
@@ -0,0 +1,424 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Yeuoly/kisara/src/helper"
+	"github.com/Yeuoly/kisara/src/router"
+	server "github.com/Yeuoly/kisara/src/routine/synergy/server"
+	"github.com/Yeuoly/kisara/src/types"
+)
+
+/*
+	DistributeImages pulls images on every node matching selector before they are needed,
+	nodes pull in parallel and images of a node are pulled one by one, message_callback
+	receives progress of all nodes prefixed by node and image, timeout is applied to each pull,
+	registry is the credential of the registry of the images, it's sealed for every pull
+*/
+func DistributeImages(images []string, selector map[string]string, registry *types.RegistryCredential, timeout time.Duration, message_callback func(string)) (_ types.ResponseDistributeImages, err error) {
+	defer observeAPI("DistributeImages", time.Now(), &err)
+	if len(images) == 0 {
+		return types.ResponseDistributeImages{}, errors.New("no image")
+	}
+
+	nodes := server.GetNodesBySelector(selector)
+	if len(nodes) == 0 {
+		return types.ResponseDistributeImages{}, errors.New("no client found")
+	}
+
+	if message_callback == nil {
+		message_callback = func(string) {}
+	}
+
+	// progress of nodes are reported one at a time
+	var progress_lock sync.Mutex
+	finished, total := 0, len(nodes)*len(images)
+	progress := func(message string, done bool) {
+		progress_lock.Lock()
+		defer progress_lock.Unlock()
+		if done {
+			finished++
+			message = fmt.Sprintf("%s (%d/%d)", message, finished, total)
+		}
+		message_callback(message)
+	}
+
+	resp := types.ResponseDistributeImages{
+		Ready: true,
+		Nodes: make([]types.ImageDistributionNode, len(nodes)),
+	}
+
+	var wg sync.WaitGroup
+	for i, node := range nodes {
+		wg.Add(1)
+		go func(i int, client_id string) {
+			defer wg.Done()
+			report := types.ImageDistributionNode{
+				ClientID: client_id,
+				Ready:    true,
+				Images:   make([]types.ImageDistributionItem, 0, len(images)),
+			}
+
+			for _, image := range images {
+				item := types.ImageDistributionItem{
+					ImageName: image,
+					Ready:     true,
+				}
+				_, err := PullImage(types.RequestPullImage{
+					ClientID:  client_id,
+					ImageName: image,
+					Registry:  registry,
+				}, timeout, func(message string) {
+					progress(fmt.Sprintf("[%s] %s: %s", client_id, image, message), false)
+				})
+				if err != nil {
+					item.Ready = false
+					item.Error = err.Error()
+					report.Ready = false
+					progress(fmt.Sprintf("[%s] %s: failed, %s", client_id, image, err.Error()), true)
+				} else {
+					progress(fmt.Sprintf("[%s] %s: ready", client_id, image), true)
+				}
+				report.Images = append(report.Images, item)
+			}
+
+			resp.Nodes[i] = report
+		}(i, node.ClientID)
+	}
+	wg.Wait()
+
+	for _, node := range resp.Nodes {
+		if !node.Ready {
+			resp.Ready = false
+		}
+	}
+
+	return resp, nil
+}
+
+/*
+	TransferImage copies an image to ToClientID from FromClientID, or from any node reported to
+	have it if FromClientID is empty, the image is streamed between the nodes directly so the
+	source must be reachable from the target by its client address, timeout covers the whole copy
+*/
+func TransferImage(req types.RequestTransferImage, timeout time.Duration) (_ types.ResponseFetchImage, err error) {
+	defer observeAPI("TransferImage", time.Now(), &err)
+	if server.GetClient(req.ToClientID) == nil {
+		return types.ResponseFetchImage{}, errors.New("client not found")
+	}
+
+	var peers []types.ImagePeer
+	if req.FromClientID != "" {
+		from := server.GetClient(req.FromClientID)
+		if from == nil {
+			return types.ResponseFetchImage{}, errors.New("source client not found")
+		}
+		peers = []types.ImagePeer{{
+			ClientID:   from.ClientID,
+			ClientIp:   from.ClientIp,
+			ClientPort: from.ClientPort,
+			Channel:    server.HasChannel(from.ClientID),
+		}}
+	} else {
+		peers = server.GetImagePeers(req.ImageName, req.ToClientID)
+		if len(peers) == 0 {
+			return types.ResponseFetchImage{}, errors.New("no client has the image")
+		}
+	}
+
+	resp, err := server.RequestClient[types.ResponseFetchImage](
+		req.ToClientID,
+		"POST",
+		router.URI_CLIENT_FETCH_IMAGE,
+		types.RequestFetchImage{
+			ClientID:  req.ToClientID,
+			ImageName: req.ImageName,
+			Peers:     peers,
+		},
+		timeout,
+	)
+	if err != nil {
+		return types.ResponseFetchImage{}, err
+	}
+
+	if resp.Code != 0 {
+		return types.ResponseFetchImage{}, errors.New(resp.Message)
+	}
+
+	return resp.Data, nil
+}
+
+/*
+	BuildImage builds image_name from a tar build context on client_id, or on every node if client_id
+	is empty, nodes build in parallel and message_callback receives build logs prefixed by node,
+	timeout is applied to each build, an error is returned if the build failed on any node, the
+	context is streamed to a single node, it's spooled to a temporary file once for several nodes
+*/
+func BuildImage(client_id string, tar io.Reader, image_name string, build_args map[string]string, timeout time.Duration, message_callback func(string)) (_ types.ResponseFinalBuildImage, err error) {
+	defer observeAPI("BuildImage", time.Now(), &err)
+	var clients []types.Client
+	if client_id == "" {
+		for _, node := range server.GetNodes() {
+			clients = append(clients, *node.Client)
+		}
+		if len(clients) == 0 {
+			return types.ResponseFinalBuildImage{}, errors.New("no client found")
+		}
+	} else {
+		client := server.GetClient(client_id)
+		if client == nil {
+			return types.ResponseFinalBuildImage{}, errors.New("client not found")
+		}
+		clients = append(clients, *client)
+	}
+
+	context := func() io.Reader { return tar }
+	if len(clients) > 1 {
+		spool, size, err := spoolBuildContext(tar)
+		if err != nil {
+			return types.ResponseFinalBuildImage{}, err
+		}
+		defer os.Remove(spool.Name())
+		defer spool.Close()
+		// every node reads the file from its own offset
+		context = func() io.Reader { return io.NewSectionReader(spool, 0, size) }
+	}
+
+	if message_callback == nil {
+		message_callback = func(string) {}
+	}
+
+	var progress_lock sync.Mutex
+	progress := func(message string) {
+		progress_lock.Lock()
+		defer progress_lock.Unlock()
+		message_callback(message)
+	}
+
+	resp := types.ResponseFinalBuildImage{
+		ImageName: image_name,
+		Nodes:     make([]types.ImageBuildNode, len(clients)),
+	}
+
+	var wg sync.WaitGroup
+	for i, client := range clients {
+		wg.Add(1)
+		go func(i int, client types.Client) {
+			defer wg.Done()
+			report := types.ImageBuildNode{
+				ClientID: client.ClientID,
+			}
+			image_id, err := buildImage(client, types.RequestBuildImage{
+				ClientID:  client.ClientID,
+				ImageName: image_name,
+				BuildArgs: build_args,
+			}, context(), timeout, func(message string) {
+				progress(fmt.Sprintf("[%s] %s", client.ClientID, message))
+			})
+			if err != nil {
+				report.Error = err.Error()
+				progress(fmt.Sprintf("[%s] failed, %s", client.ClientID, err.Error()))
+			} else {
+				report.ImageId = image_id
+				server.PublishEvent(types.EVENT_IMAGE_BUILD, client.ClientID, types.EventImage{
+					ImageName: image_name,
+					ImageId:   image_id,
+				})
+			}
+			resp.Nodes[i] = report
+		}(i, client)
+	}
+	wg.Wait()
+
+	failed := []string{}
+	for _, node := range resp.Nodes {
+		if node.Error != "" {
+			failed = append(failed, fmt.Sprintf("%s: %s", node.ClientID, node.Error))
+		}
+	}
+	if len(failed) > 0 {
+		return resp, errors.New(strings.Join(failed, "; "))
+	}
+
+	return resp, nil
+}
+
+// spoolBuildContext copies tar to a temporary file, the caller should close and remove it
+func spoolBuildContext(tar io.Reader) (*os.File, int64, error) {
+	spool, err := os.CreateTemp("", "kisara-build-*.tar")
+	if err != nil {
+		return nil, 0, err
+	}
+	size, err := io.Copy(spool, tar)
+	if err != nil {
+		spool.Close()
+		os.Remove(spool.Name())
+		return nil, 0, err
+	}
+	return spool, size, nil
+}
+
+/*
+	buildImageByChannel sends context as chunks of a stream while build logs are read, the client
+	answers with the id of the image before its last chunk
+*/
+func buildImageByChannel(req types.RequestBuildImage, context io.Reader, timeout time.Duration, message_callback func(string)) (string, error) {
+	stream, finish, err := openTimedStream(req.ClientID, router.URI_CLIENT_BUILD_IMAGE, req, timeout)
+	if err != nil {
+		return "", err
+	}
+
+	// the client stops reading when the build fails early, the stream is closed by then
+	sent := make(chan struct{})
+	go func() {
+		defer close(sent)
+		if _, err := io.Copy(stream.Writer(""), context); err != nil {
+			stream.Finish(err)
+			return
+		}
+		stream.Finish(nil)
+	}()
+
+	image_id := ""
+	err = stream.ReadChunks(func(name string, data []byte) error {
+		switch name {
+		case types.BUILD_STREAM_LOG:
+			message_callback(string(data))
+		case types.BUILD_STREAM_IMAGE:
+			image_id = string(data)
+		}
+		return nil
+	})
+	err = finish(err)
+	<-sent
+	if err != nil {
+		return "", err
+	}
+	if image_id == "" {
+		return "", errors.New("no image is built")
+	}
+	return image_id, nil
+}
+
+// buildImage builds on a node through control channel if it has one, otherwise context is uploaded and the build is polled
+func buildImage(client types.Client, req types.RequestBuildImage, context io.Reader, timeout time.Duration, message_callback func(string)) (string, error) {
+	if server.HasChannel(client.ClientID) {
+		return buildImageByChannel(req, context, timeout, message_callback)
+	}
+
+	start := time.Now()
+
+	build_args, err := json.Marshal(req.BuildArgs)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := helper.SendPostAndParse[types.KisaraResponseWrap[types.ResponseBuildImage]](
+		client.GenerateClientURI(router.URI_CLIENT_BUILD_IMAGE),
+		helper.HttpTimeout(timeout.Milliseconds()),
+		helper.HttpPyloadMultipart(
+			map[string]string{
+				"client_id":  req.ClientID,
+				"image_name": req.ImageName,
+				"build_args": string(build_args),
+			},
+			helper.HttpPayloadMultipartFile("context.tar", context),
+		),
+	)
+	if err != nil {
+		return "", err
+	}
+	if resp.Code != 0 {
+		return "", errors.New(resp.Message)
+	}
+
+	timer := time.NewTimer(timeout - time.Since(start))
+	defer timer.Stop()
+	ticker := time.NewTicker(1 * time.Second)
+	defer ticker.Stop()
+	offset := 0
+	for {
+		select {
+		case <-timer.C:
+			return "", errors.New("timeout")
+		case <-ticker.C:
+			check, err := helper.SendGetAndParse[types.KisaraResponseWrap[types.ResponseCheckBuildImage]](
+				client.GenerateClientURI(router.URI_CLIENT_BUILD_IMAGE_CHECK),
+				helper.HttpTimeout(2000),
+				helper.HttpPayloadJson(types.RequestCheckBuildImage{
+					ClientID:          client.ClientID,
+					MessageResponseId: resp.Data.MessageResponseId,
+					FinishResponseID:  resp.Data.FinishResponseID,
+					Offset:            offset,
+				}),
+			)
+			if err != nil {
+				return "", err
+			}
+			if check.Code != 0 {
+				return "", errors.New(check.Message)
+			}
+			if check.Data.ClientID != client.ClientID {
+				return "", errors.New("client id not match")
+			}
+			// client keeps every log, only those after offset are returned
+			for _, message := range check.Data.Logs {
+				message_callback(message)
+			}
+			offset = check.Data.Offset
+			if !check.Data.Finished {
+				continue
+			}
+			if check.Data.Error != "" {
+				return "", errors.New(check.Data.Error)
+			}
+			return check.Data.ImageId, nil
+		}
+	}
+}
+
+/*
+	PruneImages removes images on client_id by its gc rules, images used by containers and pinned
+	images are kept, in a dry run nothing is removed and the images which would be removed are returned
+*/
+func PruneImages(client_id string, dry_run bool, timeout time.Duration) (_ types.ResponsePruneImages, err error) {
+	defer observeAPI("PruneImages", time.Now(), &err)
+	if server.GetClient(client_id) == nil {
+		return types.ResponsePruneImages{}, errors.New("client not found")
+	}
+
+	resp, err := server.RequestClient[types.ResponsePruneImages](
+		client_id,
+		"POST",
+		router.URI_CLIENT_PRUNE_IMAGES,
+		types.RequestPruneImages{
+			ClientID: client_id,
+			DryRun:   dry_run,
+		},
+		timeout,
+	)
+	if err != nil {
+		return types.ResponsePruneImages{}, err
+	}
+
+	if resp.Code != 0 {
+		return types.ResponsePruneImages{}, errors.New(resp.Message)
+	}
+
+	if !dry_run {
+		for _, image := range resp.Data.Images {
+			if image.Error == "" {
+				server.PublishEvent(types.EVENT_IMAGE_DELETE, client_id, types.EventImage{ImageId: image.ImageId})
+			}
+		}
+	}
+
+	return resp.Data, nil
+}
@@ -0,0 +1,165 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/Yeuoly/kisara/src/helper"
+	"github.com/Yeuoly/kisara/src/router"
+	log "github.com/Yeuoly/kisara/src/routine/log"
+	server "github.com/Yeuoly/kisara/src/routine/synergy/server"
+	"github.com/Yeuoly/kisara/src/types"
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+func requestContainerLogs(client_id string, container_id string, since int64, tail int, timeout time.Duration) (types.ResponseContainerLogs, error) {
+	resp, err := server.RequestClient[types.ResponseContainerLogs](
+		client_id,
+		"POST",
+		router.URI_CLIENT_CONTAINER_LOGS,
+		types.RequestContainerLogs{
+			ClientID:    client_id,
+			ContainerID: container_id,
+			Since:       since,
+			Tail:        tail,
+		},
+		timeout,
+	)
+	if err != nil {
+		return types.ResponseContainerLogs{}, err
+	}
+
+	if resp.Code != 0 {
+		return types.ResponseContainerLogs{}, errors.New(resp.Message)
+	}
+
+	return resp.Data, nil
+}
+
+/*
+	GetContainerLogs returns logs of the container after since, a unix time, tail limits them to the
+	last lines, 0 means no limit, the node of the container is located by server, if the container
+	was removed, every node is asked for the logs it retained
+*/
+func GetContainerLogs(container_id string, since int64, tail int, timeout time.Duration) (_ types.ResponseContainerLogs, err error) {
+	defer observeAPI("GetContainerLogs", time.Now(), &err)
+	_, client_id, err := server.GetContainer(container_id)
+	if err == nil {
+		return requestContainerLogs(client_id, container_id, since, tail, timeout)
+	}
+
+	for _, node := range server.GetNodes() {
+		resp, err := requestContainerLogs(node.ClientID, container_id, since, tail, timeout)
+		if err != nil {
+			log.Debug("[Kisara-API] client %s has no logs of %s: %s", node.ClientID, container_id, err.Error())
+			continue
+		}
+		return resp, nil
+	}
+
+	return types.ResponseContainerLogs{}, errors.New("container not found")
+}
+
+/*
+	FollowContainerLogs writes logs of the container to stdout and stderr as they come, until the
+	container stops or stop is closed, logs of a container with a tty all go to stdout, they come
+	through the channel of the client if it has one
+*/
+func FollowContainerLogs(container_id string, since int64, tail int, stdout io.Writer, stderr io.Writer, stop <-chan struct{}) (err error) {
+	defer observeAPI("FollowContainerLogs", time.Now(), &err)
+	_, client_id, err := server.GetContainer(container_id)
+	if err != nil {
+		return err
+	}
+
+	client := server.GetClient(client_id)
+	if client == nil {
+		return errors.New("client not found")
+	}
+
+	if server.HasChannel(client_id) {
+		return followContainerLogsByChannel(client_id, container_id, since, tail, stdout, stderr, stop)
+	}
+
+	// client answers errors in json
+	return helper.SendGetStream(
+		client.GenerateClientURI(router.URI_CLIENT_CONTAINER_LOGS_FOLLOW),
+		"application/vnd.docker.raw-stream",
+		func(body io.ReadCloser, header *helper.ResponseHeader) error {
+			var err error
+			done := make(chan struct{})
+			defer close(done)
+			go func() {
+				select {
+				case <-stop:
+					body.Close()
+				case <-done:
+				}
+			}()
+
+			if header.FindKey("X-Kisara-Tty") == "true" {
+				_, err = io.Copy(stdout, body)
+			} else {
+				_, err = stdcopy.StdCopy(stdout, stderr, body)
+			}
+
+			select {
+			case <-stop:
+				// closed by caller, it's not an error
+				return nil
+			default:
+				return err
+			}
+		},
+		helper.HttpParams(map[string]string{
+			"client_id":    client_id,
+			"container_id": container_id,
+			"since":        strconv.FormatInt(since, 10),
+			"tail":         strconv.Itoa(tail),
+		}),
+		helper.HttpSign(helper.GetConfigString("kisara.token")),
+	)
+}
+
+// followContainerLogsByChannel receives logs as chunks of a stream, the client demultiplexes them
+func followContainerLogsByChannel(client_id string, container_id string, since int64, tail int, stdout io.Writer, stderr io.Writer, stop <-chan struct{}) error {
+	stream, err := server.OpenChannelStream(client_id, router.URI_CLIENT_CONTAINER_LOGS_FOLLOW, types.RequestContainerLogs{
+		ClientID:    client_id,
+		ContainerID: container_id,
+		Since:       since,
+		Tail:        tail,
+	})
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+
+	go func() {
+		select {
+		case <-stop:
+			stream.Close()
+		case <-stream.Done():
+		}
+	}()
+
+	err = stream.ReadChunks(func(name string, data []byte) error {
+		writer := stdout
+		if name == types.EXEC_IO_STDERR {
+			writer = stderr
+		}
+		if writer != nil {
+			writer.Write(data)
+		}
+		return nil
+	})
+
+	select {
+	case <-stop:
+		// closed by caller, it's not an error
+		return nil
+	default:
+		return err
+	}
+}
@@ -0,0 +1,32 @@
+package api
+
+import (
+	"time"
+
+	"github.com/Yeuoly/kisara/src/routine/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	api_latency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "kisara_server_api_request_duration_seconds",
+		Help:    "Latency of calls of kisara API, partitioned by API name",
+		Buckets: metrics.LATENCY_BUCKETS,
+	}, []string{"api"})
+	api_errors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kisara_server_api_errors_total",
+		Help: "Calls of kisara API which returned an error, partitioned by API name",
+	}, []string{"api"})
+)
+
+func init() {
+	prometheus.MustRegister(api_latency, api_errors)
+}
+
+// observeAPI records a call of api started at start, it's deferred with the named error result of the call
+func observeAPI(api string, start time.Time, err *error) {
+	api_latency.WithLabelValues(api).Observe(time.Since(start).Seconds())
+	if *err != nil {
+		api_errors.WithLabelValues(api).Inc()
+	}
+}
@@ -2,6 +2,7 @@ package api
 
 import (
 	"errors"
+	"io/ioutil"
 	"time"
 
 	"github.com/Yeuoly/kisara/src/helper"
@@ -10,7 +11,8 @@ import (
 	"github.com/Yeuoly/kisara/src/types"
 )
 
-func RunNetworkMonitor(req types.RequestNetworkMonitorRun, timeout time.Duration, message_callback func(string)) (types.ResponseFinalNetworkMonitorStatus, error) {
+func RunNetworkMonitor(req types.RequestNetworkMonitorRun, timeout time.Duration, message_callback func(string)) (_ types.ResponseFinalNetworkMonitorStatus, err error) {
+	defer observeAPI("RunNetworkMonitor", time.Now(), &err)
 	client := server.GetClient(req.ClientID)
 	if client == nil {
 		return types.ResponseFinalNetworkMonitorStatus{}, errors.New("client not found")
@@ -20,6 +22,43 @@ func RunNetworkMonitor(req types.RequestNetworkMonitorRun, timeout time.Duration
 		return types.ResponseFinalNetworkMonitorStatus{}, errors.New("context is nil")
 	}
 
+	// run through control channel if client has one, context is sent inline
+	if server.HasChannel(client.ClientID) {
+		context, err := ioutil.ReadAll(req.Context)
+		if err != nil {
+			return types.ResponseFinalNetworkMonitorStatus{}, err
+		}
+		resp, err := server.RequestChannel[types.ResponseNetworkMonitorCheck](
+			client.ClientID,
+			"POST",
+			router.URI_CLIENT_NETWORK_MONITOR_RUN,
+			types.RequestNetworkMonitorRunChannel{
+				ClientID:    req.ClientID,
+				Context:     context,
+				NetworkName: req.NetworkName,
+			},
+			timeout,
+			message_callback,
+		)
+		if err != nil {
+			return types.ResponseFinalNetworkMonitorStatus{}, err
+		}
+		if resp.Code != 0 {
+			return types.ResponseFinalNetworkMonitorStatus{}, errors.New(resp.Message)
+		}
+		if resp.Data.Error != "" {
+			return types.ResponseFinalNetworkMonitorStatus{}, errors.New(resp.Data.Error)
+		}
+		server.PublishEvent(types.EVENT_MONITOR_RUN, req.ClientID, types.EventMonitor{
+			NetworkName:               req.NetworkName,
+			NetworkMonitorContainerId: resp.Data.NetworkMonitorContainerId,
+		})
+		return types.ResponseFinalNetworkMonitorStatus{
+			ClientID:                  req.ClientID,
+			NetworkMonitorContainerId: resp.Data.NetworkMonitorContainerId,
+		}, nil
+	}
+
 	start := time.Now()
 	resp, err := helper.SendPostAndParse[types.KisaraResponseWrap[types.ResponseNetworkMonitorRun]](
 		client.GenerateClientURI(router.URI_CLIENT_NETWORK_MONITOR_RUN),
@@ -84,6 +123,10 @@ func RunNetworkMonitor(req types.RequestNetworkMonitorRun, timeout time.Duration
 			message_callback(resp.Data.Message)
 
 			if resp.Data.Finished {
+				server.PublishEvent(types.EVENT_MONITOR_RUN, req.ClientID, types.EventMonitor{
+					NetworkName:               req.NetworkName,
+					NetworkMonitorContainerId: resp.Data.NetworkMonitorContainerId,
+				})
 				return types.ResponseFinalNetworkMonitorStatus{
 					ClientID:                  req.ClientID,
 					Error:                     resp.Data.Error,
@@ -94,16 +137,19 @@ func RunNetworkMonitor(req types.RequestNetworkMonitorRun, timeout time.Duration
 	}
 }
 
-func StopNetworkMonitor(req types.RequestNetworkMonitorStop, timeout time.Duration) (types.ResponseNetworkMonitorStop, error) {
+func StopNetworkMonitor(req types.RequestNetworkMonitorStop, timeout time.Duration) (_ types.ResponseNetworkMonitorStop, err error) {
+	defer observeAPI("StopNetworkMonitor", time.Now(), &err)
 	client := server.GetClient(req.ClientID)
 	if client == nil {
 		return types.ResponseNetworkMonitorStop{}, errors.New("client not found")
 	}
 
-	resp, err := helper.SendPostAndParse[types.KisaraResponseWrap[types.ResponseNetworkMonitorStop]](
-		client.GenerateClientURI(router.URI_CLIENT_NETWORK_MONITOR_STOP),
-		helper.HttpTimeout(timeout.Milliseconds()),
-		helper.HttpPayloadJson(req),
+	resp, err := server.RequestClient[types.ResponseNetworkMonitorStop](
+		client.ClientID,
+		"POST",
+		router.URI_CLIENT_NETWORK_MONITOR_STOP,
+		req,
+		timeout,
 	)
 
 	if err != nil {
@@ -118,19 +164,25 @@ func StopNetworkMonitor(req types.RequestNetworkMonitorStop, timeout time.Durati
 		return types.ResponseNetworkMonitorStop{}, errors.New(resp.Data.Error)
 	}
 
+	server.PublishEvent(types.EVENT_MONITOR_STOP, req.ClientID, types.EventMonitor{
+		NetworkMonitorContainerId: req.NetworkMonitorContainerId,
+	})
 	return resp.Data, nil
 }
 
-func RunNetworkMonitorScript(req types.RequestNetworkMonitorRunScript, timeout time.Duration) (types.ResponseNetworkMonitorRunScript, error) {
+func RunNetworkMonitorScript(req types.RequestNetworkMonitorRunScript, timeout time.Duration) (_ types.ResponseNetworkMonitorRunScript, err error) {
+	defer observeAPI("RunNetworkMonitorScript", time.Now(), &err)
 	client := server.GetClient(req.ClientID)
 	if client == nil {
 		return types.ResponseNetworkMonitorRunScript{}, errors.New("client not found")
 	}
 
-	resp, err := helper.SendPostAndParse[types.KisaraResponseWrap[types.ResponseNetworkMonitorRunScript]](
-		client.GenerateClientURI(router.URI_CLIENT_NETWORK_MONITOR_SCRIPT),
-		helper.HttpTimeout(timeout.Milliseconds()),
-		helper.HttpPayloadJson(req),
+	resp, err := server.RequestClient[types.ResponseNetworkMonitorRunScript](
+		client.ClientID,
+		"POST",
+		router.URI_CLIENT_NETWORK_MONITOR_SCRIPT,
+		req,
+		timeout,
 	)
 
 	if err != nil {
@@ -0,0 +1,138 @@
+package api
+
+import (
+	"errors"
+	"time"
+
+	log "github.com/Yeuoly/kisara/src/routine/log"
+	server "github.com/Yeuoly/kisara/src/routine/synergy/server"
+	"github.com/Yeuoly/kisara/src/types"
+)
+
+// CordonNode marks a node unschedulable, workloads on it keep running
+func CordonNode(client_id string) error {
+	return server.CordonNode(client_id)
+}
+
+// UncordonNode makes a cordoned node schedulable again
+func UncordonNode(client_id string) error {
+	return server.UncordonNode(client_id)
+}
+
+/*
+	DrainNode cordons the node and moves all workloads off it, with req.Relaunch set every
+	container and service is relaunched elsewhere with its original launch request, workloads
+	which could not be relaunched are stopped, drain hooks are fired for every workload moved
+	off the node, timeout is applied to each workload
+*/
+func DrainNode(req types.RequestDrainNode, timeout time.Duration) (_ types.ResponseDrainNode, err error) {
+	defer observeAPI("DrainNode", time.Now(), &err)
+	if server.GetClient(req.ClientID) == nil {
+		return types.ResponseDrainNode{}, errors.New("client not found")
+	}
+
+	if err := server.CordonNode(req.ClientID); err != nil {
+		return types.ResponseDrainNode{}, err
+	}
+
+	resp := types.ResponseDrainNode{
+		ClientID: req.ClientID,
+		Items:    []types.DrainItem{},
+	}
+
+	// containers of services are drained with their services
+	in_service := make(map[string]bool)
+	services := server.GetNodeServices(req.ClientID)
+	for _, service := range services {
+		for _, container := range service.Containers {
+			in_service[container.Id] = true
+		}
+	}
+
+	for i := range services {
+		resp.Items = append(resp.Items, drainService(req.ClientID, &services[i], req.Relaunch, timeout))
+	}
+
+	for _, container := range server.GetNodeContainers(req.ClientID) {
+		if in_service[container.Id] {
+			continue
+		}
+		container := container
+		resp.Items = append(resp.Items, drainContainer(req.ClientID, &container, req.Relaunch, timeout))
+	}
+
+	return resp, nil
+}
+
+func drainContainer(client_id string, container *types.Container, relaunch bool, timeout time.Duration) types.DrainItem {
+	item := types.DrainItem{
+		Kind: types.DRAIN_KIND_CONTAINER,
+		Id:   container.Id,
+	}
+
+	var relaunched *types.Container
+	if launch_req, ok := server.GetContainerRequest(container.Id); relaunch && ok {
+		launch_req.ClientID = ""
+		launched, err := LaunchContainer(launch_req, timeout)
+		if err != nil {
+			log.Warn("[Kisara-API] failed to relaunch container %s: %s", container.Id, err.Error())
+			item.Error = err.Error()
+		} else {
+			relaunched = &launched.Container
+			item.NewClientID = launched.ClientID
+			item.NewId = launched.Container.Id
+		}
+	} else if relaunch {
+		item.Error = "launch request not found"
+	}
+
+	_, err := StopContainer(types.RequestStopContainer{
+		ClientID:    client_id,
+		ContainerID: container.Id,
+	}, timeout)
+	if err != nil {
+		log.Warn("[Kisara-API] failed to stop container %s: %s", container.Id, err.Error())
+		item.Error = err.Error()
+		return item
+	}
+	server.DeleteContainer(container.Id)
+
+	server.NotifyNodeDrainContainer(client_id, container, relaunched)
+	return item
+}
+
+func drainService(client_id string, service *types.Service, relaunch bool, timeout time.Duration) types.DrainItem {
+	item := types.DrainItem{
+		Kind: types.DRAIN_KIND_SERVICE,
+		Id:   service.Id,
+	}
+
+	var relaunched *types.Service
+	if launch_req, ok := server.GetServiceRequest(service.Id); relaunch && ok {
+		launch_req.ClientID = ""
+		launched, err := LaunchService(launch_req, func(string) {}, timeout)
+		if err != nil {
+			log.Warn("[Kisara-API] failed to relaunch service %s: %s", service.Id, err.Error())
+			item.Error = err.Error()
+		} else {
+			relaunched = &launched.Service
+			item.NewClientID = launched.ClientID
+			item.NewId = launched.Service.Id
+		}
+	} else if relaunch {
+		item.Error = "launch request not found"
+	}
+
+	_, err := StopService(types.RequestStopService{
+		ClientID:  client_id,
+		ServiceID: service.Id,
+	}, timeout)
+	if err != nil {
+		log.Warn("[Kisara-API] failed to stop service %s: %s", service.Id, err.Error())
+		item.Error = err.Error()
+		return item
+	}
+
+	server.NotifyNodeDrainService(client_id, service, relaunched)
+	return item
+}
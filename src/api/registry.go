@@ -0,0 +1,17 @@
+package api
+
+import (
+	"encoding/json"
+
+	"github.com/Yeuoly/kisara/src/helper"
+	"github.com/Yeuoly/kisara/src/types"
+)
+
+// sealRegistry seals the registry credential by kisara.token, so it's never sent or stored as is
+func sealRegistry(credential *types.RegistryCredential) (string, error) {
+	data, err := json.Marshal(credential)
+	if err != nil {
+		return "", err
+	}
+	return helper.SealSecret(helper.GetConfigString("kisara.token"), data)
+}
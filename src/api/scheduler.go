@@ -0,0 +1,15 @@
+package api
+
+import (
+	"github.com/Yeuoly/kisara/src/routine/synergy/server"
+)
+
+// RegisterScheduler adds a custom placement policy, it could be used by Policy of launch requests
+func RegisterScheduler(name string, scheduler server.Scheduler) {
+	server.RegisterScheduler(name, scheduler)
+}
+
+// SetDefaultScheduler sets the policy used when a launch request does not specify one
+func SetDefaultScheduler(name string) error {
+	return server.SetDefaultScheduler(name)
+}
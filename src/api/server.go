@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/Yeuoly/kisara/src/controller"
 	"github.com/Yeuoly/kisara/src/helper"
 	server_routes "github.com/Yeuoly/kisara/src/router/server"
 	log "github.com/Yeuoly/kisara/src/routine/log"
@@ -21,7 +22,9 @@ func setupConfig() {
 }
 
 func setupRouter() *gin.Engine {
-	r := gin.Default()
+	r := gin.New()
+	// requests are logged with tokens redacted
+	r.Use(controller.RequestLogger(), gin.Recovery())
 	server_routes.Setup(r)
 	return r
 }
@@ -3,6 +3,8 @@ package client
 import (
 	"github.com/Yeuoly/kisara/src/routine/docker"
 	log "github.com/Yeuoly/kisara/src/routine/log"
+	synergy_client "github.com/Yeuoly/kisara/src/routine/synergy/client"
+	"github.com/Yeuoly/kisara/src/types"
 )
 
 var after_docker_daemon_fresh = make(chan bool, 1)
@@ -17,5 +19,16 @@ func initDocker(cidr_expression string) {
 	}
 	log.Info("[Kisara] CIDR pool initialized: get %d CIDRs", cidrs)
 
+	// tell server which images are refreshed
+	docker.SetImageRefreshHandler(func(result types.ImageRefreshResult) {
+		if err := synergy_client.PushEvent(types.CHANNEL_EVENT_IMAGE_REFRESHED, result); err != nil {
+			log.Warn("[Kisara] Failed to push %s event: %s", types.CHANNEL_EVENT_IMAGE_REFRESHED, err.Error())
+		}
+	})
+
+	// images which could not be pulled are copied from nodes server knows to have them
+	docker.SetImagePeerResolver(synergy_client.GetImagePeers)
+	docker.SetImagePeerRelay(synergy_client.GetImageRelay)
+
 	after_docker_daemon_fresh <- true
 }
@@ -0,0 +1,87 @@
+package client
+
+import (
+	"runtime"
+	"time"
+
+	"github.com/Yeuoly/kisara/src/helper"
+	"github.com/Yeuoly/kisara/src/routine/docker"
+	"github.com/Yeuoly/kisara/src/routine/history"
+	log "github.com/Yeuoly/kisara/src/routine/log"
+	"github.com/Yeuoly/kisara/src/types"
+)
+
+/*
+	launchResourceHistory samples usages of this node and its containers every
+	kisaraClient.history_interval seconds and keeps them for kisaraClient.history_retention seconds,
+	monitors run every 30 seconds at most, so it has a ticker of its own
+*/
+func launchResourceHistory() {
+	history.Init(
+		helper.GetConfigInt64("kisaraClient.history_interval"),
+		helper.GetConfigInt64("kisaraClient.history_retention"),
+	)
+
+	go func() {
+		ticker := time.NewTicker(time.Duration(history.Interval()) * time.Second)
+		defer ticker.Stop()
+		for now := range ticker.C {
+			sampleResourceHistory(now)
+			history.Expire(now)
+		}
+	}()
+}
+
+func sampleResourceHistory(now time.Time) {
+	var counters history.Counters
+
+	cpu_usage, err := helper.GetCPUUsageTotal()
+	if err != nil {
+		log.Warn("[Kisara] Failed to get CPU usage: %s", err.Error())
+	}
+	_, _, mem_usage, err := helper.GetMemUsage()
+	if err != nil {
+		log.Warn("[Kisara] Failed to get memory usage: %s", err.Error())
+	}
+	counters.NetRx, counters.NetTx, err = helper.GetNetUsage()
+	if err != nil {
+		log.Warn("[Kisara] Failed to get network usage: %s", err.Error())
+	}
+	counters.BlkRead, counters.BlkWrite, err = helper.GetDiskIO()
+	if err != nil {
+		log.Warn("[Kisara] Failed to get disk I/O: %s", err.Error())
+	}
+	history.RecordNode(now, cpu_usage, mem_usage, counters)
+
+	docker := docker.NewDocker()
+	if docker == nil {
+		return
+	}
+	usages, err := docker.ListContainerUsages()
+	if err != nil {
+		log.Warn("[Kisara] Failed to get container usages: %s", err.Error())
+		return
+	}
+
+	cpus := float64(runtime.NumCPU())
+	for _, usage := range usages {
+		history.RecordContainer(
+			now,
+			types.ResourceSeries{
+				ContainerID: usage.ContainerId,
+				Image:       usage.Image,
+				Owner:       usage.Owner,
+				Module:      usage.Module,
+			},
+			// docker counts 100 for each cpu, history counts 100 for the node
+			usage.CPUUsage/cpus,
+			usage.MemUsage,
+			history.Counters{
+				NetRx:    usage.NetRx,
+				NetTx:    usage.NetTx,
+				BlkRead:  usage.BlkRead,
+				BlkWrite: usage.BlkWrite,
+			},
+		)
+	}
+}
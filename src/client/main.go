@@ -3,6 +3,7 @@ package client
 import (
 	"fmt"
 
+	"github.com/Yeuoly/kisara/src/controller"
 	"github.com/Yeuoly/kisara/src/helper"
 	"github.com/Yeuoly/kisara/src/router/client"
 	log "github.com/Yeuoly/kisara/src/routine/log"
@@ -11,7 +12,9 @@ import (
 )
 
 func setupRouter() *gin.Engine {
-	r := gin.Default()
+	// ?token= of /metrics is redacted from request logs
+	r := gin.New()
+	r.Use(controller.RequestLogger(), gin.Recovery())
 	client.Setup(r)
 	return r
 }
@@ -27,6 +30,10 @@ func Main() {
 	}
 
 	initDocker(cidr_expression)
+	launchReaper()
+	launchImageGC()
+	registerMetrics()
+	launchResourceHistory()
 
 	if helper.GetConfigString("kisara.mode") == "dev" {
 		gin.SetMode(gin.DebugMode)
@@ -34,6 +41,7 @@ func Main() {
 		gin.SetMode(gin.ReleaseMode)
 	}
 	// start client
+	client.SetupChannel()
 	synergy_client.Client()
 
 	r := setupRouter()
@@ -0,0 +1,87 @@
+package client
+
+import (
+	"github.com/Yeuoly/kisara/src/helper"
+	"github.com/Yeuoly/kisara/src/routine/docker"
+	log "github.com/Yeuoly/kisara/src/routine/log"
+	"github.com/Yeuoly/kisara/src/routine/metrics"
+	synergy_client "github.com/Yeuoly/kisara/src/routine/synergy/client"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	client_info_desc = prometheus.NewDesc("kisara_client_info", "Client id of this node", []string{"client_id"}, nil)
+
+	cpu_usage_desc     = prometheus.NewDesc("kisara_client_cpu_usage_percent", "CPU usage of this node", nil, nil)
+	memory_used_desc   = prometheus.NewDesc("kisara_client_memory_used_bytes", "Memory used on this node", nil, nil)
+	memory_total_desc  = prometheus.NewDesc("kisara_client_memory_total_bytes", "Memory of this node", nil, nil)
+	disk_used_desc     = prometheus.NewDesc("kisara_client_disk_used_bytes", "Disk used on this node", nil, nil)
+	disk_total_desc    = prometheus.NewDesc("kisara_client_disk_total_bytes", "Disk of this node", nil, nil)
+	network_recv_desc  = prometheus.NewDesc("kisara_client_network_receive_bytes_total", "Bytes received by all interfaces of this node", nil, nil)
+	network_sent_desc  = prometheus.NewDesc("kisara_client_network_transmit_bytes_total", "Bytes sent by all interfaces of this node", nil, nil)
+	containers_desc    = prometheus.NewDesc("kisara_client_containers", "Running containers launched by kisara on this node", nil, nil)
+	container_labels   = []string{"container_id", "owner_uid", "module", "image"}
+	container_cpu_desc = prometheus.NewDesc(
+		"kisara_client_container_cpu_usage_percent", "CPU usage of the container, 100 for each cpu", container_labels, nil,
+	)
+	container_memory_used_desc = prometheus.NewDesc(
+		"kisara_client_container_memory_used_bytes", "Memory used by the container", container_labels, nil,
+	)
+	container_memory_limit_desc = prometheus.NewDesc(
+		"kisara_client_container_memory_limit_bytes", "Memory limit of the container", container_labels, nil,
+	)
+)
+
+// registerMetrics exports usages of this node and its containers on /metrics
+func registerMetrics() {
+	metrics.RegisterCollector(
+		collectNodeMetrics,
+		client_info_desc, cpu_usage_desc, memory_used_desc, memory_total_desc,
+		disk_used_desc, disk_total_desc, network_recv_desc, network_sent_desc,
+	)
+	metrics.RegisterCollector(
+		collectContainerMetrics,
+		containers_desc, container_cpu_desc, container_memory_used_desc, container_memory_limit_desc,
+	)
+}
+
+func collectNodeMetrics(ch chan<- prometheus.Metric) {
+	metrics.Gauge(ch, client_info_desc, 1, synergy_client.GetClientId())
+
+	if cpu_usage, err := helper.GetCPUUsageTotal(); err == nil {
+		metrics.Gauge(ch, cpu_usage_desc, cpu_usage)
+	}
+	if _, total, used, err := helper.GetMemUsage(); err == nil {
+		metrics.Gauge(ch, memory_used_desc, float64(used))
+		metrics.Gauge(ch, memory_total_desc, float64(total))
+	}
+	if _, total, used, err := helper.GetDiskUsage(); err == nil {
+		metrics.Gauge(ch, disk_used_desc, float64(used))
+		metrics.Gauge(ch, disk_total_desc, float64(total))
+	}
+	if recv, sent, err := helper.GetNetUsage(); err == nil {
+		metrics.Counter(ch, network_recv_desc, float64(recv))
+		metrics.Counter(ch, network_sent_desc, float64(sent))
+	}
+}
+
+func collectContainerMetrics(ch chan<- prometheus.Metric) {
+	docker := docker.NewDocker()
+	if docker == nil {
+		return
+	}
+
+	usages, err := docker.ListContainerUsages()
+	if err != nil {
+		log.Warn("[Kisara] Failed to collect container metrics: %s", err.Error())
+		return
+	}
+	metrics.Gauge(ch, containers_desc, float64(len(usages)))
+
+	for _, usage := range usages {
+		labels := []string{usage.ContainerId, usage.Owner, usage.Module, usage.Image}
+		metrics.Gauge(ch, container_cpu_desc, usage.CPUUsage, labels...)
+		metrics.Gauge(ch, container_memory_used_desc, float64(usage.MemUsage), labels...)
+		metrics.Gauge(ch, container_memory_limit_desc, float64(usage.MemLimit), labels...)
+	}
+}
@@ -0,0 +1,62 @@
+package client
+
+import (
+	"github.com/Yeuoly/kisara/src/routine/docker"
+	log "github.com/Yeuoly/kisara/src/routine/log"
+	routine_monitor "github.com/Yeuoly/kisara/src/routine/monitor"
+	synergy_client "github.com/Yeuoly/kisara/src/routine/synergy/client"
+	"github.com/Yeuoly/kisara/src/types"
+)
+
+// launchReaper stops expired containers and services every 30 seconds and tells server about them
+// logs of removed containers kept longer than retention are purged as well
+func launchReaper() {
+	reaper := routine_monitor.Monitor{
+		Type:            routine_monitor.MONITOR_KISARA_REAPER,
+		RefreshInterval: 30,
+		Name:            "expired container reaper",
+		RefreshHandler: func(i interface{}) {
+			docker := docker.NewDocker()
+			if docker == nil {
+				return
+			}
+			docker.ReapExpired(func(container types.Container) {
+				pushExpired(types.CHANNEL_EVENT_CONTAINER_EXPIRED, container)
+			}, func(service types.Service) {
+				pushExpired(types.CHANNEL_EVENT_SERVICE_EXPIRED, service)
+			})
+			if err := docker.PurgeContainerLogs(); err != nil {
+				log.Warn("[Kisara] Failed to purge container logs: %s", err.Error())
+			}
+		},
+		InitHandler: func(i interface{}) {},
+	}
+	routine_monitor.AppendMonitor(&reaper)
+}
+
+// launchImageGC removes unused images by the gc rules of this node periodically
+func launchImageGC() {
+	gc := routine_monitor.Monitor{
+		Type:            routine_monitor.MONITOR_KISARA_IMAGE_GC,
+		RefreshInterval: docker.ImageGCInterval(),
+		Name:            "image garbage collector",
+		RefreshHandler: func(i interface{}) {
+			docker := docker.NewDocker()
+			if docker == nil {
+				return
+			}
+			if _, err := docker.PruneImages(false); err != nil {
+				log.Warn("[Kisara] Failed to collect images: %s", err.Error())
+			}
+		},
+		InitHandler: func(i interface{}) {},
+	}
+	routine_monitor.AppendMonitor(&gc)
+}
+
+func pushExpired(event string, payload interface{}) {
+	// server finds it out when reconciling if channel is not connected
+	if err := synergy_client.PushEvent(event, payload); err != nil {
+		log.Warn("[Kisara] Failed to push %s event: %s", event, err.Error())
+	}
+}
@@ -53,12 +53,31 @@ func attachTakinaHook() {
 				log.Error("[Kisara] Failed to connect Takina container to network: " + err.Error())
 			}
 		}
+		// proxies of recovered services were lost when Takina restarted
+		d.RestoreServiceProxies()
 	})
 
 	docker.AddBeforeNetworkRemoveHook(func(c *docker.Docker, network kisara_types.Network) error {
+		// networks left by last run are not joined by current takina container
+		inspect, err := c.Client.NetworkInspect(*c.Ctx, network.Id, types.NetworkInspectOptions{})
+		if err != nil {
+			log.Error("[Kisara] Failed to inspect network: " + err.Error())
+			return err
+		}
+		joined := false
+		for id, container := range inspect.Containers {
+			if id == takina_container_id || container.Name == "takina" {
+				joined = true
+				break
+			}
+		}
+		if !joined {
+			return nil
+		}
+
 		// remove takina container from network
 		log.Info("[Kisara] Disconnecting Takina container from network %s", network.Name)
-		err := c.DisconnectContainerFromNetwork(takina_container_id, network.Id)
+		err = c.DisconnectContainerFromNetwork(takina_container_id, network.Id)
 		if err != nil {
 			log.Error("[Kisara] Failed to disconnect Takina container from network: " + err.Error())
 			return err
@@ -0,0 +1,234 @@
+package controller
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Yeuoly/kisara/src/helper"
+	log "github.com/Yeuoly/kisara/src/routine/log"
+	"github.com/Yeuoly/kisara/src/types"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// requests whose timestamp differs from local time more than this are rejected
+	SIGNATURE_TIME_WINDOW = 90
+	// default max size of a request body, kisara.max_body_size overrides it
+	MAX_BODY_SIZE = 1024 * 1024 * 1024
+	// bodies larger than this are spooled to a temporary file while being hashed
+	MEMORY_BODY_SIZE = 1024 * 1024
+)
+
+var (
+	used_nonces      = make(map[string]int64)
+	used_nonces_lock sync.Mutex
+	last_nonce_purge int64
+	body_limits      sync.Map
+)
+
+// SetBodyLimit sets the max body size of a route, requests beyond it are rejected before they're read
+func SetBodyLimit(uri string, limit func() int64) {
+	body_limits.Store(uri, limit)
+}
+
+func maxBodySize(uri string) int64 {
+	if limit, ok := body_limits.Load(uri); ok {
+		return limit.(func() int64)()
+	}
+	if size := helper.GetConfigInt64("kisara.max_body_size"); size > 0 {
+		return size
+	}
+	return MAX_BODY_SIZE
+}
+
+/*
+	readBody hashes body while reading it, bodies larger than MEMORY_BODY_SIZE are spooled to a
+	temporary file instead of memory, cleanup closes and removes the file
+*/
+func readBody(body io.Reader) ([]byte, io.ReadCloser, func(), error) {
+	hasher := sha256.New()
+	reader := io.TeeReader(body, hasher)
+
+	head, err := ioutil.ReadAll(io.LimitReader(reader, MEMORY_BODY_SIZE+1))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if len(head) <= MEMORY_BODY_SIZE {
+		return hasher.Sum(nil), ioutil.NopCloser(bytes.NewReader(head)), func() {}, nil
+	}
+
+	spool, err := os.CreateTemp("", "kisara-body-*")
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	cleanup := func() {
+		spool.Close()
+		os.Remove(spool.Name())
+	}
+	if _, err := spool.Write(head); err != nil {
+		cleanup()
+		return nil, nil, nil, err
+	}
+	if _, err := io.Copy(spool, reader); err != nil {
+		cleanup()
+		return nil, nil, nil, err
+	}
+	if _, err := spool.Seek(0, io.SeekStart); err != nil {
+		cleanup()
+		return nil, nil, nil, err
+	}
+	return hasher.Sum(nil), ioutil.NopCloser(spool), cleanup, nil
+}
+
+// useNonce returns false if nonce has been used within the time window
+func useNonce(nonce string, now int64) bool {
+	used_nonces_lock.Lock()
+	defer used_nonces_lock.Unlock()
+
+	// nonces older than twice of window can not pass the timestamp check anymore
+	if now-last_nonce_purge > SIGNATURE_TIME_WINDOW {
+		for k, v := range used_nonces {
+			if now-v > SIGNATURE_TIME_WINDOW*2 {
+				delete(used_nonces, k)
+			}
+		}
+		last_nonce_purge = now
+	}
+
+	if _, ok := used_nonces[nonce]; ok {
+		return false
+	}
+	used_nonces[nonce] = now
+	return true
+}
+
+/*
+	SignatureMiddleware rejects every request which is not signed by kisara.token,
+	replayed requests are rejected by both timestamp window and nonce, bodies larger
+	than the limit of the route are rejected before they're hashed
+*/
+func SignatureMiddleware() gin.HandlerFunc {
+	token := helper.GetConfigString("kisara.token")
+	if token == "" {
+		log.Panic("[Auth] kisara.token is not set, refuse to serve without authentication")
+	}
+
+	reject := func(r *gin.Context, message string) {
+		log.Warn("[Auth] reject request %s %s from %s: %s", r.Request.Method, r.Request.URL.Path, r.ClientIP(), message)
+		r.AbortWithStatusJSON(401, types.ErrorResponse(-401, message))
+	}
+
+	return func(r *gin.Context) {
+		signature := r.GetHeader(helper.HEADER_KISARA_SIGNATURE)
+		nonce := r.GetHeader(helper.HEADER_KISARA_NONCE)
+		timestamp, err := strconv.ParseInt(r.GetHeader(helper.HEADER_KISARA_TIMESTAMP), 10, 64)
+		if signature == "" || nonce == "" || err != nil {
+			reject(r, "missing signature")
+			return
+		}
+
+		now := time.Now().Unix()
+		if timestamp > now+SIGNATURE_TIME_WINDOW || timestamp < now-SIGNATURE_TIME_WINDOW {
+			reject(r, "request expired")
+			return
+		}
+
+		empty_hash := sha256.Sum256(nil)
+		body_hash := empty_hash[:]
+		if r.Request.Body != nil {
+			limit := maxBodySize(r.FullPath())
+			if r.Request.ContentLength > limit {
+				r.AbortWithStatusJSON(413, types.ErrorResponse(-413, "request body too large"))
+				return
+			}
+
+			hash, body, cleanup, err := readBody(http.MaxBytesReader(r.Writer, r.Request.Body, limit))
+			if err != nil {
+				r.AbortWithStatusJSON(413, types.ErrorResponse(-413, "failed to read body: "+err.Error()))
+				return
+			}
+			defer cleanup()
+			body_hash = hash
+			r.Request.Body = body
+		}
+
+		if !helper.VerifyRequestSignatureHash(token, r.Request.Method, r.Request.URL.RequestURI(), timestamp, nonce, body_hash, signature) {
+			reject(r, "invalid signature")
+			return
+		}
+
+		// nonce is recorded only after the signature was verified, otherwise anyone could burn nonces
+		if !useNonce(nonce, now) {
+			reject(r, "replayed request")
+			return
+		}
+
+		r.Next()
+	}
+}
+
+// CheckBearerToken reports whether request carries token as "Authorization: Bearer <token>" or ?token=
+func CheckBearerToken(r *gin.Context, token string) bool {
+	if token == "" {
+		return false
+	}
+	if subtle.ConstantTimeCompare([]byte(r.GetHeader("Authorization")), []byte("Bearer "+token)) == 1 {
+		return true
+	}
+	return subtle.ConstantTimeCompare([]byte(r.Query("token")), []byte(token)) == 1
+}
+
+/*
+	TokenOrSignatureMiddleware accepts requests carrying the token configured by key, for clients
+	like browsers which are not able to sign requests, others should be signed by kisara.token,
+	requests are always signed if the token is empty
+*/
+func TokenOrSignatureMiddleware(key string) gin.HandlerFunc {
+	signature := SignatureMiddleware()
+	return func(r *gin.Context) {
+		if CheckBearerToken(r, helper.GetConfigString(key)) {
+			r.Next()
+			return
+		}
+		signature(r)
+	}
+}
+
+// RequestLogger logs requests like gin.Logger, ?token= is redacted so that tokens never reach logs
+func RequestLogger() gin.HandlerFunc {
+	return gin.LoggerWithFormatter(func(params gin.LogFormatterParams) string {
+		return fmt.Sprintf("[GIN] %v | %3d | %13v | %15s | %-7s %#v\n%s",
+			params.TimeStamp.Format("2006/01/02 - 15:04:05"),
+			params.StatusCode,
+			params.Latency,
+			params.ClientIP,
+			params.Method,
+			redactQuery(params.Path),
+			params.ErrorMessage,
+		)
+	})
+}
+
+func redactQuery(path string) string {
+	u, err := url.Parse(path)
+	if err != nil {
+		return path
+	}
+	query := u.Query()
+	if _, ok := query["token"]; !ok {
+		return path
+	}
+	query.Set("token", "REDACTED")
+	u.RawQuery = query.Encode()
+	return u.String()
+}
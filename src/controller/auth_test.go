@@ -0,0 +1,165 @@
+package controller
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Yeuoly/kisara/src/helper"
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+)
+
+const test_token = "kisara-test-token"
+
+func newSignedEngine() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	viper.Set("kisara.token", test_token)
+	eng := gin.New()
+	eng.Use(SignatureMiddleware())
+	eng.POST("/echo", func(r *gin.Context) {
+		body := new(bytes.Buffer)
+		body.ReadFrom(r.Request.Body)
+		r.String(200, body.String())
+	})
+	eng.POST("/limited", func(r *gin.Context) {
+		r.String(200, "ok")
+	})
+	SetBodyLimit("/limited", func() int64 { return 16 })
+	return eng
+}
+
+func signedRequest(uri string, body []byte, timestamp int64, nonce string) *http.Request {
+	req := httptest.NewRequest("POST", uri, bytes.NewReader(body))
+	req.Header.Set(helper.HEADER_KISARA_TIMESTAMP, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(helper.HEADER_KISARA_NONCE, nonce)
+	req.Header.Set(helper.HEADER_KISARA_SIGNATURE, helper.SignRequest(test_token, "POST", uri, timestamp, nonce, body))
+	return req
+}
+
+func TestSignatureMiddleware(t *testing.T) {
+	eng := newSignedEngine()
+	now := time.Now().Unix()
+	large := bytes.Repeat([]byte("k"), MEMORY_BODY_SIZE*2)
+
+	tampered := signedRequest("/echo", []byte("body"), now, "tampered")
+	tampered.Body = httptest.NewRequest("POST", "/echo", strings.NewReader("evil")).Body
+
+	unsigned := httptest.NewRequest("POST", "/echo", strings.NewReader("body"))
+
+	cases := []struct {
+		name   string
+		req    *http.Request
+		status int
+		body   []byte
+	}{
+		{"valid", signedRequest("/echo", []byte("body"), now, "valid"), 200, []byte("body")},
+		{"valid spooled", signedRequest("/echo", large, now, "spooled"), 200, large},
+		{"unsigned", unsigned, 401, nil},
+		{"tampered body", tampered, 401, nil},
+		{"expired", signedRequest("/echo", []byte("body"), now-SIGNATURE_TIME_WINDOW-10, "expired"), 401, nil},
+		{"future", signedRequest("/echo", []byte("body"), now+SIGNATURE_TIME_WINDOW+10, "future"), 401, nil},
+		{"replayed", signedRequest("/echo", []byte("body"), now, "valid"), 401, nil},
+		{"within limit", signedRequest("/limited", []byte("small"), now, "small"), 200, nil},
+		{"over limit", signedRequest("/limited", large, now, "large"), 413, nil},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			eng.ServeHTTP(recorder, c.req)
+			if recorder.Code != c.status {
+				t.Fatalf("expected status %d, got %d: %s", c.status, recorder.Code, recorder.Body.String())
+			}
+			if c.body != nil && !bytes.Equal(recorder.Body.Bytes(), c.body) {
+				t.Errorf("body is not passed to handler intact")
+			}
+		})
+	}
+}
+
+func TestUseNonce(t *testing.T) {
+	now := time.Now().Unix()
+	if !useNonce("nonce-a", now) {
+		t.Fatalf("fresh nonce is rejected")
+	}
+	if useNonce("nonce-a", now+1) {
+		t.Errorf("replayed nonce is accepted")
+	}
+	if !useNonce("nonce-b", now) {
+		t.Errorf("another nonce is rejected")
+	}
+
+	// nonces out of twice of the window are purged, their timestamps can not pass anymore
+	later := now + SIGNATURE_TIME_WINDOW*3
+	if !useNonce("nonce-c", later) {
+		t.Fatalf("fresh nonce is rejected")
+	}
+	used_nonces_lock.Lock()
+	_, kept := used_nonces["nonce-a"]
+	used_nonces_lock.Unlock()
+	if kept {
+		t.Errorf("expired nonce is not purged")
+	}
+}
+
+func TestTokenOrSignatureMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	viper.Set("kisara.token", test_token)
+	eng := gin.New()
+	eng.GET("/events", TokenOrSignatureMiddleware("kisara.events_token"), func(r *gin.Context) {
+		r.String(200, "ok")
+	})
+
+	signed := httptest.NewRequest("GET", "/events", nil)
+	for k, v := range helper.SignedHeaders(test_token, "GET", "/events", []byte{}) {
+		signed.Header.Set(k, v)
+	}
+	bearer := httptest.NewRequest("GET", "/events", nil)
+	bearer.Header.Set("Authorization", "Bearer events")
+	wrong_bearer := httptest.NewRequest("GET", "/events", nil)
+	wrong_bearer.Header.Set("Authorization", "Bearer wrong")
+
+	cases := []struct {
+		name         string
+		events_token string
+		req          *http.Request
+		status       int
+	}{
+		{"signed", "events", signed, 200},
+		{"bearer", "events", bearer, 200},
+		{"query", "events", httptest.NewRequest("GET", "/events?token=events", nil), 200},
+		{"wrong bearer", "events", wrong_bearer, 401},
+		{"wrong query", "events", httptest.NewRequest("GET", "/events?token=wrong", nil), 401},
+		{"empty token", "", httptest.NewRequest("GET", "/events?token=", nil), 401},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			viper.Set("kisara.events_token", c.events_token)
+			recorder := httptest.NewRecorder()
+			eng.ServeHTTP(recorder, c.req)
+			if recorder.Code != c.status {
+				t.Errorf("expected status %d, got %d", c.status, recorder.Code)
+			}
+		})
+	}
+}
+
+func TestRedactQuery(t *testing.T) {
+	cases := map[string]string{
+		"/events":                         "/events",
+		"/events?types=node":              "/events?types=node",
+		"/events?token=secret":            "/events?token=REDACTED",
+		"/events?token=secret&types=node": "/events?token=REDACTED&types=node",
+	}
+	for path, expected := range cases {
+		if got := redactQuery(path); got != expected {
+			t.Errorf("redactQuery(%q) = %q, expected %q", path, got, expected)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package client
+
+import (
+	"bytes"
+
+	"github.com/Yeuoly/kisara/src/controller"
+	docker "github.com/Yeuoly/kisara/src/routine/docker"
+	log "github.com/Yeuoly/kisara/src/routine/log"
+	"github.com/Yeuoly/kisara/src/types"
+)
+
+/*
+	handlers of long-running operations requested from control channel, they run synchronously
+	and stream progress, the final response has the same format as the check api with finished set
+*/
+
+func ChannelLaunchContainer(payload []byte, progress func(string)) types.KisaraResponse {
+	return controller.BindChannelRequest(payload, func(rc types.RequestLaunchContainer) types.KisaraResponse {
+		return checkClientKey(rc.ClientID, func() types.KisaraResponse {
+			container, err := launchContainer(docker.NewDocker(), rc)
+			if err != nil {
+				return types.ErrorResponse(-500, err.Error())
+			}
+			if container == nil {
+				return types.ErrorResponse(-500, "An unexpected error occurred, container is nil")
+			}
+			return types.SuccessResponse(types.ResponseCheckLaunchStatus{
+				ClientID:  rc.ClientID,
+				Container: *container,
+				Finished:  true,
+			})
+		})
+	})
+}
+
+func ChannelPullImage(payload []byte, progress func(string)) types.KisaraResponse {
+	return controller.BindChannelRequest(payload, func(rc types.RequestPullImage) types.KisaraResponse {
+		return checkClientKey(rc.ClientID, func() types.KisaraResponse {
+			log.Info("[PullImage] Pulling image %s", rc.ImageName)
+			registry, err := openRegistry(rc.RegistryAuth)
+			if err != nil {
+				return types.ErrorResponse(-500, err.Error())
+			}
+			docker := docker.NewDocker()
+			image, err := docker.PullImage(rc.ImageName, registry, func(message string) {
+				log.Info("[PullImage] %s", message)
+				progress(message)
+			})
+			if err != nil {
+				return types.ErrorResponse(-500, err.Error())
+			}
+			if image == nil {
+				return types.ErrorResponse(-500, "An unexpected error occurred, image is nil")
+			}
+			return types.SuccessResponse(types.ResponseCheckPullImage{
+				ClientID: rc.ClientID,
+				Finished: true,
+			})
+		})
+	})
+}
+
+func ChannelLaunchService(payload []byte, progress func(string)) types.KisaraResponse {
+	return controller.BindChannelRequest(payload, func(rc types.RequestLaunchService) types.KisaraResponse {
+		return checkClientKey(rc.ClientID, func() types.KisaraResponse {
+			resp := types.ResponseCheckLaunchService{}
+			resp.ClientID = rc.ClientID
+			resp.Finished = true
+			docker := docker.NewDocker()
+			service, err := launchService(docker, rc, progress)
+			if err != nil {
+				resp.Error = err.Error()
+			} else {
+				resp.Service = *service
+			}
+			return types.SuccessResponse(resp)
+		})
+	})
+}
+
+func ChannelStopService(payload []byte, progress func(string)) types.KisaraResponse {
+	return controller.BindChannelRequest(payload, func(rc types.RequestStopService) types.KisaraResponse {
+		return checkClientKey(rc.ClientID, func() types.KisaraResponse {
+			resp := types.ResponseCheckStopService{}
+			resp.ClientID = rc.ClientID
+			resp.Finished = true
+			docker := docker.NewDocker()
+			if err := docker.DeleteService(rc.ServiceID); err != nil {
+				resp.Error = err.Error()
+			}
+			return types.SuccessResponse(resp)
+		})
+	})
+}
+
+func ChannelNetworkMonitorRun(payload []byte, progress func(string)) types.KisaraResponse {
+	return controller.BindChannelRequest(payload, func(rc types.RequestNetworkMonitorRunChannel) types.KisaraResponse {
+		return checkClientKey(rc.ClientID, func() types.KisaraResponse {
+			resp := types.ResponseNetworkMonitorCheck{}
+			resp.ClientID = rc.ClientID
+			resp.Finished = true
+			docker := docker.NewDocker()
+			container, err := docker.RunNetworkMonitor(rc.NetworkName, bytes.NewReader(rc.Context), progress)
+			if err != nil {
+				resp.Error = err.Error()
+			} else {
+				resp.NetworkMonitorContainerId = container.ContainerId
+			}
+			return types.SuccessResponse(resp)
+		})
+	})
+}
@@ -0,0 +1,185 @@
+package client
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/Yeuoly/kisara/src/controller"
+	docker "github.com/Yeuoly/kisara/src/routine/docker"
+	log "github.com/Yeuoly/kisara/src/routine/log"
+	"github.com/Yeuoly/kisara/src/types"
+	"github.com/gin-gonic/gin"
+)
+
+// fields and headers of the multipart form around the archive
+const COPY_FORM_OVERHEAD = 1024 * 1024
+
+// CopyToContainerBodyLimit returns the max size of a request of HandleCopyToContainer
+func CopyToContainerBodyLimit() int64 {
+	return docker.CopyMaxSize() + COPY_FORM_OVERHEAD
+}
+
+// HandleCopyToContainer extracts the tar archive uploaded as a multipart file into the container
+func HandleCopyToContainer(r *gin.Context) {
+	// the form is read while binding, a body beyond the limit fails it instead of filling the disk
+	r.Request.Body = http.MaxBytesReader(r.Writer, r.Request.Body, CopyToContainerBodyLimit())
+	controller.BindRequest(r, func(rc types.RequestCopyToContainer) {
+		r.JSON(200, checkClientKey(rc.ClientID, func() types.KisaraResponse {
+			file, err := r.FormFile("file")
+			if err != nil {
+				return types.ErrorResponse(-400, "archive is required")
+			}
+			if file.Size > docker.CopyMaxSize() {
+				return types.ErrorResponse(-400, docker.ErrCopyTooLarge.Error())
+			}
+
+			reader, err := file.Open()
+			if err != nil {
+				return types.ErrorResponse(-500, err.Error())
+			}
+			defer reader.Close()
+
+			err = docker.NewDocker().CopyToContainer(rc.ContainerID, rc.Path, reader, file.Size)
+			if err != nil {
+				return types.ErrorResponse(-500, err.Error())
+			}
+
+			log.Info("[CopyToContainer] %d bytes copied to %s:%s", file.Size, rc.ContainerID, rc.Path)
+			return types.SuccessResponse(types.ResponseCopyToContainer{
+				ClientID:    rc.ClientID,
+				ContainerID: rc.ContainerID,
+				Path:        rc.Path,
+				Size:        file.Size,
+			})
+		}))
+	})
+}
+
+// ChannelCopyToContainer is HandleCopyToContainer through channel, the archive comes as chunks of stream
+func ChannelCopyToContainer(payload []byte, stream *types.ChannelStream) {
+	var rc types.RequestCopyToContainer
+	if err := json.Unmarshal(payload, &rc); err != nil {
+		stream.Finish(err)
+		return
+	}
+	if !checkChannelClientKey(stream, rc.ClientID) {
+		return
+	}
+
+	// the archive is validated before it's extracted, so it's spooled to a temporary file
+	spool, err := os.CreateTemp("", "kisara-copy-*.tar")
+	if err != nil {
+		stream.Finish(err)
+		return
+	}
+	defer os.Remove(spool.Name())
+	defer spool.Close()
+
+	// one byte beyond the limit tells the archive is too large
+	size, err := io.Copy(spool, io.LimitReader(stream.Reader(), docker.CopyMaxSize()+1))
+	if err != nil {
+		stream.Finish(err)
+		return
+	}
+	if size > docker.CopyMaxSize() {
+		stream.Finish(docker.ErrCopyTooLarge)
+		return
+	}
+	if _, err := spool.Seek(0, io.SeekStart); err != nil {
+		stream.Finish(err)
+		return
+	}
+
+	err = docker.NewDocker().CopyToContainer(rc.ContainerID, rc.Path, spool, size)
+	if err == nil {
+		log.Info("[CopyToContainer] %d bytes copied to %s:%s", size, rc.ContainerID, rc.Path)
+	}
+	stream.Finish(err)
+}
+
+/*
+	spoolCopyFromContainer writes path in the container to a temporary file, so an archive exceeding
+	the size limit fails before anything is sent, the caller should close and remove the file
+*/
+func spoolCopyFromContainer(rc types.RequestCopyFromContainer) (*os.File, int64, error) {
+	reader, err := docker.NewDocker().CopyFromContainer(rc.ContainerID, rc.Path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer reader.Close()
+
+	spool, err := os.CreateTemp("", "kisara-copy-*.tar")
+	if err != nil {
+		return nil, 0, err
+	}
+
+	size, err := io.Copy(spool, reader)
+	if err == nil {
+		_, err = spool.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		spool.Close()
+		os.Remove(spool.Name())
+		return nil, 0, err
+	}
+	return spool, size, nil
+}
+
+/*
+	HandleCopyFromContainer streams path in the container as a tar archive, the archive is spooled
+	to a temporary file first, so an archive exceeding the size limit is answered in json instead of
+	being cut in the middle, and the size of the archive is known to the receiver
+*/
+func HandleCopyFromContainer(r *gin.Context) {
+	controller.BindRequest(r, func(rc types.RequestCopyFromContainer) {
+		if !checkStreamClientKey(r, rc.ClientID) {
+			return
+		}
+
+		spool, size, err := spoolCopyFromContainer(rc)
+		if err != nil {
+			r.JSON(200, types.ErrorResponse(-500, err.Error()))
+			return
+		}
+		defer os.Remove(spool.Name())
+		defer spool.Close()
+
+		log.Info("[CopyFromContainer] Sending %d bytes of %s:%s", size, rc.ContainerID, rc.Path)
+		r.Header("Content-Length", strconv.FormatInt(size, 10))
+		r.Header("Content-Type", "application/x-tar")
+		r.Status(200)
+		if _, err := io.Copy(r.Writer, spool); err != nil {
+			log.Warn("[CopyFromContainer] Sending %s:%s failed: %s", rc.ContainerID, rc.Path, err.Error())
+		}
+	})
+}
+
+// ChannelCopyFromContainer is HandleCopyFromContainer through channel, the archive is sent as chunks of stream
+func ChannelCopyFromContainer(payload []byte, stream *types.ChannelStream) {
+	var rc types.RequestCopyFromContainer
+	if err := json.Unmarshal(payload, &rc); err != nil {
+		stream.Finish(err)
+		return
+	}
+	if !checkChannelClientKey(stream, rc.ClientID) {
+		return
+	}
+
+	spool, size, err := spoolCopyFromContainer(rc)
+	if err != nil {
+		stream.Finish(err)
+		return
+	}
+	defer os.Remove(spool.Name())
+	defer spool.Close()
+
+	log.Info("[CopyFromContainer] Sending %d bytes of %s:%s through channel", size, rc.ContainerID, rc.Path)
+	_, err = io.Copy(stream.Writer(""), spool)
+	if err != nil {
+		log.Warn("[CopyFromContainer] Sending %s:%s failed: %s", rc.ContainerID, rc.Path, err.Error())
+	}
+	stream.Finish(err)
+}
@@ -2,8 +2,13 @@ package client
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
 
 	"github.com/Yeuoly/kisara/src/controller"
+	"github.com/Yeuoly/kisara/src/helper"
 	docker "github.com/Yeuoly/kisara/src/routine/docker"
 	log "github.com/Yeuoly/kisara/src/routine/log"
 	request "github.com/Yeuoly/kisara/src/routine/request"
@@ -19,6 +24,30 @@ func checkClientKey(client_id string, success func() types.KisaraResponse) types
 	return types.ErrorResponse(-403, "Access Deind")
 }
 
+// checkStreamClientKey answers the error of checkClientKey in json for handlers streaming their responses, false if it fails
+func checkStreamClientKey(r *gin.Context, client_id string) bool {
+	resp := checkClientKey(client_id, func() types.KisaraResponse {
+		return types.SuccessResponse(nil)
+	})
+	if resp.Code != 0 {
+		r.JSON(200, resp)
+		return false
+	}
+	return true
+}
+
+// checkChannelClientKey is checkStreamClientKey of a channel stream, the stream is finished on failure
+func checkChannelClientKey(stream *types.ChannelStream, client_id string) bool {
+	resp := checkClientKey(client_id, func() types.KisaraResponse {
+		return types.SuccessResponse(nil)
+	})
+	if resp.Code != 0 {
+		stream.Finish(errors.New(resp.Message))
+		return false
+	}
+	return true
+}
+
 func jsonHelperEncoder[T any](obj T) string {
 	json, _ := json.Marshal(obj)
 	return string(json)
@@ -30,6 +59,62 @@ func jsonHelperDecoder[T any](text string) T {
 	return t
 }
 
+// openRegistry opens the registry credential sealed by server, nil if there's none
+func openRegistry(sealed string) (*types.RegistryCredential, error) {
+	if sealed == "" {
+		return nil, nil
+	}
+	data, err := helper.OpenSecret(helper.GetConfigString("kisara.token"), sealed)
+	if err != nil {
+		return nil, err
+	}
+	var credential types.RegistryCredential
+	if err := json.Unmarshal(data, &credential); err != nil {
+		return nil, errors.New("broken registry credential")
+	}
+	return &credential, nil
+}
+
+// launchContainer launches a container and sets its expiry, the container is stopped if expiry could not be set
+func launchContainer(c *docker.Docker, rc types.RequestLaunchContainer) (*types.Container, error) {
+	if err := rc.ImageRefresh.Check(); err != nil {
+		return nil, err
+	}
+	registry, err := openRegistry(rc.RegistryAuth)
+	if err != nil {
+		return nil, err
+	}
+	container, err := c.LaunchContainer(rc.Image, rc.UID, rc.PortProtocol, rc.SubnetName, rc.Module, &types.ContainerOptions{
+		ImageRefresh: rc.ImageRefresh,
+		Registry:     registry,
+	}, rc.GetResources(), rc.EnvMount...)
+	if err != nil || container == nil {
+		return container, err
+	}
+	if expire_at := rc.GetExpireAt(); expire_at > 0 {
+		if err := c.SetContainerExpire(container, expire_at); err != nil {
+			c.StopContainer(container.Id)
+			return nil, err
+		}
+	}
+	return container, nil
+}
+
+// launchService works like launchContainer but for services
+func launchService(c *docker.Docker, rc types.RequestLaunchService, message_callback func(string)) (*types.Service, error) {
+	service, err := c.CreateService(rc.ServiceConfig, rc.BuildContexts, rc.ImageRefresh, message_callback)
+	if err != nil {
+		return nil, err
+	}
+	if expire_at := rc.GetExpireAt(); expire_at > 0 {
+		if err := c.SetServiceExpire(service, expire_at); err != nil {
+			c.DeleteService(service.Id)
+			return nil, err
+		}
+	}
+	return service, nil
+}
+
 type launchContainerResponseFormat struct {
 	Container *types.Container `json:"container"`
 	Error     string           `json:"error"`
@@ -41,8 +126,7 @@ func HandleLaunchContainer(r *gin.Context) {
 			resp := &types.ResponseLaunchContainer{}
 			response_id := request.CreateNewResponse()
 			go func() {
-				docker := docker.NewDocker()
-				container, err := docker.LaunchContainer(rc.Image, rc.UID, rc.PortProtocol, rc.SubnetName, rc.Module, rc.EnvMount...)
+				container, err := launchContainer(docker.NewDocker(), rc)
 				if err != nil {
 					request.FinishRequest(response_id, jsonHelperEncoder(launchContainerResponseFormat{
 						Container: nil,
@@ -108,6 +192,27 @@ func HandleStopContainer(r *gin.Context) {
 	})
 }
 
+func HandleExtendContainer(r *gin.Context) {
+	controller.BindRequest(r, func(rc types.RequestExtendContainer) {
+		r.JSON(200, checkClientKey(rc.ClientID, func() types.KisaraResponse {
+			resp := &types.ResponseExtendContainer{}
+			resp.ClientID = rc.ClientID
+			expire_at := rc.GetExpireAt()
+			if expire_at == 0 {
+				return types.ErrorResponse(-400, "ttl or expire_at is required")
+			}
+			docker := docker.NewDocker()
+			container := &types.Container{Id: rc.ContainerID}
+			err := docker.SetContainerExpire(container, expire_at)
+			if err != nil {
+				return types.ErrorResponse(-500, err.Error())
+			}
+			resp.ExpireAt = container.ExpireAt
+			return types.SuccessResponse(resp)
+		}))
+	})
+}
+
 func HandleRemoveContainer(r *gin.Context) {
 	controller.BindRequest(r, func(rc types.RequestRemoveContainer) {
 		r.JSON(200, checkClientKey(rc.ClientID, func() types.KisaraResponse {
@@ -171,8 +276,11 @@ func HandlePullImage(r *gin.Context) {
 					request.SetRequestStatusText(message_response_id, message)
 				}
 
-				docker := docker.NewDocker()
-				image, err := docker.PullImage(rc.ImageName, pull_message_callback)
+				var image *types.Image
+				registry, err := openRegistry(rc.RegistryAuth)
+				if err == nil {
+					image, err = docker.NewDocker().PullImage(rc.ImageName, registry, pull_message_callback)
+				}
 				if err != nil {
 					request.FinishRequest(message_response_id, "Finished (Error)")
 					request.FinishRequest(finish_response_id, jsonHelperEncoder(pullImageResponseFormat{
@@ -238,6 +346,245 @@ func HandleDeleteImage(r *gin.Context) {
 	})
 }
 
+// buildImage builds the image of rc from context and waits for it, it returns the id of the built image
+func buildImage(c *docker.Docker, rc types.RequestBuildImage, context io.Reader, message_callback func(string)) (string, error) {
+	finish := make(chan struct{}, 1)
+	var fault string
+	err := c.BuildImage(context, rc.ImageName, rc.BuildArgs, message_callback, func(message string) {
+		fault = message
+	}, finish)
+	if err != nil {
+		return "", err
+	}
+	<-finish
+
+	if fault != "" {
+		return "", fmt.Errorf("build image %s failed: %s", rc.ImageName, fault)
+	}
+
+	image, err := c.InspectImage(rc.ImageName)
+	if err != nil {
+		return "", err
+	}
+	return image.Uuid, nil
+}
+
+/*
+	spoolBuildContext reads build args of a multipart upload and copies its context to a temporary
+	file, the upload is removed once the request is answered but the build goes on, the caller
+	should close and remove the file
+*/
+func spoolBuildContext(r *gin.Context, rc *types.RequestBuildImage) (*os.File, error) {
+	if build_args := r.PostForm("build_args"); build_args != "" {
+		if err := json.Unmarshal([]byte(build_args), &rc.BuildArgs); err != nil {
+			return nil, fmt.Errorf("invalid build args: %s", err.Error())
+		}
+	}
+
+	file, err := r.FormFile("file")
+	if err != nil {
+		return nil, errors.New("build context is required")
+	}
+	reader, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	spool, err := os.CreateTemp("", "kisara-build-*.tar")
+	if err != nil {
+		return nil, err
+	}
+	_, err = io.Copy(spool, reader)
+	if err == nil {
+		_, err = spool.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		spool.Close()
+		os.Remove(spool.Name())
+		return nil, err
+	}
+	return spool, nil
+}
+
+type buildImageResponseFormat struct {
+	ImageId string `json:"image_id"`
+	Error   string `json:"error"`
+}
+
+func HandleBuildImage(r *gin.Context) {
+	controller.BindRequest(r, func(rc types.RequestBuildImage) {
+		r.JSON(200, checkClientKey(rc.ClientID, func() types.KisaraResponse {
+			context, err := spoolBuildContext(r, &rc)
+			if err != nil {
+				return types.ErrorResponse(-400, err.Error())
+			}
+
+			message_response_id := request.CreateNewResponse()
+			finish_response_id := request.CreateNewResponse()
+			go func() {
+				defer os.Remove(context.Name())
+				defer context.Close()
+				log.Info("[BuildImage] Building image %s", rc.ImageName)
+				image_id, err := buildImage(docker.NewDocker(), rc, context, func(message string) {
+					request.AppendRequestLog(message_response_id, message)
+				})
+				if err != nil {
+					log.Warn("[BuildImage] %s", err.Error())
+					request.FinishRequest(message_response_id, "Finished (Error)")
+					request.FinishRequest(finish_response_id, jsonHelperEncoder(buildImageResponseFormat{
+						Error: err.Error(),
+					}))
+					return
+				}
+				request.FinishRequest(message_response_id, "Finished")
+				request.FinishRequest(finish_response_id, jsonHelperEncoder(buildImageResponseFormat{
+					ImageId: image_id,
+				}))
+			}()
+
+			return types.SuccessResponse(types.ResponseBuildImage{
+				ClientID:          rc.ClientID,
+				MessageResponseId: message_response_id,
+				FinishResponseID:  finish_response_id,
+			})
+		}))
+	})
+}
+
+func HandleCheckBuildImage(r *gin.Context) {
+	controller.BindRequest(r, func(rc types.RequestCheckBuildImage) {
+		r.JSON(200, checkClientKey(rc.ClientID, func() types.KisaraResponse {
+			resp := &types.ResponseCheckBuildImage{}
+			resp.ClientID = rc.ClientID
+			// logs are read after the result, so every log is included once it's finished
+			finish_response_text, finished := request.GetResponse(rc.FinishResponseID)
+			resp.Finished = finished
+			resp.Logs, resp.Offset = request.GetRequestLogs(rc.MessageResponseId, rc.Offset)
+			if len(resp.Logs) > 0 {
+				resp.Message = resp.Logs[len(resp.Logs)-1]
+			}
+			if finished {
+				finish_response := jsonHelperDecoder[buildImageResponseFormat](finish_response_text)
+				resp.Error = finish_response.Error
+				resp.ImageId = finish_response.ImageId
+			}
+			return types.SuccessResponse(resp)
+		}))
+	})
+}
+
+/*
+	ChannelBuildImage builds from the context sent as chunks of the stream, it's passed to docker
+	as it arrives, build logs are answered as chunks of BUILD_STREAM_LOG and the id of the image
+	as a chunk of BUILD_STREAM_IMAGE before the last one
+*/
+func ChannelBuildImage(payload []byte, stream *types.ChannelStream) {
+	var rc types.RequestBuildImage
+	if err := json.Unmarshal(payload, &rc); err != nil {
+		stream.Finish(err)
+		return
+	}
+	if !checkChannelClientKey(stream, rc.ClientID) {
+		return
+	}
+
+	log.Info("[BuildImage] Building image %s", rc.ImageName)
+	logs := stream.Writer(types.BUILD_STREAM_LOG)
+	image_id, err := buildImage(docker.NewDocker(), rc, stream.Reader(), func(message string) {
+		logs.Write([]byte(message))
+	})
+	if err != nil {
+		log.Warn("[BuildImage] %s", err.Error())
+		stream.Finish(err)
+		return
+	}
+	stream.Writer(types.BUILD_STREAM_IMAGE).Write([]byte(image_id))
+	stream.Finish(nil)
+}
+
+// HandleSaveImage streams image as a tar to a peer, errors are answered in json before streaming
+func HandleSaveImage(r *gin.Context) {
+	controller.BindRequest(r, func(rc types.RequestSaveImage) {
+		if !checkStreamClientKey(r, rc.ClientID) {
+			return
+		}
+
+		reader, err := docker.NewDocker().SaveImage(rc.ImageName)
+		if err != nil {
+			r.JSON(200, types.ErrorResponse(-500, err.Error()))
+			return
+		}
+		defer reader.Close()
+
+		log.Info("[SaveImage] Sending image %s to %s", rc.ImageName, r.ClientIP())
+		r.Header("Content-Type", "application/x-tar")
+		r.Status(200)
+		if _, err := io.Copy(r.Writer, reader); err != nil {
+			log.Warn("[SaveImage] Sending image %s failed: %s", rc.ImageName, err.Error())
+		}
+	})
+}
+
+// ChannelSaveImage is HandleSaveImage through channel, server relays it to peers which could not reach this node
+func ChannelSaveImage(payload []byte, stream *types.ChannelStream) {
+	var rc types.RequestSaveImage
+	if err := json.Unmarshal(payload, &rc); err != nil {
+		stream.Finish(err)
+		return
+	}
+	if !checkChannelClientKey(stream, rc.ClientID) {
+		return
+	}
+
+	reader, err := docker.NewDocker().SaveImage(rc.ImageName)
+	if err != nil {
+		stream.Finish(err)
+		return
+	}
+	defer reader.Close()
+
+	log.Info("[SaveImage] Sending image %s through channel", rc.ImageName)
+	_, err = io.Copy(stream.Writer(""), reader)
+	if err != nil {
+		log.Warn("[SaveImage] Sending image %s failed: %s", rc.ImageName, err.Error())
+	}
+	stream.Finish(err)
+}
+
+func HandleFetchImage(r *gin.Context) {
+	controller.BindRequest(r, func(rc types.RequestFetchImage) {
+		r.JSON(200, checkClientKey(rc.ClientID, func() types.KisaraResponse {
+			// server is asked for peers if none is given
+			image, source, err := docker.NewDocker().FetchImageFromPeers(rc.ImageName, rc.Peers, nil)
+			if err != nil {
+				return types.ErrorResponse(-500, err.Error())
+			}
+			return types.SuccessResponse(types.ResponseFetchImage{
+				ClientID: rc.ClientID,
+				Source:   source,
+				ImageId:  image.Uuid,
+			})
+		}))
+	})
+}
+
+func HandlePruneImages(r *gin.Context) {
+	controller.BindRequest(r, func(rc types.RequestPruneImages) {
+		r.JSON(200, checkClientKey(rc.ClientID, func() types.KisaraResponse {
+			images, err := docker.NewDocker().PruneImages(rc.DryRun)
+			if err != nil {
+				return types.ErrorResponse(-500, err.Error())
+			}
+			return types.SuccessResponse(types.ResponsePruneImages{
+				ClientID: rc.ClientID,
+				DryRun:   rc.DryRun,
+				Images:   images,
+			})
+		}))
+	})
+}
+
 func HandleListImage(r *gin.Context) {
 	controller.BindRequest(r, func(rc types.RequestListImage) {
 		r.JSON(200, checkClientKey(rc.ClientID, func() types.KisaraResponse {
@@ -341,10 +688,13 @@ func HandleExecContainer(r *gin.Context) {
 			resp := &types.ResponseExecContainer{}
 			resp.ClientID = rc.ClientID
 			docker := docker.NewDocker()
-			err := docker.Exec(rc.ContainerID, rc.Cmd)
+			stdout, stderr, exit_code, err := docker.ExecOutput(rc.ContainerID, rc.Cmd)
 			if err != nil {
 				return types.ErrorResponse(-500, err.Error())
 			}
+			resp.Stdout = stdout
+			resp.Stderr = stderr
+			resp.ExitCode = exit_code
 			return types.SuccessResponse(resp)
 		}))
 	})
@@ -365,7 +715,7 @@ func HandleLaunchService(r *gin.Context) {
 			message_response_id := request.CreateNewResponse()
 			finish_response_id := request.CreateNewResponse()
 			go func() {
-				service, err := docker.CreateService(rc.ServiceConfig, func(message string) {
+				service, err := launchService(docker, rc, func(message string) {
 					request.SetRequestStatusText(message_response_id, message)
 				})
 				if err != nil {
@@ -470,6 +820,23 @@ func HandleStopService(r *gin.Context) {
 	})
 }
 
+func HandleRotateServiceFlags(r *gin.Context) {
+	controller.BindRequest(r, func(rc types.RequestRotateServiceFlags) {
+		r.JSON(200, checkClientKey(rc.ClientID, func() types.KisaraResponse {
+			resp := &types.ResponseRotateServiceFlags{}
+			resp.ClientID = rc.ClientID
+			docker := docker.NewDocker()
+			flags, failed, err := docker.RotateServiceFlags(rc.ServiceID)
+			if err != nil {
+				return types.ErrorResponse(-500, err.Error())
+			}
+			resp.Flags = flags
+			resp.Failed = failed
+			return types.SuccessResponse(resp)
+		}))
+	})
+}
+
 func HandleCheckStopService(r *gin.Context) {
 	controller.BindRequest(r, func(rc types.RequestCheckStopService) {
 		r.JSON(200, checkClientKey(rc.ClientID, func() types.KisaraResponse {
@@ -0,0 +1,179 @@
+package client
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	docker "github.com/Yeuoly/kisara/src/routine/docker"
+	log "github.com/Yeuoly/kisara/src/routine/log"
+	"github.com/Yeuoly/kisara/src/types"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+var upgrader = websocket.Upgrader{
+	// only server connects to this endpoint, the upgrade request is already signed
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// execIOConn carries ExecIOMessage of an exec, over a websocket or a stream of channel
+type execIOConn interface {
+	WriteMessage(message types.ExecIOMessage) error
+	ReadMessage(message *types.ExecIOMessage) error
+}
+
+type websocketExecIO struct {
+	conn *websocket.Conn
+	lock sync.Mutex
+}
+
+func (w *websocketExecIO) WriteMessage(message types.ExecIOMessage) error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	return w.conn.WriteJSON(message)
+}
+
+func (w *websocketExecIO) ReadMessage(message *types.ExecIOMessage) error {
+	return w.conn.ReadJSON(message)
+}
+
+type channelExecIO struct {
+	stream *types.ChannelStream
+}
+
+func (c *channelExecIO) WriteMessage(message types.ExecIOMessage) error {
+	return c.stream.Send(message)
+}
+
+func (c *channelExecIO) ReadMessage(message *types.ExecIOMessage) error {
+	return c.stream.Recv(message)
+}
+
+// execIOWriter sends output of exec as messages of type
+type execIOWriter struct {
+	conn execIOConn
+	typ  string
+}
+
+func (w *execIOWriter) Write(p []byte) (int, error) {
+	data := make([]byte, len(p))
+	copy(data, p)
+	if err := w.conn.WriteMessage(types.ExecIOMessage{Type: w.typ, Data: data}); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+/*
+	HandleExecContainerIO serves an interactive exec through websocket, the first message is
+	RequestExecContainerIO, then ExecIOMessage flows in both directions until the process exits
+*/
+func HandleExecContainerIO(r *gin.Context) {
+	ws, err := upgrader.Upgrade(r.Writer, r.Request, nil)
+	if err != nil {
+		log.Warn("[ExecIO] Failed to upgrade: %s", err.Error())
+		return
+	}
+	defer ws.Close()
+
+	conn := &websocketExecIO{conn: ws}
+	var rc types.RequestExecContainerIO
+	ws.SetReadDeadline(time.Now().Add(10 * time.Second))
+	if err := ws.ReadJSON(&rc); err != nil {
+		conn.WriteMessage(types.ExecIOMessage{Type: types.EXEC_IO_ERROR, Error: err.Error()})
+		return
+	}
+	ws.SetReadDeadline(time.Time{})
+
+	serveExecIO(rc, conn)
+	ws.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+}
+
+// ChannelExecContainerIO serves an interactive exec through a stream of channel, payload is RequestExecContainerIO
+func ChannelExecContainerIO(payload []byte, stream *types.ChannelStream) {
+	conn := &channelExecIO{stream: stream}
+	var rc types.RequestExecContainerIO
+	if err := json.Unmarshal(payload, &rc); err != nil {
+		conn.WriteMessage(types.ExecIOMessage{Type: types.EXEC_IO_ERROR, Error: err.Error()})
+		return
+	}
+
+	serveExecIO(rc, conn)
+}
+
+// serveExecIO runs the exec, ExecIOMessage flows in both directions until the process exits
+func serveExecIO(rc types.RequestExecContainerIO, conn execIOConn) {
+	fail := func(message string) {
+		conn.WriteMessage(types.ExecIOMessage{Type: types.EXEC_IO_ERROR, Error: message})
+	}
+
+	resp := checkClientKey(rc.ClientID, func() types.KisaraResponse {
+		return types.SuccessResponse(nil)
+	})
+	if resp.Code != 0 {
+		fail(resp.Message)
+		return
+	}
+
+	cmd := rc.Cmd
+	if len(cmd) == 0 {
+		cmd = []string{"/bin/sh"}
+	}
+
+	docker := docker.NewDocker()
+	session, err := docker.ExecIO(rc.ContainerID, cmd, rc.Tty, rc.Rows, rc.Cols)
+	if err != nil {
+		fail(err.Error())
+		return
+	}
+	defer session.Close()
+
+	// stdin and resize from server
+	go func() {
+		for {
+			var message types.ExecIOMessage
+			if err := conn.ReadMessage(&message); err != nil {
+				// server is gone, stop the process by closing its stdin
+				session.CloseWrite()
+				return
+			}
+			switch message.Type {
+			case types.EXEC_IO_STDIN:
+				if _, err := session.Conn.Write(message.Data); err != nil {
+					return
+				}
+			case types.EXEC_IO_STDIN_CLOSE:
+				session.CloseWrite()
+			case types.EXEC_IO_RESIZE:
+				if err := session.Resize(message.Rows, message.Cols); err != nil {
+					log.Warn("[ExecIO] Failed to resize: %s", err.Error())
+				}
+			}
+		}
+	}()
+
+	stdout := &execIOWriter{conn: conn, typ: types.EXEC_IO_STDOUT}
+	stderr := &execIOWriter{conn: conn, typ: types.EXEC_IO_STDERR}
+	if rc.Tty {
+		_, err = io.Copy(stdout, session.Reader)
+	} else {
+		_, err = stdcopy.StdCopy(stdout, stderr, session.Reader)
+	}
+	if err != nil {
+		fail(err.Error())
+		return
+	}
+
+	exit_code, err := session.ExitCode()
+	if err != nil {
+		fail(err.Error())
+		return
+	}
+
+	conn.WriteMessage(types.ExecIOMessage{Type: types.EXEC_IO_EXIT, ExitCode: exit_code})
+}
@@ -0,0 +1,41 @@
+package client
+
+import (
+	"time"
+
+	"github.com/Yeuoly/kisara/src/controller"
+	"github.com/Yeuoly/kisara/src/routine/history"
+	"github.com/Yeuoly/kisara/src/types"
+	"github.com/gin-gonic/gin"
+)
+
+// HandleResourceHistory returns usage history of this node, one of its containers, or both
+func HandleResourceHistory(r *gin.Context) {
+	controller.BindRequest(r, func(rc types.RequestResourceHistory) {
+		r.JSON(200, checkClientKey(rc.ClientID, func() types.KisaraResponse {
+			rc.Normalize(time.Now().Unix(), history.Interval())
+
+			series := []types.ResourceSeries{}
+			if rc.ContainerID != "" {
+				container, ok := history.QueryContainer(rc.ContainerID, rc.From, rc.To, rc.Step)
+				if !ok {
+					return types.ErrorResponse(-404, "no history of container")
+				}
+				series = append(series, container)
+			} else {
+				series = append(series, history.QueryNode(rc.From, rc.To, rc.Step))
+				if rc.AllContainers {
+					series = append(series, history.QueryContainers(rc.From, rc.To, rc.Step)...)
+				}
+			}
+
+			for i := range series {
+				series[i].ClientID = rc.ClientID
+			}
+			return types.SuccessResponse(types.ResponseResourceHistory{
+				Step:   rc.Step,
+				Series: series,
+			})
+		}))
+	})
+}
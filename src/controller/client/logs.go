@@ -0,0 +1,113 @@
+package client
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/Yeuoly/kisara/src/controller"
+	docker "github.com/Yeuoly/kisara/src/routine/docker"
+	log "github.com/Yeuoly/kisara/src/routine/log"
+	"github.com/Yeuoly/kisara/src/types"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/gin-gonic/gin"
+)
+
+// HandleContainerLogs returns logs of the container, logs retained are returned if it was removed
+func HandleContainerLogs(r *gin.Context) {
+	controller.BindRequest(r, func(rc types.RequestContainerLogs) {
+		r.JSON(200, checkClientKey(rc.ClientID, func() types.KisaraResponse {
+			logs, err := docker.NewDocker().GetContainerLogs(rc.ContainerID, rc.Since, rc.Tail)
+			if err != nil {
+				return types.ErrorResponse(-500, err.Error())
+			}
+			logs.ClientID = rc.ClientID
+			return types.SuccessResponse(logs)
+		}))
+	})
+}
+
+/*
+	HandleFollowContainerLogs streams logs of the container until it stops or the receiver goes away,
+	the stream is sent as docker sends it, multiplexed by stdcopy unless X-Kisara-Tty is true
+*/
+func HandleFollowContainerLogs(r *gin.Context) {
+	controller.BindRequest(r, func(rc types.RequestContainerLogs) {
+		if !checkStreamClientKey(r, rc.ClientID) {
+			return
+		}
+
+		reader, tty, err := docker.NewDocker().OpenContainerLogs(rc.ContainerID, rc.Since, rc.Tail, true)
+		if err != nil {
+			r.JSON(200, types.ErrorResponse(-500, err.Error()))
+			return
+		}
+		defer reader.Close()
+
+		// docker stops sending once the receiver closed the connection
+		go func() {
+			<-r.Request.Context().Done()
+			reader.Close()
+		}()
+
+		if tty {
+			r.Header("X-Kisara-Tty", "true")
+		} else {
+			r.Header("X-Kisara-Tty", "false")
+		}
+		r.Header("Content-Type", "application/vnd.docker.raw-stream")
+		r.Status(200)
+		r.Writer.Flush()
+
+		buf := make([]byte, 4096)
+		for {
+			n, err := reader.Read(buf)
+			if n > 0 {
+				if _, err := r.Writer.Write(buf[:n]); err != nil {
+					return
+				}
+				r.Writer.Flush()
+			}
+			if err == io.EOF {
+				return
+			} else if err != nil {
+				log.Warn("[FollowContainerLogs] Reading logs of %s failed: %s", rc.ContainerID, err.Error())
+				return
+			}
+		}
+	})
+}
+
+/*
+	ChannelFollowContainerLogs is HandleFollowContainerLogs through channel, logs are demultiplexed
+	here and sent as chunks of stream stdout or stderr, it stops once server closes the stream
+*/
+func ChannelFollowContainerLogs(payload []byte, stream *types.ChannelStream) {
+	var rc types.RequestContainerLogs
+	if err := json.Unmarshal(payload, &rc); err != nil {
+		stream.Finish(err)
+		return
+	}
+	if !checkChannelClientKey(stream, rc.ClientID) {
+		return
+	}
+
+	reader, tty, err := docker.NewDocker().OpenContainerLogs(rc.ContainerID, rc.Since, rc.Tail, true)
+	if err != nil {
+		stream.Finish(err)
+		return
+	}
+	defer reader.Close()
+
+	go func() {
+		<-stream.Done()
+		reader.Close()
+	}()
+
+	stdout, stderr := stream.Writer(types.EXEC_IO_STDOUT), stream.Writer(types.EXEC_IO_STDERR)
+	if tty {
+		_, err = io.Copy(stdout, reader)
+	} else {
+		_, err = stdcopy.StdCopy(stdout, stderr, reader)
+	}
+	stream.Finish(err)
+}
@@ -1,8 +1,11 @@
 package controller
 
 import (
+	"encoding/json"
+
 	"github.com/Yeuoly/kisara/src/types"
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 )
 
 func BindRequest[T any](r *gin.Context, success func(T)) {
@@ -23,3 +26,15 @@ func BindRequest[T any](r *gin.Context, success func(T)) {
 	}
 	success(request)
 }
+
+// BindChannelRequest works like BindRequest but for requests from control channel
+func BindChannelRequest[T any](payload []byte, success func(T) types.KisaraResponse) types.KisaraResponse {
+	var request T
+	if err := json.Unmarshal(payload, &request); err != nil {
+		return types.ErrorResponse(-400, err.Error())
+	}
+	if err := binding.Validator.ValidateStruct(&request); err != nil {
+		return types.ErrorResponse(-400, err.Error())
+	}
+	return success(request)
+}
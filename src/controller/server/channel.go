@@ -0,0 +1,33 @@
+package server
+
+import (
+	"net/http"
+
+	log "github.com/Yeuoly/kisara/src/routine/log"
+	"github.com/Yeuoly/kisara/src/routine/synergy/server"
+	"github.com/Yeuoly/kisara/src/types"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+var upgrader = websocket.Upgrader{
+	// clients are not browsers, the upgrade request is already signed
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+func HandleChannel(r *gin.Context) {
+	client_id := r.Query("client_id")
+	client_token := r.Query("client_token")
+	if !server.VerifyClientToken(client_id, client_token) {
+		r.JSON(200, types.ErrorResponse(-403, "Access Denied"))
+		return
+	}
+
+	conn, err := upgrader.Upgrade(r.Writer, r.Request, nil)
+	if err != nil {
+		log.Warn("[Channel] Failed to upgrade channel of client %s: %s", client_id, err.Error())
+		return
+	}
+
+	server.AttachChannel(client_id, conn)
+}
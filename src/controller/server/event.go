@@ -0,0 +1,124 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/Yeuoly/kisara/src/routine/log"
+	"github.com/Yeuoly/kisara/src/routine/synergy/server"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+/*
+	HandleEvents streams cluster events as Server-Sent-Events, or as json messages if it's a
+	websocket upgrade, ?types=container,node.connect filters events by type, Last-Event-ID header
+	or ?last_id resumes after the last event received
+*/
+func HandleEvents(r *gin.Context) {
+	filter := []string{}
+	for _, t := range strings.Split(r.Query("types"), ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			filter = append(filter, t)
+		}
+	}
+
+	last_event_id := r.GetHeader("Last-Event-ID")
+	if last_event_id == "" {
+		last_event_id = r.Query("last_id")
+	}
+	last_id, _ := strconv.ParseUint(last_event_id, 10, 64)
+
+	if websocket.IsWebSocketUpgrade(r.Request) {
+		serveEventsWebsocket(r, filter, last_id)
+	} else {
+		serveEventsSSE(r, filter, last_id)
+	}
+}
+
+func serveEventsSSE(r *gin.Context, filter []string, last_id uint64) {
+	subscription := server.SubscribeEvents(filter, last_id)
+	defer subscription.Close()
+
+	r.Header("Content-Type", "text/event-stream")
+	r.Header("Cache-Control", "no-cache")
+	r.Header("Connection", "keep-alive")
+	r.Status(200)
+	r.Writer.Flush()
+
+	ping := time.NewTicker(15 * time.Second)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-r.Request.Context().Done():
+			return
+		case <-ping.C:
+			// comments keep proxies from closing an idle stream
+			if _, err := fmt.Fprint(r.Writer, ": ping\n\n"); err != nil {
+				return
+			}
+			r.Writer.Flush()
+		case event, ok := <-subscription.C:
+			if !ok {
+				// fell behind, subscriber resumes with Last-Event-ID
+				return
+			}
+			data, _ := json.Marshal(event)
+			_, err := fmt.Fprintf(r.Writer, "id: %d\nevent: %s\ndata: %s\n\n", event.Id, event.Type, data)
+			if err != nil {
+				return
+			}
+			r.Writer.Flush()
+		}
+	}
+}
+
+func serveEventsWebsocket(r *gin.Context, filter []string, last_id uint64) {
+	conn, err := upgrader.Upgrade(r.Writer, r.Request, nil)
+	if err != nil {
+		log.Warn("[Event] Failed to upgrade: %s", err.Error())
+		return
+	}
+	defer conn.Close()
+
+	subscription := server.SubscribeEvents(filter, last_id)
+	defer subscription.Close()
+
+	// nothing is expected from subscriber, reading only detects that it's gone
+	closed := make(chan bool)
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ping := time.NewTicker(15 * time.Second)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-closed:
+			return
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(10*time.Second)); err != nil {
+				return
+			}
+		case event, ok := <-subscription.C:
+			if !ok {
+				conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "fell behind"), time.Now().Add(time.Second))
+				return
+			}
+			conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+			if err := conn.WriteJSON(event); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -1,10 +1,14 @@
 package server
 
 import (
+	"bufio"
+	"io"
 	"time"
 
 	"github.com/Yeuoly/kisara/src/controller"
 	"github.com/Yeuoly/kisara/src/helper"
+	"github.com/Yeuoly/kisara/src/router"
+	log "github.com/Yeuoly/kisara/src/routine/log"
 	"github.com/Yeuoly/kisara/src/routine/synergy/server"
 	"github.com/Yeuoly/kisara/src/types"
 	"github.com/gin-gonic/gin"
@@ -56,6 +60,7 @@ func HandleRecvStatus(r *gin.Context) {
 			NetworkUsage:   rss.NetworkUsage,
 			ContainerNum:   rss.ContainerNum,
 			ContainerUsage: rss.ContainerUsage,
+			Images:         rss.Images,
 		})
 		if err != nil {
 			r.JSON(200, types.ErrorResponse(-500, err.Error()))
@@ -66,3 +71,45 @@ func HandleRecvStatus(r *gin.Context) {
 		}))
 	})
 }
+
+func HandleImagePeers(r *gin.Context) {
+	controller.BindRequest(r, func(rip types.RequestImagePeers) {
+		if server.GetClient(rip.ClientID) == nil {
+			r.JSON(200, types.ErrorResponse(-404, "client not found"))
+			return
+		}
+		r.JSON(200, types.SuccessResponse(types.ResponseImagePeers{
+			ClientID: rip.ClientID,
+			Peers:    server.GetImagePeers(rip.ImageName, rip.ClientID),
+		}))
+	})
+}
+
+/*
+	HandleSaveImage relays an image of rc.ClientID to the node asking for it, the image is read from
+	the channel of rc.ClientID, so nodes reached only through their channels still share images, an
+	error before the first byte is answered in json like a node does
+*/
+func HandleSaveImage(r *gin.Context) {
+	controller.BindRequest(r, func(rc types.RequestSaveImage) {
+		stream, err := server.OpenChannelStream(rc.ClientID, router.URI_CLIENT_SAVE_IMAGE, rc)
+		if err != nil {
+			r.JSON(200, types.ErrorResponse(-500, err.Error()))
+			return
+		}
+		defer stream.Close()
+
+		reader := bufio.NewReaderSize(stream.Reader(), types.CHANNEL_STREAM_CHUNK_SIZE)
+		if _, err := reader.Peek(1); err != nil {
+			r.JSON(200, types.ErrorResponse(-500, err.Error()))
+			return
+		}
+
+		log.Info("[SaveImage] Relaying image %s of %s to %s", rc.ImageName, rc.ClientID, r.ClientIP())
+		r.Header("Content-Type", "application/x-tar")
+		r.Status(200)
+		if _, err := io.Copy(r.Writer, reader); err != nil {
+			log.Warn("[SaveImage] Relaying image %s of %s failed: %s", rc.ImageName, rc.ClientID, err.Error())
+		}
+	})
+}
@@ -22,6 +22,23 @@ func GetConfigInteger(name string) int {
 	return viper.GetInt(name)
 }
 
+func GetConfigInt64(name string) int64 {
+	return viper.GetInt64(name)
+}
+
+func GetConfigFloat(name string) float64 {
+	return viper.GetFloat64(name)
+}
+
 func GetConfigString(name string) string {
 	return viper.GetString(name)
 }
+
+func GetConfigStringMap(name string) map[string]string {
+	return viper.GetStringMapString(name)
+}
+
+// UnmarshalConfig decodes the config under name into v, e.g. an array of tables
+func UnmarshalConfig(name string, v interface{}) error {
+	return viper.UnmarshalKey(name, v)
+}
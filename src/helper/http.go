@@ -2,14 +2,17 @@ package helper
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"math/rand"
 	"mime/multipart"
 	"net/http"
+	"os"
 	"strconv"
 	"strings"
 	"time"
@@ -143,6 +146,11 @@ func HttpWithRetCode(retCode *int) HttpOptions {
 	return HttpOptions{"retCode", retCode}
 }
 
+// sign the request with the shared token, it should be applied after the payload was built
+func HttpSign(token string) HttpOptions {
+	return HttpOptions{"sign", token}
+}
+
 func randUA() string {
 	ua := []string{"Mozilla/5.0 (Windows NT 6.1) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/41.0.2228.0 Safari/537.36",
 		"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_10_1) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/41.0.2227.1 Safari/537.36",
@@ -162,13 +170,89 @@ func randUA() string {
 	return ua[n]
 }
 
-func buildHttpRequest(method string, url string, options ...HttpOptions) (*http.Client, *http.Request, error) {
+// spoolBody is a request body spooled to a temporary file, the file is removed when it's closed
+type spoolBody struct {
+	*os.File
+}
+
+func (b spoolBody) Close() error {
+	err := b.File.Close()
+	os.Remove(b.Name())
+	return err
+}
+
+func hashBody(body []byte) []byte {
+	hash := sha256.Sum256(body)
+	return hash[:]
+}
+
+/*
+	spoolMultipart writes payload and files as a multipart body to a temporary file, the body is
+	hashed while it's written, so it's never held in memory even if it has to be signed
+*/
+func spoolMultipart(payload map[string]string, files []httpPayloadMultipartFile) (spoolBody, int64, string, []byte, error) {
+	spool, err := os.CreateTemp("", "kisara-request-*")
+	if err != nil {
+		return spoolBody{}, 0, "", nil, err
+	}
+	body := spoolBody{spool}
+
+	hasher := sha256.New()
+	body_writer := multipart.NewWriter(io.MultiWriter(spool, hasher))
+
+	for k, v := range payload {
+		body_writer.WriteField(k, v)
+	}
+
+	for _, file := range files {
+		file_writer, err := body_writer.CreateFormFile("file", file.Filename)
+		if err != nil {
+			body.Close()
+			return spoolBody{}, 0, "", nil, err
+		}
+
+		_, err = io.Copy(file_writer, file.File)
+		if err != nil {
+			body.Close()
+			return spoolBody{}, 0, "", nil, err
+		}
+	}
+
+	if err := body_writer.Close(); err != nil {
+		body.Close()
+		return spoolBody{}, 0, "", nil, err
+	}
+
+	size, err := spool.Seek(0, io.SeekCurrent)
+	if err == nil {
+		_, err = spool.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		body.Close()
+		return spoolBody{}, 0, "", nil, err
+	}
+
+	return body, size, body_writer.FormDataContentType(), hasher.Sum(nil), nil
+}
+
+func buildHttpRequest(method string, url string, options ...HttpOptions) (_ *http.Client, _ *http.Request, err error) {
 	client := &http.Client{}
 	req, err := http.NewRequest(method, url, nil)
 	if err != nil {
 		return nil, nil, err
 	}
 
+	// a spooled body is removed if the request is not sent
+	defer func() {
+		if err != nil && req.Body != nil {
+			req.Body.Close()
+		}
+	}()
+
+	sign_token := ""
+	// sha256 of body, it's computed when body is built
+	body_hash := hashBody(nil)
+
 	for _, option := range options {
 		switch option.Type {
 		case "timeout":
@@ -204,9 +288,11 @@ func buildHttpRequest(method string, url string, options ...HttpOptions) (*http.
 				q.Add(k, v)
 			}
 			req.Body = ioutil.NopCloser(strings.NewReader(q.Encode()))
+			body_hash = hashBody([]byte(q.Encode()))
 			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 		case "payloadText":
 			req.Body = ioutil.NopCloser(strings.NewReader(option.Value.(string)))
+			body_hash = hashBody([]byte(option.Value.(string)))
 			req.Header.Set("Content-Type", "text/plain")
 		case "payloadJson":
 			jsonStr, err := json.Marshal(option.Value)
@@ -214,6 +300,7 @@ func buildHttpRequest(method string, url string, options ...HttpOptions) (*http.
 				return nil, nil, err
 			}
 			req.Body = ioutil.NopCloser(bytes.NewBuffer(jsonStr))
+			body_hash = hashBody(jsonStr)
 			req.Header.Set("Content-Type", "application/json")
 		case "payloadMultipart":
 			payload_inf := option.Value.(map[string]interface{})["payload"]
@@ -241,28 +328,13 @@ func buildHttpRequest(method string, url string, options ...HttpOptions) (*http.
 				files = []httpPayloadMultipartFile{}
 			}
 
-			body_buf := &bytes.Buffer{}
-			body_writer := multipart.NewWriter(body_buf)
-
-			for k, v := range payload {
-				body_writer.WriteField(k, v)
-			}
-
-			for _, file := range files {
-				file_writer, err := body_writer.CreateFormFile("file", file.Filename)
-				if err != nil {
-					return nil, nil, err
-				}
-
-				_, err = io.Copy(file_writer, file.File)
-				if err != nil {
-					return nil, nil, err
-				}
+			body, size, content_type, hash, err := spoolMultipart(payload, files)
+			if err != nil {
+				return nil, nil, err
 			}
-
-			content_type := body_writer.FormDataContentType()
-			body_writer.Close()
-			req.Body = ioutil.NopCloser(body_buf)
+			req.Body = body
+			req.ContentLength = size
+			body_hash = hash
 			req.Header.Set("Content-Type", content_type)
 		case "noRedirect":
 			client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
@@ -272,6 +344,14 @@ func buildHttpRequest(method string, url string, options ...HttpOptions) (*http.
 			req.Header.Set("User-Agent", randUA())
 		case "directReferer":
 			req.Header.Set("Referer", url)
+		case "sign":
+			sign_token = option.Value.(string)
+		}
+	}
+
+	if sign_token != "" {
+		for k, v := range SignedHeadersHash(sign_token, method, req.URL.RequestURI(), body_hash) {
+			req.Header.Set(k, v)
 		}
 	}
 
@@ -322,6 +402,11 @@ func httpDelete(url string, options ...HttpOptions) (io.ReadCloser, *ResponseHea
 
 func SendAndParse[T any](method string, url string, options ...HttpOptions) (T, error) {
 	var result T
+	// every request between kisara nodes is signed with the shared token
+	if token := GetConfigString("kisara.token"); token != "" {
+		options = append(options, HttpSign(token))
+	}
+
 	body, _, err := doRequest(method, url, options...)
 	if err != nil {
 		return result, err
@@ -414,7 +499,39 @@ func SendDelete(url string, options ...HttpOptions) ([]byte, *ResponseHeader, er
 func SendGetAsync(url string, final func(io.ReadCloser, *ResponseHeader, error), options ...HttpOptions) {
 	resp, header, err := httpGet(url, options...)
 	final(resp, header, err)
-	resp.Close()
+	if resp != nil {
+		resp.Close()
+	}
+}
+
+/*
+	SendGetStream opens url and calls stream with the body if it's of content_type, otherwise the
+	body is an error answered in json like {"message": "..."}, it's returned as an error, so are
+	errors of stream and of the connection
+*/
+func SendGetStream(url string, content_type string, stream func(body io.ReadCloser, header *ResponseHeader) error, options ...HttpOptions) error {
+	var stream_err error
+	SendGetAsync(url, func(body io.ReadCloser, header *ResponseHeader, err error) {
+		if err != nil {
+			stream_err = err
+			return
+		}
+
+		if !strings.HasPrefix(header.FindKey("Content-Type"), content_type) {
+			var resp struct {
+				Message string `json:"message"`
+			}
+			if err := json.NewDecoder(io.LimitReader(body, 4096)).Decode(&resp); err != nil {
+				stream_err = fmt.Errorf("unexpected response: %s", err.Error())
+			} else {
+				stream_err = errors.New(resp.Message)
+			}
+			return
+		}
+
+		stream_err = stream(body, header)
+	}, options...)
+	return stream_err
 }
 
 // SendPostAsync is not a real async function, it only open the connection
@@ -423,5 +540,7 @@ func SendGetAsync(url string, final func(io.ReadCloser, *ResponseHeader, error),
 func SendPostAsync(url string, final func(io.ReadCloser, *ResponseHeader, error), options ...HttpOptions) {
 	resp, header, err := httpPost(url, options...)
 	final(resp, header, err)
-	resp.Close()
+	if resp != nil {
+		resp.Close()
+	}
 }
@@ -2,14 +2,20 @@ package helper
 
 import "sync"
 
+// highGranularityLock is the lock of an id, it's dropped when nobody holds or waits for it
+type highGranularityLock struct {
+	sync.Mutex
+	refs int
+}
+
 type HighGranularityMutex[K Compareable] struct {
-	mu     map[K]*sync.Mutex
+	mu     map[K]*highGranularityLock
 	s_lock sync.Mutex
 }
 
 func NewHighGranularityMutex[K Compareable]() *HighGranularityMutex[K] {
 	return &HighGranularityMutex[K]{
-		mu: make(map[K]*sync.Mutex),
+		mu: make(map[K]*highGranularityLock),
 	}
 }
 
@@ -18,22 +24,42 @@ func (c *HighGranularityMutex[K]) Lock(id K) {
 	// check if s_mu[id] exists
 	l, ok := c.mu[id]
 	if !ok || l == nil {
-		c.mu[id] = &sync.Mutex{}
+		l = &highGranularityLock{}
+		c.mu[id] = l
 	}
-	l = c.mu[id]
+	// waiters keep the lock in map, so that it's not replaced while they wait
+	l.refs++
 	c.s_lock.Unlock()
 	l.Lock()
 }
 
+// TryLock locks id if it's not held by others, it never blocks
+func (c *HighGranularityMutex[K]) TryLock(id K) bool {
+	c.s_lock.Lock()
+	defer c.s_lock.Unlock()
+	l, ok := c.mu[id]
+	if !ok || l == nil {
+		l = &highGranularityLock{}
+		c.mu[id] = l
+	}
+	if !l.TryLock() {
+		return false
+	}
+	l.refs++
+	return true
+}
+
 func (c *HighGranularityMutex[K]) Unlock(id K) {
 	c.s_lock.Lock()
+	defer c.s_lock.Unlock()
 	// check if s_mu[id] exists
 	l, ok := c.mu[id]
 	if !ok || l == nil {
-		c.s_lock.Unlock()
 		return
 	}
+	l.refs--
+	if l.refs <= 0 {
+		delete(c.mu, id)
+	}
 	l.Unlock()
-	delete(c.mu, id)
-	c.s_lock.Unlock()
 }
@@ -0,0 +1,55 @@
+package helper
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHighGranularityMutex(t *testing.T) {
+	mutex := NewHighGranularityMutex[string]()
+
+	mutex.Lock("a")
+	if mutex.TryLock("a") {
+		t.Fatalf("held id is locked again")
+	}
+	if !mutex.TryLock("b") {
+		t.Fatalf("another id is not locked")
+	}
+	mutex.Unlock("b")
+	mutex.Unlock("a")
+
+	if !mutex.TryLock("a") {
+		t.Fatalf("released id is not locked")
+	}
+	mutex.Unlock("a")
+
+	// holders of an id never overlap, even when some of them wait while it's released
+	var wg sync.WaitGroup
+	var holders_lock sync.Mutex
+	holders := 0
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			mutex.Lock("c")
+			holders_lock.Lock()
+			holders++
+			overlapped := holders > 1
+			holders_lock.Unlock()
+			if overlapped {
+				t.Errorf("id is held by more than one")
+			}
+			time.Sleep(time.Millisecond)
+			holders_lock.Lock()
+			holders--
+			holders_lock.Unlock()
+			mutex.Unlock("c")
+		}()
+	}
+	wg.Wait()
+
+	if len(mutex.mu) != 0 {
+		t.Errorf("locks are leaked: %d", len(mutex.mu))
+	}
+}
@@ -0,0 +1,62 @@
+package helper
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+)
+
+/*
+	secrets sent between server and client are sealed by AES-256-GCM with the sha256 of
+	kisara.token as the key, the random nonce is prepended to the cipher text
+*/
+
+func sealCipher(token string) (cipher.AEAD, error) {
+	key := sha256.Sum256([]byte(token))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// SealSecret encrypts secret by token and encodes it in base64
+func SealSecret(token string, secret []byte) (string, error) {
+	aead, err := sealCipher(token)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(aead.Seal(nonce, nonce, secret, nil)), nil
+}
+
+// OpenSecret decrypts a secret sealed by SealSecret with the same token
+func OpenSecret(token string, sealed string) ([]byte, error) {
+	data, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := sealCipher(token)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < aead.NonceSize() {
+		return nil, errors.New("sealed secret is too short")
+	}
+
+	secret, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], nil)
+	if err != nil {
+		return nil, errors.New("failed to open sealed secret")
+	}
+	return secret, nil
+}
@@ -1,6 +1,10 @@
 package helper
 
 import (
+	"strings"
+	"sync"
+	"time"
+
 	"github.com/shirou/gopsutil/cpu"
 	"github.com/shirou/gopsutil/disk"
 	"github.com/shirou/gopsutil/mem"
@@ -126,17 +130,102 @@ func GetNetUsage() (uint64, uint64, error) {
 	return recv, sent, nil
 }
 
+/*
+ret:
+1. read bytes, 2. written bytes, 3. error
+*/
+func GetDiskIO() (uint64, uint64, error) {
+	counters, err := disk.IOCounters()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var read uint64
+	var written uint64
+	for name, v := range counters {
+		// partitions are counted by their disk already
+		if isPartition(name, counters) {
+			continue
+		}
+		read += v.ReadBytes
+		written += v.WriteBytes
+	}
+
+	return read, written, nil
+}
+
+// isPartition tells sda1 of sda and nvme0n1p1 of nvme0n1, but not dm-10 of dm-1
+func isPartition(name string, counters map[string]disk.IOCountersStat) bool {
+	for other := range counters {
+		if other == name || !strings.HasPrefix(name, other) {
+			continue
+		}
+		suffix := name[len(other):]
+		last := other[len(other)-1]
+		if last >= '0' && last <= '9' {
+			if strings.HasPrefix(suffix, "p") && isDigits(suffix[1:]) {
+				return true
+			}
+		} else if isDigits(suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+var (
+	last_net_recv uint64
+	last_net_sent uint64
+	last_net_time time.Time
+	last_net_lock sync.Mutex
+)
+
+/*
+	GetNetUsagePercent returns the fractions of bandwidth used since last call, bandwidth is set by
+	kisaraClient.network_in and kisaraClient.network_out in bits per second, the first call returns 0
+*/
 func GetNetUsagePercent() (float64, float64, error) {
 	recv, sent, err := GetNetUsage()
 	if err != nil {
 		return 0, 0, err
 	}
 
+	last_net_lock.Lock()
+	defer last_net_lock.Unlock()
+
+	now := time.Now()
+	elapsed := now.Sub(last_net_time).Seconds()
+	first := last_net_time.IsZero()
+	// counters may be reset when interfaces are recreated
+	reset := recv < last_net_recv || sent < last_net_sent
+	recv_delta, sent_delta := recv-last_net_recv, sent-last_net_sent
+	last_net_recv, last_net_sent, last_net_time = recv, sent, now
+	if first || reset || elapsed <= 0 {
+		return 0, 0, nil
+	}
+
 	total_recv := GetConfigInteger("kisaraClient.network_in")
 	total_sent := GetConfigInteger("kisaraClient.network_out")
 
-	recv_percent := float64(recv) / float64(total_recv)
-	sent_percent := float64(sent) / float64(total_sent)
+	recv_percent, sent_percent := 0.0, 0.0
+	if total_recv > 0 {
+		recv_percent = float64(recv_delta) * 8 / elapsed / float64(total_recv)
+	}
+	if total_sent > 0 {
+		sent_percent = float64(sent_delta) * 8 / elapsed / float64(total_sent)
+	}
 
 	return recv_percent, sent_percent, nil
 }
@@ -0,0 +1,63 @@
+package helper
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+const (
+	HEADER_KISARA_TIMESTAMP = "X-Kisara-Timestamp"
+	HEADER_KISARA_NONCE     = "X-Kisara-Nonce"
+	HEADER_KISARA_SIGNATURE = "X-Kisara-Signature"
+)
+
+/*
+	SignRequest computes the HMAC-SHA256 signature of a request, the signature covers
+	method, request uri (path and query), timestamp, nonce and the sha256 of body
+*/
+func SignRequest(token string, method string, uri string, timestamp int64, nonce string, body []byte) string {
+	body_hash := sha256.Sum256(body)
+	return SignRequestHash(token, method, uri, timestamp, nonce, body_hash[:])
+}
+
+// SignRequestHash is SignRequest with the sha256 of body computed by caller, so body could be streamed
+func SignRequestHash(token string, method string, uri string, timestamp int64, nonce string, body_hash []byte) string {
+	mac := hmac.New(sha256.New, []byte(token))
+	mac.Write([]byte(method + "\n" + uri + "\n" + strconv.FormatInt(timestamp, 10) + "\n" + nonce + "\n"))
+	mac.Write([]byte(hex.EncodeToString(body_hash)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyRequestSignature compares the signature in constant time
+func VerifyRequestSignature(token string, method string, uri string, timestamp int64, nonce string, body []byte, signature string) bool {
+	body_hash := sha256.Sum256(body)
+	return VerifyRequestSignatureHash(token, method, uri, timestamp, nonce, body_hash[:], signature)
+}
+
+// VerifyRequestSignatureHash is VerifyRequestSignature with the sha256 of body computed by caller
+func VerifyRequestSignatureHash(token string, method string, uri string, timestamp int64, nonce string, body_hash []byte, signature string) bool {
+	expected := SignRequestHash(token, method, uri, timestamp, nonce, body_hash)
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
+
+// SignedHeaders generates a fresh timestamp and nonce and returns all headers needed by a signed request
+func SignedHeaders(token string, method string, uri string, body []byte) map[string]string {
+	body_hash := sha256.Sum256(body)
+	return SignedHeadersHash(token, method, uri, body_hash[:])
+}
+
+// SignedHeadersHash is SignedHeaders with the sha256 of body computed by caller
+func SignedHeadersHash(token string, method string, uri string, body_hash []byte) map[string]string {
+	timestamp := time.Now().Unix()
+	nonce := uuid.NewV4().String()
+	return map[string]string{
+		HEADER_KISARA_TIMESTAMP: strconv.FormatInt(timestamp, 10),
+		HEADER_KISARA_NONCE:     nonce,
+		HEADER_KISARA_SIGNATURE: SignRequestHash(token, method, uri, timestamp, nonce, body_hash),
+	}
+}
@@ -0,0 +1,92 @@
+package helper
+
+import (
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestVerifyRequestSignature(t *testing.T) {
+	const token = "kisara-test-token"
+	body := []byte(`{"client_id":"a"}`)
+	signature := SignRequest(token, "POST", "/container/launch?x=1", 1000, "nonce", body)
+
+	cases := []struct {
+		name      string
+		token     string
+		method    string
+		uri       string
+		timestamp int64
+		nonce     string
+		body      []byte
+		signature string
+		valid     bool
+	}{
+		{"valid", token, "POST", "/container/launch?x=1", 1000, "nonce", body, signature, true},
+		{"wrong token", "other", "POST", "/container/launch?x=1", 1000, "nonce", body, signature, false},
+		{"tampered method", token, "GET", "/container/launch?x=1", 1000, "nonce", body, signature, false},
+		{"tampered uri", token, "POST", "/container/launch", 1000, "nonce", body, signature, false},
+		{"tampered query", token, "POST", "/container/launch?x=2", 1000, "nonce", body, signature, false},
+		{"tampered timestamp", token, "POST", "/container/launch?x=1", 1001, "nonce", body, signature, false},
+		{"tampered nonce", token, "POST", "/container/launch?x=1", 1000, "nonce2", body, signature, false},
+		{"tampered body", token, "POST", "/container/launch?x=1", 1000, "nonce", []byte(`{"client_id":"b"}`), signature, false},
+		{"empty signature", token, "POST", "/container/launch?x=1", 1000, "nonce", body, "", false},
+		{"truncated signature", token, "POST", "/container/launch?x=1", 1000, "nonce", body, signature[:10], false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := VerifyRequestSignature(c.token, c.method, c.uri, c.timestamp, c.nonce, c.body, c.signature)
+			if got != c.valid {
+				t.Errorf("expected %v, got %v", c.valid, got)
+			}
+		})
+	}
+}
+
+func TestSignedHeaders(t *testing.T) {
+	body := []byte("body")
+	headers := SignedHeaders("token", "POST", "/status", body)
+
+	timestamp := headers[HEADER_KISARA_TIMESTAMP]
+	nonce := headers[HEADER_KISARA_NONCE]
+	if timestamp == "" || nonce == "" {
+		t.Fatalf("timestamp and nonce are required, got %v", headers)
+	}
+
+	other := SignedHeaders("token", "POST", "/status", body)
+	if other[HEADER_KISARA_NONCE] == nonce {
+		t.Errorf("nonce is reused")
+	}
+}
+
+func TestSignedMultipartRequest(t *testing.T) {
+	_, req, err := buildHttpRequest("POST", "http://127.0.0.1/image/build",
+		HttpPyloadMultipart(map[string]string{"image_name": "a"}, HttpPayloadMultipartFile("context.tar", strings.NewReader("context"))),
+		HttpSign("token"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the body is spooled to a file while it's hashed, the signature covers what is sent
+	spool := req.Body.(spoolBody).Name()
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int64(len(body)) != req.ContentLength || !strings.Contains(string(body), "context") {
+		t.Fatalf("unexpected body of %d bytes: %q", req.ContentLength, body)
+	}
+	timestamp, _ := strconv.ParseInt(req.Header.Get(HEADER_KISARA_TIMESTAMP), 10, 64)
+	if !VerifyRequestSignature("token", "POST", "/image/build", timestamp, req.Header.Get(HEADER_KISARA_NONCE), body, req.Header.Get(HEADER_KISARA_SIGNATURE)) {
+		t.Fatalf("signature does not match the body")
+	}
+
+	req.Body.Close()
+	if _, err := os.Stat(spool); !os.IsNotExist(err) {
+		t.Fatalf("spooled body is not removed: %v", err)
+	}
+}
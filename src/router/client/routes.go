@@ -1,12 +1,48 @@
 package client
 
 import (
+	"github.com/Yeuoly/kisara/src/controller"
 	"github.com/Yeuoly/kisara/src/controller/client"
 	"github.com/Yeuoly/kisara/src/router"
+	"github.com/Yeuoly/kisara/src/routine/metrics"
+	synergy_client "github.com/Yeuoly/kisara/src/routine/synergy/client"
 	"github.com/gin-gonic/gin"
 )
 
 func Setup(eng *gin.Engine) {
+	// metrics are scraped by prometheus, they are registered before signature is required
+	eng.GET(router.URI_METRICS, metrics.Handler())
+	// every endpoint requires a request signed by kisara.token
+	eng.Use(controller.SignatureMiddleware())
+	// uploads are rejected before they are hashed if they could not be extracted anyway
+	controller.SetBodyLimit(router.URI_CLIENT_COPY_TO_CONTAINER, client.CopyToContainerBodyLimit)
+	setupRoutes(eng)
+}
+
+/*
+	SetupChannel serves requests from control channel, long-running operations are handled
+	synchronously with streamed progress, the others are dispatched to the same http handlers,
+	channel is authenticated when it's opened so requests in it are not signed
+*/
+func SetupChannel() {
+	eng := gin.New()
+	setupRoutes(eng)
+	synergy_client.SetChannelFallback(eng)
+
+	synergy_client.RegisterChannelHandler(router.URI_CLIENT_LAUNCH_CONTAINER, client.ChannelLaunchContainer)
+	synergy_client.RegisterChannelHandler(router.URI_CLIENT_PULL_IMAGE, client.ChannelPullImage)
+	synergy_client.RegisterChannelStream(router.URI_CLIENT_BUILD_IMAGE, client.ChannelBuildImage)
+	synergy_client.RegisterChannelHandler(router.URI_CLIENT_LAUNCH_SERVICE, client.ChannelLaunchService)
+	synergy_client.RegisterChannelHandler(router.URI_CLIENT_STOP_SERVICE, client.ChannelStopService)
+	synergy_client.RegisterChannelHandler(router.URI_CLIENT_NETWORK_MONITOR_RUN, client.ChannelNetworkMonitorRun)
+	synergy_client.RegisterChannelStream(router.URI_CLIENT_EXEC_CONTAINER_IO, client.ChannelExecContainerIO)
+	synergy_client.RegisterChannelStream(router.URI_CLIENT_COPY_TO_CONTAINER, client.ChannelCopyToContainer)
+	synergy_client.RegisterChannelStream(router.URI_CLIENT_COPY_FROM_CONTAINER, client.ChannelCopyFromContainer)
+	synergy_client.RegisterChannelStream(router.URI_CLIENT_CONTAINER_LOGS_FOLLOW, client.ChannelFollowContainerLogs)
+	synergy_client.RegisterChannelStream(router.URI_CLIENT_SAVE_IMAGE, client.ChannelSaveImage)
+}
+
+func setupRoutes(eng *gin.Engine) {
 	eng.POST(router.URI_CLIENT_CREATE_NETWORK, client.HandleCreateSubnet)
 	eng.POST(router.URI_CLIENT_REMOVE_NETWORK, client.HandleDeleteSubnet)
 	eng.GET(router.URI_CLIENT_LIST_NETWORK, client.HandleListSubnet)
@@ -14,18 +50,31 @@ func Setup(eng *gin.Engine) {
 	eng.POST(router.URI_CLIENT_LAUNCH_CONTAINER, client.HandleLaunchContainer)
 	eng.GET(router.URI_CLIENT_LAUNCH_CONTAINER_CHECK, client.HandleCheckLaunchContainerStatus)
 	eng.POST(router.URI_CLIENT_STOP_CONTAINER, client.HandleStopContainer)
+	eng.POST(router.URI_CLIENT_EXTEND_CONTAINER, client.HandleExtendContainer)
 	eng.POST(router.URI_CLIENT_REMOVE_CONTAINER, client.HandleRemoveContainer)
 	eng.POST(router.URI_CLIENT_EXEC_CONTAINER, client.HandleExecContainer)
+	eng.GET(router.URI_CLIENT_EXEC_CONTAINER_IO, client.HandleExecContainerIO)
 	eng.GET(router.URI_CLIENT_LIST_IMAGE, client.HandleListImage)
 	eng.POST(router.URI_CLIENT_INSPECT_CONTAINER, client.HandleInspectContainers)
+	eng.POST(router.URI_CLIENT_COPY_TO_CONTAINER, client.HandleCopyToContainer)
+	eng.GET(router.URI_CLIENT_COPY_FROM_CONTAINER, client.HandleCopyFromContainer)
+	eng.POST(router.URI_CLIENT_CONTAINER_LOGS, client.HandleContainerLogs)
+	eng.GET(router.URI_CLIENT_CONTAINER_LOGS_FOLLOW, client.HandleFollowContainerLogs)
+	eng.POST(router.URI_CLIENT_RESOURCE_HISTORY, client.HandleResourceHistory)
 	eng.POST(router.URI_CLIENT_PULL_IMAGE, client.HandlePullImage)
 	eng.GET(router.URI_CLIENT_PULL_IMAGE_CHECK, client.HandleCheckPullImage)
 	eng.POST(router.URI_CLIENT_DELETE_IMAGE, client.HandleDeleteImage)
+	eng.POST(router.URI_CLIENT_PRUNE_IMAGES, client.HandlePruneImages)
+	eng.GET(router.URI_CLIENT_SAVE_IMAGE, client.HandleSaveImage)
+	eng.POST(router.URI_CLIENT_FETCH_IMAGE, client.HandleFetchImage)
+	eng.POST(router.URI_CLIENT_BUILD_IMAGE, client.HandleBuildImage)
+	eng.GET(router.URI_CLIENT_BUILD_IMAGE_CHECK, client.HandleCheckBuildImage)
 	eng.POST(router.URI_CLIENT_LAUNCH_SERVICE, client.HandleLaunchService)
 	eng.GET(router.URI_CLIENT_LAUNCH_SERVICE_CHECK, client.HandleCheclLaunchService)
 	eng.POST(router.URI_CLIENT_STOP_SERVICE, client.HandleStopService)
 	eng.GET(router.URI_CLIENT_STOP_SERVICE_CHECK, client.HandleCheckStopService)
 	eng.GET(router.URI_CLIENT_LIST_SERVICE, client.HandleListService)
+	eng.POST(router.URI_CLIENT_ROTATE_SERVICE_FLAGS, client.HandleRotateServiceFlags)
 	eng.POST(router.URI_CLIENT_NETWORK_MONITOR_RUN, client.HandleNetworkMonitorRun)
 	eng.GET(router.URI_CLIENT_NETWORK_MONITOR_RUN_CHECK, client.HandleNetworkMonitorRunCheck)
 	eng.POST(router.URI_CLIENT_NETWORK_MONITOR_STOP, client.HandleNetworkMonitorStop)
@@ -1,15 +1,27 @@
 package server
 
 import (
+	"github.com/Yeuoly/kisara/src/controller"
 	"github.com/Yeuoly/kisara/src/router"
+	"github.com/Yeuoly/kisara/src/routine/metrics"
 	"github.com/gin-gonic/gin"
 
 	server_controller "github.com/Yeuoly/kisara/src/controller/server"
 )
 
 func Setup(eng *gin.Engine) {
+	// metrics are scraped by prometheus, they are registered before signature is required
+	eng.GET(router.URI_METRICS, metrics.Handler())
+	// events could be subscribed by browsers with kisara.events_token as well
+	eng.GET(router.URI_SERVER_EVENTS, controller.TokenOrSignatureMiddleware("kisara.events_token"), server_controller.HandleEvents)
+	// every endpoint requires a request signed by kisara.token
+	eng.Use(controller.SignatureMiddleware())
+
 	eng.POST(router.URI_SERVER_CONNECT, server_controller.HandleConnect)
 	eng.POST(router.URI_SERVER_DISCONNECT, server_controller.HandleDisconnect)
 	eng.POST(router.URI_SERVER_HEARTBEAT, server_controller.HandleHeartBeat)
 	eng.POST(router.URI_SERVER_STATUS, server_controller.HandleRecvStatus)
+	eng.GET(router.URI_SERVER_CHANNEL, server_controller.HandleChannel)
+	eng.POST(router.URI_SERVER_IMAGE_PEERS, server_controller.HandleImagePeers)
+	eng.GET(router.URI_SERVER_IMAGE_SAVE, server_controller.HandleSaveImage)
 }
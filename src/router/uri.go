@@ -1,18 +1,31 @@
 package router
 
 const (
-	URI_SERVER_CONNECT    = "/connect"    // connect to server
-	URI_SERVER_DISCONNECT = "/disconnect" // disconnect from server
-	URI_SERVER_HEARTBEAT  = "/heartbeat"  // heartbeat to server
-	URI_SERVER_STATUS     = "/status"     // report status to server
+	URI_METRICS = "/metrics" // prometheus metrics, served by both server and client
+
+	URI_SERVER_CONNECT     = "/connect"     // connect to server
+	URI_SERVER_DISCONNECT  = "/disconnect"  // disconnect from server
+	URI_SERVER_HEARTBEAT   = "/heartbeat"   // heartbeat to server
+	URI_SERVER_STATUS      = "/status"      // report status to server
+	URI_SERVER_CHANNEL     = "/channel"     // control channel opened by client
+	URI_SERVER_EVENTS      = "/events"      // stream of cluster events
+	URI_SERVER_IMAGE_PEERS = "/image/peers" // nodes having an image
+	URI_SERVER_IMAGE_SAVE  = "/image/save"  // image of a node relayed from its channel
 
 	URI_CLIENT_LAUNCH_CONTAINER          = "/container/launch"          // launch container
 	URI_CLIENT_LAUNCH_CONTAINER_CHECK    = "/container/launch/check"    // launch container check
 	URI_CLIENT_STOP_CONTAINER            = "/container/stop"            // stop container
+	URI_CLIENT_EXTEND_CONTAINER          = "/container/extend"          // extend lifetime of container
 	URI_CLIENT_REMOVE_CONTAINER          = "/container/remove"          // remove container
 	URI_CLIENT_LIST_CONTAINER            = "/container/list"            // list container
 	URI_CLIENT_EXEC_CONTAINER            = "/container/exec"            // exec container
+	URI_CLIENT_EXEC_CONTAINER_IO         = "/container/exec/io"         // interactive exec container through websocket
 	URI_CLIENT_INSPECT_CONTAINER         = "/container/inspect"         // inspect container
+	URI_CLIENT_COPY_TO_CONTAINER         = "/container/copy/to"         // copy tar archive into container
+	URI_CLIENT_COPY_FROM_CONTAINER       = "/container/copy/from"       // copy path out of container as a tar archive
+	URI_CLIENT_CONTAINER_LOGS            = "/container/logs"            // logs of container
+	URI_CLIENT_CONTAINER_LOGS_FOLLOW     = "/container/logs/follow"     // stream logs of container until it stops
+	URI_CLIENT_RESOURCE_HISTORY          = "/resource/history"          // usage history of node and containers
 	URI_CLIENT_CREATE_NETWORK            = "/network/create"            // create network
 	URI_CLIENT_LIST_NETWORK              = "/network/list"              // list network
 	URI_CLIENT_REMOVE_NETWORK            = "/network/remove"            // remove network
@@ -20,11 +33,17 @@ const (
 	URI_CLIENT_PULL_IMAGE                = "/image/pull"                // pull image
 	URI_CLIENT_PULL_IMAGE_CHECK          = "/image/pull/check"          // pull image check
 	URI_CLIENT_DELETE_IMAGE              = "/image/delete"              // delete image
+	URI_CLIENT_PRUNE_IMAGES              = "/image/prune"               // remove unused images by gc rules
+	URI_CLIENT_SAVE_IMAGE                = "/image/save"                // stream image as a tar to peer
+	URI_CLIENT_FETCH_IMAGE               = "/image/fetch"               // copy image from peers
+	URI_CLIENT_BUILD_IMAGE               = "/image/build"               // build image from uploaded context
+	URI_CLIENT_BUILD_IMAGE_CHECK         = "/image/build/check"         // build image check
 	URI_CLIENT_LAUNCH_SERVICE            = "/service/launch"            // launch service
 	URI_CLIENT_LAUNCH_SERVICE_CHECK      = "/service/launch/check"      // launch service check
 	URI_CLIENT_STOP_SERVICE              = "/service/stop"              // stop service
 	URI_CLIENT_STOP_SERVICE_CHECK        = "/service/stop/check"        // stop service check
 	URI_CLIENT_LIST_SERVICE              = "/service/list"              // list service
+	URI_CLIENT_ROTATE_SERVICE_FLAGS      = "/service/flags/rotate"      // rotate flags of service
 	URI_CLIENT_NETWORK_MONITOR_RUN       = "/network/monitor/run"       // run network monitor
 	URI_CLIENT_NETWORK_MONITOR_RUN_CHECK = "/network/monitor/run/check" // run network monitor check
 	URI_CLIENT_NETWORK_MONITOR_STOP      = "/network/monitor/stop"      // stop network monitor
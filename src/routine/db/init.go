@@ -34,6 +34,12 @@ func registerModel() {
 	kisaraDB.AutoMigrate(&types.DBContainer{})
 	kisaraDB.AutoMigrate(&types.DBService{})
 	kisaraDB.AutoMigrate(&types.DBImage{})
+	kisaraDB.AutoMigrate(&types.DBContainerLog{})
+	kisaraDB.AutoMigrate(&types.DBNode{})
+	kisaraDB.AutoMigrate(&types.DBNodeContainer{})
+	kisaraDB.AutoMigrate(&types.DBNodeService{})
+	kisaraDB.AutoMigrate(&types.DBGame{})
+	kisaraDB.AutoMigrate(&types.DBGameRound{})
 }
 
 func CreateGeneric[T any](data *T) error {
@@ -0,0 +1,177 @@
+package docker
+
+/*
+	files are copied into and out of containers as tar archives, the size of an archive is
+	limited by kisaraClient.copy_max_size, paths are absolute paths in the container and
+	entries of an archive copied in must stay under the directory it's extracted to
+*/
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/Yeuoly/kisara/src/helper"
+	"github.com/docker/docker/api/types"
+)
+
+const (
+	COPY_MAX_SIZE = 100 * 1024 * 1024 // default max size of a copied archive, 100MB
+)
+
+var (
+	ErrCopyTooLarge = errors.New("archive exceeds copy size limit")
+)
+
+// pseudo filesystems of the container, nothing should be copied into or out of them
+var copy_forbidden_paths = []string{"/proc", "/sys", "/dev"}
+
+// CopyMaxSize returns the max size of an archive copied into or out of a container
+func CopyMaxSize() int64 {
+	if size := helper.GetConfigInt64("kisaraClient.copy_max_size"); size > 0 {
+		return size
+	}
+	return COPY_MAX_SIZE
+}
+
+// ValidateContainerPath checks p is an absolute path in the container and returns it cleaned
+func ValidateContainerPath(p string) (string, error) {
+	if !path.IsAbs(p) {
+		return "", errors.New("path must be absolute")
+	}
+	if strings.ContainsRune(p, 0) {
+		return "", errors.New("path contains null byte")
+	}
+	for _, element := range strings.Split(p, "/") {
+		if element == ".." {
+			return "", errors.New("path must not contain ..")
+		}
+	}
+
+	p = path.Clean(p)
+	for _, forbidden := range copy_forbidden_paths {
+		if p == forbidden || strings.HasPrefix(p, forbidden+"/") {
+			return "", fmt.Errorf("path under %s is not allowed", forbidden)
+		}
+	}
+	return p, nil
+}
+
+/*
+	validateCopyArchive checks every entry of a tar archive stays under the directory it's extracted
+	to, links must point inside it and nothing could be written through a symlink of the archive
+*/
+func validateCopyArchive(reader io.Reader) error {
+	tar_reader := tar.NewReader(reader)
+	symlinks := make(map[string]bool)
+	for {
+		header, err := tar_reader.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("broken archive: %s", err.Error())
+		}
+
+		name := path.Clean(header.Name)
+		if escapesDestination(name) {
+			return fmt.Errorf("entry %s is out of the destination", header.Name)
+		}
+		// an entry under a symlink would be written wherever the symlink points to
+		if parent := underSymlink(name, symlinks); parent != "" {
+			return fmt.Errorf("entry %s is under symlink %s", header.Name, parent)
+		}
+
+		switch header.Typeflag {
+		case tar.TypeLink:
+			// hard links are relative to the root of the archive
+			linkname := path.Clean(header.Linkname)
+			if escapesDestination(linkname) || underSymlink(linkname, symlinks) != "" {
+				return fmt.Errorf("hard link %s is out of the destination", header.Name)
+			}
+		case tar.TypeSymlink:
+			// symlinks are relative to the directory containing them
+			if path.IsAbs(header.Linkname) || escapesDestination(path.Join(path.Dir(name), header.Linkname)) {
+				return fmt.Errorf("symlink %s is out of the destination", header.Name)
+			}
+			symlinks[name] = true
+		}
+	}
+}
+
+func escapesDestination(name string) bool {
+	name = path.Clean(name)
+	return path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../")
+}
+
+// underSymlink returns the symlink which name is under, empty if there is none
+func underSymlink(name string, symlinks map[string]bool) string {
+	for parent := path.Dir(name); parent != "." && parent != "/"; parent = path.Dir(parent) {
+		if symlinks[parent] {
+			return parent
+		}
+	}
+	return ""
+}
+
+// CopyToContainer extracts a tar archive to dst_path, a directory existing in the container
+// content is read twice, once for validation and once for copying
+func (c *Docker) CopyToContainer(container_id string, dst_path string, content io.ReadSeeker, size int64) error {
+	if size > CopyMaxSize() {
+		return ErrCopyTooLarge
+	}
+
+	dst_path, err := ValidateContainerPath(dst_path)
+	if err != nil {
+		return err
+	}
+
+	if err := validateCopyArchive(io.LimitReader(content, size)); err != nil {
+		return err
+	}
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	return c.Client.CopyToContainer(*c.Ctx, container_id, dst_path, io.LimitReader(content, size), types.CopyToContainerOptions{})
+}
+
+// CopyFromContainer opens src_path in the container as a tar archive, the caller should close it
+// reading more than the copy size limit fails with ErrCopyTooLarge
+func (c *Docker) CopyFromContainer(container_id string, src_path string) (io.ReadCloser, error) {
+	src_path, err := ValidateContainerPath(src_path)
+	if err != nil {
+		return nil, err
+	}
+
+	reader, _, err := c.Client.CopyFromContainer(*c.Ctx, container_id, src_path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &limitedReadCloser{reader: reader, remain: CopyMaxSize()}, nil
+}
+
+type limitedReadCloser struct {
+	reader io.ReadCloser
+	remain int64
+}
+
+func (l *limitedReadCloser) Read(p []byte) (int, error) {
+	// one byte more than the limit tells an exceeded stream from one ending right at the limit
+	if int64(len(p)) > l.remain+1 {
+		p = p[:l.remain+1]
+	}
+	n, err := l.reader.Read(p)
+	l.remain -= int64(n)
+	if l.remain < 0 {
+		return 0, ErrCopyTooLarge
+	}
+	return n, err
+}
+
+func (l *limitedReadCloser) Close() error {
+	return l.reader.Close()
+}
@@ -0,0 +1,56 @@
+package docker
+
+import (
+	"archive/tar"
+	"bytes"
+	"testing"
+)
+
+func TestValidateCopyArchive(t *testing.T) {
+	file := func(name string) *tar.Header {
+		return &tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0644}
+	}
+	symlink := func(name string, target string) *tar.Header {
+		return &tar.Header{Name: name, Typeflag: tar.TypeSymlink, Linkname: target, Mode: 0777}
+	}
+	hardlink := func(name string, target string) *tar.Header {
+		return &tar.Header{Name: name, Typeflag: tar.TypeLink, Linkname: target, Mode: 0644}
+	}
+
+	cases := []struct {
+		name    string
+		headers []*tar.Header
+		valid   bool
+	}{
+		{"plain files", []*tar.Header{file("a"), file("dir/b")}, true},
+		{"parent escape", []*tar.Header{file("../a")}, false},
+		{"absolute entry", []*tar.Header{file("/etc/passwd")}, false},
+		{"relative symlink", []*tar.Header{symlink("dir/link", "../a")}, true},
+		{"absolute symlink", []*tar.Header{symlink("link", "/etc")}, false},
+		{"escaping symlink", []*tar.Header{symlink("dir/link", "../../etc")}, false},
+		{"entry under symlink", []*tar.Header{symlink("link", "dir"), file("link/a")}, false},
+		{"entry deep under symlink", []*tar.Header{symlink("dir/link", "sub"), file("dir/link/x/a")}, false},
+		{"sibling of symlink", []*tar.Header{symlink("link", "dir"), file("linked/a")}, true},
+		{"hard link inside", []*tar.Header{file("a"), hardlink("b", "a")}, true},
+		{"hard link escape", []*tar.Header{hardlink("b", "../a")}, false},
+		{"hard link through symlink", []*tar.Header{symlink("link", "dir"), hardlink("b", "link/a")}, false},
+	}
+
+	for _, c := range cases {
+		var buf bytes.Buffer
+		writer := tar.NewWriter(&buf)
+		for _, header := range c.headers {
+			if err := writer.WriteHeader(header); err != nil {
+				t.Fatalf("%s: %s", c.name, err.Error())
+			}
+		}
+		writer.Close()
+
+		err := validateCopyArchive(&buf)
+		if c.valid && err != nil {
+			t.Errorf("%s: unexpected error %s", c.name, err.Error())
+		} else if !c.valid && err == nil {
+			t.Errorf("%s: expected an error", c.name)
+		}
+	}
+}
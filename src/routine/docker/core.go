@@ -1,6 +1,7 @@
 package docker
 
 import (
+	"bytes"
 	"context"
 	"encoding/binary"
 	"encoding/json"
@@ -22,6 +23,7 @@ import (
 	"github.com/docker/docker/api/types/mount"
 	"github.com/docker/docker/api/types/network"
 	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
 	uuid "github.com/satori/go.uuid"
 )
 
@@ -58,6 +60,11 @@ type containerMonitor struct {
 	MemTotal    uint64
 	CPUPer      float64
 	MemPer      float64
+	// cumulative bytes of network and block I/O
+	NetRx    uint64
+	NetTx    uint64
+	BlkRead  uint64
+	BlkWrite uint64
 }
 
 var containerMonitors sync.Map
@@ -111,7 +118,7 @@ func attachMonitor(container_id string) {
 		systemDelta := float64(v.CPUStats.SystemUsage - v.PreCPUStats.SystemUsage)
 		cpuPercent := (cpuDelta / systemDelta) * float64(len(v.CPUStats.CPUUsage.PercpuUsage)) * 100.0
 
-		setMonitor(container_id, containerMonitor{
+		monitor := containerMonitor{
 			ContainerId: container_id,
 			CPUUsage:    v.CPUStats.CPUUsage.TotalUsage,
 			MemUsage:    v.MemoryStats.Usage,
@@ -119,7 +126,20 @@ func attachMonitor(container_id string) {
 			MemTotal:    v.MemoryStats.Limit,
 			CPUPer:      cpuPercent,
 			MemPer:      float64(v.MemoryStats.Usage) / float64(v.MemoryStats.Limit) * 100.0,
-		})
+		}
+		for _, network := range v.Networks {
+			monitor.NetRx += network.RxBytes
+			monitor.NetTx += network.TxBytes
+		}
+		// ops are capitalized by cgroup v1 and lowercase by cgroup v2
+		for _, entry := range v.BlkioStats.IoServiceBytesRecursive {
+			if strings.EqualFold(entry.Op, "read") {
+				monitor.BlkRead += entry.Value
+			} else if strings.EqualFold(entry.Op, "write") {
+				monitor.BlkWrite += entry.Value
+			}
+		}
+		setMonitor(container_id, monitor)
 	}
 }
 
@@ -149,7 +169,15 @@ func InitDocker() {
 		log.Panic("[docker] init docker failed")
 	}
 
+	// adopt services which are still alive before cleaning orphan containers
+	adopted := c.RecoverServices()
+
 	for _, container := range containers {
+		// containers of recovered services are kept
+		if adopted[container.ID] {
+			go attachMonitor(container.ID)
+			continue
+		}
 		// check if container belongs to irina
 		if container.Labels["irina"] == "true" {
 			err := c.StopContainer(container.ID)
@@ -224,13 +252,21 @@ func (c *Docker) Stop() {
 
 func (c *Docker) CreateContainer(
 	image string, uid int, port_protocol string,
-	subnet_names []string, module string,
+	subnet_names []string, options *kisara_types.ContainerOptions, module string,
 	env map[string]string, vol map[string]string,
-	cpu_usage float64, mem_usage int64, disk_usage int64,
+	resources kisara_types.ContainerResources,
 ) (*kisara_types.Container, error) {
 	log.Info("[docker] start launch container:" + image)
+	if options == nil {
+		options = &kisara_types.ContainerOptions{}
+	}
+	resources, err := resolveResources(resources)
+	if err != nil {
+		return nil, err
+	}
+
 	// require image first, if image not exist, kisara will pull it first
-	kisara_image, err := c.RequireImage(image, func(message string) {
+	kisara_image, err := c.RequireImage(image, options.ImageRefresh, options.Registry, func(message string) {
 		log.Info("[docker] require image:" + image + " " + message)
 	})
 	if err != nil {
@@ -252,6 +288,17 @@ func (c *Docker) CreateContainer(
 
 		endpoints[subnet_name] = &network.EndpointSettings{
 			NetworkID: subnet_instance.Id,
+			Aliases:   options.Aliases,
+		}
+
+		// static address, IPv4Addresses maps network name to address
+		if address := options.IPv4Addresses[subnet_name]; address != "" {
+			if err := c.CheckNetworkAddress(subnet_instance.Id, address); err != nil {
+				return nil, err
+			}
+			endpoints[subnet_name].IPAMConfig = &network.EndpointIPAMConfig{
+				IPv4Address: address,
+			}
 		}
 	}
 
@@ -281,6 +328,25 @@ func (c *Docker) CreateContainer(
 			Target: v,
 		})
 	}
+	for _, volume := range options.Volumes {
+		mounts = append(mounts, mount.Mount{
+			Type:     mount.TypeVolume,
+			Source:   volume.Source,
+			Target:   volume.Target,
+			ReadOnly: volume.ReadOnly,
+		})
+	}
+
+	var healthcheck *container.HealthConfig
+	if options.Healthcheck != nil && len(options.Healthcheck.Test) > 0 {
+		healthcheck = &container.HealthConfig{
+			Test:        options.Healthcheck.Test,
+			Interval:    time.Duration(options.Healthcheck.Interval) * time.Second,
+			Timeout:     time.Duration(options.Healthcheck.Timeout) * time.Second,
+			StartPeriod: time.Duration(options.Healthcheck.StartPeriod) * time.Second,
+			Retries:     options.Healthcheck.Retries,
+		}
+	}
 
 	uuid := uuid.NewV4().String()
 	resp, err := c.Client.ContainerCreate(
@@ -292,6 +358,9 @@ func (c *Docker) CreateContainer(
 			AttachStdin:  true,
 			AttachStdout: true,
 			Env:          envs,
+			Cmd:          options.Cmd,
+			Entrypoint:   options.Entrypoint,
+			Healthcheck:  healthcheck,
 			Labels: map[string]string{
 				"owner_uid": strconv.Itoa(uid),
 				"uuid":      uuid,
@@ -302,15 +371,10 @@ func (c *Docker) CreateContainer(
 		&container.HostConfig{
 			NetworkMode: container.NetworkMode(default_network_name),
 			Mounts:      mounts,
-			Resources: container.Resources{
-				//set max memory
-				Memory: mem_usage,
-				//set max cpu
-				NanoCPUs: int64(cpu_usage * 1000.0 * 1000.0 * 1000.0),
-				//set max disk
-				BlkioWeight: uint16(disk_usage / (GBYTES / 100)),
-			},
-			DNS: []string{docker_dns},
+			Resources:   hostResources(resources),
+			StorageOpt:  storageOpt(resources),
+			DNS:         []string{docker_dns},
+			CapAdd:      options.CapAdd,
 		},
 		&network.NetworkingConfig{
 			EndpointsConfig: map[string]*network.EndpointSettings{
@@ -368,7 +432,7 @@ func (c *Docker) CreateContainer(
 		if name == default_network_name {
 			continue
 		}
-		err = c.Client.NetworkConnect(*c.Ctx, network.NetworkID, resp.ID, nil)
+		err = c.Client.NetworkConnect(*c.Ctx, network.NetworkID, resp.ID, network)
 		if err != nil {
 			stop_container()
 			remove_container()
@@ -377,6 +441,13 @@ func (c *Docker) CreateContainer(
 		}
 	}
 
+	if err := c.limitBandwidth(resp.ID, resources); err != nil {
+		stop_container()
+		remove_container()
+		log.Warn("[docker] limit bandwidth error: " + err.Error())
+		return nil, err
+	}
+
 	// get at least one ip
 	container_default_ip := ""
 	for _, network := range inspect.NetworkSettings.Networks {
@@ -506,9 +577,9 @@ func (c *Docker) CheckImageExist(image_name string) bool {
 
 func (c *Docker) LaunchTargetMachine(image_name string, port_protocol string, subnet_name string, uid int, module string) (*kisara_types.Container, error) {
 	container, err := c.CreateContainer(
-		image_name, uid, port_protocol, []string{subnet_name},
+		image_name, uid, port_protocol, []string{subnet_name}, nil,
 		module, map[string]string{}, map[string]string{},
-		1.0, GBYTES*2, GBYTES*5,
+		kisara_types.ContainerResources{},
 	)
 	if err != nil {
 		log.Warn("[docker] create container failed: " + err.Error())
@@ -520,7 +591,7 @@ func (c *Docker) LaunchTargetMachine(image_name string, port_protocol string, su
 	return container, nil
 }
 
-func (c *Docker) LaunchContainer(image_name string, uid int, port_protocol string, subnet_name string, module string, env_mount ...map[string]string) (*kisara_types.Container, error) {
+func (c *Docker) LaunchContainer(image_name string, uid int, port_protocol string, subnet_name string, module string, options *kisara_types.ContainerOptions, resources kisara_types.ContainerResources, env_mount ...map[string]string) (*kisara_types.Container, error) {
 	var env, mount map[string]string
 
 	if len(env_mount) > 0 {
@@ -536,8 +607,8 @@ func (c *Docker) LaunchContainer(image_name string, uid int, port_protocol strin
 	}
 
 	container, err := c.CreateContainer(
-		image_name, uid, port_protocol, []string{subnet_name}, module,
-		env, mount, 1.0, GBYTES*2, GBYTES*5,
+		image_name, uid, port_protocol, []string{subnet_name}, options, module,
+		env, mount, resources,
 	)
 
 	if err != nil {
@@ -550,11 +621,11 @@ func (c *Docker) LaunchContainer(image_name string, uid int, port_protocol strin
 	return container, nil
 }
 
-func (c *Docker) LaunchAWD(image_name string, port_protocols string, uid int, subnet_name string, env map[string]string) (*kisara_types.Container, error) {
+func (c *Docker) LaunchAWD(image_name string, port_protocols string, uid int, subnet_name string, env map[string]string, resources kisara_types.ContainerResources) (*kisara_types.Container, error) {
 	mount := make(map[string]string)
 	container, err := c.CreateContainer(
-		image_name, uid, port_protocols, []string{subnet_name}, "awd",
-		env, mount, 1.0, GBYTES*2, GBYTES*5,
+		image_name, uid, port_protocols, []string{subnet_name}, nil, "awd",
+		env, mount, resources,
 	)
 	if err != nil {
 		log.Warn("[docker] create AWD container failed: " + err.Error())
@@ -566,13 +637,13 @@ func (c *Docker) LaunchAWD(image_name string, port_protocols string, uid int, su
 	return container, nil
 }
 
-func (c *Docker) LaunchServiceContainer(image_name string, port_protocols string, uid int, subnet_names []string, env map[string]string) (*kisara_types.Container, error) {
+func (c *Docker) LaunchServiceContainer(image_name string, port_protocols string, uid int, subnet_names []string, options *kisara_types.ContainerOptions, env map[string]string, resources kisara_types.ContainerResources) (*kisara_types.Container, error) {
 	//创建容器并留下记录
 	mount := make(map[string]string)
 	container, err := c.CreateContainer(
 		image_name, uid, port_protocols,
-		subnet_names, "service", env, mount,
-		1.0, GBYTES*2, GBYTES*5,
+		subnet_names, options, "service", env, mount,
+		resources,
 	)
 	if err != nil {
 		log.Warn("[docker] create service container failed: " + err.Error())
@@ -651,8 +722,17 @@ func (c *Docker) StopContainer(id string) error {
 	if err != nil {
 		return nil
 	}
-	err = c.Client.ContainerRemove(*c.Ctx, id, types.ContainerRemoveOptions{})
+	c.retainContainerLogs(id)
+	// anonymous volumes go with the container
+	err = c.Client.ContainerRemove(*c.Ctx, id, types.ContainerRemoveOptions{RemoveVolumes: true})
 	if err == nil {
+		// container is gone, so is its record
+		container, err := db.GetGenericOne[kisara_types.DBContainer](
+			db.GenericEqual("container_id", id),
+		)
+		if err == nil {
+			db.DeleteGeneric(&container)
+		}
 		callOnContainerStopHooks(c, kisara_container)
 	}
 
@@ -666,6 +746,12 @@ func (c *Docker) RemoveContainer(id string) error {
 }
 
 func (c *Docker) Exec(container_id string, cmd string) error {
+	_, _, _, err := c.ExecOutput(container_id, cmd)
+	return err
+}
+
+// ExecOutput runs cmd in container and returns its stdout, stderr and exit code
+func (c *Docker) ExecOutput(container_id string, cmd string) (string, string, int, error) {
 	exec, err := c.Client.ContainerExecCreate(*c.Ctx, container_id, types.ExecConfig{
 		AttachStdin:  false,
 		AttachStderr: true,
@@ -675,7 +761,7 @@ func (c *Docker) Exec(container_id string, cmd string) error {
 		Cmd:          []string{"sh", "-c", cmd},
 	})
 	if err != nil {
-		return err
+		return "", "", 0, err
 	}
 
 	resp, err := c.Client.ContainerExecAttach(*c.Ctx, exec.ID, types.ExecStartCheck{
@@ -683,19 +769,27 @@ func (c *Docker) Exec(container_id string, cmd string) error {
 		Tty:    false,
 	})
 	if err != nil {
-		return err
+		return "", "", 0, err
 	}
+	defer resp.Close()
 
-	_, err = io.ReadAll(resp.Reader)
+	stdout := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+	_, err = stdcopy.StdCopy(stdout, stderr, resp.Reader)
+	if err != nil {
+		return "", "", 0, err
+	}
 
+	exit_code, err := c.execExitCode(exec.ID)
 	if err != nil {
-		return err
+		return "", "", 0, err
 	}
 
-	return nil
+	return stdout.String(), stderr.String(), exit_code, nil
 }
 
-func (c *Docker) ExecWarp(container_id string, cmd string, timeout time.Duration) ([]byte, error) {
+// ExecWarp runs cmd in container within timeout and returns its output and exit code
+func (c *Docker) ExecWarp(container_id string, cmd string, timeout time.Duration) ([]byte, int, error) {
 	exec, err := c.Client.ContainerExecCreate(*c.Ctx, container_id, types.ExecConfig{
 		AttachStdin:  true,
 		AttachStderr: true,
@@ -703,7 +797,7 @@ func (c *Docker) ExecWarp(container_id string, cmd string, timeout time.Duration
 		Cmd:          []string{"sh", "-c", cmd},
 	})
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
 	resp, err := c.Client.ContainerExecAttach(*c.Ctx, exec.ID, types.ExecStartCheck{
@@ -711,7 +805,7 @@ func (c *Docker) ExecWarp(container_id string, cmd string, timeout time.Duration
 		Tty:    false,
 	})
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
 	resp.Conn.SetDeadline(time.Now().Add(timeout))
@@ -734,7 +828,7 @@ func (c *Docker) ExecWarp(container_id string, cmd string, timeout time.Duration
 			if err == io.EOF {
 				break
 			}
-			return nil, err
+			return nil, 0, err
 		}
 
 		if len(last) == 0 {
@@ -744,7 +838,12 @@ func (c *Docker) ExecWarp(container_id string, cmd string, timeout time.Duration
 		}
 	}
 
-	return result, nil
+	exit_code, err := c.execExitCode(exec.ID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return result, exit_code, nil
 }
 
 func (c *Docker) ListContainer() (*[]*kisara_types.Container, error) {
@@ -764,9 +863,11 @@ func (c *Docker) ListContainer() (*[]*kisara_types.Container, error) {
 			db.GenericEqual("container_id", container.ID),
 		)
 
+		expire_at := int64(0)
 		if err == nil {
 			labels_str := db_container.Labels
 			json.Unmarshal([]byte(labels_str), &labels)
+			expire_at = db_container.ExpireAt
 		}
 
 		owner_uid, _ := strconv.Atoi(container.Labels["owner_uid"])
@@ -778,6 +879,7 @@ func (c *Docker) ListContainer() (*[]*kisara_types.Container, error) {
 			Uuid:     labels["uuid"],
 			HostPort: labels["host_port"],
 			Status:   container.Status,
+			ExpireAt: expire_at,
 		})
 	}
 
@@ -808,6 +910,25 @@ func (c *Docker) ListImage() (*[]*kisara_types.Image, error) {
 	return &image_list, nil
 }
 
+// ListImageTags returns all tags of images, normalized by NormalizeImageName
+func (c *Docker) ListImageTags() ([]string, error) {
+	images, err := c.Client.ImageList(*c.Ctx, types.ImageListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	tags := make([]string, 0)
+	for _, image := range images {
+		for _, tag := range image.RepoTags {
+			if tag == "<none>:<none>" {
+				continue
+			}
+			tags = append(tags, kisara_types.NormalizeImageName(tag))
+		}
+	}
+	return tags, nil
+}
+
 func (c *Docker) DeleteImage(uuid string) error {
 	log.Info("[docker] delete image: " + uuid)
 	_, err := c.Client.ImageRemove(*c.Ctx, uuid, types.ImageRemoveOptions{
@@ -865,6 +986,7 @@ func (c *Docker) InspectContainer(container_id string, has_state ...bool) (*kisa
 		// memory usage
 		CPUUsage: cpu_usage,
 		MemUsage: memory_usage,
+		ExpireAt: db_container.ExpireAt,
 	}
 
 	return ret, nil
@@ -883,10 +1005,25 @@ func (c *Docker) GetContainerNumber() (int, error) {
 
 /*
 BuildImage will build a docker image from a tar file
+build output is passed to message_callback, fault_callback is called instead of the success message
+if the build fails, a built image is recorded as used now
 */
-func (c *Docker) BuildImage(tar_file io.Reader, image_name string, message_callback func(string), fault_callback func(string), finish ...chan struct{}) error {
+func (c *Docker) BuildImage(tar_file io.Reader, image_name string, build_args map[string]string, message_callback func(string), fault_callback func(string), finish ...chan struct{}) error {
+	return c.BuildImageWithDockerfile(tar_file, image_name, "", build_args, message_callback, fault_callback, finish...)
+}
+
+// BuildImageWithDockerfile is BuildImage with the path of Dockerfile in the context, Dockerfile at the root if it's empty
+func (c *Docker) BuildImageWithDockerfile(tar_file io.Reader, image_name string, dockerfile string, build_args map[string]string, message_callback func(string), fault_callback func(string), finish ...chan struct{}) error {
+	args := make(map[string]*string)
+	for k := range build_args {
+		v := build_args[k]
+		args[k] = &v
+	}
+
 	resp, err := c.Client.ImageBuild(*c.Ctx, tar_file, types.ImageBuildOptions{
 		Tags:        []string{image_name},
+		Dockerfile:  dockerfile,
+		BuildArgs:   args,
 		NoCache:     true,
 		PullParent:  true,
 		Remove:      true,
@@ -905,18 +1042,22 @@ func (c *Docker) BuildImage(tar_file io.Reader, image_name string, message_callb
 			}
 		}()
 
-		buf := make([]byte, 1024)
-		for {
-			n, err := resp.Body.Read(buf)
-			if err != nil && err != io.EOF {
-				fault_callback(err.Error())
-				return
-			}
+		// a failed step is reported as an error message in build output
+		if err := readJSONMessages(resp.Body, message_callback); err != nil {
+			fault_callback(err.Error())
+			return
+		}
 
-			if n == 0 || err == io.EOF {
-				break
-			}
-			message_callback(string(buf[:n]))
+		raw_image, _, err := c.Client.ImageInspectWithRaw(*c.Ctx, image_name)
+		if err != nil {
+			fault_callback(err.Error())
+			return
+		}
+
+		// a built image has no registry to be refreshed from
+		if err := saveImageRecord(image_name, raw_image.ID, false); err != nil {
+			fault_callback(err.Error())
+			return
 		}
 
 		message_callback("build image successfully")
@@ -0,0 +1,86 @@
+package docker
+
+import (
+	"errors"
+	"time"
+
+	"github.com/docker/docker/api/types"
+)
+
+/*
+	ExecSession is an interactive exec attached to a container, write stdin to Conn and read
+	output from Reader, output is multiplexed by stdcopy unless Tty is set
+*/
+type ExecSession struct {
+	types.HijackedResponse
+	Id  string
+	Tty bool
+	c   *Docker
+}
+
+// ExecIO starts cmd in container with stdin attached, a tty is allocated if tty is true
+func (c *Docker) ExecIO(container_id string, cmd []string, tty bool, rows uint, cols uint) (*ExecSession, error) {
+	if len(cmd) == 0 {
+		return nil, errors.New("cmd is empty")
+	}
+
+	config := types.ExecConfig{
+		AttachStdin:  true,
+		AttachStderr: true,
+		AttachStdout: true,
+		Tty:          tty,
+		User:         "root",
+		Cmd:          cmd,
+	}
+	if tty && rows > 0 && cols > 0 {
+		config.ConsoleSize = &[2]uint{rows, cols}
+	}
+
+	exec, err := c.Client.ContainerExecCreate(*c.Ctx, container_id, config)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.Client.ContainerExecAttach(*c.Ctx, exec.ID, types.ExecStartCheck{
+		Detach:      false,
+		Tty:         tty,
+		ConsoleSize: config.ConsoleSize,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &ExecSession{
+		HijackedResponse: resp,
+		Id:               exec.ID,
+		Tty:              tty,
+		c:                c,
+	}, nil
+}
+
+func (s *ExecSession) Resize(rows uint, cols uint) error {
+	return s.c.Client.ContainerExecResize(*s.c.Ctx, s.Id, types.ResizeOptions{
+		Height: rows,
+		Width:  cols,
+	})
+}
+
+// ExitCode returns the exit code of the session, it should be called after output reached EOF
+func (s *ExecSession) ExitCode() (int, error) {
+	return s.c.execExitCode(s.Id)
+}
+
+// execExitCode waits a while for the exec to be stopped as EOF of output may come before it
+func (c *Docker) execExitCode(exec_id string) (int, error) {
+	for i := 0; i < 20; i++ {
+		inspect, err := c.Client.ContainerExecInspect(*c.Ctx, exec_id)
+		if err != nil {
+			return 0, err
+		}
+		if !inspect.Running {
+			return inspect.ExitCode, nil
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return 0, errors.New("exec is still running")
+}
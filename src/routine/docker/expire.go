@@ -0,0 +1,90 @@
+package docker
+
+import (
+	"errors"
+	"time"
+
+	"github.com/Yeuoly/kisara/src/routine/db"
+	log "github.com/Yeuoly/kisara/src/routine/log"
+	kisara_types "github.com/Yeuoly/kisara/src/types"
+)
+
+/*
+	containers and services could be launched with an expiry time, it's kept in database,
+	ReapExpired stops those expired, it's called periodically by client
+*/
+
+// SetContainerExpire sets the unix time container expires at, 0 means never
+func (c *Docker) SetContainerExpire(container *kisara_types.Container, expire_at int64) error {
+	record, err := db.GetGenericOne[kisara_types.DBContainer](db.GenericEqual("container_id", container.Id))
+	if err != nil {
+		return errors.New("unable to find container in kisara db")
+	}
+	record.ExpireAt = expire_at
+	if err := db.UpdateGeneric(&record); err != nil {
+		return err
+	}
+	container.ExpireAt = expire_at
+	return nil
+}
+
+// SetServiceExpire sets the unix time service expires at, 0 means never
+func (c *Docker) SetServiceExpire(service *kisara_types.Service, expire_at int64) error {
+	if get_service(service.Id) == nil {
+		return errors.New("service not found")
+	}
+	service.ExpireAt = expire_at
+	return saveService(service)
+}
+
+// ReapExpired stops expired services and containers, callbacks are called for each of them
+func (c *Docker) ReapExpired(on_container func(kisara_types.Container), on_service func(kisara_types.Service)) {
+	now := time.Now().Unix()
+
+	services, err := db.GetGenericAll[kisara_types.DBService](
+		db.GenericGreaterThan("expire_at", int64(0)),
+		db.GenericLessThanOrEqual("expire_at", now),
+	)
+	if err != nil {
+		log.Warn("[docker] load expired services failed: %s", err.Error())
+	}
+	for _, record := range services {
+		service, err := record.GetService()
+		if err != nil {
+			continue
+		}
+		log.Info("[service] service %s expired", service.Id)
+		if err := c.DeleteService(service.Id); err != nil {
+			log.Warn("[service] stop expired service %s failed: %s", service.Id, err.Error())
+			continue
+		}
+		on_service(service)
+	}
+
+	containers, err := db.GetGenericAll[kisara_types.DBContainer](
+		db.GenericGreaterThan("expire_at", int64(0)),
+		db.GenericLessThanOrEqual("expire_at", now),
+	)
+	if err != nil {
+		log.Warn("[docker] load expired containers failed: %s", err.Error())
+	}
+	for _, record := range containers {
+		record := record
+		container := kisara_types.Container{
+			Id:       record.ContainerId,
+			Image:    record.Image,
+			Uuid:     record.ContainerName,
+			Owner:    record.Uid,
+			ExpireAt: record.ExpireAt,
+		}
+		log.Info("[docker] container %s expired", container.Id)
+		if _, err := c.Client.ContainerInspect(*c.Ctx, container.Id); err != nil {
+			// container is already gone, only its record is left
+			db.DeleteGeneric(&record)
+		} else if err := c.StopContainer(container.Id); err != nil {
+			log.Warn("[docker] stop expired container %s failed: %s", container.Id, err.Error())
+			continue
+		}
+		on_container(container)
+	}
+}
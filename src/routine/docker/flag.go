@@ -0,0 +1,89 @@
+package docker
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	log "github.com/Yeuoly/kisara/src/routine/log"
+	"github.com/Yeuoly/kisara/src/types"
+	uuid "github.com/satori/go.uuid"
+)
+
+// rotations of the same service are serialized, so that every caller gets a consistent flag list
+var service_flag_lockers sync.Map
+
+func generateFlag() string {
+	return `kisara{` + uuid.NewV4().String() + `}`
+}
+
+// writeFlag runs flag_command with $flag replaced by flag in container, it fails if the command exits with non-zero
+func (c *Docker) writeFlag(container_id string, flag_command string, flag string) error {
+	_, stderr, exit_code, err := c.ExecOutput(container_id, strings.Replace(flag_command, "$flag", flag, -1))
+	if err != nil {
+		return err
+	}
+	if exit_code != 0 {
+		return fmt.Errorf("flag command exited with code %d: %s", exit_code, strings.TrimSpace(stderr))
+	}
+	return nil
+}
+
+/*
+	RotateServiceFlags writes a new flag for every flag of the service by its flag command,
+	flags failed to rotate keep the old value and are reported, the service is updated at once
+	after all flags are tried, so readers never see a half rotated flag list, an error is returned
+	if the rotated flags could not be saved
+*/
+func (c *Docker) RotateServiceFlags(service_id string) ([]types.ServiceFlag, []types.ServiceFlagFailure, error) {
+	locker, _ := service_flag_lockers.LoadOrStore(service_id, &sync.Mutex{})
+	locker.(*sync.Mutex).Lock()
+	defer locker.(*sync.Mutex).Unlock()
+
+	service := get_service(service_id)
+	if service == nil {
+		return nil, nil, errors.New("service not found")
+	}
+
+	flags := make([]types.ServiceFlag, len(service.Flags))
+	copy(flags, service.Flags)
+	failed := make([]types.ServiceFlagFailure, 0)
+
+	for i := range flags {
+		flag := &flags[i]
+		if flag.ContainerId == "" || flag.FlagCommand == "" {
+			// services launched before flags remembered their commands
+			failed = append(failed, types.ServiceFlagFailure{
+				FlagUuid:    flag.FlagUuid,
+				ContainerId: flag.ContainerId,
+				Error:       "flag command is unknown",
+			})
+			continue
+		}
+
+		flag_text := generateFlag()
+		if err := c.writeFlag(flag.ContainerId, flag.FlagCommand, flag_text); err != nil {
+			failed = append(failed, types.ServiceFlagFailure{
+				FlagUuid:    flag.FlagUuid,
+				ContainerId: flag.ContainerId,
+				Error:       err.Error(),
+			})
+			continue
+		}
+		flag.Flag = flag_text
+	}
+
+	// copy on write, the service may be read by others at the same time
+	rotated := *service
+	rotated.Flags = flags
+	// containers have the new flags already, so they're kept in memory even if they're not saved,
+	// but the caller is told that they would be lost when the client restarts
+	set_service(&rotated)
+	if err := saveService(&rotated); err != nil {
+		log.Warn("[service] save rotated flags of %s failed: %s", service_id, err.Error())
+		return nil, nil, fmt.Errorf("save rotated flags: %s", err.Error())
+	}
+
+	return flags, failed, nil
+}
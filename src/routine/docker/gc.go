@@ -0,0 +1,279 @@
+package docker
+
+/*
+	images are collected by two rules configured in [kisaraClient.image_gc], images not required
+	for longer than max_age are removed, and if disk usage is still above high_watermark the least
+	recently used images are removed until it falls below low_watermark, images used by any
+	container and images in pinned are never removed
+*/
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Yeuoly/kisara/src/helper"
+	db "github.com/Yeuoly/kisara/src/routine/db"
+	log "github.com/Yeuoly/kisara/src/routine/log"
+	kisara_types "github.com/Yeuoly/kisara/src/types"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/shirou/gopsutil/disk"
+)
+
+const (
+	IMAGE_GC_INTERVAL       = 3600 // seconds
+	IMAGE_GC_HIGH_WATERMARK = 80.0 // percent
+	IMAGE_GC_LOW_WATERMARK  = 70.0 // percent
+)
+
+var (
+	image_gc_lock sync.Mutex
+	errImageBusy  = errors.New("image is being required, skipped")
+)
+
+type imageGCConfig struct {
+	Interval      int64    `mapstructure:"interval"`
+	MaxAge        int64    `mapstructure:"max_age"`
+	HighWatermark float64  `mapstructure:"high_watermark"`
+	LowWatermark  float64  `mapstructure:"low_watermark"`
+	Pinned        []string `mapstructure:"pinned"`
+}
+
+// nodeImageGC returns the gc config of this node, defaults are used for values not configured
+// max_age below 0 disables the age rule
+func nodeImageGC() imageGCConfig {
+	var config imageGCConfig
+	if err := helper.UnmarshalConfig("kisaraClient.image_gc", &config); err != nil {
+		log.Warn("[docker] image gc config is broken, use defaults: %s", err.Error())
+		config = imageGCConfig{}
+	}
+
+	if config.Interval <= 0 {
+		config.Interval = IMAGE_GC_INTERVAL
+	}
+	if config.MaxAge == 0 {
+		config.MaxAge = int64(IMAGE_EXPIRE_DURATION / time.Second)
+	}
+	if config.HighWatermark <= 0 {
+		config.HighWatermark = IMAGE_GC_HIGH_WATERMARK
+	}
+	if config.LowWatermark <= 0 {
+		config.LowWatermark = IMAGE_GC_LOW_WATERMARK
+	}
+	if config.LowWatermark > config.HighWatermark {
+		config.LowWatermark = config.HighWatermark
+	}
+	return config
+}
+
+// ImageGCInterval returns how often images should be collected in seconds
+func ImageGCInterval() int {
+	return int(nodeImageGC().Interval)
+}
+
+// diskUsage returns the disk usage of docker root in percent, with total bytes of the disk
+func (c *Docker) diskUsage() (float64, uint64, error) {
+	root := "/"
+	if info, err := c.Client.Info(*c.Ctx); err == nil && info.DockerRootDir != "" {
+		root = info.DockerRootDir
+	}
+
+	usage, err := disk.Usage(root)
+	if err != nil {
+		return 0, 0, err
+	}
+	return usage.UsedPercent, usage.Total, nil
+}
+
+// freeDiskForPull collects images if disk usage is above the high watermark
+func (c *Docker) freeDiskForPull() {
+	used, _, err := c.diskUsage()
+	if err != nil {
+		log.Error("[Docker] Failed to get disk usage: " + err.Error())
+		return
+	}
+
+	if used > nodeImageGC().HighWatermark {
+		log.Info("[Docker] Disk usage is too high, try to clean up...")
+		if _, err := c.PruneImages(false); err != nil {
+			log.Warn("[Docker] Failed to clean up images: %s", err.Error())
+		}
+	}
+}
+
+/*
+	PruneImages removes images by the gc rules of this node, nothing is removed in a dry run,
+	it returns images removed or to be removed, only one collection runs at a time
+*/
+func (c *Docker) PruneImages(dry_run bool) ([]kisara_types.PrunedImage, error) {
+	image_gc_lock.Lock()
+	defer image_gc_lock.Unlock()
+
+	config := nodeImageGC()
+
+	images, err := c.Client.ImageList(*c.Ctx, types.ImageListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	// images of stopped containers are kept too, they may be started again
+	containers, err := c.Client.ContainerList(*c.Ctx, types.ContainerListOptions{All: true})
+	if err != nil {
+		return nil, err
+	}
+	in_use := make(map[string]bool)
+	for _, container := range containers {
+		in_use[container.ImageID] = true
+	}
+
+	pinned := make(map[string]bool)
+	for _, image_name := range config.Pinned {
+		pinned[kisara_types.NormalizeImageName(image_name)] = true
+	}
+
+	last_usages := make(map[string]int64)
+	records, err := db.GetGenericAll[kisara_types.DBImage]()
+	if err != nil {
+		return nil, err
+	}
+	for _, record := range records {
+		last_usages[record.ImageId] = record.LastUsage.Unix()
+	}
+
+	used, total, err := c.diskUsage()
+	if err != nil {
+		log.Warn("[docker] get disk usage failed, disk watermark is skipped: %s", err.Error())
+		total = 0
+	}
+
+	pruned := selectPrunedImages(images, in_use, pinned, last_usages, config, time.Now(), used, total)
+
+	if dry_run {
+		return pruned, nil
+	}
+
+	for i := range pruned {
+		if err := c.removeCollectedImage(pruned[i].ImageId); err != nil {
+			log.Warn("[docker] remove image %s failed: %s", pruned[i].ImageId, err.Error())
+			pruned[i].Error = err.Error()
+			continue
+		}
+		log.Info("[docker] image %s %v removed, reason: %s", pruned[i].ImageId, pruned[i].ImageTags, pruned[i].Reason)
+	}
+
+	return pruned, nil
+}
+
+/*
+	selectPrunedImages returns images to be removed, images in use, pinned or not recorded are excluded, those
+	not required for longer than max_age go first, then the least recently used ones while disk
+	usage is above the high watermark until it falls below the low watermark, last_usages are unix
+	times images were last required, the watermark is skipped if total is 0
+*/
+func selectPrunedImages(images []types.ImageSummary, in_use map[string]bool, pinned map[string]bool, last_usages map[string]int64, config imageGCConfig, now time.Time, used float64, total uint64) []kisara_types.PrunedImage {
+	candidates := []kisara_types.PrunedImage{}
+	for _, image := range images {
+		if in_use[image.ID] || isPinnedImage(image, pinned) {
+			continue
+		}
+
+		// images without record are not pulled or built by kisara, they may be loaded by the operator
+		// or belong to something else on the host, so they are never collected
+		last_usage, ok := last_usages[image.ID]
+		if !ok {
+			continue
+		}
+
+		candidates = append(candidates, kisara_types.PrunedImage{
+			ImageId:   image.ID,
+			ImageTags: image.RepoTags,
+			Size:      image.Size,
+			LastUsage: last_usage,
+		})
+	}
+
+	// least recently used first
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].LastUsage < candidates[j].LastUsage
+	})
+
+	pruned := []kisara_types.PrunedImage{}
+	rest := []kisara_types.PrunedImage{}
+	for _, candidate := range candidates {
+		if config.MaxAge > 0 && now.Sub(time.Unix(candidate.LastUsage, 0)) > time.Duration(config.MaxAge)*time.Second {
+			candidate.Reason = kisara_types.IMAGE_PRUNE_EXPIRED
+			pruned = append(pruned, candidate)
+		} else {
+			rest = append(rest, candidate)
+		}
+	}
+
+	if total == 0 {
+		return pruned
+	}
+
+	// usage is estimated by sizes of images, layers shared with other images are not freed
+	for _, candidate := range pruned {
+		used -= float64(candidate.Size) / float64(total) * 100
+	}
+	if used > config.HighWatermark {
+		for _, candidate := range rest {
+			if used <= config.LowWatermark {
+				break
+			}
+			candidate.Reason = kisara_types.IMAGE_PRUNE_DISK
+			pruned = append(pruned, candidate)
+			used -= float64(candidate.Size) / float64(total) * 100
+		}
+	}
+
+	return pruned
+}
+
+func isPinnedImage(image types.ImageSummary, pinned map[string]bool) bool {
+	for _, tag := range image.RepoTags {
+		if pinned[kisara_types.NormalizeImageName(tag)] {
+			return true
+		}
+	}
+	return pinned[image.ID]
+}
+
+// removeCollectedImage removes image and its record, it's skipped if a launch is requiring it
+func (c *Docker) removeCollectedImage(image_id string) error {
+	// waiting here would hold image_gc_lock for as long as the launch takes
+	if !image_mutex.TryLock(image_id) {
+		return errImageBusy
+	}
+	defer image_mutex.Unlock(image_id)
+
+	// a container may be launched from it after candidates were listed
+	containers, err := c.Client.ContainerList(*c.Ctx, types.ContainerListOptions{
+		All:     true,
+		Filters: filters.NewArgs(filters.Arg("ancestor", image_id)),
+	})
+	if err != nil {
+		return err
+	}
+	if len(containers) > 0 {
+		return errors.New("image is used by a container")
+	}
+
+	_, err = c.Client.ImageRemove(*c.Ctx, image_id, types.ImageRemoveOptions{
+		Force:         true,
+		PruneChildren: true,
+	})
+	if err != nil {
+		return err
+	}
+
+	record, err := db.GetGenericOne[kisara_types.DBImage](
+		db.GenericEqual("image_id", image_id),
+	)
+	if err == nil {
+		db.DeleteGeneric(&record)
+	}
+	return nil
+}
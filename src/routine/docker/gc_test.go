@@ -0,0 +1,136 @@
+package docker
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	kisara_types "github.com/Yeuoly/kisara/src/types"
+	"github.com/docker/docker/api/types"
+)
+
+func TestSelectPrunedImages(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	hours_ago := func(n int64) int64 {
+		return now.Unix() - n*3600
+	}
+
+	// 50 bytes of 1000 is 5 percent of the disk
+	images := []types.ImageSummary{
+		{ID: "sha256:used", RepoTags: []string{"used:latest"}, Size: 50, Created: hours_ago(100)},
+		{ID: "sha256:pinned-tag", RepoTags: []string{"docker.io/library/nginx:latest"}, Size: 50, Created: hours_ago(100)},
+		{ID: "sha256:pinned-id", Size: 50, Created: hours_ago(100)},
+		{ID: "sha256:old", RepoTags: []string{"old:latest"}, Size: 50, Created: hours_ago(1)},
+		{ID: "sha256:unrecorded", RepoTags: []string{"loaded:latest"}, Size: 50, Created: hours_ago(1000)},
+		{ID: "sha256:a", Size: 50, Created: hours_ago(100)},
+		{ID: "sha256:b", Size: 50, Created: hours_ago(100)},
+		{ID: "sha256:c", Size: 50, Created: hours_ago(100)},
+		{ID: "sha256:d", Size: 50, Created: hours_ago(100)},
+	}
+	in_use := map[string]bool{"sha256:used": true}
+	pinned := map[string]bool{
+		kisara_types.NormalizeImageName("nginx"): true,
+		"sha256:pinned-id":                       true,
+	}
+	last_usages := map[string]int64{
+		"sha256:used":       hours_ago(100),
+		"sha256:pinned-tag": hours_ago(100),
+		"sha256:pinned-id":  hours_ago(100),
+		"sha256:old":        hours_ago(30),
+		"sha256:a":          hours_ago(4),
+		"sha256:b":          hours_ago(3),
+		"sha256:c":          hours_ago(2),
+		"sha256:d":          hours_ago(1),
+	}
+	config := imageGCConfig{MaxAge: 24 * 3600, HighWatermark: 80, LowWatermark: 70}
+
+	type selected struct {
+		id     string
+		reason string
+	}
+
+	cases := []struct {
+		name     string
+		config   imageGCConfig
+		used     float64
+		total    uint64
+		expected []selected
+	}{
+		{
+			"age rule only below high watermark",
+			config, 50, 1000,
+			[]selected{
+				{"sha256:old", kisara_types.IMAGE_PRUNE_EXPIRED},
+			},
+		},
+		{
+			"watermark stops at low watermark",
+			// 95 - 5 of the expired one is 90, four more are removed to reach 70
+			config, 95, 1000,
+			[]selected{
+				{"sha256:old", kisara_types.IMAGE_PRUNE_EXPIRED},
+				{"sha256:a", kisara_types.IMAGE_PRUNE_DISK},
+				{"sha256:b", kisara_types.IMAGE_PRUNE_DISK},
+				{"sha256:c", kisara_types.IMAGE_PRUNE_DISK},
+				{"sha256:d", kisara_types.IMAGE_PRUNE_DISK},
+			},
+		},
+		{
+			"expired ones bring usage below high watermark",
+			config, 84, 1000,
+			[]selected{
+				{"sha256:old", kisara_types.IMAGE_PRUNE_EXPIRED},
+			},
+		},
+		{
+			"watermark without age rule",
+			imageGCConfig{MaxAge: -1, HighWatermark: 80, LowWatermark: 70},
+			90, 1000,
+			[]selected{
+				{"sha256:old", kisara_types.IMAGE_PRUNE_DISK},
+				{"sha256:a", kisara_types.IMAGE_PRUNE_DISK},
+				{"sha256:b", kisara_types.IMAGE_PRUNE_DISK},
+				{"sha256:c", kisara_types.IMAGE_PRUNE_DISK},
+			},
+		},
+		{
+			"unknown disk usage skips watermark",
+			config, 99, 0,
+			[]selected{
+				{"sha256:old", kisara_types.IMAGE_PRUNE_EXPIRED},
+			},
+		},
+		{
+			// every recorded image is removed, the unrecorded one created long ago is still kept
+			"unrecorded images are kept by both rules",
+			imageGCConfig{MaxAge: 3600, HighWatermark: 50, LowWatermark: 0},
+			100, 1000,
+			[]selected{
+				{"sha256:old", kisara_types.IMAGE_PRUNE_EXPIRED},
+				{"sha256:a", kisara_types.IMAGE_PRUNE_EXPIRED},
+				{"sha256:b", kisara_types.IMAGE_PRUNE_EXPIRED},
+				{"sha256:c", kisara_types.IMAGE_PRUNE_EXPIRED},
+				{"sha256:d", kisara_types.IMAGE_PRUNE_DISK},
+			},
+		},
+		{
+			"nothing to remove",
+			imageGCConfig{MaxAge: -1, HighWatermark: 80, LowWatermark: 70},
+			50, 1000,
+			[]selected{},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			pruned := selectPrunedImages(images, in_use, pinned, last_usages, c.config, now, c.used, c.total)
+			got := []selected{}
+			for _, image := range pruned {
+				got = append(got, selected{image.ImageId, image.Reason})
+			}
+			if !reflect.DeepEqual(got, c.expected) {
+				t.Errorf("expected %v, got %v", c.expected, got)
+			}
+		})
+	}
+}
@@ -12,8 +12,9 @@ package docker
 */
 
 import (
-	"container/list"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"strings"
 	"time"
@@ -23,12 +24,10 @@ import (
 	log "github.com/Yeuoly/kisara/src/routine/log"
 	kisara_types "github.com/Yeuoly/kisara/src/types"
 	"github.com/docker/docker/api/types"
-	"github.com/shirou/gopsutil/disk"
 )
 
 var (
 	image_mutex = helper.NewHighGranularityMutex[string]()
-	last_update time.Time
 )
 
 const (
@@ -38,23 +37,18 @@ const (
 // lock a image, it will wait for all running operation of a image
 // inlcuding launch container, delete image etc.
 
-func (c *Docker) PullImage(image_name string, event_callback func(message string)) (*kisara_types.Image, error) {
-	// check if disk space is enough
-	disk_usage, err := disk.Usage("/")
-	if err == nil {
-		if disk_usage.UsedPercent > 80 {
-			log.Info("[Docker] Disk usage is too high, try to clean up...")
-			c.updateImage()
-		}
-	} else {
-		log.Error("[Docker] Failed to get disk usage: " + err.Error())
-	}
+// PullImage pulls image with credential of its registry, the one configured on this node is used if credential is nil
+func (c *Docker) PullImage(image_name string, credential *kisara_types.RegistryCredential, event_callback func(message string)) (*kisara_types.Image, error) {
+	// free disk space before pulling if it's running out
+	c.freeDiskForPull()
 
 	image := &kisara_types.Image{
 		Name: image_name,
 	}
 
-	reader, err := c.Client.ImagePull(*c.Ctx, image_name, types.ImagePullOptions{})
+	reader, err := c.Client.ImagePull(*c.Ctx, image_name, types.ImagePullOptions{
+		RegistryAuth: registryAuth(image_name, credential),
+	})
 
 	if err != nil || reader == nil {
 		return nil, err
@@ -85,24 +79,68 @@ func (c *Docker) PullImage(image_name string, event_callback func(message string
 
 	image.Uuid = raw_image.ID
 
-	image_db := &kisara_types.DBImage{
-		ImageName: image_name,
-		ImageId:   image.Uuid,
-		LastUsage: time.Now(),
-	}
-
-	err = db.CreateGeneric(image_db)
-	if err != nil {
+	// a freshly pulled image is the same as its registry
+	if err := saveImageRecord(image_name, image.Uuid, true); err != nil {
 		return nil, err
 	}
 
 	return image, nil
 }
 
+// saveImageRecord creates or updates the record of an image got on this node, the image may be got before
+func saveImageRecord(image_name string, image_id string, pulled bool) error {
+	image_db, err := db.GetGenericOne[kisara_types.DBImage](
+		db.GenericEqual("image_id", image_id),
+	)
+	if err == db.ErrNotFound {
+		image_db = kisara_types.DBImage{
+			ImageName: image_name,
+			ImageId:   image_id,
+			LastUsage: time.Now(),
+		}
+		if pulled {
+			image_db.RefreshedAt = time.Now()
+		}
+		return db.CreateGeneric(&image_db)
+	} else if err != nil {
+		return err
+	}
+
+	image_db.LastUsage = time.Now()
+	if pulled {
+		image_db.RefreshedAt = time.Now()
+	}
+	return db.UpdateGeneric(&image_db)
+}
+
+// readJSONMessages reads a stream of json messages returned by docker, an error message fails the stream
+func readJSONMessages(reader io.Reader, callback func(string)) error {
+	decoder := json.NewDecoder(reader)
+	for {
+		var message struct {
+			Stream string `json:"stream"`
+			Error  string `json:"error"`
+		}
+		if err := decoder.Decode(&message); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if message.Error != "" {
+			return errors.New(message.Error)
+		}
+		if message.Stream != "" && callback != nil {
+			callback(message.Stream)
+		}
+	}
+}
+
 // when launch container, it's nessesscry to require image first
 // it will lock the image to avoid image deletion before launch container
 // it will also automatically pull image if not exists
-func (c *Docker) RequireImage(image_name string, message_callback func(string)) (*kisara_types.Image, error) {
+// image tagged latest is refreshed in background according to refresh policy
+// credential is used to pull or refresh the image, see PullImage
+func (c *Docker) RequireImage(image_name string, refresh kisara_types.ImageRefresh, credential *kisara_types.RegistryCredential, message_callback func(string)) (*kisara_types.Image, error) {
 	image_raw, _, _ := c.Client.ImageInspectWithRaw(*c.Ctx, image_name)
 
 	image := &kisara_types.Image{}
@@ -110,15 +148,24 @@ func (c *Docker) RequireImage(image_name string, message_callback func(string))
 
 	if image_id == "" {
 		message_callback("image not found, try pull...")
-		image_pull, err := c.PullImage(image_name, func(message string) {
+		image_pull, err := c.PullImage(image_name, credential, func(message string) {
 			message_callback("pulling in progress...")
 		})
 
 		if err != nil {
-			return nil, errors.New("image not found")
+			// registry may be unreachable in offline clusters, copy the image from other nodes instead
+			message_callback("image pull failed, try copy from peers...")
+			image_fetch, _, fetch_err := c.FetchImageFromPeers(image_name, nil, func(message string) {
+				message_callback("copying in progress...")
+			})
+			if fetch_err != nil {
+				return nil, fmt.Errorf("image not found, pull failed: %s, copy from peers failed: %s", err.Error(), fetch_err.Error())
+			}
+			image_pull = image_fetch
 		}
 
 		image = image_pull
+		image_id = image.Uuid
 		message_callback("image pull finished")
 	} else {
 		image.Uuid = image_raw.ID
@@ -128,10 +175,15 @@ func (c *Docker) RequireImage(image_name string, message_callback func(string))
 
 		image.Name = image_raw.RepoTags[0]
 
-		// TODO: check if image has tag latest is updated, pull again
+		// images without digest are built or loaded locally, they have nothing to refresh from
+		if isLatestImage(image_name) && len(image_raw.RepoDigests) > 0 && shouldRefreshImage(image_id, refresh) {
+			message_callback("refreshing image in background...")
+			c.refreshImageAsync(image_name, image_id, image_raw.RepoDigests, credential)
+		}
 	}
 
 	image_mutex.Lock(image_id)
+	defer image_mutex.Unlock(image_id)
 	// TODO: update image latest usage
 	image_record, err := db.GetGenericOne[kisara_types.DBImage](
 		db.GenericEqual("image_id", image_id),
@@ -158,8 +210,6 @@ func (c *Docker) RequireImage(image_name string, message_callback func(string))
 		}
 	}
 
-	image_mutex.Unlock(image_id)
-
 	return image, nil
 }
 
@@ -199,108 +249,18 @@ func (c *Docker) InitImage() error {
 	return nil
 }
 
-// check image status and delete the oldest image, ensure the image is at the newest status
-func (c *Docker) updateImage() {
-	if time.Since(last_update) < time.Hour*1 {
-		return
-	}
-	last_update = time.Now()
-
-	images, err := c.Client.ImageList(*c.Ctx, types.ImageListOptions{
-		All: true,
-	})
-
-	if err != nil {
-		log.Error("[UpdateImage] Failed to get image list: %v", err)
-	}
-
-	image_relation_tree := helper.Tree[string, types.ImageSummary]{}
-	// to avoid push child before parent layer, use a queue
-	image_push_queue := list.New()
-	// build image relation tree
-	for _, image := range images {
-		image_push_queue.PushBack(&image)
-	}
-
-	for image_push_queue.Len() != 0 {
-		e := image_push_queue.Front()
-		image_push_queue.Remove(e)
-		image := e.Value.(*types.ImageSummary)
-		// no parent, push to tree directly
-		if len(image.ParentID) == 0 {
-			image_relation_tree.AddParent(image.ID, image)
-		} else {
-			// try push to parent node, if failed, push back to queue
-			if image_relation_tree.AddToParent(image.ParentID, image.ID, image) != nil {
-				image_push_queue.PushBack(image)
-			}
-		}
-	}
-
-	// walk from bottom to root
-	image_relation_tree.WalkReverse(func(id string, v *types.ImageSummary) {
-		// check if current expired
-		image_mutex.Lock(id)
-		if !c.imageHasExpired(id) {
-			image_mutex.Unlock(id)
-			return
-		}
-		image_mutex.Lock(id)
-
-		// get all child nodes
-		current := image_relation_tree.GetNode(id)
-		if current == nil {
-			return
-		}
-
-		children := current.GetAllChildren()
-		if children == nil {
-			return
-		}
-
-		// lock all images which depends on current image
-		for k := range children {
-			image_mutex.Lock(k)
-		}
-
-		defer func() {
-			for k := range children {
-				image_mutex.Unlock(k)
-			}
-		}()
-
-		// check if current expired
-		if !c.imageHasExpired(id) {
-			return
-		}
-
-		// delete current image
-		images, err := c.Client.ImageRemove(*c.Ctx, id, types.ImageRemoveOptions{
-			Force:         true,
-			PruneChildren: true,
-		})
-
-		if err != nil {
-			log.Error("[UpdateImage] Failed to remove image: %v", err)
-			return
-		}
-
-		for _, image := range images {
-			log.Info("[UpdateImage] Image removed: %v:%v", image.Untagged, image.Deleted)
-		}
-	})
-}
-
-func (c *Docker) imageHasExpired(image_id string) bool {
-	record, err := db.GetGenericOne[kisara_types.DBImage](
-		db.GenericEqual("image_id", image_id),
-	)
-
+// InspectImage returns the local image image_name refers to, image_name may have any of its tags
+func (c *Docker) InspectImage(image_name string) (*kisara_types.Image, error) {
+	raw_image, _, err := c.Client.ImageInspectWithRaw(*c.Ctx, image_name)
 	if err != nil {
-		return false
+		return nil, err
 	}
 
-	return record.IsExpired(IMAGE_EXPIRE_DURATION)
+	return &kisara_types.Image{
+		Name:        image_name,
+		Uuid:        raw_image.ID,
+		VirtualSize: raw_image.VirtualSize,
+	}, nil
 }
 
 func (c *Docker) GetImage(image_name string) (*kisara_types.Image, error) {
@@ -0,0 +1,242 @@
+package docker
+
+/*
+	logs of a container are captured when it's stopped by kisara and kept in database for
+	kisaraClient.log_retention seconds, so a crashed challenge can be debugged after it's removed,
+	only the tail of the logs is kept
+*/
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Yeuoly/kisara/src/helper"
+	db "github.com/Yeuoly/kisara/src/routine/db"
+	log "github.com/Yeuoly/kisara/src/routine/log"
+	kisara_types "github.com/Yeuoly/kisara/src/types"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+const (
+	CONTAINER_LOG_RETENTION   = 86400           // default seconds logs of a removed container are kept
+	CONTAINER_LOG_RETAIN_TAIL = 5000            // lines kept
+	CONTAINER_LOG_RETAIN_SIZE = 1024 * 1024 * 1 // bytes kept of each stream
+	CONTAINER_LOG_MAX_SIZE    = 1024 * 1024 * 4 // default bytes returned of each stream by GetContainerLogs
+)
+
+// containerLogMaxSize returns how many bytes from the end of each stream GetContainerLogs returns
+func containerLogMaxSize() int {
+	size := helper.GetConfigInteger("kisaraClient.log_max_size")
+	if size <= 0 {
+		return CONTAINER_LOG_MAX_SIZE
+	}
+	return size
+}
+
+// containerLogRetention returns how long logs of removed containers are kept, 0 if they are not kept
+func containerLogRetention() time.Duration {
+	retention := helper.GetConfigInt64("kisaraClient.log_retention")
+	if retention < 0 {
+		return 0
+	}
+	if retention == 0 {
+		retention = CONTAINER_LOG_RETENTION
+	}
+	return time.Duration(retention) * time.Second
+}
+
+func containerLogsOptions(since int64, tail int, follow bool) types.ContainerLogsOptions {
+	options := types.ContainerLogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Follow:     follow,
+		Tail:       "all",
+	}
+	if since > 0 {
+		options.Since = strconv.FormatInt(since, 10)
+	}
+	if tail > 0 {
+		options.Tail = strconv.Itoa(tail)
+	}
+	return options
+}
+
+// OpenContainerLogs opens the raw log stream of container, it's multiplexed by stdcopy unless the container has a tty
+// the stream is followed until the container stops if follow is set, the caller should close it
+func (c *Docker) OpenContainerLogs(container_id string, since int64, tail int, follow bool) (io.ReadCloser, bool, error) {
+	inspect, err := c.Client.ContainerInspect(*c.Ctx, container_id)
+	if err != nil {
+		return nil, false, err
+	}
+
+	reader, err := c.Client.ContainerLogs(*c.Ctx, container_id, containerLogsOptions(since, tail, follow))
+	if err != nil {
+		return nil, false, err
+	}
+
+	return reader, inspect.Config != nil && inspect.Config.Tty, nil
+}
+
+// GetContainerLogs returns stdout and stderr of container, logs retained are returned if it's removed
+// only the last kisaraClient.log_max_size bytes of each stream are kept while reading, Truncated is set if more were dropped
+func (c *Docker) GetContainerLogs(container_id string, since int64, tail int) (kisara_types.ResponseContainerLogs, error) {
+	resp := kisara_types.ResponseContainerLogs{
+		ContainerID: container_id,
+	}
+
+	reader, tty, err := c.OpenContainerLogs(container_id, since, tail, false)
+	if err != nil {
+		record, record_err := db.GetGenericOne[kisara_types.DBContainerLog](
+			db.GenericEqual("container_id", container_id),
+		)
+		if record_err != nil {
+			return resp, err
+		}
+		// retained logs have no timestamps, since is not applied to them
+		resp.Stdout = tailLines(record.Stdout, tail)
+		resp.Stderr = tailLines(record.Stderr, tail)
+		resp.Retained = true
+		return resp, nil
+	}
+	defer reader.Close()
+
+	max_size := containerLogMaxSize()
+	stdout, stderr := newTailBuffer(max_size), newTailBuffer(max_size)
+	if tty {
+		_, err = io.Copy(stdout, reader)
+	} else {
+		_, err = stdcopy.StdCopy(stdout, stderr, reader)
+	}
+	if err != nil {
+		return resp, err
+	}
+
+	resp.Stdout = stdout.String()
+	resp.Stderr = stderr.String()
+	resp.Truncated = stdout.Truncated() || stderr.Truncated()
+	return resp, nil
+}
+
+// retainContainerLogs captures the tail of logs of container before it's removed
+func (c *Docker) retainContainerLogs(container_id string) {
+	if containerLogRetention() == 0 {
+		return
+	}
+
+	logs, err := c.GetContainerLogs(container_id, 0, CONTAINER_LOG_RETAIN_TAIL)
+	if err != nil {
+		log.Warn("[docker] capture logs of container %s failed: %s", container_id, err.Error())
+		return
+	}
+	if logs.Retained {
+		return
+	}
+
+	record := kisara_types.DBContainerLog{
+		ContainerId: container_id,
+		Stdout:      tailBytes(logs.Stdout, CONTAINER_LOG_RETAIN_SIZE),
+		Stderr:      tailBytes(logs.Stderr, CONTAINER_LOG_RETAIN_SIZE),
+		RemovedAt:   time.Now().Unix(),
+	}
+	if err := db.CreateGeneric(&record); err != nil {
+		log.Warn("[docker] save logs of container %s failed: %s", container_id, err.Error())
+	}
+}
+
+// PurgeContainerLogs deletes logs of removed containers kept longer than retention
+func (c *Docker) PurgeContainerLogs() error {
+	retention := containerLogRetention()
+	// logs are still purged after retention is disabled
+	if retention == 0 {
+		retention = time.Nanosecond
+	}
+
+	records, err := db.GetGenericAll[kisara_types.DBContainerLog](
+		db.GenericLessThan("removed_at", time.Now().Add(-retention).Unix()),
+	)
+	if err != nil {
+		return err
+	}
+
+	errs := []string{}
+	for _, record := range records {
+		record := record
+		if err := db.DeleteGeneric(&record); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func tailLines(text string, tail int) string {
+	if tail <= 0 {
+		return text
+	}
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) <= tail {
+		return text
+	}
+	return strings.Join(lines[len(lines)-tail:], "")
+}
+
+/*
+	tailBuffer keeps the last max bytes written to it, a log of a long running container may be
+	far larger than the memory of the node, older bytes are dropped once twice of max is buffered
+	so they are not moved on every write
+*/
+type tailBuffer struct {
+	buf       []byte
+	max       int
+	truncated bool
+}
+
+func newTailBuffer(max int) *tailBuffer {
+	return &tailBuffer{max: max}
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.buf = append(b.buf, p...)
+	if len(b.buf) > b.max*2 {
+		b.buf = append(b.buf[:0], b.buf[len(b.buf)-b.max:]...)
+		b.truncated = true
+	}
+	return len(p), nil
+}
+
+// Truncated reports whether bytes have been dropped
+func (b *tailBuffer) Truncated() bool {
+	return b.truncated || len(b.buf) > b.max
+}
+
+// String returns the kept bytes, a line cut by the limit is dropped
+func (b *tailBuffer) String() string {
+	if !b.Truncated() {
+		return string(b.buf)
+	}
+	text := b.buf
+	if len(text) > b.max {
+		text = text[len(text)-b.max:]
+	}
+	if i := bytes.IndexByte(text, '\n'); i >= 0 && i < len(text)-1 {
+		text = text[i+1:]
+	}
+	return string(text)
+}
+
+func tailBytes(text string, size int) string {
+	if len(text) <= size {
+		return text
+	}
+	return text[len(text)-size:]
+}
@@ -0,0 +1,36 @@
+package docker
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTailBuffer(t *testing.T) {
+	buffer := newTailBuffer(16)
+	buffer.Write([]byte("line1\nline2\n"))
+	if buffer.Truncated() || buffer.String() != "line1\nline2\n" {
+		t.Fatalf("unexpected buffer %q", buffer.String())
+	}
+
+	// writes beyond twice of max are compacted, the cut line is dropped
+	for i := 0; i < 100; i++ {
+		buffer.Write([]byte("abcdefg\n"))
+	}
+	buffer.Write([]byte("last\n"))
+	if len(buffer.buf) > 32 {
+		t.Fatalf("buffer grows to %d bytes", len(buffer.buf))
+	}
+	if !buffer.Truncated() {
+		t.Fatalf("buffer should be truncated")
+	}
+	if text := buffer.String(); text != "abcdefg\nlast\n" {
+		t.Fatalf("unexpected tail %q", text)
+	}
+
+	// a single write larger than max keeps its end
+	buffer = newTailBuffer(8)
+	buffer.Write([]byte(strings.Repeat("x", 20) + "\nend\n"))
+	if text := buffer.String(); text != "end\n" {
+		t.Fatalf("unexpected tail %q", text)
+	}
+}
@@ -115,6 +115,7 @@ func (c *Docker) RunNetworkMonitor(network_name string, context io.Reader, messa
 	err = c.BuildImage(
 		context,
 		image_name,
+		nil,
 		func(message string) {
 			message_callback(fmt.Sprintf("build image: %s, %s", image_name, message))
 		},
@@ -142,7 +143,7 @@ func (c *Docker) RunNetworkMonitor(network_name string, context io.Reader, messa
 	}
 
 	// run the container
-	container, err := c.LaunchContainer(image_name, 0, "", network_name, "checker")
+	container, err := c.LaunchContainer(image_name, 0, "", network_name, "checker", nil, types.ContainerResources{})
 	if err != nil {
 		return nil, err
 	}
@@ -205,6 +206,7 @@ func (c *Docker) RunNetworkMonitorScript(containers *types.KisaraNetworkTestSet)
 	var errs []error
 
 	var wg sync.WaitGroup
+	var lock sync.Mutex
 	for _, container := range containers.Containers {
 		// get the network of the container
 		container_networks, err := c.GetContainerNetwork(container.ContainerId)
@@ -230,20 +232,24 @@ func (c *Docker) RunNetworkMonitorScript(containers *types.KisaraNetworkTestSet)
 		}
 
 		wg.Add(1)
-		go func(container_id string, test_container_id string, cmd string) {
+		go func(container_id string, test_container_id string, cmd string, flag string) {
 			// run the test script
 			cmd = strings.Replace(cmd, "$ip", ip, -1)
-			result, err := c.ExecWarp(test_container_id, cmd, time.Second*10)
+			cmd = strings.Replace(cmd, "$flag", flag, -1)
+			result, exit_code, err := c.ExecWarp(test_container_id, cmd, time.Second*10)
+			lock.Lock()
 			if err != nil {
 				errs = append(errs, err)
 			} else {
 				results.Results = append(results.Results, types.KisaraNetworkTestResult{
 					ContainerId: container_id,
 					Result:      result,
+					ExitCode:    exit_code,
 				})
 			}
+			lock.Unlock()
 			wg.Done()
-		}(container.ContainerId, container.TestContainerId, container.Script)
+		}(container.ContainerId, container.TestContainerId, container.Script, container.Flag)
 	}
 
 	wg.Wait()
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package docker
+
+import "errors"
+
+func inNetns(pid int, f func() error) error {
+	return errors.New("network namespace is only supported on linux")
+}
@@ -4,6 +4,8 @@ import (
 	"container/list"
 	"context"
 	"errors"
+	"fmt"
+	"net"
 	"strconv"
 	"strings"
 	"sync"
@@ -18,6 +20,8 @@ import (
 var (
 	cidr_pool = list.New()
 	cidr_mux  = sync.Mutex{}
+	// every subnet of the pool, including those handed out
+	cidr_ranges = []string{}
 )
 
 func requestCIDR() (string, error) {
@@ -39,6 +43,18 @@ func releaseCIDR(cidr string) {
 	cidr_pool.PushBack(cidr)
 }
 
+// poolOverlap returns a subnet of the pool overlapping subnet, empty if there is none
+func poolOverlap(subnet string) string {
+	cidr_mux.Lock()
+	defer cidr_mux.Unlock()
+	for _, cidr := range cidr_ranges {
+		if kisara_types.SubnetOverlaps(cidr, subnet) {
+			return cidr
+		}
+	}
+	return ""
+}
+
 /*
 Parse a CIDR expression into a list of CIDR
 CIDR expression like: 172.[128-255].[0-255].0/24
@@ -98,11 +114,23 @@ func InitCIDRPool(cidr_expression string) (int, error) {
 	if err != nil {
 		return 0, err
 	}
+
+	cidr_mux.Lock()
+	cidr_ranges = cidr_list
+	cidr_mux.Unlock()
+
 	for _, cidr := range cidr_list {
+		network_name := "kisara_" + strings.Replace(strings.Replace(cidr, "/", "_", -1), ".", "_", -1)
+		// CIDR of recovered services is still in use
+		if recovered_networks[network_name] {
+			continue
+		}
 		// check if CIDR is used
 		for _, network := range networks {
-			if network.Name == "kisara_"+strings.Replace(strings.Replace(cidr, "/", "_", -1), ".", "_", -1) {
-				c.DeleteNetwork(network.Id)
+			if network.Name == network_name {
+				if err := c.DeleteNetwork(network.Id); err != nil {
+					log.Warn("[Network] Failed to delete leaked network %s: %s", network.Name, err.Error())
+				}
 			}
 		}
 		cidr_pool.PushBack(cidr)
@@ -136,6 +164,29 @@ func (c *Docker) CreateRandomCIDRNetwork(internal bool, driver string) (*kisara_
 	return nil, errors.New("no cidr available")
 }
 
+/*
+Create a network with a fixed subnet, conflicts with existing networks are reported instead of
+letting docker fail, subnets overlapping the CIDR pool are rejected as they will be handed out later
+*/
+func (c *Docker) CreateFixedSubnetNetwork(subnet string, name string, internal bool, driver string) (*kisara_types.Network, error) {
+	if cidr := poolOverlap(subnet); cidr != "" {
+		return nil, fmt.Errorf("subnet %s overlaps %s of network_cidrs", subnet, cidr)
+	}
+
+	networks, err := c.ListNetwork()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, network := range networks {
+		if kisara_types.SubnetOverlaps(network.Subnet, subnet) {
+			return nil, fmt.Errorf("subnet %s conflicts with network %s(%s)", subnet, network.Name, network.Subnet)
+		}
+	}
+
+	return c.CreateNetwork(subnet, name, internal, driver)
+}
+
 /*
 Release a CIDR network
 */
@@ -150,7 +201,8 @@ func (c *Docker) ReleaseCIDRNetwork(cidr string) error {
 		return err
 	}
 
-	releaseCIDR(cidr)
+	// cidr here is the name suffix like 172_128_0_0_24, subnet is what the pool holds
+	releaseCIDR(network.Subnet)
 	return nil
 }
 
@@ -297,6 +349,44 @@ func (c *Docker) ListNetwork() ([]kisara_types.Network, error) {
 	return ret, nil
 }
 
+/*
+Check if a static address could be assigned in a network, it should be in the subnet and not used by other containers
+*/
+func (c *Docker) CheckNetworkAddress(network_id string, address string) error {
+	ip := net.ParseIP(address).To4()
+	if ip == nil {
+		return fmt.Errorf("invalid ipv4 address %s", address)
+	}
+
+	resource, err := c.Client.NetworkInspect(*c.Ctx, network_id, types.NetworkInspectOptions{})
+	if err != nil {
+		return err
+	}
+
+	in_subnet := false
+	for _, config := range resource.IPAM.Config {
+		_, ipnet, err := net.ParseCIDR(config.Subnet)
+		if err == nil && ipnet.Contains(ip) {
+			in_subnet = true
+		}
+		if config.Gateway == address {
+			return fmt.Errorf("address %s is the gateway of network %s", address, resource.Name)
+		}
+	}
+	if !in_subnet {
+		return fmt.Errorf("address %s is not in network %s", address, resource.Name)
+	}
+
+	for id, endpoint := range resource.Containers {
+		// IPv4Address of endpoint is like 10.0.0.2/24
+		if strings.Split(endpoint.IPv4Address, "/")[0] == address {
+			return fmt.Errorf("address %s is already used by container %s", address, id)
+		}
+	}
+
+	return nil
+}
+
 /*
 Connect a container to a network
 */
@@ -0,0 +1,136 @@
+package docker
+
+/*
+	clusters without access to a registry share images between nodes, an image is saved
+	as a tar on a node having it and streamed into docker of the node requiring it, the
+	tar is never written to disk on either side, nodes with a control channel may not be
+	reachable by their address, their images are relayed by server through the channel
+*/
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/Yeuoly/kisara/src/helper"
+	"github.com/Yeuoly/kisara/src/router"
+	log "github.com/Yeuoly/kisara/src/routine/log"
+	kisara_types "github.com/Yeuoly/kisara/src/types"
+)
+
+const (
+	IMAGE_TRANSFER_TIMEOUT = time.Minute * 30
+)
+
+var (
+	image_peer_resolver func(image_name string) ([]kisara_types.ImagePeer, error)
+	image_peer_relay    func() string
+)
+
+// SetImagePeerResolver sets the resolver used to find nodes having an image when it could not be pulled
+func SetImagePeerResolver(resolver func(image_name string) ([]kisara_types.ImagePeer, error)) {
+	image_peer_resolver = resolver
+}
+
+// SetImagePeerRelay sets the function returning the url of server relaying images of peers with a channel
+func SetImagePeerRelay(relay func() string) {
+	image_peer_relay = relay
+}
+
+// SaveImage opens image as a tar stream, the caller should close it
+func (c *Docker) SaveImage(image_name string) (io.ReadCloser, error) {
+	return c.Client.ImageSave(*c.Ctx, []string{image_name})
+}
+
+// LoadImage loads image_name from a tar stream and records it
+func (c *Docker) LoadImage(image_name string, reader io.Reader, message_callback func(string)) (*kisara_types.Image, error) {
+	resp, err := c.Client.ImageLoad(*c.Ctx, reader, true)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if err := readJSONMessages(resp.Body, message_callback); err != nil {
+		return nil, fmt.Errorf("load image %s failed: %s", image_name, err.Error())
+	}
+
+	raw_image, _, err := c.Client.ImageInspectWithRaw(*c.Ctx, image_name)
+	if err != nil {
+		return nil, err
+	}
+
+	// a loaded image has no digest, it's not known to be the same as its registry
+	if err := saveImageRecord(image_name, raw_image.ID, false); err != nil {
+		return nil, err
+	}
+
+	return &kisara_types.Image{
+		Name: image_name,
+		Uuid: raw_image.ID,
+	}, nil
+}
+
+// FetchImageFromPeers copies image from peers in order, peers are resolved by server if it's nil
+// it returns the image and the node it was copied from
+func (c *Docker) FetchImageFromPeers(image_name string, peers []kisara_types.ImagePeer, message_callback func(string)) (*kisara_types.Image, string, error) {
+	if peers == nil {
+		if image_peer_resolver == nil {
+			return nil, "", errors.New("peers of image are unknown")
+		}
+		var err error
+		peers, err = image_peer_resolver(image_name)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	if len(peers) == 0 {
+		return nil, "", errors.New("no peer has the image")
+	}
+
+	errs := []string{}
+	for _, peer := range peers {
+		image, err := c.fetchImageFromPeer(image_name, peer, message_callback)
+		if err == nil {
+			log.Info("[docker] image %s copied from %s", image_name, peer.ClientID)
+			return image, peer.ClientID, nil
+		}
+		log.Warn("[docker] copy image %s from %s failed: %s", image_name, peer.ClientID, err.Error())
+		errs = append(errs, fmt.Sprintf("%s: %s", peer.ClientID, err.Error()))
+	}
+
+	return nil, "", errors.New(strings.Join(errs, "; "))
+}
+
+func (c *Docker) fetchImageFromPeer(image_name string, peer kisara_types.ImagePeer, message_callback func(string)) (*kisara_types.Image, error) {
+	var image *kisara_types.Image
+
+	url := fmt.Sprintf("http://%s:%d%s", peer.ClientIp, peer.ClientPort, router.URI_CLIENT_SAVE_IMAGE)
+	if peer.Channel {
+		if image_peer_relay == nil {
+			return nil, errors.New("relay of peer is unknown")
+		}
+		url = image_peer_relay()
+	}
+
+	// peer answers errors in json, only a tar is loaded
+	err := helper.SendGetStream(
+		url,
+		"application/x-tar",
+		func(body io.ReadCloser, header *helper.ResponseHeader) error {
+			var err error
+			image, err = c.LoadImage(image_name, body, message_callback)
+			return err
+		},
+		helper.HttpParams(map[string]string{
+			"client_id":  peer.ClientID,
+			"image_name": image_name,
+		}),
+		helper.HttpTimeout(IMAGE_TRANSFER_TIMEOUT.Milliseconds()),
+		helper.HttpSign(helper.GetConfigString("kisara.token")),
+	)
+
+	return image, err
+}
@@ -0,0 +1,133 @@
+package docker
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Yeuoly/kisara/src/types"
+)
+
+/*
+	readiness probes connect to the container inside its network namespace, so that containers
+	on internal networks which node could not route to are probed too
+*/
+
+// WaitReady blocks until probe of the container passes, it fails early if the container exits
+func (c *Docker) WaitReady(container_id string, probe types.ServiceConfigContainerProbe) error {
+	interval := time.Duration(probe.Interval) * time.Second
+	if interval == 0 {
+		interval = time.Second
+	}
+	timeout := time.Duration(probe.Timeout) * time.Second
+	if timeout == 0 {
+		timeout = 60 * time.Second
+	}
+
+	deadline := time.Now().Add(timeout)
+	var last_err error
+	for {
+		inspect, err := c.Client.ContainerInspect(*c.Ctx, container_id)
+		if err != nil {
+			return err
+		}
+		if inspect.State == nil || !inspect.State.Running {
+			exit_code := 0
+			if inspect.State != nil {
+				exit_code = inspect.State.ExitCode
+			}
+			return fmt.Errorf("container %s exited with code %d before it's ready", container_id, exit_code)
+		}
+
+		switch probe.Type {
+		case types.PROBE_TCP, types.PROBE_HTTP:
+			ip := ""
+			for _, network := range inspect.NetworkSettings.Networks {
+				if network.IPAddress != "" {
+					ip = network.IPAddress
+					break
+				}
+			}
+			if ip == "" {
+				return errors.New("container has no ip to probe")
+			}
+			address := net.JoinHostPort(ip, strconv.Itoa(probe.Port))
+			last_err = inNetns(inspect.State.Pid, func() error {
+				if probe.Type == types.PROBE_TCP {
+					return probeTCP(address)
+				}
+				return probeHTTP(address, probe.Path)
+			})
+		case types.PROBE_EXEC:
+			_, stderr, exit_code, err := c.ExecOutput(container_id, probe.Command)
+			if err == nil && exit_code != 0 {
+				err = fmt.Errorf("exit with code %d: %s", exit_code, stderr)
+			}
+			last_err = err
+		case types.PROBE_HEALTHCHECK:
+			if inspect.State.Health == nil {
+				return errors.New("container has no healthcheck")
+			}
+			switch inspect.State.Health.Status {
+			case "healthy":
+				last_err = nil
+			case "unhealthy":
+				return fmt.Errorf("container %s is unhealthy", container_id)
+			default:
+				last_err = errors.New("container is " + inspect.State.Health.Status)
+			}
+		default:
+			return fmt.Errorf("unknown probe type %s", probe.Type)
+		}
+
+		if last_err == nil {
+			return nil
+		}
+		if time.Now().Add(interval).After(deadline) {
+			return fmt.Errorf("%s probe of container %s failed: %s", probe.Type, container_id, last_err.Error())
+		}
+		time.Sleep(interval)
+	}
+}
+
+func probeTCP(address string) error {
+	conn, err := net.DialTimeout("tcp", address, time.Second)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+func probeHTTP(address string, path string) error {
+	if path == "" {
+		path = "/"
+	}
+	conn, err := net.DialTimeout("tcp", address, time.Second)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(3 * time.Second))
+
+	req, err := http.NewRequest("GET", "http://"+address+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Close = true
+	if err := req.Write(conn); err != nil {
+		return err
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 400 {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return nil
+}
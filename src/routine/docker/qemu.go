@@ -20,13 +20,17 @@ func launchX86Qemu(
 	return docker.CreateContainer(
 		"yeuoly/kisara-vm-qemu-x86:latest",
 		uid, protocol_port,
-		subnet_names, "vm-qemu-x86",
+		subnet_names, nil, "vm-qemu-x86",
 		map[string]string{
 			"QEMU_ENV": "ENV",
 		},
 		map[string]string{
 			path: "/var/qemu/vm/",
 		},
-		image.Limit.Cpu, image.Limit.Mem, image.Limit.Disk,
+		types.ContainerResources{
+			CpuLimit:    image.Limit.Cpu,
+			MemoryLimit: image.Limit.Mem,
+			DiskQuota:   image.Limit.Disk,
+		},
 	)
 }
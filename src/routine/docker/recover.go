@@ -0,0 +1,175 @@
+package docker
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/Yeuoly/Takina/src/api"
+	"github.com/Yeuoly/kisara/src/routine/db"
+	log "github.com/Yeuoly/kisara/src/routine/log"
+	kisara_types "github.com/Yeuoly/kisara/src/types"
+	"github.com/docker/docker/api/types"
+)
+
+/*
+	when client restarts, services recorded in database may still be running,
+	they should be adopted again instead of being stopped as orphan containers
+*/
+
+// names of networks owned by recovered services, they should not be put back into cidr pool
+var recovered_networks = make(map[string]bool)
+
+/*
+	RecoverServices loads services from database, services whose containers and networks are
+	all alive are adopted, the others are torn down, returns ids of adopted containers
+*/
+func (c *Docker) RecoverServices() map[string]bool {
+	adopted := make(map[string]bool)
+
+	records, err := db.GetGenericAll[kisara_types.DBService]()
+	if err != nil {
+		log.Error("[service] load services from database failed: %s", err.Error())
+		return adopted
+	}
+
+	for _, record := range records {
+		record := record
+		service, err := record.GetService()
+		if err != nil {
+			log.Warn("[service] broken service record %s: %s", record.ServiceId, err.Error())
+			db.DeleteGeneric(&record)
+			continue
+		}
+
+		if c.serviceAlive(&service) {
+			service.Status = kisara_types.SERVICE_STATUS_RUNNING
+			set_service(&service)
+			for _, container := range service.Containers {
+				adopted[container.Id] = true
+			}
+			for _, network := range service.Networks {
+				recovered_networks[network.Name] = true
+			}
+			log.Info("[service] service %s recovered", service.Id)
+		} else {
+			c.teardownService(&service)
+			if err := db.DeleteGeneric(&record); err != nil {
+				log.Warn("[service] delete service record %s failed: %s", service.Id, err.Error())
+			}
+			log.Info("[service] service %s is broken, torn down", service.Id)
+		}
+	}
+
+	return adopted
+}
+
+func (c *Docker) serviceAlive(service *kisara_types.Service) bool {
+	for _, container := range service.Containers {
+		inspect, err := c.Client.ContainerInspect(*c.Ctx, container.Id)
+		if err != nil || inspect.State == nil || !inspect.State.Running {
+			return false
+		}
+	}
+
+	for _, network := range service.Networks {
+		_, err := c.Client.NetworkInspect(*c.Ctx, network.Id, types.NetworkInspectOptions{})
+		if err != nil {
+			return false
+		}
+	}
+
+	return true
+}
+
+// teardownService removes everything left by a broken service, cidr pool is not touched
+// as it will be rebuilt from the remaining networks
+func (c *Docker) teardownService(service *kisara_types.Service) {
+	for _, container := range service.Containers {
+		if _, err := c.Client.ContainerInspect(*c.Ctx, container.Id); err != nil {
+			continue
+		}
+		if err := c.StopContainer(container.Id); err != nil {
+			log.Warn("[service] stop container %s failed: %s, force remove it", container.Id, err.Error())
+			err = c.Client.ContainerRemove(*c.Ctx, container.Id, types.ContainerRemoveOptions{Force: true})
+			if err != nil {
+				log.Warn("[service] remove container %s failed: %s", container.Id, err.Error())
+			}
+		}
+	}
+
+	for _, volume := range service.Volumes {
+		if err := c.Client.VolumeRemove(*c.Ctx, volume, true); err != nil {
+			log.Warn("[service] remove volume %s failed: %s", volume, err.Error())
+		}
+	}
+
+	for _, network := range service.Networks {
+		if _, err := c.Client.NetworkInspect(*c.Ctx, network.Id, types.NetworkInspectOptions{}); err != nil {
+			continue
+		}
+		if err := c.DeleteNetwork(network.Id); err != nil {
+			log.Warn("[service] delete network %s failed: %s", network.Name, err.Error())
+		}
+	}
+}
+
+/*
+	RestoreServiceProxies starts port proxies of recovered services again, proxies are lost
+	when Takina restarts, so it should be called after Takina joined all networks
+*/
+func (c *Docker) RestoreServiceProxies() {
+	walk_services(func(service *kisara_types.Service) {
+		for i := range service.Containers {
+			container := &service.Containers[i]
+			host_port, err := c.restoreContainerProxies(container.Id)
+			if err != nil {
+				log.Warn("[service] restore proxies of container %s failed: %s", container.Id, err.Error())
+				continue
+			}
+			container.HostPort = host_port
+		}
+
+		if err := saveService(service); err != nil {
+			log.Warn("[service] save service %s failed: %s", service.Id, err.Error())
+		}
+	})
+}
+
+func (c *Docker) restoreContainerProxies(container_id string) (string, error) {
+	record, err := db.GetGenericOne[kisara_types.DBContainer](db.GenericEqual("container_id", container_id))
+	if err != nil {
+		return "", err
+	}
+
+	labels := make(map[string]string)
+	if err := json.Unmarshal([]byte(record.Labels), &labels); err != nil {
+		return "", err
+	}
+
+	var port_mappings []portMapping
+	if labels["port_map"] != "" {
+		if err := json.Unmarshal([]byte(labels["port_map"]), &port_mappings); err != nil {
+			return "", err
+		}
+	}
+
+	host_port := ""
+	for i, port_mapping := range port_mappings {
+		resp, err := api.StartProxy(port_mapping.Laddr, port_mapping.Lport, port_mapping.Protocol)
+		if err != nil {
+			return "", err
+		}
+		port_mappings[i].Raddr = resp.Proxy.Raddr
+		port_mappings[i].Rport = resp.Proxy.Rport
+		host_port += fmt.Sprintf("%s/%s:%d->%s:%d,", port_mapping.Protocol, port_mapping.Laddr, port_mapping.Lport, resp.Proxy.Raddr, resp.Proxy.Rport)
+		log.Info("[service] restore proxy %s:%d -> %s:%d", port_mapping.Laddr, port_mapping.Lport, resp.Proxy.Raddr, resp.Proxy.Rport)
+	}
+
+	port_map_str, _ := json.Marshal(port_mappings)
+	labels["port_map"] = string(port_map_str)
+	labels["host_port"] = host_port
+	labels_str, _ := json.Marshal(labels)
+	record.Labels = string(labels_str)
+
+	return host_port, db.UpdateGeneric(&record)
+}
@@ -0,0 +1,139 @@
+package docker
+
+/*
+	images tagged latest are refreshed in background when they are required, the digest of
+	the tag in registry is compared with the local one and the image is pulled again if they
+	differ, containers launched before the pull finishes still use the cached image
+*/
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Yeuoly/kisara/src/helper"
+	db "github.com/Yeuoly/kisara/src/routine/db"
+	log "github.com/Yeuoly/kisara/src/routine/log"
+	kisara_types "github.com/Yeuoly/kisara/src/types"
+)
+
+var (
+	image_refreshing      sync.Map // image name -> struct{}, refreshes in progress
+	image_refresh_handler func(kisara_types.ImageRefreshResult)
+)
+
+// SetImageRefreshHandler sets the handler called after an image is pulled again by refreshing
+func SetImageRefreshHandler(handler func(kisara_types.ImageRefreshResult)) {
+	image_refresh_handler = handler
+}
+
+// nodeImageRefresh returns the refresh policy of this node, never if it's not configured
+func nodeImageRefresh() kisara_types.ImageRefresh {
+	return kisara_types.ImageRefresh{
+		Policy: helper.GetConfigString("kisaraClient.image_refresh.policy"),
+		MaxAge: helper.GetConfigInt64("kisaraClient.image_refresh.max_age"),
+	}
+}
+
+// isLatestImage checks if image_name refers to the tag latest, explicitly or not
+func isLatestImage(image_name string) bool {
+	if strings.Contains(image_name, "@") {
+		return false
+	}
+	// registry address may contain a port
+	name := image_name[strings.LastIndex(image_name, "/")+1:]
+	return !strings.Contains(name, ":") || strings.HasSuffix(name, ":latest")
+}
+
+// shouldRefreshImage checks refresh policy of the launch, or the one of node if it's empty
+func shouldRefreshImage(image_id string, refresh kisara_types.ImageRefresh) bool {
+	if refresh.Policy == "" {
+		refresh = nodeImageRefresh()
+	}
+
+	switch refresh.Policy {
+	case kisara_types.IMAGE_REFRESH_ALWAYS:
+		return true
+	case kisara_types.IMAGE_REFRESH_IF_OLDER_THAN:
+		record, err := db.GetGenericOne[kisara_types.DBImage](
+			db.GenericEqual("image_id", image_id),
+		)
+		if err != nil {
+			return true
+		}
+		return time.Since(record.RefreshedAt) > time.Duration(refresh.MaxAge)*time.Second
+	}
+
+	return false
+}
+
+// refreshImageAsync refreshes image in background, only one refresh of an image runs at a time
+func (c *Docker) refreshImageAsync(image_name string, image_id string, repo_digests []string, credential *kisara_types.RegistryCredential) {
+	if _, loaded := image_refreshing.LoadOrStore(image_name, struct{}{}); loaded {
+		return
+	}
+
+	go func() {
+		defer image_refreshing.Delete(image_name)
+
+		result, err := c.refreshImage(image_name, image_id, repo_digests, credential)
+		if err != nil {
+			log.Warn("[docker] refresh image %s failed: %s", image_name, err.Error())
+			return
+		}
+		if result == nil {
+			return
+		}
+
+		log.Info("[docker] image %s refreshed: %s -> %s", image_name, result.OldImageId, result.NewImageId)
+		if image_refresh_handler != nil {
+			image_refresh_handler(*result)
+		}
+	}()
+}
+
+// refreshImage pulls image again if its digest in registry differs, nil if it's up to date
+func (c *Docker) refreshImage(image_name string, image_id string, repo_digests []string, credential *kisara_types.RegistryCredential) (*kisara_types.ImageRefreshResult, error) {
+	distribution, err := c.Client.DistributionInspect(*c.Ctx, image_name, registryAuth(image_name, credential))
+	if err != nil {
+		return nil, err
+	}
+
+	digest := distribution.Descriptor.Digest.String()
+	for _, repo_digest := range repo_digests {
+		if strings.HasSuffix(repo_digest, "@"+digest) {
+			touchImageRefreshed(image_id)
+			return nil, nil
+		}
+	}
+
+	image, err := c.PullImage(image_name, credential, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if image.Uuid == image_id {
+		return nil, nil
+	}
+
+	return &kisara_types.ImageRefreshResult{
+		ImageName:  image_name,
+		OldImageId: image_id,
+		NewImageId: image.Uuid,
+		Digest:     digest,
+	}, nil
+}
+
+func touchImageRefreshed(image_id string) {
+	record, err := db.GetGenericOne[kisara_types.DBImage](
+		db.GenericEqual("image_id", image_id),
+	)
+	if err != nil {
+		return
+	}
+
+	record.RefreshedAt = time.Now()
+	if err := db.UpdateGeneric(&record); err != nil {
+		log.Warn("[docker] update refresh time of image %s failed: %s", image_id, err.Error())
+	}
+}
@@ -0,0 +1,76 @@
+package docker
+
+/*
+	credentials of private registries come from requests or from [[kisaraClient.registries]]
+	of the node, they are only handed to docker and must never be logged or reported
+*/
+
+import (
+	"encoding/base64"
+	"encoding/json"
+
+	"github.com/Yeuoly/kisara/src/helper"
+	log "github.com/Yeuoly/kisara/src/routine/log"
+	kisara_types "github.com/Yeuoly/kisara/src/types"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/docker/api/types"
+)
+
+type registryConfig struct {
+	Host          string `mapstructure:"host"`
+	Username      string `mapstructure:"username"`
+	Password      string `mapstructure:"password"`
+	IdentityToken string `mapstructure:"identity_token"`
+}
+
+// registryHost returns the registry of image, docker.io for images on docker hub
+func registryHost(image_name string) string {
+	named, err := reference.ParseNormalizedNamed(image_name)
+	if err != nil {
+		return ""
+	}
+	return reference.Domain(named)
+}
+
+// nodeRegistryCredential returns the credential of host configured on this node, nil if there's none
+func nodeRegistryCredential(host string) *kisara_types.RegistryCredential {
+	var registries []registryConfig
+	if err := helper.UnmarshalConfig("kisaraClient.registries", &registries); err != nil {
+		// the error may contain values of the config
+		log.Warn("[docker] registries in config are broken")
+		return nil
+	}
+
+	for _, registry := range registries {
+		if registry.Host == host {
+			return &kisara_types.RegistryCredential{
+				Username:      registry.Username,
+				Password:      registry.Password,
+				IdentityToken: registry.IdentityToken,
+			}
+		}
+	}
+	return nil
+}
+
+// registryAuth encodes the credential of image for docker, the node's one is used if credential is nil
+func registryAuth(image_name string, credential *kisara_types.RegistryCredential) string {
+	host := registryHost(image_name)
+	if credential == nil {
+		credential = nodeRegistryCredential(host)
+	}
+	if credential == nil {
+		return ""
+	}
+
+	data, err := json.Marshal(types.AuthConfig{
+		Username:      credential.Username,
+		Password:      credential.Password,
+		IdentityToken: credential.IdentityToken,
+		ServerAddress: host,
+	})
+	if err != nil {
+		return ""
+	}
+	return base64.URLEncoding.EncodeToString(data)
+}
@@ -0,0 +1,212 @@
+package docker
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/Yeuoly/kisara/src/helper"
+	kisara_types "github.com/Yeuoly/kisara/src/types"
+	"github.com/docker/docker/api/types/container"
+)
+
+/*
+	resource limits of containers, defaults and maximums are read from [kisaraClient.limits],
+	a request exceeding the maximums of node is rejected instead of being cut down silently,
+	a maximum of 0 means no limit
+*/
+
+const (
+	default_cpu_limit    = 1.0
+	default_memory_limit = GBYTES * 2
+)
+
+type resourceLimits struct {
+	cpu           float64
+	memory        int64
+	pids          int64
+	disk_quota    int64
+	bandwidth     int64
+	max_cpu       float64
+	max_memory    int64
+	max_pids      int64
+	max_disk      int64
+	max_bandwidth int64
+}
+
+func getResourceLimits() resourceLimits {
+	limits := resourceLimits{
+		cpu:           helper.GetConfigFloat("kisaraClient.limits.cpu"),
+		memory:        helper.GetConfigInt64("kisaraClient.limits.memory"),
+		pids:          helper.GetConfigInt64("kisaraClient.limits.pids"),
+		disk_quota:    helper.GetConfigInt64("kisaraClient.limits.disk_quota"),
+		bandwidth:     helper.GetConfigInt64("kisaraClient.limits.bandwidth"),
+		max_cpu:       helper.GetConfigFloat("kisaraClient.limits.max_cpu"),
+		max_memory:    helper.GetConfigInt64("kisaraClient.limits.max_memory"),
+		max_pids:      helper.GetConfigInt64("kisaraClient.limits.max_pids"),
+		max_disk:      helper.GetConfigInt64("kisaraClient.limits.max_disk_quota"),
+		max_bandwidth: helper.GetConfigInt64("kisaraClient.limits.max_bandwidth"),
+	}
+	if limits.cpu == 0 {
+		limits.cpu = default_cpu_limit
+	}
+	if limits.memory == 0 {
+		limits.memory = default_memory_limit
+	}
+	return limits
+}
+
+func exceeded[T int64 | float64](value T, max T) bool {
+	return max > 0 && value > max
+}
+
+// resolveResources fills zero values with defaults and checks them against the maximums of node
+func resolveResources(resources kisara_types.ContainerResources) (kisara_types.ContainerResources, error) {
+	limits := getResourceLimits()
+
+	if resources.CpuLimit == 0 {
+		resources.CpuLimit = limits.cpu
+	}
+	if resources.MemoryLimit == 0 {
+		resources.MemoryLimit = limits.memory
+	}
+	if resources.PidsLimit == 0 {
+		resources.PidsLimit = limits.pids
+	}
+	if resources.DiskQuota == 0 {
+		resources.DiskQuota = limits.disk_quota
+	}
+	if resources.BandwidthIn == 0 {
+		resources.BandwidthIn = limits.bandwidth
+	}
+	if resources.BandwidthOut == 0 {
+		resources.BandwidthOut = limits.bandwidth
+	}
+
+	// no limit is more than any maximum
+	if resources.PidsLimit == 0 {
+		resources.PidsLimit = limits.max_pids
+	}
+	if resources.DiskQuota == 0 {
+		resources.DiskQuota = limits.max_disk
+	}
+	if resources.BandwidthIn == 0 {
+		resources.BandwidthIn = limits.max_bandwidth
+	}
+	if resources.BandwidthOut == 0 {
+		resources.BandwidthOut = limits.max_bandwidth
+	}
+
+	if resources.CpuLimit < 0 || resources.MemoryLimit < 0 || resources.PidsLimit < 0 ||
+		resources.DiskQuota < 0 || resources.BandwidthIn < 0 || resources.BandwidthOut < 0 {
+		return resources, errors.New("resource limits could not be negative")
+	}
+	if exceeded(resources.CpuLimit, limits.max_cpu) {
+		return resources, fmt.Errorf("cpu limit %.2f exceeds the maximum %.2f of node", resources.CpuLimit, limits.max_cpu)
+	}
+	if exceeded(resources.MemoryLimit, limits.max_memory) {
+		return resources, fmt.Errorf("memory limit %d exceeds the maximum %d of node", resources.MemoryLimit, limits.max_memory)
+	}
+	if exceeded(resources.PidsLimit, limits.max_pids) {
+		return resources, fmt.Errorf("pids limit %d exceeds the maximum %d of node", resources.PidsLimit, limits.max_pids)
+	}
+	if exceeded(resources.DiskQuota, limits.max_disk) {
+		return resources, fmt.Errorf("disk quota %d exceeds the maximum %d of node", resources.DiskQuota, limits.max_disk)
+	}
+	if exceeded(resources.BandwidthIn, limits.max_bandwidth) || exceeded(resources.BandwidthOut, limits.max_bandwidth) {
+		return resources, fmt.Errorf("bandwidth exceeds the maximum %d of node", limits.max_bandwidth)
+	}
+
+	return resources, nil
+}
+
+// hostResources converts resources into docker resources
+func hostResources(resources kisara_types.ContainerResources) container.Resources {
+	result := container.Resources{
+		Memory:   resources.MemoryLimit,
+		NanoCPUs: int64(resources.CpuLimit * 1000.0 * 1000.0 * 1000.0),
+	}
+	if resources.PidsLimit > 0 {
+		pids := resources.PidsLimit
+		result.PidsLimit = &pids
+	}
+	return result
+}
+
+// storageOpt returns the storage options of a container, disk quota is set as the size of its writable layer
+func storageOpt(resources kisara_types.ContainerResources) map[string]string {
+	if resources.DiskQuota <= 0 {
+		return nil
+	}
+	return map[string]string{
+		"size": strconv.FormatInt(resources.DiskQuota, 10),
+	}
+}
+
+/*
+	limitBandwidth shapes traffic of every interface in the network namespace of the container with tc
+	from host, so that images do not need to ship it, egress is shaped by tbf and ingress is policed
+*/
+func (c *Docker) limitBandwidth(container_id string, resources kisara_types.ContainerResources) error {
+	if resources.BandwidthIn <= 0 && resources.BandwidthOut <= 0 {
+		return nil
+	}
+
+	inspect, err := c.Client.ContainerInspect(*c.Ctx, container_id)
+	if err != nil {
+		return err
+	}
+	if inspect.State == nil || inspect.State.Pid == 0 {
+		return errors.New("container is not running")
+	}
+	pid := strconv.Itoa(inspect.State.Pid)
+
+	nsenter := func(args ...string) error {
+		output, err := exec.Command("nsenter", append([]string{"-t", pid, "-n"}, args...)...).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("%s: %s", strings.Join(args, " "), strings.TrimSpace(string(output)))
+		}
+		return nil
+	}
+
+	output, err := exec.Command("nsenter", "-t", pid, "-n", "ip", "-o", "link", "show").Output()
+	if err != nil {
+		return err
+	}
+
+	for _, line := range strings.Split(string(output), "\n") {
+		// 2: eth0@if10: <BROADCAST,MULTICAST,UP,LOWER_UP> ...
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		name := strings.SplitN(strings.TrimSuffix(fields[1], ":"), "@", 2)[0]
+		if name == "lo" {
+			continue
+		}
+
+		if resources.BandwidthOut > 0 {
+			rate := strconv.FormatInt(resources.BandwidthOut, 10) + "bit"
+			if err := nsenter("tc", "qdisc", "add", "dev", name, "root", "tbf", "rate", rate, "burst", "32kbit", "latency", "400ms"); err != nil {
+				return err
+			}
+		}
+
+		if resources.BandwidthIn > 0 {
+			rate := strconv.FormatInt(resources.BandwidthIn, 10) + "bit"
+			if err := nsenter("tc", "qdisc", "add", "dev", name, "handle", "ffff:", "ingress"); err != nil {
+				return err
+			}
+			if err := nsenter(
+				"tc", "filter", "add", "dev", name, "parent", "ffff:", "protocol", "all", "u32",
+				"match", "u32", "0", "0", "police", "rate", rate, "burst", "64kbit", "drop", "flowid", ":1",
+			); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
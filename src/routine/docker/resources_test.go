@@ -0,0 +1,113 @@
+package docker
+
+import (
+	"reflect"
+	"testing"
+
+	kisara_types "github.com/Yeuoly/kisara/src/types"
+	"github.com/spf13/viper"
+)
+
+var limit_keys = []string{"cpu", "memory", "pids", "disk_quota", "bandwidth", "max_cpu", "max_memory", "max_pids", "max_disk_quota", "max_bandwidth"}
+
+// setLimits replaces [kisaraClient.limits] with limits
+func setLimits(limits map[string]interface{}) {
+	for _, key := range limit_keys {
+		viper.Set("kisaraClient.limits."+key, limits[key])
+	}
+}
+
+func TestResolveResources(t *testing.T) {
+	defer setLimits(nil)
+
+	cases := []struct {
+		name      string
+		limits    map[string]interface{}
+		resources kisara_types.ContainerResources
+		expected  kisara_types.ContainerResources
+		fails     bool
+	}{
+		{
+			name:     "built-in defaults without config",
+			expected: kisara_types.ContainerResources{CpuLimit: 1, MemoryLimit: GBYTES * 2},
+		},
+		{
+			name:   "defaults of node",
+			limits: map[string]interface{}{"cpu": 2.0, "memory": GBYTES, "pids": 100, "disk_quota": GBYTES * 10, "bandwidth": 1000000},
+			expected: kisara_types.ContainerResources{
+				CpuLimit: 2, MemoryLimit: GBYTES, PidsLimit: 100, DiskQuota: GBYTES * 10, BandwidthIn: 1000000, BandwidthOut: 1000000,
+			},
+		},
+		{
+			name:      "requested values override defaults",
+			limits:    map[string]interface{}{"cpu": 2.0, "pids": 100, "bandwidth": 1000000},
+			resources: kisara_types.ContainerResources{CpuLimit: 0.5, PidsLimit: 50, BandwidthOut: 2000},
+			expected: kisara_types.ContainerResources{
+				CpuLimit: 0.5, MemoryLimit: GBYTES * 2, PidsLimit: 50, BandwidthIn: 1000000, BandwidthOut: 2000,
+			},
+		},
+		{
+			name:   "0 falls back to the maximum",
+			limits: map[string]interface{}{"max_pids": 200, "max_disk_quota": GBYTES, "max_bandwidth": 5000},
+			expected: kisara_types.ContainerResources{
+				CpuLimit: 1, MemoryLimit: GBYTES * 2, PidsLimit: 200, DiskQuota: GBYTES, BandwidthIn: 5000, BandwidthOut: 5000,
+			},
+		},
+		{
+			name:      "values equal to the maximums are accepted",
+			limits:    map[string]interface{}{"max_cpu": 2.0, "max_memory": GBYTES, "max_pids": 200},
+			resources: kisara_types.ContainerResources{CpuLimit: 2, MemoryLimit: GBYTES, PidsLimit: 200},
+			expected:  kisara_types.ContainerResources{CpuLimit: 2, MemoryLimit: GBYTES, PidsLimit: 200},
+		},
+		{
+			name:      "cpu above the maximum is rejected",
+			limits:    map[string]interface{}{"max_cpu": 1.0},
+			resources: kisara_types.ContainerResources{CpuLimit: 1.5},
+			fails:     true,
+		},
+		{
+			name:   "a default above the maximum is rejected",
+			limits: map[string]interface{}{"max_memory": GBYTES},
+			fails:  true,
+		},
+		{
+			name:      "pids above the maximum are rejected",
+			limits:    map[string]interface{}{"max_pids": 100},
+			resources: kisara_types.ContainerResources{PidsLimit: 101},
+			fails:     true,
+		},
+		{
+			name:      "disk quota above the maximum is rejected",
+			limits:    map[string]interface{}{"max_disk_quota": GBYTES},
+			resources: kisara_types.ContainerResources{DiskQuota: GBYTES + 1},
+			fails:     true,
+		},
+		{
+			name:      "bandwidth above the maximum is rejected",
+			limits:    map[string]interface{}{"max_bandwidth": 1000},
+			resources: kisara_types.ContainerResources{BandwidthIn: 500, BandwidthOut: 1001},
+			fails:     true,
+		},
+		{
+			name:      "negative values are rejected",
+			resources: kisara_types.ContainerResources{MemoryLimit: -1},
+			fails:     true,
+		},
+	}
+
+	for _, c := range cases {
+		setLimits(c.limits)
+		resources, err := resolveResources(c.resources)
+		if c.fails {
+			if err == nil {
+				t.Errorf("%s: expected an error, got %+v", c.name, resources)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", c.name, err.Error())
+		} else if !reflect.DeepEqual(resources, c.expected) {
+			t.Errorf("%s: unexpected resources %+v", c.name, resources)
+		}
+	}
+}
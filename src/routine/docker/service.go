@@ -1,6 +1,7 @@
 package docker
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"strings"
@@ -9,6 +10,7 @@ import (
 	"github.com/Yeuoly/kisara/src/routine/db"
 	log "github.com/Yeuoly/kisara/src/routine/log"
 	"github.com/Yeuoly/kisara/src/types"
+	volume_types "github.com/docker/docker/api/types/volume"
 	uuid "github.com/satori/go.uuid"
 )
 
@@ -44,12 +46,29 @@ func walk_services(callback func(service *types.Service)) {
 	current_services_locker.Unlock()
 }
 
-// create a service from a service config
-func (c *Docker) CreateService(service_config types.KisaraService, message_callback ...func(string)) (*types.Service, error) {
+// saveService writes the service back into database
+func saveService(service *types.Service) error {
+	record, err := db.GetGenericOne[types.DBService](db.GenericEqual("service_id", service.Id))
+	if err != nil {
+		return err
+	}
+	record.InjectService(*service)
+	return db.UpdateGeneric(&record)
+}
+
+/*
+	create a service from a service config, build_contexts are tar archives of build contexts
+	used by containers with build, keyed by ServiceConfigContainerBuild.Context, image_refresh
+	overrides the image refresh policy of the node if it's set
+*/
+func (c *Docker) CreateService(service_config types.KisaraService, build_contexts map[string][]byte, image_refresh types.ImageRefresh, message_callback ...func(string)) (*types.Service, error) {
 	config, err := service_config.GetConfig()
 	if err != nil {
 		return nil, err
 	}
+	if err := image_refresh.Check(); err != nil {
+		return nil, err
+	}
 
 	networks := config.GetNetworks()
 	if len(networks) > 4 {
@@ -103,7 +122,7 @@ func (c *Docker) CreateService(service_config types.KisaraService, message_callb
 				return nil, err
 			}
 		} else {
-			net, err = c.CreateNetwork(uuid.NewV4().String(), network.Network, true, "overlay")
+			net, err = c.CreateFixedSubnetNetwork(network.Subnet, uuid.NewV4().String(), true, "overlay")
 			if err != nil {
 				release_networks()
 				return nil, err
@@ -117,38 +136,123 @@ func (c *Docker) CreateService(service_config types.KisaraService, message_callb
 		callback(fmt.Sprintf("network %s created\n", network.Network))
 	}
 
-	// create containers
-	result_containers := make([]types.Container, 0)
+	// build images, built_images[i] is the image built for config.Containers[i]
+	built_images := make(map[int]string)
+	for i, container_config := range config.Containers {
+		if container_config.Build == nil {
+			continue
+		}
+		build_context, ok := build_contexts[container_config.Build.Context]
+		if !ok {
+			release_networks()
+			return nil, fmt.Errorf("build context %s is not uploaded", container_config.Build.Context)
+		}
+		image_name := container_config.Build.ImageName(container_config.Image, container_config.Name, build_context)
+		err = c.buildServiceImage(build_context, *container_config.Build, image_name, callback)
+		if err != nil {
+			release_networks()
+			return nil, err
+		}
+		built_images[i] = image_name
+		callback(fmt.Sprintf("image %s built\n", image_name))
+	}
+
+	service_id := uuid.NewV4().String()
+
+	// create volumes shared by containers, anonymous ones are created by docker with containers
+	result_volumes := make([]string, 0)
+	volume_names := make(map[string]string)
+	release_volumes := func() {
+		for _, name := range result_volumes {
+			if err := c.Client.VolumeRemove(*c.Ctx, name, true); err != nil {
+				log.Warn("[service] release volume failed: %s", err.Error())
+			}
+		}
+		release_networks()
+	}
+
+	for _, container_config := range config.Containers {
+		for _, volume := range container_config.Volumes {
+			if volume.Source == "" || volume_names[volume.Source] != "" {
+				continue
+			}
+			name := "kisara_service_" + service_id + "_" + volume.Source
+			_, err := c.Client.VolumeCreate(*c.Ctx, volume_types.CreateOptions{
+				Name:   name,
+				Labels: map[string]string{"irina": "true", "service": service_id},
+			})
+			if err != nil {
+				release_volumes()
+				return nil, err
+			}
+			volume_names[volume.Source] = name
+			result_volumes = append(result_volumes, name)
+		}
+	}
+
+	// create containers, launched[i] is the container of config.Containers[i]
+	launched := make([]*types.Container, len(config.Containers))
+	container_flags := make([][]types.ServiceFlag, len(config.Containers))
 	release_containers := func() {
-		for _, container := range result_containers {
+		for _, container := range launched {
+			if container == nil {
+				continue
+			}
 			err = c.StopContainer(container.Id)
 			if err != nil {
 				log.Warn("[service] release container failed: %s", err.Error())
 			}
 		}
-		release_networks()
+		release_volumes()
 	}
 
-	flags := make([]types.ServiceFlag, 0)
+	order, err := config.LaunchOrder()
+	if err != nil {
+		release_volumes()
+		return nil, err
+	}
 
-	for i := 0; i < len(config.Containers); i++ {
+	for _, i := range order {
 		container_config := config.Containers[i]
+		options := &types.ContainerOptions{
+			IPv4Addresses: make(map[string]string),
+			Cmd:           container_config.Command,
+			Entrypoint:    container_config.Entrypoint,
+			CapAdd:        container_config.CapAdd,
+			Healthcheck:   container_config.Healthcheck,
+			ImageRefresh:  image_refresh,
+		}
+		if container_config.Name != "" {
+			options.Aliases = []string{container_config.Name}
+		}
+		for _, volume := range container_config.Volumes {
+			volume.Source = volume_names[volume.Source]
+			options.Volumes = append(options.Volumes, volume)
+		}
+
 		// find networks the container should be connected to
-		networks := make([]*types.Network, 0)
+		network_names := make([]string, 0)
 		for _, network := range result_networks {
 			for _, container_network := range container_config.Networks {
 				if container_network.Network == network.OriginalName {
-					networks = append(networks, network.network)
+					address, err := container_network.GetAddress(network.network.Subnet)
+					if err != nil {
+						release_containers()
+						return nil, err
+					}
+					network_names = append(network_names, network.network.Name)
+					if address != "" {
+						options.IPv4Addresses[network.network.Name] = address
+					}
 				}
 			}
 		}
 
-		network_names := make([]string, 0)
-		for _, network := range networks {
-			network_names = append(network_names, network.Name)
+		image := container_config.Image
+		if built, ok := built_images[i]; ok {
+			image = built
 		}
-
-		container, err := c.LaunchServiceContainer(container_config.Image, container_config.GetPortProtocolText(), service_config.Owner, network_names, container_config.Env)
+		container, err := c.LaunchServiceContainer(image, container_config.GetPortProtocolText(), service_config.Owner, network_names, options, container_config.Env, container_config.GetResources())
 		if err != nil {
 			release_containers()
 			return nil, err
@@ -156,26 +260,44 @@ func (c *Docker) CreateService(service_config types.KisaraService, message_callb
 
 		callback(fmt.Sprintf("container %s created\n", container.Id))
 
-		result_containers = append(result_containers, *container)
+		launched[i] = container
+
+		// flags and dependents wait until the container is ready, a failed probe rolls back the service
+		if container_config.Readiness != nil {
+			callback(fmt.Sprintf("waiting for container %s to be ready\n", container.Id))
+			if err := c.WaitReady(container.Id, *container_config.Readiness); err != nil {
+				release_containers()
+				return nil, err
+			}
+			callback(fmt.Sprintf("container %s is ready\n", container.Id))
+		}
 		// execute flag command
 		for _, flag := range container_config.Flags {
-			flag_text := `kisara{` + uuid.NewV4().String() + `}`
-			flag_command := strings.Replace(flag.FlagCommand, "$flag", flag_text, -1)
-			err := c.Exec(container.Id, flag_command)
+			flag_text := generateFlag()
+			err := c.writeFlag(container.Id, flag.FlagCommand, flag_text)
 			if err != nil {
 				release_containers()
 				return nil, err
 			}
 
-			flags = append(flags, types.ServiceFlag{
-				FlagUuid: flag.FlagUuid,
-				Flag:     flag_text,
+			container_flags[i] = append(container_flags[i], types.ServiceFlag{
+				FlagUuid:    flag.FlagUuid,
+				Flag:        flag_text,
+				ContainerId: container.Id,
+				FlagCommand: flag.FlagCommand,
 			})
 
 			callback(fmt.Sprintf("flag %s created\n", flag.FlagUuid))
 		}
 	}
 
+	result_containers := make([]types.Container, 0)
+	flags := make([]types.ServiceFlag, 0)
+	for i, container := range launched {
+		result_containers = append(result_containers, *container)
+		flags = append(flags, container_flags[i]...)
+	}
+
 	networks_result := make([]types.Network, 0)
 	for _, network := range result_networks {
 		networks_result = append(networks_result, *network.network)
@@ -183,12 +305,13 @@ func (c *Docker) CreateService(service_config types.KisaraService, message_callb
 
 	// create service
 	service := types.Service{
-		Id:         uuid.NewV4().String(),
+		Id:         service_id,
 		Name:       service_config.Name,
 		Containers: result_containers,
 		Networks:   networks_result,
 		Flags:      flags,
 		Status:     types.SERVICE_STATUS_RUNNING,
+		Volumes:    result_volumes,
 	}
 
 	// save service
@@ -212,6 +335,14 @@ func (c *Docker) DeleteService(service_id string) error {
 		return errors.New("service not found")
 	}
 	defer delete_service(service_id)
+	defer service_flag_lockers.Delete(service_id)
+
+	record, err := db.GetGenericOne[types.DBService](db.GenericEqual("service_id", service_id))
+	if err == nil {
+		if err := db.DeleteGeneric(&record); err != nil {
+			log.Warn("[service] delete service record failed: %s", err.Error())
+		}
+	}
 
 	for _, container := range service.Containers {
 		err := c.StopContainer(container.Id)
@@ -220,6 +351,12 @@ func (c *Docker) DeleteService(service_id string) error {
 		}
 	}
 
+	for _, volume := range service.Volumes {
+		if err := c.Client.VolumeRemove(*c.Ctx, volume, true); err != nil {
+			log.Warn("[service] remove volume %s failed: %s", volume, err.Error())
+		}
+	}
+
 	for _, network := range service.Networks {
 		if strings.HasPrefix(network.Name, "kisara_") {
 			err := c.ReleaseCIDRNetwork(network.Name[7:])
@@ -237,6 +374,38 @@ func (c *Docker) DeleteService(service_id string) error {
 	return nil
 }
 
+/*
+	buildServiceImage builds image_name from a tar context, it fails if any step of the build fails,
+	image_name is hashed from the build, so an image already built from the same build is reused
+*/
+func (c *Docker) buildServiceImage(build_context []byte, build types.ServiceConfigContainerBuild, image_name string, callback func(string)) error {
+	if raw_image, _, err := c.Client.ImageInspectWithRaw(*c.Ctx, image_name); err == nil {
+		callback(fmt.Sprintf("image %s is already built\n", image_name))
+		return saveImageRecord(image_name, raw_image.ID, false)
+	}
+
+	finished_chan := make(chan struct{}, 1)
+	var fault_error error
+
+	err := c.BuildImageWithDockerfile(
+		bytes.NewReader(build_context),
+		image_name,
+		build.Dockerfile,
+		build.Args,
+		callback,
+		func(fault string) {
+			fault_error = fmt.Errorf("build image %s failed: %s", image_name, fault)
+		},
+		finished_chan,
+	)
+	if err != nil {
+		return err
+	}
+
+	<-finished_chan
+	return fault_error
+}
+
 func (c *Docker) GetService(service_id string) (*types.Service, error) {
 	service := get_service(service_id)
 	if service == nil {
@@ -0,0 +1,39 @@
+package docker
+
+import (
+	kisara_types "github.com/Yeuoly/kisara/src/types"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+)
+
+// ListContainerUsages returns usages of running containers launched by kisara, read from their stats monitors
+func (c *Docker) ListContainerUsages() ([]kisara_types.ContainerUsage, error) {
+	containers, err := c.Client.ContainerList(*c.Ctx, types.ContainerListOptions{
+		Filters: filters.NewArgs(filters.Arg("label", "irina=true")),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	usages := []kisara_types.ContainerUsage{}
+	for _, container := range containers {
+		stats, ok := getMonitor(container.ID)
+		if !ok {
+			continue
+		}
+		usages = append(usages, kisara_types.ContainerUsage{
+			ContainerId: container.ID,
+			Image:       container.Image,
+			Owner:       container.Labels["owner_uid"],
+			Module:      container.Labels["module"],
+			CPUUsage:    stats.CPUPer,
+			MemUsage:    stats.MemUsage,
+			MemLimit:    stats.MemTotal,
+			NetRx:       stats.NetRx,
+			NetTx:       stats.NetTx,
+			BlkRead:     stats.BlkRead,
+			BlkWrite:    stats.BlkWrite,
+		})
+	}
+	return usages, nil
+}
@@ -0,0 +1,249 @@
+package history
+
+/*
+	resource usage of the node and its containers is sampled every interval and kept in ring buffers
+	for retention, rates of network and block I/O are computed from counters when they're sampled,
+	so a query only averages samples in each step, history of a removed container is kept until its
+	last sample expires, nothing is kept across restarts
+*/
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Yeuoly/kisara/src/types"
+)
+
+const (
+	HISTORY_INTERVAL  = 10    // default seconds between samples
+	HISTORY_RETENTION = 86400 // default seconds samples are kept
+)
+
+// Counters are cumulative bytes of network and block I/O
+type Counters struct {
+	NetRx    uint64
+	NetTx    uint64
+	BlkRead  uint64
+	BlkWrite uint64
+}
+
+// point is a sample stored compactly, 40 bytes each
+type point struct {
+	time      int64
+	mem_usage uint64
+	cpu_usage float32
+	net_rx    float32
+	net_tx    float32
+	blk_read  float32
+	blk_write float32
+}
+
+// series is a ring of points, it grows until capacity so short-lived containers take little memory
+type series struct {
+	meta     types.ResourceSeries
+	points   []point
+	capacity int
+	start    int
+	counters Counters
+	last     int64
+}
+
+var (
+	history_lock     sync.RWMutex
+	history_capacity = HISTORY_RETENTION / HISTORY_INTERVAL
+	history_interval = int64(HISTORY_INTERVAL)
+	node_series      *series
+	container_series = make(map[string]*series)
+)
+
+// Init sets the interval and retention in seconds, history recorded before is dropped
+func Init(interval int64, retention int64) {
+	if interval <= 0 {
+		interval = HISTORY_INTERVAL
+	}
+	if retention <= 0 {
+		retention = HISTORY_RETENTION
+	}
+
+	history_lock.Lock()
+	defer history_lock.Unlock()
+	history_interval = interval
+	history_capacity = int((retention + interval - 1) / interval)
+	node_series = nil
+	container_series = make(map[string]*series)
+}
+
+// Interval returns seconds between samples, the finest step of a query
+func Interval() int64 {
+	history_lock.RLock()
+	defer history_lock.RUnlock()
+	return history_interval
+}
+
+func rate(current uint64, last uint64, elapsed float64) float32 {
+	// counters are reset when a container restarts or an interface is recreated
+	if current < last || elapsed <= 0 {
+		return 0
+	}
+	return float32(float64(current-last) / elapsed)
+}
+
+func (s *series) record(now time.Time, cpu_usage float64, mem_usage uint64, counters Counters) {
+	p := point{
+		time:      now.Unix(),
+		mem_usage: mem_usage,
+		cpu_usage: float32(cpu_usage),
+	}
+	// the first sample has nothing to compare with, its rates are 0
+	if s.last > 0 {
+		elapsed := float64(now.Unix() - s.last)
+		p.net_rx = rate(counters.NetRx, s.counters.NetRx, elapsed)
+		p.net_tx = rate(counters.NetTx, s.counters.NetTx, elapsed)
+		p.blk_read = rate(counters.BlkRead, s.counters.BlkRead, elapsed)
+		p.blk_write = rate(counters.BlkWrite, s.counters.BlkWrite, elapsed)
+	}
+	s.counters = counters
+	s.last = now.Unix()
+
+	if len(s.points) < s.capacity {
+		s.points = append(s.points, p)
+	} else {
+		s.points[s.start] = p
+		s.start = (s.start + 1) % len(s.points)
+	}
+}
+
+// query averages points in [from, to) by step, steps without points are skipped
+func (s *series) query(from int64, to int64, step int64) []types.ResourceSample {
+	if step <= 0 {
+		step = 1
+	}
+	samples := []types.ResourceSample{}
+	var sum types.ResourceSample
+	var mem_sum float64
+	count := 0
+
+	flush := func() {
+		if count == 0 {
+			return
+		}
+		n := float64(count)
+		samples = append(samples, types.ResourceSample{
+			Time:     sum.Time,
+			CPUUsage: sum.CPUUsage / n,
+			MemUsage: uint64(mem_sum / n),
+			NetRx:    sum.NetRx / n,
+			NetTx:    sum.NetTx / n,
+			BlkRead:  sum.BlkRead / n,
+			BlkWrite: sum.BlkWrite / n,
+		})
+	}
+
+	for i := 0; i < len(s.points); i++ {
+		p := s.points[(s.start+i)%len(s.points)]
+		if p.time < from || p.time >= to {
+			continue
+		}
+
+		bucket := p.time - p.time%step
+		if count > 0 && bucket != sum.Time {
+			flush()
+			sum, mem_sum, count = types.ResourceSample{}, 0, 0
+		}
+		sum.Time = bucket
+		sum.CPUUsage += float64(p.cpu_usage)
+		mem_sum += float64(p.mem_usage)
+		sum.NetRx += float64(p.net_rx)
+		sum.NetTx += float64(p.net_tx)
+		sum.BlkRead += float64(p.blk_read)
+		sum.BlkWrite += float64(p.blk_write)
+		count++
+	}
+	flush()
+
+	return samples
+}
+
+func newSeries(meta types.ResourceSeries) *series {
+	return &series{meta: meta, capacity: history_capacity}
+}
+
+// RecordNode adds a sample of the node
+func RecordNode(now time.Time, cpu_usage float64, mem_usage uint64, counters Counters) {
+	history_lock.Lock()
+	defer history_lock.Unlock()
+	if node_series == nil {
+		node_series = newSeries(types.ResourceSeries{})
+	}
+	node_series.record(now, cpu_usage, mem_usage, counters)
+}
+
+// RecordContainer adds a sample of a container, meta is kept from its first sample
+func RecordContainer(now time.Time, meta types.ResourceSeries, cpu_usage float64, mem_usage uint64, counters Counters) {
+	history_lock.Lock()
+	defer history_lock.Unlock()
+	s, ok := container_series[meta.ContainerID]
+	if !ok {
+		s = newSeries(meta)
+		container_series[meta.ContainerID] = s
+	}
+	s.record(now, cpu_usage, mem_usage, counters)
+}
+
+// Expire drops history of containers whose last sample is older than retention
+func Expire(now time.Time) {
+	history_lock.Lock()
+	defer history_lock.Unlock()
+	before := now.Unix() - int64(history_capacity)*history_interval
+	for container_id, s := range container_series {
+		if s.last < before {
+			delete(container_series, container_id)
+		}
+	}
+}
+
+// QueryNode returns history of the node
+func QueryNode(from int64, to int64, step int64) types.ResourceSeries {
+	history_lock.RLock()
+	defer history_lock.RUnlock()
+	if node_series == nil {
+		return types.ResourceSeries{Samples: []types.ResourceSample{}}
+	}
+	result := node_series.meta
+	result.Samples = node_series.query(from, to, step)
+	return result
+}
+
+// QueryContainer returns history of a container, false if nothing is recorded for it
+func QueryContainer(container_id string, from int64, to int64, step int64) (types.ResourceSeries, bool) {
+	history_lock.RLock()
+	defer history_lock.RUnlock()
+	s, ok := container_series[container_id]
+	if !ok {
+		return types.ResourceSeries{}, false
+	}
+	result := s.meta
+	result.Samples = s.query(from, to, step)
+	return result, true
+}
+
+// QueryContainers returns history of every container having samples in the range, ordered by container id
+func QueryContainers(from int64, to int64, step int64) []types.ResourceSeries {
+	history_lock.RLock()
+	defer history_lock.RUnlock()
+	results := []types.ResourceSeries{}
+	for _, s := range container_series {
+		samples := s.query(from, to, step)
+		if len(samples) == 0 {
+			continue
+		}
+		result := s.meta
+		result.Samples = samples
+		results = append(results, result)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].ContainerID < results[j].ContainerID
+	})
+	return results
+}
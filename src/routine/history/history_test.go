@@ -0,0 +1,122 @@
+package history
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Yeuoly/kisara/src/types"
+)
+
+func at(sec int64) time.Time {
+	return time.Unix(sec, 0)
+}
+
+func TestSeriesRate(t *testing.T) {
+	s := &series{capacity: 10}
+	s.record(at(100), 50, 1000, Counters{NetRx: 1000, NetTx: 500, BlkRead: 100, BlkWrite: 10})
+	s.record(at(110), 50, 1000, Counters{NetRx: 2000, NetTx: 700, BlkRead: 600, BlkWrite: 10})
+	// the counter of NetRx is reset, its rate is 0 instead of a wrapped value
+	s.record(at(120), 50, 1000, Counters{NetRx: 100, NetTx: 900, BlkRead: 600, BlkWrite: 30})
+
+	expected := []point{
+		// the first sample has nothing to compare with
+		{time: 100, mem_usage: 1000, cpu_usage: 50},
+		{time: 110, mem_usage: 1000, cpu_usage: 50, net_rx: 100, net_tx: 20, blk_read: 50},
+		{time: 120, mem_usage: 1000, cpu_usage: 50, net_tx: 20, blk_write: 2},
+	}
+	if !reflect.DeepEqual(s.points, expected) {
+		t.Fatalf("unexpected points %+v", s.points)
+	}
+
+	// the sample after a reset is rated against the reset counter
+	s.record(at(130), 50, 1000, Counters{NetRx: 600, NetTx: 900, BlkRead: 600, BlkWrite: 30})
+	if s.points[3].net_rx != 50 {
+		t.Fatalf("unexpected rate after reset %v", s.points[3].net_rx)
+	}
+
+	// samples in the same second have no elapsed time
+	s.record(at(130), 50, 1000, Counters{NetRx: 700})
+	if s.points[4].net_rx != 0 {
+		t.Fatalf("unexpected rate without elapsed time %v", s.points[4].net_rx)
+	}
+}
+
+func TestSeriesRingWraparound(t *testing.T) {
+	s := &series{capacity: 3}
+	for i := int64(0); i < 5; i++ {
+		s.record(at(100+i*10), float64(i), uint64(i), Counters{})
+	}
+
+	if len(s.points) != 3 {
+		t.Fatalf("ring grows to %d points", len(s.points))
+	}
+	// the two oldest samples are overwritten, the rest are returned in time order
+	samples := s.query(0, 1000, 1)
+	times := []int64{}
+	for _, sample := range samples {
+		times = append(times, sample.Time)
+	}
+	if !reflect.DeepEqual(times, []int64{120, 130, 140}) {
+		t.Fatalf("unexpected times %v", times)
+	}
+	if samples[0].CPUUsage != 2 || samples[2].MemUsage != 4 {
+		t.Fatalf("unexpected samples %+v", samples)
+	}
+}
+
+func TestSeriesQuery(t *testing.T) {
+	s := &series{capacity: 10}
+	for i := int64(0); i < 6; i++ {
+		s.record(at(100+i*10), float64(i*10), uint64(i*100), Counters{})
+	}
+
+	cases := []struct {
+		name     string
+		from     int64
+		to       int64
+		step     int64
+		expected []types.ResourceSample
+	}{
+		{
+			name: "from is inclusive and to is exclusive",
+			from: 110, to: 130, step: 10,
+			expected: []types.ResourceSample{
+				{Time: 110, CPUUsage: 10, MemUsage: 100},
+				{Time: 120, CPUUsage: 20, MemUsage: 200},
+			},
+		},
+		{
+			name: "points are averaged in each step",
+			from: 100, to: 160, step: 30,
+			expected: []types.ResourceSample{
+				{Time: 90, CPUUsage: 5, MemUsage: 50},
+				{Time: 120, CPUUsage: 30, MemUsage: 300},
+				{Time: 150, CPUUsage: 50, MemUsage: 500},
+			},
+		},
+		{
+			name: "nothing in the range",
+			from: 200, to: 300, step: 10,
+			expected: []types.ResourceSample{},
+		},
+		{
+			name: "empty range",
+			from: 120, to: 120, step: 10,
+			expected: []types.ResourceSample{},
+		},
+		{
+			name: "step is at least 1",
+			from: 150, to: 151, step: 0,
+			expected: []types.ResourceSample{
+				{Time: 150, CPUUsage: 50, MemUsage: 500},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		if samples := s.query(c.from, c.to, c.step); !reflect.DeepEqual(samples, c.expected) {
+			t.Errorf("%s: unexpected samples %+v", c.name, samples)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package metrics
+
+/*
+	metrics are exported by prometheus client, counters and histograms are kept in memory by it,
+	gauges which depend on the state of kisara are read by collectors when /metrics is scraped
+*/
+
+import (
+	"net/http"
+
+	"github.com/Yeuoly/kisara/src/controller"
+	"github.com/Yeuoly/kisara/src/helper"
+	log "github.com/Yeuoly/kisara/src/routine/log"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// default buckets of latency histograms in seconds
+var LATENCY_BUCKETS = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// collector reads gauges on every scrape, descs are all metrics it may send
+type collector struct {
+	descs   []*prometheus.Desc
+	collect func(ch chan<- prometheus.Metric)
+}
+
+func (c *collector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range c.descs {
+		ch <- desc
+	}
+}
+
+func (c *collector) Collect(ch chan<- prometheus.Metric) {
+	c.collect(ch)
+}
+
+// RegisterCollector registers collect to be called on every scrape, it should only send metrics of descs
+func RegisterCollector(collect func(ch chan<- prometheus.Metric), descs ...*prometheus.Desc) {
+	prometheus.MustRegister(&collector{descs: descs, collect: collect})
+}
+
+// Gauge sends a gauge sample of desc, label values are in the order of the labels of desc
+func Gauge(ch chan<- prometheus.Metric, desc *prometheus.Desc, value float64, label_values ...string) {
+	ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, value, label_values...)
+}
+
+// Counter sends a counter sample of desc, label values are in the order of the labels of desc
+func Counter(ch chan<- prometheus.Metric, desc *prometheus.Desc, value float64, label_values ...string) {
+	ch <- prometheus.MustNewConstMetric(desc, prometheus.CounterValue, value, label_values...)
+}
+
+/*
+	Handler serves /metrics, it requires "Authorization: Bearer <kisara.metrics_token>", metrics are
+	not signed by kisara.token since prometheus is not able to sign requests, /metrics refuses every
+	request if the token is not set, so they are never exposed by a config missing it
+*/
+func Handler() gin.HandlerFunc {
+	token := helper.GetConfigString("kisara.metrics_token")
+	if token == "" {
+		log.Warn("[Kisara] kisara.metrics_token is not set, /metrics is disabled")
+		return func(r *gin.Context) {
+			r.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"message": "metrics are disabled since kisara.metrics_token is not set"})
+		}
+	}
+
+	handler := promhttp.Handler()
+	return func(r *gin.Context) {
+		if !controller.CheckBearerToken(r, token) {
+			r.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		handler.ServeHTTP(r.Writer, r.Request)
+	}
+}
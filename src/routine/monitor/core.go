@@ -18,6 +18,8 @@ const (
 	MONITOR_VM                   = 0x9
 	MONITOR_AWD_STATUS_REFRESHER = 0xA
 	MONITOR_USER_LIVING          = 0xB // use to monitor how many users are living
+	MONITOR_KISARA_REAPER        = 0xC // stops expired containers and services
+	MONITOR_KISARA_IMAGE_GC      = 0xD // removes unused images
 	MONITOR_SCHEDULE_INTERVAL    = 30
 )
 
@@ -5,7 +5,9 @@ import (
 	"sync"
 
 	"github.com/Yeuoly/kisara/src/helper"
+	"github.com/Yeuoly/kisara/src/routine/metrics"
 	routine_minitor "github.com/Yeuoly/kisara/src/routine/monitor"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 type Response struct {
@@ -13,6 +15,9 @@ type Response struct {
 	RemainderTimes int
 	Finished       bool
 	StatusText     string
+	// Logs are kept until the request is collected, they are read by offset instead of being consumed
+	Logs      []string
+	logs_lock sync.Mutex
 }
 
 type RequestField struct {
@@ -76,6 +81,36 @@ func SetRequestStatusText(request_id string, text string) bool {
 	return false
 }
 
+// AppendRequestLog appends text to logs of the request
+func AppendRequestLog(request_id string, text string) bool {
+	value, _ := request_field.Map.Load(request_id)
+	if value != nil {
+		response := value.(*Response)
+		response.logs_lock.Lock()
+		defer response.logs_lock.Unlock()
+		response.Logs = append(response.Logs, text)
+		return true
+	}
+	return false
+}
+
+// GetRequestLogs returns logs of the request from offset and the offset after them
+func GetRequestLogs(request_id string, offset int) ([]string, int) {
+	value, _ := request_field.Map.Load(request_id)
+	if value == nil {
+		return []string{}, offset
+	}
+	response := value.(*Response)
+	response.logs_lock.Lock()
+	defer response.logs_lock.Unlock()
+	if offset < 0 || offset > len(response.Logs) {
+		offset = len(response.Logs)
+	}
+	logs := make([]string, len(response.Logs)-offset)
+	copy(logs, response.Logs[offset:])
+	return logs, len(response.Logs)
+}
+
 func FinishRequest(request_id string, response_text string) {
 	value, _ := request_field.Map.Load(request_id)
 	if value != nil {
@@ -85,8 +120,28 @@ func FinishRequest(request_id string, response_text string) {
 	}
 }
 
+// Backlog returns the number of requests still running and finished ones not collected yet
+func Backlog() (int, int) {
+	running, finished := 0, 0
+	request_field.Map.Range(func(key, value interface{}) bool {
+		if value.(*Response).Finished {
+			finished++
+		} else {
+			running++
+		}
+		return true
+	})
+	return running, finished
+}
+
 func init() {
 	request_field = &RequestField{}
+	requests_desc := prometheus.NewDesc("kisara_async_requests", "Async requests kept in routine/request", []string{"state"}, nil)
+	metrics.RegisterCollector(func(ch chan<- prometheus.Metric) {
+		running, finished := Backlog()
+		metrics.Gauge(ch, requests_desc, float64(running), "running")
+		metrics.Gauge(ch, requests_desc, float64(finished), "finished")
+	}, requests_desc)
 	request_field_monitor := routine_minitor.Monitor{
 		Type:            routine_minitor.MONITOR_REQUEST,
 		RefreshInterval: 30,
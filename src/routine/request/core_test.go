@@ -0,0 +1,49 @@
+package routine
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRequestLogs(t *testing.T) {
+	request_id := CreateNewResponse()
+
+	logs, offset := GetRequestLogs(request_id, 0)
+	if len(logs) != 0 || offset != 0 {
+		t.Fatalf("expected no logs, got %v at %d", logs, offset)
+	}
+
+	AppendRequestLog(request_id, "step 1")
+	AppendRequestLog(request_id, "step 1")
+	AppendRequestLog(request_id, "step 2")
+
+	cases := []struct {
+		offset   int
+		logs     []string
+		expected int
+	}{
+		{0, []string{"step 1", "step 1", "step 2"}, 3},
+		{2, []string{"step 2"}, 3},
+		{3, []string{}, 3},
+		// offsets out of range skip to the end instead of failing
+		{10, []string{}, 3},
+		{-1, []string{}, 3},
+	}
+	for _, c := range cases {
+		logs, offset := GetRequestLogs(request_id, c.offset)
+		if !reflect.DeepEqual(logs, c.logs) || offset != c.expected {
+			t.Errorf("offset %d: expected %v at %d, got %v at %d", c.offset, c.logs, c.expected, logs, offset)
+		}
+	}
+
+	// logs are still readable after the request is finished
+	FinishRequest(request_id, "Finished")
+	AppendRequestLog(request_id, "step 3")
+	if logs, offset := GetRequestLogs(request_id, 3); !reflect.DeepEqual(logs, []string{"step 3"}) || offset != 4 {
+		t.Errorf("expected [step 3] at 4, got %v at %d", logs, offset)
+	}
+
+	if logs, offset := GetRequestLogs("missing", 5); len(logs) != 0 || offset != 5 {
+		t.Errorf("expected nothing for a missing request, got %v at %d", logs, offset)
+	}
+}
@@ -0,0 +1,234 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/Yeuoly/kisara/src/helper"
+	"github.com/Yeuoly/kisara/src/router"
+	log "github.com/Yeuoly/kisara/src/routine/log"
+	"github.com/Yeuoly/kisara/src/types"
+	"github.com/gorilla/websocket"
+)
+
+/*
+	control channel is a websocket opened by client to server, server sends requests through it,
+	so that long-running operations could stream their progress and client behind NAT still works
+*/
+
+// ChannelStreamHandler serves a stream opened from channel, payload is the request body, the stream is closed after it returns
+type ChannelStreamHandler func(payload []byte, stream *types.ChannelStream)
+
+// ChannelHandler handles a request from channel, progress sends a message to server immediately
+type ChannelHandler func(payload []byte, progress func(string)) types.KisaraResponse
+
+var (
+	channel_handlers = make(map[string]ChannelHandler)
+	channel_streams  = make(map[string]ChannelStreamHandler)
+	open_streams     sync.Map
+	channel_fallback http.Handler
+	channel_conn     *websocket.Conn
+	channel_lock     sync.Mutex
+)
+
+// RegisterChannelHandler handles requests to uri from channel by handler instead of http handlers
+func RegisterChannelHandler(uri string, handler ChannelHandler) {
+	channel_handlers[uri] = handler
+}
+
+// RegisterChannelStream serves streams opened to uri from channel by handler
+func RegisterChannelStream(uri string, handler ChannelStreamHandler) {
+	channel_streams[uri] = handler
+}
+
+// SetChannelFallback sets the handler which serves requests to uris without a channel handler
+func SetChannelFallback(handler http.Handler) {
+	channel_fallback = handler
+}
+
+func writeChannel(message types.ChannelMessage) error {
+	channel_lock.Lock()
+	defer channel_lock.Unlock()
+	if channel_conn == nil {
+		return errors.New("channel is not connected")
+	}
+	channel_conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	return channel_conn.WriteJSON(message)
+}
+
+// PushEvent sends an event to server, it fails if channel is not connected
+func PushEvent(event string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return writeChannel(types.ChannelMessage{
+		Type:    types.CHANNEL_MESSAGE_EVENT,
+		Event:   event,
+		Payload: data,
+	})
+}
+
+// keepChannel keeps the channel connected until stop is closed
+func keepChannel(stop chan bool) {
+	for {
+		conn, err := dialChannel()
+		if err != nil {
+			log.Warn("[Channel] Failed to open channel: %s", err.Error())
+		} else {
+			log.Info("[Channel] Channel opened")
+			closed := make(chan bool)
+			go func() {
+				select {
+				case <-stop:
+					conn.Close()
+				case <-closed:
+				}
+			}()
+			serveChannel(conn)
+			close(closed)
+			log.Warn("[Channel] Channel closed")
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
+
+func dialChannel() (*websocket.Conn, error) {
+	uri := fmt.Sprintf("%s?client_id=%s&client_token=%s", router.URI_SERVER_CHANNEL, url.QueryEscape(clientId), url.QueryEscape(clientToken))
+	header := http.Header{}
+	if token := helper.GetConfigString("kisara.token"); token != "" {
+		for k, v := range helper.SignedHeaders(token, "GET", uri, []byte{}) {
+			header.Set(k, v)
+		}
+	}
+
+	dialer := websocket.Dialer{HandshakeTimeout: 5 * time.Second}
+	conn, _, err := dialer.Dial(fmt.Sprintf("ws://%s:%d%s", serverIp, serverPort, uri), header)
+	if err != nil {
+		return nil, err
+	}
+
+	channel_lock.Lock()
+	channel_conn = conn
+	channel_lock.Unlock()
+	return conn, nil
+}
+
+func serveChannel(conn *websocket.Conn) {
+	defer func() {
+		channel_lock.Lock()
+		if channel_conn == conn {
+			channel_conn = nil
+		}
+		channel_lock.Unlock()
+		conn.Close()
+		// server drops streams of a detached channel as well
+		open_streams.Range(func(key, value interface{}) bool {
+			value.(*types.ChannelStream).End()
+			return true
+		})
+	}()
+
+	for {
+		var message types.ChannelMessage
+		if err := conn.ReadJSON(&message); err != nil {
+			log.Warn("[Channel] Failed to read channel: %s", err.Error())
+			return
+		}
+		switch message.Type {
+		case types.CHANNEL_MESSAGE_REQUEST:
+			if handler, ok := channel_streams[message.Uri]; ok {
+				// registered before the next message is read, data sent right after opening is not lost
+				stream := openChannelStream(message.Id)
+				go handleChannelStream(stream, message.Payload, handler)
+			} else {
+				go handleChannelRequest(message)
+			}
+		case types.CHANNEL_MESSAGE_STREAM:
+			if stream, ok := open_streams.Load(message.Id); ok {
+				stream.(*types.ChannelStream).Deliver(message.Payload)
+			}
+		case types.CHANNEL_MESSAGE_STREAM_ACK:
+			if stream, ok := open_streams.Load(message.Id); ok {
+				stream.(*types.ChannelStream).Acked(message.Payload)
+			}
+		case types.CHANNEL_MESSAGE_STREAM_CLOSE:
+			if stream, ok := open_streams.Load(message.Id); ok {
+				stream.(*types.ChannelStream).End()
+			}
+		}
+	}
+}
+
+func handleChannelRequest(message types.ChannelMessage) {
+	progress := func(text string) {
+		err := writeChannel(types.ChannelMessage{
+			Type:    types.CHANNEL_MESSAGE_PROGRESS,
+			Id:      message.Id,
+			Message: text,
+		})
+		if err != nil {
+			log.Warn("[Channel] Failed to send progress of %s: %s", message.Uri, err.Error())
+		}
+	}
+
+	var payload []byte
+	if handler, ok := channel_handlers[message.Uri]; ok {
+		payload, _ = json.Marshal(handler(message.Payload, progress))
+	} else {
+		payload = dispatchFallback(message)
+	}
+
+	err := writeChannel(types.ChannelMessage{
+		Type:    types.CHANNEL_MESSAGE_RESPONSE,
+		Id:      message.Id,
+		Payload: payload,
+	})
+	if err != nil {
+		log.Warn("[Channel] Failed to send response of %s: %s", message.Uri, err.Error())
+	}
+}
+
+func openChannelStream(id string) *types.ChannelStream {
+	stream := types.NewChannelStream(id, writeChannel, func() {
+		open_streams.Delete(id)
+	})
+	open_streams.Store(id, stream)
+	return stream
+}
+
+func handleChannelStream(stream *types.ChannelStream, payload []byte, handler ChannelStreamHandler) {
+	defer stream.Close()
+	handler(payload, stream)
+}
+
+// dispatchFallback serves the request by http handlers in process
+func dispatchFallback(message types.ChannelMessage) []byte {
+	if channel_fallback == nil {
+		payload, _ := json.Marshal(types.ErrorResponse(-404, "no handler for "+message.Uri))
+		return payload
+	}
+
+	req := httptest.NewRequest(message.Method, message.Uri, bytes.NewReader(message.Payload))
+	req.Header.Set("Content-Type", "application/json")
+	recorder := httptest.NewRecorder()
+	channel_fallback.ServeHTTP(recorder, req)
+
+	if recorder.Code != http.StatusOK {
+		payload, _ := json.Marshal(types.ErrorResponse(-recorder.Code, recorder.Body.String()))
+		return payload
+	}
+	return recorder.Body.Bytes()
+}
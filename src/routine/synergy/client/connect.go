@@ -5,6 +5,7 @@ package client
 */
 
 import (
+	"errors"
 	"fmt"
 	"math"
 	"time"
@@ -107,6 +108,11 @@ func Client() {
 	}()
 }
 
+// usages are reported as fractions, gopsutil gives percentages of cpu, memory and disk
+func roundUsage(usage float64) float64 {
+	return math.Round(usage*10000) / 10000
+}
+
 func uploadStatus() {
 	cpu_usage := getCPUUsage()
 
@@ -122,10 +128,10 @@ func uploadStatus() {
 		disk_usage = 0
 	}
 
-	network_usage_in, _, err := helper.GetNetUsagePercent()
+	network_usage_in, network_usage_out, err := helper.GetNetUsagePercent()
 	if err != nil {
 		log.Warn("[Connection] Failed to get network usage: %s", err.Error())
-		network_usage_in = 0
+		network_usage_in, network_usage_out = 0, 0
 	}
 
 	max_container := helper.GetMaxContainer()
@@ -141,18 +147,25 @@ func uploadStatus() {
 		container_num = 0
 	}
 
+	images, err := docker.ListImageTags()
+	if err != nil {
+		log.Warn("[Connection] Failed to list images: %s", err.Error())
+		images = []string{}
+	}
+
 	//log.Info("[Connection] Uploading status to server %s:%d with cpu %f%%, mem %f%%, disk %f%%, net %f%%, container_num %d", serverIp, serverPort, cpu_usage, mem_usage, disk_usage, network_usage_in, container_num)
 
 	resp, err := helper.SendPostAndParse[types.KisaraResponseWrap[types.ResponseStatus]](
 		getServerRequest(router.URI_SERVER_STATUS),
 		helper.HttpPayloadJson(types.RequestStatus{
 			ClientID:       clientId,
-			CPUUsage:       math.Round(cpu_usage*100) / 100,
-			MemoryUsage:    math.Round(mem_usage*100) / 100,
-			DiskUsage:      math.Round(disk_usage*100) / 100,
-			NetworkUsage:   math.Round(network_usage_in*100) / 100,
+			CPUUsage:       roundUsage(cpu_usage / 100),
+			MemoryUsage:    roundUsage(mem_usage / 100),
+			DiskUsage:      roundUsage(disk_usage / 100),
+			NetworkUsage:   roundUsage(math.Max(network_usage_in, network_usage_out)),
 			ContainerNum:   container_num,
-			ContainerUsage: math.Round(float64(container_num)/float64(max_container)*100) / 100,
+			ContainerUsage: roundUsage(float64(container_num) / float64(max_container)),
+			Images:         images,
 		}),
 		helper.HttpTimeout(5000),
 	)
@@ -174,6 +187,7 @@ func connect() {
 			ClientID:   clientId,
 			ClientIp:   clientIp,
 			ClientPort: clientPort,
+			Labels:     helper.GetConfigStringMap("kisaraClient.labels"),
 		}),
 		helper.HttpTimeout(5000),
 	)
@@ -197,6 +211,10 @@ func connect() {
 	// start heart beat
 	log.Info("[Connection] Connected to server, start heart beat")
 	defer log.Warn("[Connection] Heart beat stopped")
+	// open control channel, it will be closed when the connection is lost
+	stop_channel := make(chan bool)
+	defer close(stop_channel)
+	go keepChannel(stop_channel)
 	// start status monitor
 	ticker := time.NewTicker(time.Duration(10 * time.Second))
 	defer ticker.Stop()
@@ -250,3 +268,27 @@ func connect() {
 		}
 	}
 }
+
+// GetImageRelay returns the url server relays images of nodes reached through their channels at
+func GetImageRelay() string {
+	return getServerRequest(router.URI_SERVER_IMAGE_SAVE)
+}
+
+// GetImagePeers asks server for other nodes having image
+func GetImagePeers(image_name string) ([]types.ImagePeer, error) {
+	resp, err := helper.SendPostAndParse[types.KisaraResponseWrap[types.ResponseImagePeers]](
+		getServerRequest(router.URI_SERVER_IMAGE_PEERS),
+		helper.HttpPayloadJson(types.RequestImagePeers{
+			ClientID:  clientId,
+			ImageName: image_name,
+		}),
+		helper.HttpTimeout(5000),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Code != 0 {
+		return nil, errors.New(resp.Message)
+	}
+	return resp.Data.Peers, nil
+}
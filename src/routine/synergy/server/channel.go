@@ -0,0 +1,293 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/Yeuoly/kisara/src/helper"
+	log "github.com/Yeuoly/kisara/src/routine/log"
+	"github.com/Yeuoly/kisara/src/types"
+	"github.com/gorilla/websocket"
+	uuid "github.com/satori/go.uuid"
+)
+
+/*
+	control channel is a websocket opened by client, requests to a client with channel are sent
+	through it and progress messages are delivered as soon as client sends them, clients without
+	channel are still reached by http
+*/
+
+var channelMap sync.Map
+var channelLock sync.Mutex
+
+type clientChannel struct {
+	conn       *websocket.Conn
+	write_lock sync.Mutex
+	pending    sync.Map
+	streams    sync.Map
+}
+
+type pendingRequest struct {
+	progress func(string)
+	done     chan types.ChannelMessage
+}
+
+type KisaraOnChannelEvent func(client_id string, event string, payload []byte)
+
+var onChannelEvent []KisaraOnChannelEvent
+
+func RegisterOnChannelEvent(f KisaraOnChannelEvent) {
+	onChannelEvent = append(onChannelEvent, f)
+}
+
+func UnsetOnChannelEvent() {
+	onChannelEvent = []KisaraOnChannelEvent{}
+}
+
+func (c *clientChannel) write(message types.ChannelMessage) error {
+	c.write_lock.Lock()
+	defer c.write_lock.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	return c.conn.WriteJSON(message)
+}
+
+func (c *clientChannel) close() {
+	c.conn.Close()
+	// wake up all requests waiting for this channel
+	c.pending.Range(func(key, value interface{}) bool {
+		if pending, ok := c.pending.LoadAndDelete(key); ok {
+			close(pending.(*pendingRequest).done)
+		}
+		return true
+	})
+	c.streams.Range(func(key, value interface{}) bool {
+		value.(*types.ChannelStream).End()
+		return true
+	})
+}
+
+// VerifyClientToken checks the token issued to client when it connected
+func VerifyClientToken(client_id string, client_token string) bool {
+	client := GetClient(client_id)
+	return client != nil && client_token != "" && client.ClientToken == client_token
+}
+
+func HasChannel(client_id string) bool {
+	_, ok := channelMap.Load(client_id)
+	return ok
+}
+
+func closeChannel(client_id string) {
+	channelLock.Lock()
+	defer channelLock.Unlock()
+	if channel, ok := channelMap.LoadAndDelete(client_id); ok {
+		channel.(*clientChannel).close()
+	}
+}
+
+// AttachChannel serves the channel of client_id, it blocks until the channel is closed
+func AttachChannel(client_id string, conn *websocket.Conn) {
+	channel := &clientChannel{conn: conn}
+	channelLock.Lock()
+	if old, ok := channelMap.Load(client_id); ok {
+		old.(*clientChannel).close()
+	}
+	channelMap.Store(client_id, channel)
+	channelLock.Unlock()
+	log.Info("[Channel] Channel of client %s attached", client_id)
+
+	defer func() {
+		channelLock.Lock()
+		if current, ok := channelMap.Load(client_id); ok && current == channel {
+			channelMap.Delete(client_id)
+		}
+		channelLock.Unlock()
+		channel.close()
+		log.Info("[Channel] Channel of client %s detached", client_id)
+	}()
+
+	// client may be unreachable by http, reconcile through channel
+	go func() {
+		if err := UpdateClientContainer(client_id); err != nil {
+			log.Warn("[Channel] Failed to update client containers, error: %s", err.Error())
+		}
+		if err := UpdateClientService(client_id); err != nil {
+			log.Warn("[Channel] Failed to update client services, error: %s", err.Error())
+		}
+	}()
+
+	// keep alive, client answers ping automatically
+	conn.SetReadDeadline(time.Now().Add(90 * time.Second))
+	conn.SetPongHandler(func(string) error {
+		conn.SetReadDeadline(time.Now().Add(90 * time.Second))
+		return nil
+	})
+	stop := make(chan bool)
+	defer close(stop)
+	go func() {
+		ticker := time.NewTicker(30 * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(10*time.Second))
+			}
+		}
+	}()
+
+	for {
+		var message types.ChannelMessage
+		if err := conn.ReadJSON(&message); err != nil {
+			return
+		}
+		conn.SetReadDeadline(time.Now().Add(90 * time.Second))
+
+		switch message.Type {
+		case types.CHANNEL_MESSAGE_PROGRESS:
+			if pending, ok := channel.pending.Load(message.Id); ok {
+				if progress := pending.(*pendingRequest).progress; progress != nil {
+					progress(message.Message)
+				}
+			}
+		case types.CHANNEL_MESSAGE_RESPONSE:
+			if pending, ok := channel.pending.LoadAndDelete(message.Id); ok {
+				pending.(*pendingRequest).done <- message
+			}
+		case types.CHANNEL_MESSAGE_STREAM:
+			if stream, ok := channel.streams.Load(message.Id); ok {
+				stream.(*types.ChannelStream).Deliver(message.Payload)
+			}
+		case types.CHANNEL_MESSAGE_STREAM_ACK:
+			if stream, ok := channel.streams.Load(message.Id); ok {
+				stream.(*types.ChannelStream).Acked(message.Payload)
+			}
+		case types.CHANNEL_MESSAGE_STREAM_CLOSE:
+			if stream, ok := channel.streams.Load(message.Id); ok {
+				stream.(*types.ChannelStream).End()
+			}
+		case types.CHANNEL_MESSAGE_EVENT:
+			handleExpiredEvent(client_id, message.Event, message.Payload)
+			handleImageEvent(client_id, message.Event, message.Payload)
+			PublishEvent(types.EVENT_NODE_EVENT, client_id, types.EventNodeEvent{
+				Event:   message.Event,
+				Payload: message.Payload,
+			})
+			for _, f := range onChannelEvent {
+				f(client_id, message.Event, message.Payload)
+			}
+		}
+	}
+}
+
+/*
+	RequestChannel sends a request to client through its channel and waits for the response,
+	progress is called with every progress message sent by client, it could be nil
+*/
+func RequestChannel[T any](client_id string, method string, uri string, payload interface{}, timeout time.Duration, progress func(string)) (types.KisaraResponseWrap[T], error) {
+	var result types.KisaraResponseWrap[T]
+
+	value, ok := channelMap.Load(client_id)
+	if !ok {
+		return result, errors.New("channel not found")
+	}
+	channel := value.(*clientChannel)
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return result, err
+	}
+
+	id := uuid.NewV4().String()
+	pending := &pendingRequest{
+		progress: progress,
+		done:     make(chan types.ChannelMessage, 1),
+	}
+	channel.pending.Store(id, pending)
+	defer channel.pending.Delete(id)
+
+	err = channel.write(types.ChannelMessage{
+		Type:    types.CHANNEL_MESSAGE_REQUEST,
+		Id:      id,
+		Method:  method,
+		Uri:     uri,
+		Payload: body,
+	})
+	if err != nil {
+		return result, err
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return result, errors.New("timeout")
+	case message, ok := <-pending.done:
+		if !ok {
+			return result, errors.New("channel closed")
+		}
+		if err := json.Unmarshal(message.Payload, &result); err != nil {
+			return result, err
+		}
+		return result, nil
+	}
+}
+
+/*
+	OpenChannelStream opens a stream to uri of client through its channel, payload is the request
+	body, the caller should close the stream
+*/
+func OpenChannelStream(client_id string, uri string, payload interface{}) (*types.ChannelStream, error) {
+	value, ok := channelMap.Load(client_id)
+	if !ok {
+		return nil, errors.New("channel not found")
+	}
+	channel := value.(*clientChannel)
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	id := uuid.NewV4().String()
+	stream := types.NewChannelStream(id, channel.write, func() {
+		channel.streams.Delete(id)
+	})
+	channel.streams.Store(id, stream)
+
+	err = channel.write(types.ChannelMessage{
+		Type:    types.CHANNEL_MESSAGE_REQUEST,
+		Id:      id,
+		Method:  "GET",
+		Uri:     uri,
+		Payload: body,
+	})
+	if err != nil {
+		stream.End()
+		return nil, err
+	}
+
+	return stream, nil
+}
+
+// RequestClient sends a request to client through its channel if there is one, otherwise by http
+func RequestClient[T any](client_id string, method string, uri string, payload interface{}, timeout time.Duration) (types.KisaraResponseWrap[T], error) {
+	if HasChannel(client_id) {
+		return RequestChannel[T](client_id, method, uri, payload, timeout, nil)
+	}
+
+	client := GetClient(client_id)
+	if client == nil {
+		return types.KisaraResponseWrap[T]{}, errors.New("client not found")
+	}
+
+	return helper.SendAndParse[types.KisaraResponseWrap[T]](
+		method,
+		client.GenerateClientURI(uri),
+		helper.HttpTimeout(timeout.Milliseconds()),
+		helper.HttpPayloadJson(payload),
+	)
+}
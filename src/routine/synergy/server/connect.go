@@ -2,11 +2,9 @@ package server
 
 import (
 	"errors"
-	"math"
 	"sync"
 	"time"
 
-	"github.com/Yeuoly/kisara/src/helper"
 	"github.com/Yeuoly/kisara/src/router"
 	log "github.com/Yeuoly/kisara/src/routine/log"
 	"github.com/Yeuoly/kisara/src/types"
@@ -28,6 +26,8 @@ type ClientItem struct {
 	Client        *types.Client
 	ClientStatus  *types.ClientStatus
 	LastHeartBeat time.Time
+	// Cordoned node is skipped by scheduler
+	Cordoned bool
 }
 
 type ContainerItem struct {
@@ -49,6 +49,8 @@ type KisaraOnNodeLaunchContainer func(client_id string, client *types.Client, co
 type KisaraOnNodeStopContainer func(client_id string, client *types.Client, container *types.Container)
 type KisaraOnServiceStart func(service_id string, service *types.Service)
 type KisaraOnServiceStop func(service_id string, service *types.Service)
+type KisaraOnNodeDrainContainer func(client_id string, container *types.Container, relaunched *types.Container)
+type KisaraOnNodeDrainService func(client_id string, service *types.Service, relaunched *types.Service)
 
 var onNodeConnect []KisaraOnNodeConnect
 var onNodeDisconnect []KisaraOnNodeDisconnect
@@ -57,6 +59,8 @@ var onNodeLaunchContainer []KisaraOnNodeLaunchContainer
 var onNodeStopContainer []KisaraOnNodeStopContainer
 var onServiceStart []KisaraOnServiceStart
 var onServiceStop []KisaraOnServiceStop
+var onNodeDrainContainer []KisaraOnNodeDrainContainer
+var onNodeDrainService []KisaraOnNodeDrainService
 
 func RegisterOnNodeConnect(f KisaraOnNodeConnect) {
 	onNodeConnect = append(onNodeConnect, f)
@@ -86,6 +90,14 @@ func RegisterOnServiceStop(f KisaraOnServiceStop) {
 	onServiceStop = append(onServiceStop, f)
 }
 
+func RegisterOnNodeDrainContainer(f KisaraOnNodeDrainContainer) {
+	onNodeDrainContainer = append(onNodeDrainContainer, f)
+}
+
+func RegisterOnNodeDrainService(f KisaraOnNodeDrainService) {
+	onNodeDrainService = append(onNodeDrainService, f)
+}
+
 func UnsetOnNodeConnect() {
 	onNodeConnect = []KisaraOnNodeConnect{}
 }
@@ -114,12 +126,22 @@ func UnsetOnServiceStop() {
 	onServiceStop = []KisaraOnServiceStop{}
 }
 
+func UnsetOnNodeDrainContainer() {
+	onNodeDrainContainer = []KisaraOnNodeDrainContainer{}
+}
+
+func UnsetOnNodeDrainService() {
+	onNodeDrainService = []KisaraOnNodeDrainService{}
+}
+
 func AddContainer(container_id string, client_id string, container *types.Container) {
 	containerMap.Store(container_id, &ContainerItem{
 		ClientId:    client_id,
 		ContainerId: container_id,
 		Container:   container,
 	})
+	storeContainer(client_id, container)
+	PublishEvent(types.EVENT_CONTAINER_LAUNCH, client_id, container)
 	for _, f := range onNodeLaunchContainer {
 		client := GetClient(client_id)
 		if client != nil {
@@ -150,24 +172,38 @@ func FlushContainer(client_id string) {
 }
 
 func DeleteContainer(container_id string) {
+	// look it up before it's gone, hooks need it
+	container, client_id, err := GetContainer(container_id)
 	containerMap.Delete(container_id)
+	containerRequests.Delete(container_id)
+	unstoreContainer(container_id)
+	if err != nil {
+		return
+	}
+	PublishEvent(types.EVENT_CONTAINER_STOP, client_id, container)
 	for _, f := range onNodeStopContainer {
-		container, client_id, err := GetContainer(container_id)
-		if err == nil {
-			client := GetClient(client_id)
-			if client != nil {
-				f(client_id, client, container)
-			}
+		client := GetClient(client_id)
+		if client != nil {
+			f(client_id, client, container)
 		}
 	}
 }
 
+// eventService is service without its flags, events are readable by every subscriber
+func eventService(service *types.Service) types.Service {
+	event := *service
+	event.Flags = nil
+	return event
+}
+
 func AddService(service_id string, client_id string, service *types.Service) {
 	serviceMap.Store(service_id, &ServiceItem{
 		ClientId:  client_id,
 		ServiceId: service_id,
 		Service:   service,
 	})
+	storeService(client_id, service)
+	PublishEvent(types.EVENT_SERVICE_START, client_id, eventService(service))
 	for _, f := range onServiceStart {
 		f(service_id, service)
 	}
@@ -190,41 +226,50 @@ func FlushService(client_id string) {
 }
 
 func DeleteService(service_id string) {
+	// look it up before it's gone, hooks need it
+	service, client_id, err := GetService(service_id)
 	serviceMap.Delete(service_id)
+	serviceRequests.Delete(service_id)
+	unstoreService(service_id)
+	if err != nil {
+		return
+	}
+	PublishEvent(types.EVENT_SERVICE_STOP, client_id, eventService(service))
 	for _, f := range onServiceStop {
-		service, _, err := GetService(service_id)
-		if err == nil {
-			f(service_id, service)
-		}
+		f(service_id, service)
 	}
 }
 
-/*
-TODO: currently, this function is too simple.
-*/
-func (c *ClientItem) GetDemand() (float64, error) {
+// Overloaded reports whether the node should not accept new workloads, usages are fractions
+func (c *ClientItem) Overloaded() bool {
 	if c.ClientStatus == nil {
-		return 0, errors.New("client status is not initialized")
+		return true
 	}
 
 	status := *c.ClientStatus
-	// if status.NetworkUsage >= 0.9 {
-	// 	return 1, nil
-	// }
-
-	if status.CPUUsage >= 0.98 {
-		return 1, nil
-	}
+	return status.CPUUsage >= 0.98 ||
+		status.MemoryUsage >= 0.98 ||
+		status.DiskUsage >= 0.95 ||
+		status.NetworkUsage >= 0.95 ||
+		status.ContainerUsage >= 1
+}
 
-	if status.MemoryUsage >= 0.98 {
-		return 1, nil
+// GetDemand returns the load of node in [0, 1], an overloaded node is 1
+func (c *ClientItem) GetDemand() (float64, error) {
+	if c.ClientStatus == nil {
+		return 0, errors.New("client status is not initialized")
 	}
 
-	if status.ContainerUsage >= 1 {
+	if c.Overloaded() {
 		return 1, nil
 	}
 
-	return status.CPUUsage*0.7 + status.MemoryUsage*0.2 + status.ContainerUsage*0.1, nil
+	status := *c.ClientStatus
+	return status.CPUUsage*0.5 +
+		status.MemoryUsage*0.2 +
+		status.ContainerUsage*0.1 +
+		status.DiskUsage*0.1 +
+		status.NetworkUsage*0.1, nil
 }
 
 func AddConnectRequest(req types.RequestConnect) {
@@ -243,20 +288,22 @@ func GetClient(client_id string) *types.Client {
 }
 
 func UpdateHeartBeat(client_id string) error {
-	if client, ok := clientMap.Load(client_id); ok {
-		client.(*ClientItem).LastHeartBeat = time.Now()
+	item, ok := clientMap.Load(client_id)
+	if !ok {
+		return errors.New("client not found")
+	}
+	item.(*ClientItem).LastHeartBeat = time.Now()
+
+	// status is not known until the client reported it
+	status, err := GetClientStatus(client_id)
+	if err != nil {
 		return nil
 	}
+	PublishEvent(types.EVENT_NODE_HEARTBEAT, client_id, status)
 	for _, f := range onNodeHeartBeat {
-		client := GetClient(client_id)
-		if client != nil {
-			status, err := GetClientStatus(client_id)
-			if err == nil {
-				f(client_id, client, &status)
-			}
-		}
+		f(client_id, item.(*ClientItem).Client, &status)
 	}
-	return errors.New("client not found")
+	return nil
 }
 
 func UpdateClientStatus(client_id string, status types.ClientStatus) error {
@@ -276,12 +323,14 @@ func UpdateClientContainer(client_id string) error {
 	}
 
 	// get all containers
-	resp, err := helper.SendGetAndParse[types.KisaraResponseWrap[types.ResponseListContainer]](
-		client.GenerateClientURI(router.URI_CLIENT_LIST_CONTAINER),
-		helper.HttpPayloadJson(types.RequestListContainer{
+	resp, err := RequestClient[types.ResponseListContainer](
+		client_id,
+		"GET",
+		router.URI_CLIENT_LIST_CONTAINER,
+		types.RequestListContainer{
 			ClientID: client_id,
-		}),
-		helper.HttpTimeout(2000),
+		},
+		2*time.Second,
 	)
 	if err != nil {
 		return err
@@ -295,45 +344,151 @@ func UpdateClientContainer(client_id string) error {
 		return errors.New(resp.Data.Error)
 	}
 
-	// update container list
-	for _, container := range resp.Data.Containers {
-		AddContainer(container.Id, client_id, &container)
+	ReconcileContainers(client_id, resp.Data.Containers)
+
+	return nil
+}
+
+func UpdateClientService(client_id string) error {
+	client := GetClient(client_id)
+	if client == nil {
+		return errors.New("client not found")
 	}
 
+	resp, err := RequestClient[types.ResponseListService](
+		client_id,
+		"GET",
+		router.URI_CLIENT_LIST_SERVICE,
+		types.RequestListService{
+			ClientID: client_id,
+		},
+		2*time.Second,
+	)
+	if err != nil {
+		return err
+	}
+
+	if resp.Code != 0 {
+		return errors.New(resp.Message)
+	}
+
+	if resp.Data.Error != "" {
+		return errors.New(resp.Data.Error)
+	}
+
+	ReconcileServices(client_id, resp.Data.Services)
+
 	return nil
 }
 
+/*
+	ReconcileContainers makes the containers of client_id exactly the same as containers,
+	containers already known are refreshed silently, new ones fire launch hooks and
+	vanished ones fire stop hooks
+*/
+func ReconcileContainers(client_id string, containers []types.Container) {
+	alive := make(map[string]bool)
+	for i := range containers {
+		container := containers[i]
+		alive[container.Id] = true
+		if _, ok := containerMap.Load(container.Id); ok {
+			containerMap.Store(container.Id, &ContainerItem{
+				ClientId:    client_id,
+				ContainerId: container.Id,
+				Container:   &container,
+			})
+			storeContainer(client_id, &container)
+		} else {
+			AddContainer(container.Id, client_id, &container)
+		}
+	}
+
+	containerMap.Range(func(key, value interface{}) bool {
+		item := value.(*ContainerItem)
+		if item.ClientId == client_id && !alive[item.ContainerId] {
+			DeleteContainer(item.ContainerId)
+		}
+		return true
+	})
+}
+
+// ReconcileServices works like ReconcileContainers but for services
+func ReconcileServices(client_id string, services []types.Service) {
+	alive := make(map[string]bool)
+	for i := range services {
+		service := services[i]
+		alive[service.Id] = true
+		if _, ok := serviceMap.Load(service.Id); ok {
+			serviceMap.Store(service.Id, &ServiceItem{
+				ClientId:  client_id,
+				ServiceId: service.Id,
+				Service:   &service,
+			})
+			storeService(client_id, &service)
+		} else {
+			AddService(service.Id, client_id, &service)
+		}
+	}
+
+	serviceMap.Range(func(key, value interface{}) bool {
+		item := value.(*ServiceItem)
+		if item.ClientId == client_id && !alive[item.ServiceId] {
+			DeleteService(item.ServiceId)
+		}
+		return true
+	})
+}
+
+// adoptReplacedNodes moves containers and services of nodes replaced by client_id to it,
+// those not running on client_id anymore will be removed by reconciliation
+func adoptReplacedNodes(client *types.Client) {
+	for _, old_id := range replacedNodes(client) {
+		log.Info("[Connection] Client %s replaced node %s at %s:%d", client.ClientID, old_id, client.ClientIp, client.ClientPort)
+		containerMap.Range(func(key, value interface{}) bool {
+			item := value.(*ContainerItem)
+			if item.ClientId == old_id {
+				containerMap.Store(item.ContainerId, &ContainerItem{
+					ClientId:    client.ClientID,
+					ContainerId: item.ContainerId,
+					Container:   item.Container,
+				})
+				storeContainer(client.ClientID, item.Container)
+			}
+			return true
+		})
+		serviceMap.Range(func(key, value interface{}) bool {
+			item := value.(*ServiceItem)
+			if item.ClientId == old_id {
+				serviceMap.Store(item.ServiceId, &ServiceItem{
+					ClientId:  client.ClientID,
+					ServiceId: item.ServiceId,
+					Service:   item.Service,
+				})
+				storeService(client.ClientID, item.Service)
+			}
+			return true
+		})
+		unstoreNode(old_id)
+	}
+}
+
 func Disconnect(client_id string) {
 	clientMap.Delete(client_id)
+	closeChannel(client_id)
 }
 
 func GetClientStatus(client_id string) (types.ClientStatus, error) {
 	if client, ok := clientMap.Load(client_id); ok {
+		if client.(*ClientItem).ClientStatus == nil {
+			return types.ClientStatus{}, errors.New("client status is not reported yet")
+		}
 		return *client.(*ClientItem).ClientStatus, nil
 	}
 	return types.ClientStatus{}, errors.New("client not found")
 }
 
 func FetchLowestDemandClient() (types.Client, error) {
-	var lowestDemandClient types.Client
-	var lowestDemand float64 = math.MaxFloat64
-	clientMap.Range(func(key, value interface{}) bool {
-		client := value.(*ClientItem)
-		demand, err := client.GetDemand()
-		if err != nil {
-			return true
-		} else {
-			if demand < lowestDemand {
-				lowestDemandClient = *client.Client
-				lowestDemand = demand
-			}
-		}
-		return true
-	})
-	if lowestDemand == math.MaxFloat64 {
-		return types.Client{}, errors.New("no client found")
-	}
-	return lowestDemandClient, nil
+	return Schedule(ScheduleRequest{Policy: SCHEDULER_LEAST_LOADED})
 }
 
 // Server is the main function of the synergy server, it's non-blocking, call it directly without goroutine
@@ -341,6 +496,9 @@ func Server(show_log ...bool) {
 	if len(show_log) > 0 && show_log[0] {
 		log.SetShowLog(show_log[0])
 	}
+	// rebuild cluster state from store
+	initStore()
+	initScheduler()
 	// add client listener
 	log.Info("[Connection] Start listening for new clients")
 	go func() {
@@ -359,17 +517,27 @@ func Server(show_log ...bool) {
 				ClientToken: client_token,
 				ClientIp:    req.ClientIp,
 				ClientPort:  req.ClientPort,
+				Labels:      req.Labels,
 			}
+			// a node cordoned before restart stays cordoned
+			cordoned := storedCordon(client)
 			clientMap.Store(req.ClientID, &ClientItem{
 				ClientID:      req.ClientID,
 				Client:        client,
 				LastHeartBeat: time.Now(),
+				Cordoned:      cordoned,
 			})
+			storeNode(client)
+			if cordoned {
+				storeCordon(req.ClientID, true)
+			}
+			adoptReplacedNodes(client)
 			req.Callback(types.ResponseConnect{
 				ClientID:    req.ClientID,
 				ClientToken: client_token,
 			})
 			// on client connected
+			PublishEvent(types.EVENT_NODE_CONNECT, req.ClientID, eventNode(client))
 			for _, f := range onNodeConnect {
 				f(req.ClientID, client)
 			}
@@ -379,25 +547,31 @@ func Server(show_log ...bool) {
 }
 
 func handleClientConnection(client_id string) {
-	// update client containers
+	// reconcile containers and services with the client
 	if err := UpdateClientContainer(client_id); err != nil {
 		log.Warn("[Connection] Failed to update client containers, error: %s", err.Error())
 	}
+	if err := UpdateClientService(client_id); err != nil {
+		log.Warn("[Connection] Failed to update client services, error: %s", err.Error())
+	}
 	timer := time.NewTicker(30 * time.Second)
 	defer timer.Stop()
 	defer log.Info("[Connection] Client %s disconnected", client_id)
+	client := GetClient(client_id)
 	defer func() {
+		if client == nil {
+			return
+		}
+		PublishEvent(types.EVENT_NODE_DISCONNECT, client_id, eventNode(client))
 		for _, f := range onNodeDisconnect {
-			client := GetClient(client_id)
-			if client != nil {
-				f(client_id, client)
-			}
+			f(client_id, client)
 		}
 	}()
 	for range timer.C {
 		if client, ok := clientMap.Load(client_id); ok {
 			if time.Since(client.(*ClientItem).LastHeartBeat) > 90*time.Second {
 				clientMap.Delete(client_id)
+				closeChannel(client_id)
 				return
 			} else if time.Since(client.(*ClientItem).LastHeartBeat) > 40*time.Second {
 				log.Warn(
@@ -0,0 +1,177 @@
+package server
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Yeuoly/kisara/src/routine/log"
+	"github.com/Yeuoly/kisara/src/types"
+)
+
+/*
+	event bus keeps the latest events in memory, a subscriber resumes from the id of the last
+	event it received, so that nothing is lost when it reconnects, a subscriber too slow to
+	keep up is closed instead of blocking publishers, it should resume in the same way, ids are
+	seeded by the time server starts at in microseconds, so they keep increasing after restarts,
+	a subscriber resuming from an event which is no longer kept gets an EVENT_RESET first
+*/
+
+const (
+	EVENT_HISTORY_SIZE = 4096
+	EVENT_BUFFER_SIZE  = 256
+)
+
+type EventSubscription struct {
+	// C delivers events in order, it's closed when the subscription is closed or falls behind
+	C      <-chan types.KisaraEvent
+	c      chan types.KisaraEvent
+	filter []string
+	closed bool
+}
+
+var (
+	event_lock        sync.Mutex
+	event_next_id     = uint64(time.Now().UnixMicro())
+	event_history     []types.KisaraEvent
+	event_subscribers = make(map[*EventSubscription]bool)
+)
+
+func (s *EventSubscription) match(event_type string) bool {
+	if len(s.filter) == 0 {
+		return true
+	}
+	for _, f := range s.filter {
+		if event_type == f || strings.HasPrefix(event_type, f+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// Close stops the subscription
+func (s *EventSubscription) Close() {
+	event_lock.Lock()
+	defer event_lock.Unlock()
+	s.close()
+}
+
+func (s *EventSubscription) close() {
+	if !s.closed {
+		s.closed = true
+		delete(event_subscribers, s)
+		close(s.c)
+	}
+}
+
+// PublishEvent records an event and delivers it to subscribers, payload is encoded as json
+func PublishEvent(event_type string, client_id string, payload interface{}) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		log.Warn("[Event] Failed to encode %s event: %s", event_type, err.Error())
+		return
+	}
+
+	event_lock.Lock()
+	defer event_lock.Unlock()
+
+	event := types.KisaraEvent{
+		Id:       event_next_id,
+		Type:     event_type,
+		Time:     time.Now().UnixMilli(),
+		ClientID: client_id,
+		Payload:  data,
+	}
+	event_next_id++
+
+	event_history = append(event_history, event)
+	if len(event_history) > EVENT_HISTORY_SIZE {
+		event_history = event_history[len(event_history)-EVENT_HISTORY_SIZE:]
+	}
+
+	for subscriber := range event_subscribers {
+		if !subscriber.match(event_type) {
+			continue
+		}
+		select {
+		case subscriber.c <- event:
+		default:
+			log.Warn("[Event] Subscriber falls behind, close it")
+			subscriber.close()
+		}
+	}
+}
+
+/*
+	SubscribeEvents subscribes events whose type matches filter, all events if filter is empty,
+	events after last_id which are still kept are delivered first, 0 means only new events
+*/
+func SubscribeEvents(filter []string, last_id uint64) *EventSubscription {
+	event_lock.Lock()
+	defer event_lock.Unlock()
+
+	subscription := &EventSubscription{filter: filter}
+
+	missed := []types.KisaraEvent{}
+	if last_id > 0 {
+		missed = missedEvents(subscription, last_id)
+	}
+
+	subscription.c = make(chan types.KisaraEvent, EVENT_BUFFER_SIZE+len(missed))
+	subscription.C = subscription.c
+	for _, event := range missed {
+		subscription.c <- event
+	}
+
+	event_subscribers[subscription] = true
+	return subscription
+}
+
+// GetEvents returns kept events after last_id whose type matches filter
+func GetEvents(filter []string, last_id uint64) []types.KisaraEvent {
+	event_lock.Lock()
+	defer event_lock.Unlock()
+
+	return missedEvents(&EventSubscription{filter: filter}, last_id)
+}
+
+/*
+	missedEvents returns kept events after last_id matching s, it starts with an EVENT_RESET if
+	events after last_id are no longer kept or last_id is not an id of this server at all, the
+	reset has the id before the oldest kept event, so resuming from it loses nothing more
+*/
+func missedEvents(s *EventSubscription, last_id uint64) []types.KisaraEvent {
+	events := []types.KisaraEvent{}
+
+	oldest_id := event_next_id
+	if len(event_history) > 0 {
+		oldest_id = event_history[0].Id
+	}
+	if last_id > 0 && (last_id+1 < oldest_id || last_id >= event_next_id) {
+		data, _ := json.Marshal(types.EventReset{LastId: last_id, OldestId: oldest_id})
+		events = append(events, types.KisaraEvent{
+			Id:      oldest_id - 1,
+			Type:    types.EVENT_RESET,
+			Time:    time.Now().UnixMilli(),
+			Payload: data,
+		})
+		last_id = oldest_id - 1
+	}
+
+	for _, event := range event_history {
+		if event.Id > last_id && s.match(event.Type) {
+			events = append(events, event)
+		}
+	}
+	return events
+}
+
+func eventNode(client *types.Client) types.EventNode {
+	return types.EventNode{
+		ClientID:   client.ClientID,
+		ClientIp:   client.ClientIp,
+		ClientPort: client.ClientPort,
+		Labels:     client.Labels,
+	}
+}
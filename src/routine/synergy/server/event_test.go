@@ -0,0 +1,143 @@
+package server
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/Yeuoly/kisara/src/types"
+)
+
+// resetEvents forgets all events and subscribers, ids keep increasing
+func resetEvents() {
+	event_lock.Lock()
+	defer event_lock.Unlock()
+	event_history = nil
+	for subscriber := range event_subscribers {
+		subscriber.close()
+	}
+}
+
+func receive(t *testing.T, s *EventSubscription, n int) []types.KisaraEvent {
+	events := []types.KisaraEvent{}
+	for i := 0; i < n; i++ {
+		select {
+		case event, ok := <-s.C:
+			if !ok {
+				t.Fatalf("subscription closed after %d events", i)
+			}
+			events = append(events, event)
+		default:
+			t.Fatalf("only %d of %d events received", i, n)
+		}
+	}
+	return events
+}
+
+func TestSubscribeEventsResume(t *testing.T) {
+	resetEvents()
+
+	PublishEvent(types.EVENT_NODE_CONNECT, "a", nil)
+	PublishEvent(types.EVENT_NODE_HEARTBEAT, "a", nil)
+	PublishEvent(types.EVENT_NODE_DISCONNECT, "a", nil)
+	history := GetEvents(nil, 0)
+	if len(history) != 3 || history[1].Id <= history[0].Id || history[2].Id <= history[1].Id {
+		t.Fatalf("unexpected history %+v", history)
+	}
+
+	// events after last_id are delivered first, then new ones
+	subscription := SubscribeEvents(nil, history[0].Id)
+	defer subscription.Close()
+	PublishEvent(types.EVENT_NODE_CONNECT, "b", nil)
+
+	events := receive(t, subscription, 3)
+	if events[0].Id != history[1].Id || events[1].Id != history[2].Id || events[2].ClientID != "b" {
+		t.Fatalf("unexpected events %+v", events)
+	}
+
+	// 0 only subscribes new events
+	latest := SubscribeEvents(nil, 0)
+	defer latest.Close()
+	receive(t, latest, 0)
+}
+
+func TestSubscribeEventsFilter(t *testing.T) {
+	resetEvents()
+
+	subscription := SubscribeEvents([]string{"container", types.EVENT_NODE_CONNECT}, 0)
+	defer subscription.Close()
+
+	PublishEvent(types.EVENT_CONTAINER_LAUNCH, "", nil)
+	PublishEvent(types.EVENT_NODE_HEARTBEAT, "", nil)
+	PublishEvent(types.EVENT_NODE_CONNECT, "", nil)
+	PublishEvent("containers.launch", "", nil)
+
+	events := receive(t, subscription, 2)
+	if events[0].Type != types.EVENT_CONTAINER_LAUNCH || events[1].Type != types.EVENT_NODE_CONNECT {
+		t.Fatalf("unexpected events %+v", events)
+	}
+	receive(t, subscription, 0)
+
+	if events := GetEvents([]string{"node"}, 0); len(events) != 2 {
+		t.Fatalf("unexpected filtered history %+v", events)
+	}
+}
+
+func TestSubscribeEventsSlowSubscriber(t *testing.T) {
+	resetEvents()
+
+	subscription := SubscribeEvents(nil, 0)
+	for i := 0; i <= EVENT_BUFFER_SIZE; i++ {
+		PublishEvent(types.EVENT_NODE_HEARTBEAT, "", nil)
+	}
+
+	// buffered events are still read, then the subscription is closed instead of blocking publishers
+	events := receive(t, subscription, EVENT_BUFFER_SIZE)
+	if _, ok := <-subscription.C; ok {
+		t.Fatalf("slow subscriber is not closed")
+	}
+
+	// it resumes from the last event it received
+	resumed := SubscribeEvents(nil, events[len(events)-1].Id)
+	defer resumed.Close()
+	if event := receive(t, resumed, 1)[0]; event.Type != types.EVENT_NODE_HEARTBEAT {
+		t.Fatalf("unexpected event %+v", event)
+	}
+	subscription.Close()
+}
+
+func TestSubscribeEventsGap(t *testing.T) {
+	resetEvents()
+
+	PublishEvent(types.EVENT_NODE_CONNECT, "", nil)
+	PublishEvent(types.EVENT_NODE_CONNECT, "", nil)
+	first := GetEvents(nil, 0)[0]
+	for i := 0; i < EVENT_HISTORY_SIZE; i++ {
+		PublishEvent(types.EVENT_NODE_HEARTBEAT, "", nil)
+	}
+	oldest := GetEvents(nil, 0)[0]
+
+	// the event after the first is dropped, resuming from the first starts with a reset
+	events := GetEvents(nil, first.Id)
+	if len(events) != EVENT_HISTORY_SIZE+1 || events[0].Type != types.EVENT_RESET || events[1].Id != oldest.Id {
+		t.Fatalf("unexpected events %d, %+v", len(events), events[0])
+	}
+	var reset types.EventReset
+	if err := json.Unmarshal(events[0].Payload, &reset); err != nil {
+		t.Fatal(err)
+	}
+	if reset.LastId != first.Id || reset.OldestId != oldest.Id || events[0].Id != oldest.Id-1 {
+		t.Fatalf("unexpected reset %+v of %d", reset, events[0].Id)
+	}
+
+	// resuming from the event before the oldest kept one loses nothing
+	if events := GetEvents(nil, oldest.Id-1); events[0].Type == types.EVENT_RESET {
+		t.Fatalf("unexpected reset")
+	}
+
+	// an id this server never published, e.g. from before a restart with the clock going back
+	subscription := SubscribeEvents([]string{"container"}, oldest.Id+EVENT_HISTORY_SIZE*2)
+	defer subscription.Close()
+	if event := receive(t, subscription, 1)[0]; event.Type != types.EVENT_RESET {
+		t.Fatalf("unexpected event %+v", event)
+	}
+}
@@ -0,0 +1,62 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+
+	log "github.com/Yeuoly/kisara/src/routine/log"
+	"github.com/Yeuoly/kisara/src/types"
+)
+
+/*
+	expired containers and services are stopped by clients themselves, server only removes
+	them from cluster state when the expiry events arrive, stop hooks are fired as usual
+*/
+
+// SetContainerExpire updates the expiry of a known container
+func SetContainerExpire(container_id string, expire_at int64) error {
+	item, ok := containerMap.Load(container_id)
+	if !ok {
+		return errors.New("container not found")
+	}
+	container := *item.(*ContainerItem).Container
+	container.ExpireAt = expire_at
+	client_id := item.(*ContainerItem).ClientId
+	containerMap.Store(container_id, &ContainerItem{
+		ClientId:    client_id,
+		ContainerId: container_id,
+		Container:   &container,
+	})
+	storeContainer(client_id, &container)
+	PublishEvent(types.EVENT_CONTAINER_EXTEND, client_id, &container)
+	return nil
+}
+
+// handleExpiredEvent removes workloads expired on client_id
+func handleExpiredEvent(client_id string, event string, payload []byte) {
+	switch event {
+	case types.CHANNEL_EVENT_CONTAINER_EXPIRED:
+		var container types.Container
+		if err := json.Unmarshal(payload, &container); err != nil {
+			log.Warn("[Channel] Broken %s event from client %s: %s", event, client_id, err.Error())
+			return
+		}
+		if _, owner, err := GetContainer(container.Id); err == nil && owner == client_id {
+			log.Info("[Connection] Container %s on client %s expired", container.Id, client_id)
+			DeleteContainer(container.Id)
+		}
+	case types.CHANNEL_EVENT_SERVICE_EXPIRED:
+		var service types.Service
+		if err := json.Unmarshal(payload, &service); err != nil {
+			log.Warn("[Channel] Broken %s event from client %s: %s", event, client_id, err.Error())
+			return
+		}
+		if _, owner, err := GetService(service.Id); err == nil && owner == client_id {
+			log.Info("[Connection] Service %s on client %s expired", service.Id, client_id)
+			for _, container := range service.Containers {
+				DeleteContainer(container.Id)
+			}
+			DeleteService(service.Id)
+		}
+	}
+}
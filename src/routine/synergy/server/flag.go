@@ -0,0 +1,30 @@
+package server
+
+import (
+	"errors"
+
+	"github.com/Yeuoly/kisara/src/types"
+)
+
+// SetServiceFlags replaces flags of a known service after they are rotated on its client
+func SetServiceFlags(service_id string, flags []types.ServiceFlag, failed []types.ServiceFlagFailure) error {
+	item, ok := serviceMap.Load(service_id)
+	if !ok {
+		return errors.New("service not found")
+	}
+	service := *item.(*ServiceItem).Service
+	service.Flags = flags
+	client_id := item.(*ServiceItem).ClientId
+	serviceMap.Store(service_id, &ServiceItem{
+		ClientId:  client_id,
+		ServiceId: service_id,
+		Service:   &service,
+	})
+	storeService(client_id, &service)
+	PublishEvent(types.EVENT_SERVICE_FLAGS, client_id, types.EventServiceFlags{
+		ServiceId: service_id,
+		Rotated:   len(flags) - len(failed),
+		Failed:    failed,
+	})
+	return nil
+}
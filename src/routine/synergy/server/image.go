@@ -0,0 +1,66 @@
+package server
+
+import (
+	"encoding/json"
+
+	log "github.com/Yeuoly/kisara/src/routine/log"
+	"github.com/Yeuoly/kisara/src/types"
+)
+
+// handleImageEvent publishes images refreshed on client_id
+func handleImageEvent(client_id string, event string, payload []byte) {
+	if event != types.CHANNEL_EVENT_IMAGE_REFRESHED {
+		return
+	}
+
+	var result types.ImageRefreshResult
+	if err := json.Unmarshal(payload, &result); err != nil {
+		log.Warn("[Channel] Broken %s event from client %s: %s", event, client_id, err.Error())
+		return
+	}
+
+	log.Info("[Connection] Image %s on client %s refreshed to %s", result.ImageName, client_id, result.NewImageId)
+	PublishEvent(types.EVENT_IMAGE_REFRESH, client_id, result)
+}
+
+// HasImage checks if the node has reported image in its status
+func (c *ClientItem) HasImage(image_name string) bool {
+	if c.ClientStatus == nil {
+		return false
+	}
+	image_name = types.NormalizeImageName(image_name)
+	for _, image := range c.ClientStatus.Images {
+		if image == image_name {
+			return true
+		}
+	}
+	return false
+}
+
+// GetNodesBySelector returns nodes having all labels in selector
+func GetNodesBySelector(selector map[string]string) []ClientItem {
+	nodes := []ClientItem{}
+	for _, node := range GetNodes() {
+		if matchLabels(node.Client.Labels, selector) {
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes
+}
+
+// GetImagePeers returns nodes having reported image in their status, except exclude_client_id
+func GetImagePeers(image_name string, exclude_client_id string) []types.ImagePeer {
+	peers := []types.ImagePeer{}
+	for _, node := range GetNodes() {
+		if node.ClientID == exclude_client_id || !node.HasImage(image_name) {
+			continue
+		}
+		peers = append(peers, types.ImagePeer{
+			ClientID:   node.ClientID,
+			ClientIp:   node.Client.ClientIp,
+			ClientPort: node.Client.ClientPort,
+			Channel:    HasChannel(node.ClientID),
+		})
+	}
+	return peers
+}
@@ -0,0 +1,76 @@
+package server
+
+import (
+	"time"
+
+	"github.com/Yeuoly/kisara/src/routine/metrics"
+	"github.com/Yeuoly/kisara/src/types"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	nodes_desc          = prometheus.NewDesc("kisara_server_nodes", "Number of connected nodes", nil, nil)
+	nodes_cordoned_desc = prometheus.NewDesc("kisara_server_nodes_cordoned", "Number of connected nodes which are cordoned", nil, nil)
+	heartbeat_age_desc  = prometheus.NewDesc(
+		"kisara_server_node_heartbeat_age_seconds", "Seconds since the last heartbeat of the node", []string{"client_id"}, nil,
+	)
+	pending_requests_desc = prometheus.NewDesc(
+		"kisara_server_channel_pending_requests", "Requests sent through control channels and waiting for answers", nil, nil,
+	)
+)
+
+func collectMetrics(ch chan<- prometheus.Metric) {
+	nodes := GetNodes()
+	cordoned := 0
+	for _, node := range nodes {
+		if node.Cordoned {
+			cordoned++
+		}
+	}
+	metrics.Gauge(ch, nodes_desc, float64(len(nodes)))
+	metrics.Gauge(ch, nodes_cordoned_desc, float64(cordoned))
+
+	for _, node := range nodes {
+		metrics.Gauge(ch, heartbeat_age_desc, time.Since(node.LastHeartBeat).Seconds(), node.ClientID)
+		if node.ClientStatus == nil {
+			continue
+		}
+		for _, gauge := range node_status_gauges {
+			metrics.Gauge(ch, gauge.desc, gauge.value(node.ClientStatus), node.ClientID)
+		}
+	}
+
+	pending := 0
+	channelMap.Range(func(key, value interface{}) bool {
+		value.(*clientChannel).pending.Range(func(key, value interface{}) bool {
+			pending++
+			return true
+		})
+		return true
+	})
+	metrics.Gauge(ch, pending_requests_desc, float64(pending))
+}
+
+// status reported by nodes, usages are fractions in [0, 1]
+var node_status_gauges = []struct {
+	desc  *prometheus.Desc
+	value func(*types.ClientStatus) float64
+}{
+	{nodeStatusDesc("kisara_server_node_cpu_usage", "CPU usage reported by the node"), func(s *types.ClientStatus) float64 { return s.CPUUsage }},
+	{nodeStatusDesc("kisara_server_node_memory_usage", "Memory usage reported by the node"), func(s *types.ClientStatus) float64 { return s.MemoryUsage }},
+	{nodeStatusDesc("kisara_server_node_disk_usage", "Disk usage reported by the node"), func(s *types.ClientStatus) float64 { return s.DiskUsage }},
+	{nodeStatusDesc("kisara_server_node_network_usage", "Bandwidth usage reported by the node"), func(s *types.ClientStatus) float64 { return s.NetworkUsage }},
+	{nodeStatusDesc("kisara_server_node_containers", "Number of containers reported by the node"), func(s *types.ClientStatus) float64 { return float64(s.ContainerNum) }},
+}
+
+func nodeStatusDesc(name string, help string) *prometheus.Desc {
+	return prometheus.NewDesc(name, help, []string{"client_id"}, nil)
+}
+
+func init() {
+	descs := []*prometheus.Desc{nodes_desc, nodes_cordoned_desc, heartbeat_age_desc, pending_requests_desc}
+	for _, gauge := range node_status_gauges {
+		descs = append(descs, gauge.desc)
+	}
+	metrics.RegisterCollector(collectMetrics, descs...)
+}
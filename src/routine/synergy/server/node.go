@@ -0,0 +1,122 @@
+package server
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/Yeuoly/kisara/src/types"
+)
+
+/*
+	a cordoned node is skipped by scheduler, workloads already on it keep running until it's drained,
+	launch requests are kept so that drained workloads could be relaunched on other nodes
+*/
+
+var containerRequests sync.Map
+var serviceRequests sync.Map
+
+func setCordon(client_id string, cordoned bool) error {
+	item, ok := clientMap.Load(client_id)
+	if !ok {
+		return errors.New("client not found")
+	}
+	item.(*ClientItem).Cordoned = cordoned
+	storeCordon(client_id, cordoned)
+	if cordoned {
+		PublishEvent(types.EVENT_NODE_CORDON, client_id, eventNode(item.(*ClientItem).Client))
+	} else {
+		PublishEvent(types.EVENT_NODE_UNCORDON, client_id, eventNode(item.(*ClientItem).Client))
+	}
+	return nil
+}
+
+func CordonNode(client_id string) error {
+	return setCordon(client_id, true)
+}
+
+func UncordonNode(client_id string) error {
+	return setCordon(client_id, false)
+}
+
+func IsCordoned(client_id string) bool {
+	if item, ok := clientMap.Load(client_id); ok {
+		return item.(*ClientItem).Cordoned
+	}
+	return false
+}
+
+// SetContainerRequest records the request which launched container_id
+func SetContainerRequest(container_id string, req types.RequestLaunchContainer) {
+	containerRequests.Store(container_id, req)
+	storeContainerRequest(container_id, req)
+}
+
+func GetContainerRequest(container_id string) (types.RequestLaunchContainer, bool) {
+	if req, ok := containerRequests.Load(container_id); ok {
+		return req.(types.RequestLaunchContainer), true
+	}
+	return types.RequestLaunchContainer{}, false
+}
+
+// SetServiceRequest records the request which launched service_id
+func SetServiceRequest(service_id string, req types.RequestLaunchService) {
+	serviceRequests.Store(service_id, req)
+	storeServiceRequest(service_id, req)
+}
+
+func GetServiceRequest(service_id string) (types.RequestLaunchService, bool) {
+	if req, ok := serviceRequests.Load(service_id); ok {
+		return req.(types.RequestLaunchService), true
+	}
+	return types.RequestLaunchService{}, false
+}
+
+// GetNodeContainers returns containers on client_id
+func GetNodeContainers(client_id string) []types.Container {
+	containers := []types.Container{}
+	containerMap.Range(func(key, value interface{}) bool {
+		item := value.(*ContainerItem)
+		if item.ClientId == client_id {
+			containers = append(containers, *item.Container)
+		}
+		return true
+	})
+	return containers
+}
+
+// GetNodeServices returns services on client_id
+func GetNodeServices(client_id string) []types.Service {
+	services := []types.Service{}
+	serviceMap.Range(func(key, value interface{}) bool {
+		item := value.(*ServiceItem)
+		if item.ClientId == client_id {
+			services = append(services, *item.Service)
+		}
+		return true
+	})
+	return services
+}
+
+func NotifyNodeDrainContainer(client_id string, container *types.Container, relaunched *types.Container) {
+	item := types.DrainItem{Kind: types.DRAIN_KIND_CONTAINER, Id: container.Id}
+	if relaunched != nil {
+		_, item.NewClientID, _ = GetContainer(relaunched.Id)
+		item.NewId = relaunched.Id
+	}
+	PublishEvent(types.EVENT_NODE_DRAIN, client_id, item)
+	for _, f := range onNodeDrainContainer {
+		f(client_id, container, relaunched)
+	}
+}
+
+func NotifyNodeDrainService(client_id string, service *types.Service, relaunched *types.Service) {
+	item := types.DrainItem{Kind: types.DRAIN_KIND_SERVICE, Id: service.Id}
+	if relaunched != nil {
+		_, item.NewClientID, _ = GetService(relaunched.Id)
+		item.NewId = relaunched.Id
+	}
+	PublishEvent(types.EVENT_NODE_DRAIN, client_id, item)
+	for _, f := range onNodeDrainService {
+		f(client_id, service, relaunched)
+	}
+}
@@ -0,0 +1,191 @@
+package server
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/Yeuoly/kisara/src/helper"
+	log "github.com/Yeuoly/kisara/src/routine/log"
+	"github.com/Yeuoly/kisara/src/types"
+)
+
+/*
+	scheduler chooses a node for workloads whose ClientID is not set, nodes without status,
+	cordoned, overloaded ones and those not matching the selector are filtered out before a policy is applied
+*/
+
+const (
+	SCHEDULER_LEAST_LOADED = "least_loaded" // node with the lowest demand
+	SCHEDULER_SPREAD       = "spread"       // node with the fewest containers
+	SCHEDULER_BIN_PACK     = "bin_pack"     // node with the highest demand which is not overloaded
+	SCHEDULER_AFFINITY     = "affinity"     // node matching the most affinity labels
+	SCHEDULER_IMAGE        = "image"        // node having the most images of the workload
+)
+
+type ScheduleRequest struct {
+	// Policy is the name of scheduler, default scheduler is used if empty
+	Policy string
+	// Selector is the labels a node must have
+	Selector map[string]string
+	// Affinity is the labels a node is preferred to have, used by affinity policy
+	Affinity map[string]string
+	// Images are images of the workload, used by image policy
+	Images []string
+}
+
+type Scheduler interface {
+	// Pick chooses a node from candidates, candidates are never empty
+	Pick(candidates []ClientItem, req ScheduleRequest) (ClientItem, error)
+}
+
+// SchedulerFunc makes a function a Scheduler
+type SchedulerFunc func(candidates []ClientItem, req ScheduleRequest) (ClientItem, error)
+
+func (f SchedulerFunc) Pick(candidates []ClientItem, req ScheduleRequest) (ClientItem, error) {
+	return f(candidates, req)
+}
+
+var (
+	schedulers        = make(map[string]Scheduler)
+	schedulers_lock   sync.RWMutex
+	default_scheduler = SCHEDULER_LEAST_LOADED
+)
+
+func init() {
+	RegisterScheduler(SCHEDULER_LEAST_LOADED, SchedulerFunc(pickLeastLoaded))
+	RegisterScheduler(SCHEDULER_SPREAD, SchedulerFunc(pickSpread))
+	RegisterScheduler(SCHEDULER_BIN_PACK, SchedulerFunc(pickBinPack))
+	RegisterScheduler(SCHEDULER_AFFINITY, SchedulerFunc(pickAffinity))
+	RegisterScheduler(SCHEDULER_IMAGE, SchedulerFunc(pickImage))
+}
+
+// RegisterScheduler adds or replaces a scheduler
+func RegisterScheduler(name string, scheduler Scheduler) {
+	schedulers_lock.Lock()
+	defer schedulers_lock.Unlock()
+	schedulers[name] = scheduler
+}
+
+// SetDefaultScheduler sets the scheduler used when a request does not specify one
+func SetDefaultScheduler(name string) error {
+	schedulers_lock.Lock()
+	defer schedulers_lock.Unlock()
+	if _, ok := schedulers[name]; !ok {
+		return errors.New("scheduler not found")
+	}
+	default_scheduler = name
+	return nil
+}
+
+func initScheduler() {
+	name := helper.GetConfigString("kisaraServer.scheduler")
+	if name == "" {
+		return
+	}
+	if err := SetDefaultScheduler(name); err != nil {
+		log.Warn("[Scheduler] unknown scheduler %s, use %s instead", name, default_scheduler)
+	}
+}
+
+func matchLabels(labels map[string]string, selector map[string]string) bool {
+	for k, v := range selector {
+		if labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// Schedule chooses a node for req
+func Schedule(req ScheduleRequest) (types.Client, error) {
+	schedulers_lock.RLock()
+	policy := req.Policy
+	if policy == "" {
+		policy = default_scheduler
+	}
+	scheduler, ok := schedulers[policy]
+	schedulers_lock.RUnlock()
+	if !ok {
+		return types.Client{}, errors.New("scheduler not found")
+	}
+
+	candidates := []ClientItem{}
+	for _, node := range GetNodes() {
+		if node.ClientStatus == nil || node.Cordoned || node.Overloaded() {
+			continue
+		}
+		if !matchLabels(node.Client.Labels, req.Selector) {
+			continue
+		}
+		candidates = append(candidates, node)
+	}
+
+	if len(candidates) == 0 {
+		return types.Client{}, errors.New("no client found")
+	}
+
+	node, err := scheduler.Pick(candidates, req)
+	if err != nil {
+		return types.Client{}, err
+	}
+	return *node.Client, nil
+}
+
+// pickBy returns the candidate with the lowest key, ties are broken by demand
+func pickBy(candidates []ClientItem, key func(node *ClientItem) float64) ClientItem {
+	best := 0
+	best_key := key(&candidates[0])
+	best_demand, _ := candidates[0].GetDemand()
+	for i := 1; i < len(candidates); i++ {
+		k := key(&candidates[i])
+		demand, _ := candidates[i].GetDemand()
+		if k < best_key || (k == best_key && demand < best_demand) {
+			best, best_key, best_demand = i, k, demand
+		}
+	}
+	return candidates[best]
+}
+
+func pickLeastLoaded(candidates []ClientItem, req ScheduleRequest) (ClientItem, error) {
+	return pickBy(candidates, func(node *ClientItem) float64 {
+		demand, _ := node.GetDemand()
+		return demand
+	}), nil
+}
+
+func pickSpread(candidates []ClientItem, req ScheduleRequest) (ClientItem, error) {
+	return pickBy(candidates, func(node *ClientItem) float64 {
+		return float64(node.ClientStatus.ContainerNum)
+	}), nil
+}
+
+func pickBinPack(candidates []ClientItem, req ScheduleRequest) (ClientItem, error) {
+	return pickBy(candidates, func(node *ClientItem) float64 {
+		demand, _ := node.GetDemand()
+		return -demand
+	}), nil
+}
+
+func pickAffinity(candidates []ClientItem, req ScheduleRequest) (ClientItem, error) {
+	return pickBy(candidates, func(node *ClientItem) float64 {
+		matched := 0
+		for k, v := range req.Affinity {
+			if node.Client.Labels[k] == v {
+				matched++
+			}
+		}
+		return -float64(matched)
+	}), nil
+}
+
+func pickImage(candidates []ClientItem, req ScheduleRequest) (ClientItem, error) {
+	return pickBy(candidates, func(node *ClientItem) float64 {
+		matched := 0
+		for _, image := range req.Images {
+			if node.HasImage(image) {
+				matched++
+			}
+		}
+		return -float64(matched)
+	}), nil
+}
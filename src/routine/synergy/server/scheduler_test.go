@@ -0,0 +1,113 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/Yeuoly/kisara/src/types"
+)
+
+// setNodes replaces all connected nodes with nodes
+func setNodes(nodes ...*ClientItem) {
+	clientMap.Range(func(key, value interface{}) bool {
+		clientMap.Delete(key)
+		return true
+	})
+	for _, node := range nodes {
+		clientMap.Store(node.ClientID, node)
+	}
+}
+
+func schedulerNode(client_id string, status *types.ClientStatus, labels map[string]string) *ClientItem {
+	return &ClientItem{
+		ClientID:     client_id,
+		Client:       &types.Client{ClientID: client_id, Labels: labels},
+		ClientStatus: status,
+	}
+}
+
+func normalizedImages(names ...string) []string {
+	result := []string{}
+	for _, name := range names {
+		result = append(result, types.NormalizeImageName(name))
+	}
+	return result
+}
+
+func TestSchedule(t *testing.T) {
+	cordoned := schedulerNode("cordoned", &types.ClientStatus{}, map[string]string{"zone": "x"})
+	cordoned.Cordoned = true
+	setNodes(
+		// demand 0.05, the most containers
+		schedulerNode("a", &types.ClientStatus{CPUUsage: 0.1, ContainerNum: 5, Images: normalizedImages("nginx")}, map[string]string{"zone": "x", "gpu": "yes"}),
+		// demand 0.25, the fewest containers
+		schedulerNode("b", &types.ClientStatus{CPUUsage: 0.5, ContainerNum: 1}, map[string]string{"zone": "y"}),
+		// demand 0.45
+		schedulerNode("c", &types.ClientStatus{CPUUsage: 0.9, ContainerNum: 3, Images: normalizedImages("redis", "mysql:8")}, map[string]string{"zone": "x"}),
+		// the idlest node is cordoned, the busiest is overloaded and one has not reported its status
+		cordoned,
+		schedulerNode("overloaded", &types.ClientStatus{CPUUsage: 0.99}, map[string]string{"zone": "x"}),
+		schedulerNode("unknown", nil, map[string]string{"zone": "x"}),
+	)
+	defer setNodes()
+
+	cases := []struct {
+		name     string
+		req      ScheduleRequest
+		expected string
+	}{
+		{name: "default is least loaded", req: ScheduleRequest{}, expected: "a"},
+		{name: "least loaded", req: ScheduleRequest{Policy: SCHEDULER_LEAST_LOADED}, expected: "a"},
+		{name: "spread", req: ScheduleRequest{Policy: SCHEDULER_SPREAD}, expected: "b"},
+		{name: "bin pack skips overloaded nodes", req: ScheduleRequest{Policy: SCHEDULER_BIN_PACK}, expected: "c"},
+		{name: "affinity", req: ScheduleRequest{Policy: SCHEDULER_AFFINITY, Affinity: map[string]string{"zone": "y"}}, expected: "b"},
+		{name: "affinity ties are broken by demand", req: ScheduleRequest{Policy: SCHEDULER_AFFINITY, Affinity: map[string]string{"zone": "x"}}, expected: "a"},
+		{name: "selector", req: ScheduleRequest{Policy: SCHEDULER_SPREAD, Selector: map[string]string{"zone": "x"}}, expected: "c"},
+		{name: "image", req: ScheduleRequest{Policy: SCHEDULER_IMAGE, Images: []string{"redis:latest", "mysql:8", "nginx"}}, expected: "c"},
+		{name: "image ties are broken by demand", req: ScheduleRequest{Policy: SCHEDULER_IMAGE, Images: []string{"alpine"}}, expected: "a"},
+		{name: "selector matching nothing", req: ScheduleRequest{Selector: map[string]string{"zone": "z"}}, expected: ""},
+		{name: "unknown policy", req: ScheduleRequest{Policy: "random"}, expected: ""},
+	}
+
+	for _, c := range cases {
+		client, err := Schedule(c.req)
+		if c.expected == "" {
+			if err == nil {
+				t.Errorf("%s: expected an error, got %s", c.name, client.ClientID)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", c.name, err.Error())
+		} else if client.ClientID != c.expected {
+			t.Errorf("%s: expected %s, got %s", c.name, c.expected, client.ClientID)
+		}
+	}
+}
+
+func TestOverloaded(t *testing.T) {
+	cases := []struct {
+		name       string
+		status     *types.ClientStatus
+		overloaded bool
+	}{
+		{name: "no status", status: nil, overloaded: true},
+		{name: "idle", status: &types.ClientStatus{}, overloaded: false},
+		{name: "busy but below every limit", status: &types.ClientStatus{CPUUsage: 0.97, MemoryUsage: 0.97, DiskUsage: 0.94, NetworkUsage: 0.94, ContainerUsage: 0.99}, overloaded: false},
+		{name: "cpu", status: &types.ClientStatus{CPUUsage: 0.98}, overloaded: true},
+		{name: "memory", status: &types.ClientStatus{MemoryUsage: 0.98}, overloaded: true},
+		{name: "disk", status: &types.ClientStatus{DiskUsage: 0.95}, overloaded: true},
+		{name: "network", status: &types.ClientStatus{NetworkUsage: 0.95}, overloaded: true},
+		{name: "containers", status: &types.ClientStatus{ContainerUsage: 1}, overloaded: true},
+	}
+
+	for _, c := range cases {
+		node := ClientItem{ClientStatus: c.status}
+		if node.Overloaded() != c.overloaded {
+			t.Errorf("%s: expected overloaded %v", c.name, c.overloaded)
+		}
+		// an overloaded node has the highest demand
+		if demand, err := node.GetDemand(); err == nil && c.overloaded && demand != 1 {
+			t.Errorf("%s: unexpected demand %v", c.name, demand)
+		}
+	}
+}
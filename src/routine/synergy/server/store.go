@@ -0,0 +1,392 @@
+package server
+
+import (
+	"sort"
+	"time"
+
+	"github.com/Yeuoly/kisara/src/helper"
+	"github.com/Yeuoly/kisara/src/routine/db"
+	log "github.com/Yeuoly/kisara/src/routine/log"
+	"github.com/Yeuoly/kisara/src/types"
+)
+
+/*
+	store persists nodes, containers and services into SQLite, so that a restart of
+	server does not forget the cluster state, it's enabled by kisaraServer.db_path
+*/
+
+var store_enabled = false
+
+// KisaraOnGameRestore is called for every stored game when server restarts, rounds are in order
+type KisaraOnGameRestore func(game types.Game, req types.RequestStartGame, timeout time.Duration, rounds []types.GameRound)
+
+var onGameRestore KisaraOnGameRestore
+
+// SetGameRestorer sets the function rebuilding games from store, it must be set before Server is called
+func SetGameRestorer(f KisaraOnGameRestore) {
+	onGameRestore = f
+}
+
+func initStore() {
+	db_path := helper.GetConfigString("kisaraServer.db_path")
+	if db_path == "" {
+		log.Warn("[Store] kisaraServer.db_path is not set, cluster state will not be persisted")
+		return
+	}
+
+	db.InitKisaraDB(db_path)
+	store_enabled = true
+
+	restoreFromStore()
+}
+
+// restoreFromStore rebuilds containers and services from store, hooks will not be fired
+func restoreFromStore() {
+	containers, err := db.GetGenericAll[types.DBNodeContainer]()
+	if err != nil {
+		log.Error("[Store] failed to load containers: %s", err.Error())
+	}
+	for _, record := range containers {
+		container, err := record.GetContainer()
+		if err != nil {
+			log.Warn("[Store] broken container record %s: %s", record.ContainerId, err.Error())
+			continue
+		}
+		containerMap.Store(record.ContainerId, &ContainerItem{
+			ClientId:    record.ClientId,
+			ContainerId: record.ContainerId,
+			Container:   &container,
+		})
+		if record.Request != "" {
+			if req, err := record.GetRequest(); err == nil {
+				containerRequests.Store(record.ContainerId, req)
+			}
+		}
+	}
+
+	services, err := db.GetGenericAll[types.DBNodeService]()
+	if err != nil {
+		log.Error("[Store] failed to load services: %s", err.Error())
+	}
+	for _, record := range services {
+		service, err := record.GetService()
+		if err != nil {
+			log.Warn("[Store] broken service record %s: %s", record.ServiceId, err.Error())
+			continue
+		}
+		serviceMap.Store(record.ServiceId, &ServiceItem{
+			ClientId:  record.ClientId,
+			ServiceId: record.ServiceId,
+			Service:   &service,
+		})
+		if record.Request != "" {
+			if req, err := record.GetRequest(); err == nil {
+				serviceRequests.Store(record.ServiceId, req)
+			}
+		}
+	}
+
+	log.Info("[Store] restored %d containers and %d services", len(containers), len(services))
+
+	restoreGames()
+}
+
+func restoreGames() {
+	records, err := db.GetGenericAll[types.DBGame]()
+	if err != nil {
+		log.Error("[Store] failed to load games: %s", err.Error())
+	}
+	for _, record := range records {
+		game, err := record.GetGame()
+		if err != nil {
+			log.Warn("[Store] broken game record %s: %s", record.GameId, err.Error())
+			continue
+		}
+		req, err := record.GetRequest()
+		if err != nil {
+			log.Warn("[Store] broken game record %s: %s", record.GameId, err.Error())
+			continue
+		}
+
+		round_records, err := db.GetGenericAll[types.DBGameRound](db.GenericEqual("game_id", record.GameId))
+		if err != nil {
+			log.Error("[Store] failed to load rounds of game %s: %s", record.GameId, err.Error())
+		}
+		rounds := make([]types.GameRound, 0, len(round_records))
+		for _, round_record := range round_records {
+			round, err := round_record.GetRound()
+			if err != nil {
+				log.Warn("[Store] broken round %d of game %s: %s", round_record.Round, record.GameId, err.Error())
+				continue
+			}
+			rounds = append(rounds, round)
+		}
+		sort.Slice(rounds, func(i, j int) bool { return rounds[i].Round < rounds[j].Round })
+
+		if onGameRestore != nil {
+			onGameRestore(game, req, time.Duration(record.Timeout)*time.Second, rounds)
+		}
+	}
+
+	log.Info("[Store] restored %d games", len(records))
+}
+
+func storeNode(client *types.Client) {
+	if !store_enabled {
+		return
+	}
+
+	node, err := db.GetGenericOne[types.DBNode](db.GenericEqual("client_id", client.ClientID))
+	if err != nil && err != db.ErrNotFound {
+		log.Error("[Store] failed to load node %s: %s", client.ClientID, err.Error())
+		return
+	}
+
+	node.ClientId = client.ClientID
+	node.ClientIp = client.ClientIp
+	node.ClientPort = client.ClientPort
+	node.LastSeen = time.Now()
+
+	if err == db.ErrNotFound {
+		err = db.CreateGeneric(&node)
+	} else {
+		err = db.UpdateGeneric(&node)
+	}
+	if err != nil {
+		log.Error("[Store] failed to save node %s: %s", client.ClientID, err.Error())
+	}
+}
+
+// replacedNodes returns the nodes which have the same address with client but a different id,
+// it happens when a client restarted and connected with a new id
+func replacedNodes(client *types.Client) []string {
+	if !store_enabled {
+		return nil
+	}
+
+	nodes, err := db.GetGenericAll[types.DBNode](
+		db.GenericEqual("client_ip", client.ClientIp),
+		db.GenericEqual("client_port", client.ClientPort),
+		db.GenericNotEqual("client_id", client.ClientID),
+	)
+	if err != nil {
+		log.Error("[Store] failed to load nodes: %s", err.Error())
+		return nil
+	}
+
+	ids := []string{}
+	for _, node := range nodes {
+		// a connected client is not replaced
+		if GetClient(node.ClientId) == nil {
+			ids = append(ids, node.ClientId)
+		}
+	}
+	return ids
+}
+
+func unstoreNode(client_id string) {
+	if !store_enabled {
+		return
+	}
+
+	nodes, err := db.GetGenericAll[types.DBNode](db.GenericEqual("client_id", client_id))
+	if err != nil {
+		log.Error("[Store] failed to load node %s: %s", client_id, err.Error())
+		return
+	}
+	for _, node := range nodes {
+		node := node
+		if err := db.DeleteGeneric(&node); err != nil {
+			log.Error("[Store] failed to delete node %s: %s", client_id, err.Error())
+		}
+	}
+}
+
+func storeContainer(client_id string, container *types.Container) {
+	if !store_enabled {
+		return
+	}
+
+	record, err := db.GetGenericOne[types.DBNodeContainer](db.GenericEqual("container_id", container.Id))
+	if err != nil && err != db.ErrNotFound {
+		log.Error("[Store] failed to load container %s: %s", container.Id, err.Error())
+		return
+	}
+
+	record.InjectContainer(client_id, *container)
+	if err == db.ErrNotFound {
+		err = db.CreateGeneric(&record)
+	} else {
+		err = db.UpdateGeneric(&record)
+	}
+	if err != nil {
+		log.Error("[Store] failed to save container %s: %s", container.Id, err.Error())
+	}
+}
+
+func unstoreContainer(container_id string) {
+	if !store_enabled {
+		return
+	}
+
+	records, err := db.GetGenericAll[types.DBNodeContainer](db.GenericEqual("container_id", container_id))
+	if err != nil {
+		log.Error("[Store] failed to load container %s: %s", container_id, err.Error())
+		return
+	}
+	for _, record := range records {
+		record := record
+		if err := db.DeleteGeneric(&record); err != nil {
+			log.Error("[Store] failed to delete container %s: %s", container_id, err.Error())
+		}
+	}
+}
+
+func storeService(client_id string, service *types.Service) {
+	if !store_enabled {
+		return
+	}
+
+	record, err := db.GetGenericOne[types.DBNodeService](db.GenericEqual("service_id", service.Id))
+	if err != nil && err != db.ErrNotFound {
+		log.Error("[Store] failed to load service %s: %s", service.Id, err.Error())
+		return
+	}
+
+	record.InjectService(client_id, *service)
+	if err == db.ErrNotFound {
+		err = db.CreateGeneric(&record)
+	} else {
+		err = db.UpdateGeneric(&record)
+	}
+	if err != nil {
+		log.Error("[Store] failed to save service %s: %s", service.Id, err.Error())
+	}
+}
+
+func unstoreService(service_id string) {
+	if !store_enabled {
+		return
+	}
+
+	records, err := db.GetGenericAll[types.DBNodeService](db.GenericEqual("service_id", service_id))
+	if err != nil {
+		log.Error("[Store] failed to load service %s: %s", service_id, err.Error())
+		return
+	}
+	for _, record := range records {
+		record := record
+		if err := db.DeleteGeneric(&record); err != nil {
+			log.Error("[Store] failed to delete service %s: %s", service_id, err.Error())
+		}
+	}
+}
+
+func storeCordon(client_id string, cordoned bool) {
+	if !store_enabled {
+		return
+	}
+
+	node, err := db.GetGenericOne[types.DBNode](db.GenericEqual("client_id", client_id))
+	if err != nil {
+		log.Error("[Store] failed to load node %s: %s", client_id, err.Error())
+		return
+	}
+	node.Cordoned = cordoned
+	if err := db.UpdateGeneric(&node); err != nil {
+		log.Error("[Store] failed to save node %s: %s", client_id, err.Error())
+	}
+}
+
+// storedCordon reports whether a node at the address of client was cordoned, a restarted client
+// comes back with a new id but it should stay cordoned
+func storedCordon(client *types.Client) bool {
+	if !store_enabled {
+		return false
+	}
+
+	nodes, err := db.GetGenericAll[types.DBNode](
+		db.GenericEqual("client_ip", client.ClientIp),
+		db.GenericEqual("client_port", client.ClientPort),
+	)
+	if err != nil {
+		log.Error("[Store] failed to load nodes: %s", err.Error())
+		return false
+	}
+	for _, node := range nodes {
+		if node.Cordoned {
+			return true
+		}
+	}
+	return false
+}
+
+func storeContainerRequest(container_id string, req types.RequestLaunchContainer) {
+	if !store_enabled {
+		return
+	}
+
+	record, err := db.GetGenericOne[types.DBNodeContainer](db.GenericEqual("container_id", container_id))
+	if err != nil {
+		log.Error("[Store] failed to load container %s: %s", container_id, err.Error())
+		return
+	}
+	record.InjectRequest(req)
+	if err := db.UpdateGeneric(&record); err != nil {
+		log.Error("[Store] failed to save container %s: %s", container_id, err.Error())
+	}
+}
+
+func storeServiceRequest(service_id string, req types.RequestLaunchService) {
+	if !store_enabled {
+		return
+	}
+
+	record, err := db.GetGenericOne[types.DBNodeService](db.GenericEqual("service_id", service_id))
+	if err != nil {
+		log.Error("[Store] failed to load service %s: %s", service_id, err.Error())
+		return
+	}
+	record.InjectRequest(req)
+	if err := db.UpdateGeneric(&record); err != nil {
+		log.Error("[Store] failed to save service %s: %s", service_id, err.Error())
+	}
+}
+
+// StoreGame saves the state of a game, req and timeout are only written when it's created
+func StoreGame(game types.Game, req types.RequestStartGame, timeout time.Duration) {
+	if !store_enabled {
+		return
+	}
+
+	record, err := db.GetGenericOne[types.DBGame](db.GenericEqual("game_id", game.Id))
+	if err != nil && err != db.ErrNotFound {
+		log.Error("[Store] failed to load game %s: %s", game.Id, err.Error())
+		return
+	}
+
+	record.InjectGame(game)
+	if err == db.ErrNotFound {
+		record.InjectRequest(req)
+		record.Timeout = int64(timeout / time.Second)
+		err = db.CreateGeneric(&record)
+	} else {
+		err = db.UpdateGeneric(&record)
+	}
+	if err != nil {
+		log.Error("[Store] failed to save game %s: %s", game.Id, err.Error())
+	}
+}
+
+// StoreGameRound saves the result of a round, flags included
+func StoreGameRound(round types.GameRound) {
+	if !store_enabled {
+		return
+	}
+
+	var record types.DBGameRound
+	record.InjectRound(round)
+	if err := db.CreateGeneric(&record); err != nil {
+		log.Error("[Store] failed to save round %d of game %s: %s", round.Round, round.GameId, err.Error())
+	}
+}
@@ -0,0 +1,337 @@
+package types
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"sync"
+)
+
+/*
+	control channel is a websocket opened by client, server sends requests through it,
+	client answers with progress messages and a final response, it also carries events
+	pushed by client, so that server never needs to reach client directly
+*/
+
+const (
+	CHANNEL_MESSAGE_REQUEST  = "request"
+	CHANNEL_MESSAGE_PROGRESS = "progress"
+	CHANNEL_MESSAGE_RESPONSE = "response"
+	CHANNEL_MESSAGE_EVENT    = "event"
+	// a request to a stream uri opens a stream, payloads of stream messages with the same id flow in
+	// both directions until either side sends stream_close, a side sends no more than the window of
+	// payloads until the other one acks them with stream_ack whose payload is the number consumed
+	CHANNEL_MESSAGE_STREAM       = "stream"
+	CHANNEL_MESSAGE_STREAM_ACK   = "stream_ack"
+	CHANNEL_MESSAGE_STREAM_CLOSE = "stream_close"
+)
+
+const (
+	CHANNEL_STREAM_WINDOW     = 64        // payloads of a stream in flight before they are acked
+	CHANNEL_STREAM_CHUNK_SIZE = 32 * 1024 // bytes of data in a StreamChunk
+)
+
+// events pushed by client, payload is the Container or Service
+const (
+	CHANNEL_EVENT_CONTAINER_EXPIRED = "container_expired"
+	CHANNEL_EVENT_SERVICE_EXPIRED   = "service_expired"
+	CHANNEL_EVENT_IMAGE_REFRESHED   = "image_refreshed" // payload is ImageRefreshResult
+)
+
+type ChannelMessage struct {
+	// Type is one of CHANNEL_MESSAGE_*
+	Type string `json:"type"`
+	// Id pairs requests with their progress and response
+	Id string `json:"id,omitempty"`
+	// Method is the http method of the request, GET or POST
+	Method string `json:"method,omitempty"`
+	// Uri is the uri of the request, same as the http api of client
+	Uri string `json:"uri,omitempty"`
+	// Event is the name of event
+	Event string `json:"event,omitempty"`
+	// Payload is the request body, response body which is a KisaraResponse, event body or stream data
+	Payload json.RawMessage `json:"payload,omitempty"`
+	// Message is the progress message
+	Message string `json:"message,omitempty"`
+}
+
+// network monitor context is sent inline as the channel has no multipart
+type RequestNetworkMonitorRunChannel struct {
+	// ClientID is the unique ID of the client
+	ClientID string `json:"client_id" binding:"required"`
+	// context, tar archive of the monitor
+	Context []byte `json:"context" binding:"required"`
+	// NetworkName
+	NetworkName string `json:"network_name" binding:"required"`
+}
+
+/*
+	ChannelStream is one side of a stream over the control channel, payloads delivered are buffered
+	up to the window, Send waits for the other side to ack what it has read before sending more, so
+	the reader of the channel never waits for a slow stream, a stream sending beyond the window is
+	reset instead
+*/
+type ChannelStream struct {
+	id      string
+	write   func(ChannelMessage) error
+	recv    chan json.RawMessage
+	done    chan struct{}
+	once    sync.Once
+	release func()
+
+	credit_lock sync.Mutex
+	credits     int
+	credited    chan struct{}
+	consumed    int
+}
+
+// NewChannelStream creates a stream sending by write, release is called once when it ends
+func NewChannelStream(id string, write func(ChannelMessage) error, release func()) *ChannelStream {
+	return &ChannelStream{
+		id:       id,
+		write:    write,
+		recv:     make(chan json.RawMessage, CHANNEL_STREAM_WINDOW),
+		done:     make(chan struct{}),
+		release:  release,
+		credits:  CHANNEL_STREAM_WINDOW,
+		credited: make(chan struct{}, 1),
+	}
+}
+
+func (s *ChannelStream) Id() string {
+	return s.id
+}
+
+// Done is closed when the stream ends
+func (s *ChannelStream) Done() <-chan struct{} {
+	return s.done
+}
+
+// Send sends v as json to the other side, it waits while the window of the other side is full
+func (s *ChannelStream) Send(v interface{}) error {
+	for {
+		select {
+		case <-s.done:
+			return io.ErrClosedPipe
+		default:
+		}
+		s.credit_lock.Lock()
+		if s.credits > 0 {
+			s.credits--
+			s.credit_lock.Unlock()
+			break
+		}
+		s.credit_lock.Unlock()
+		select {
+		case <-s.credited:
+		case <-s.done:
+			return io.ErrClosedPipe
+		}
+	}
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return s.write(ChannelMessage{
+		Type:    CHANNEL_MESSAGE_STREAM,
+		Id:      s.id,
+		Payload: payload,
+	})
+}
+
+// Recv reads the next payload into v, io.EOF is returned after the stream ends
+func (s *ChannelStream) Recv(v interface{}) error {
+	var payload json.RawMessage
+	select {
+	case payload = <-s.recv:
+		s.ack()
+	case <-s.done:
+		// payloads delivered before the end are still read
+		select {
+		case payload = <-s.recv:
+		default:
+			return io.EOF
+		}
+	}
+	return json.Unmarshal(payload, v)
+}
+
+// ack tells the other side payloads are consumed once half of the window is read
+func (s *ChannelStream) ack() {
+	s.credit_lock.Lock()
+	s.consumed++
+	consumed := s.consumed
+	if consumed < CHANNEL_STREAM_WINDOW/2 {
+		s.credit_lock.Unlock()
+		return
+	}
+	s.consumed = 0
+	s.credit_lock.Unlock()
+
+	payload, _ := json.Marshal(consumed)
+	s.write(ChannelMessage{
+		Type:    CHANNEL_MESSAGE_STREAM_ACK,
+		Id:      s.id,
+		Payload: payload,
+	})
+}
+
+/*
+	Deliver passes a payload received from the other side, it never blocks since it's called by
+	the reader of the channel shared by every request, a payload beyond the window means the other
+	side ignores acks, the stream is reset then
+*/
+func (s *ChannelStream) Deliver(payload json.RawMessage) {
+	select {
+	case s.recv <- payload:
+	case <-s.done:
+	default:
+		s.End()
+		go s.write(ChannelMessage{Type: CHANNEL_MESSAGE_STREAM_CLOSE, Id: s.id})
+	}
+}
+
+// Acked adds credits acked by the other side, it's called by the reader of the channel
+func (s *ChannelStream) Acked(payload json.RawMessage) {
+	var consumed int
+	if err := json.Unmarshal(payload, &consumed); err != nil || consumed <= 0 {
+		return
+	}
+	s.credit_lock.Lock()
+	s.credits += consumed
+	s.credit_lock.Unlock()
+	select {
+	case s.credited <- struct{}{}:
+	default:
+	}
+}
+
+// End ends the stream without telling the other side, it's called when the other side closes it
+func (s *ChannelStream) End() {
+	s.once.Do(func() {
+		close(s.done)
+		if s.release != nil {
+			s.release()
+		}
+	})
+}
+
+// Close ends the stream and tells the other side
+func (s *ChannelStream) Close() {
+	select {
+	case <-s.done:
+		return
+	default:
+	}
+	s.write(ChannelMessage{Type: CHANNEL_MESSAGE_STREAM_CLOSE, Id: s.id})
+	s.End()
+}
+
+/*
+	StreamChunk carries a transfer of bytes over a channel stream, such as an archive or logs, each
+	side ends what it sends with a chunk having End set, Error tells the transfer failed
+*/
+type StreamChunk struct {
+	// Stream names what Data is, such as stdout or stderr of logs or build logs, empty for a single transfer
+	Stream string `json:"stream,omitempty"`
+	Data   []byte `json:"data,omitempty"`
+	End    bool   `json:"end,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+type channelStreamWriter struct {
+	stream *ChannelStream
+	name   string
+}
+
+func (w *channelStreamWriter) Write(p []byte) (int, error) {
+	written := 0
+	for written < len(p) {
+		n := len(p) - written
+		if n > CHANNEL_STREAM_CHUNK_SIZE {
+			n = CHANNEL_STREAM_CHUNK_SIZE
+		}
+		if err := w.stream.Send(StreamChunk{Stream: w.name, Data: p[written : written+n]}); err != nil {
+			return written, err
+		}
+		written += n
+	}
+	return len(p), nil
+}
+
+// Writer sends bytes written to it as chunks of stream name, Finish should be called after them
+func (s *ChannelStream) Writer(name string) io.Writer {
+	return &channelStreamWriter{stream: s, name: name}
+}
+
+// Finish sends the last chunk, err is sent as its error if it's not nil
+func (s *ChannelStream) Finish(err error) error {
+	chunk := StreamChunk{End: true}
+	if err != nil {
+		chunk.Error = err.Error()
+	}
+	return s.Send(chunk)
+}
+
+/*
+	ReadChunks calls f with every chunk the other side sends until its last one, the error of the
+	last chunk is returned, io.ErrUnexpectedEOF is returned if the stream ends without it
+*/
+func (s *ChannelStream) ReadChunks(f func(stream string, data []byte) error) error {
+	for {
+		var chunk StreamChunk
+		if err := s.Recv(&chunk); err == io.EOF {
+			return io.ErrUnexpectedEOF
+		} else if err != nil {
+			return err
+		}
+		if len(chunk.Data) > 0 {
+			if err := f(chunk.Stream, chunk.Data); err != nil {
+				return err
+			}
+		}
+		if chunk.End {
+			if chunk.Error != "" {
+				return errors.New(chunk.Error)
+			}
+			return nil
+		}
+	}
+}
+
+type channelStreamReader struct {
+	stream *ChannelStream
+	buf    []byte
+	err    error
+}
+
+func (r *channelStreamReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		var chunk StreamChunk
+		if err := r.stream.Recv(&chunk); err == io.EOF {
+			r.err = io.ErrUnexpectedEOF
+			continue
+		} else if err != nil {
+			r.err = err
+			continue
+		}
+		if chunk.End {
+			r.err = io.EOF
+			if chunk.Error != "" {
+				r.err = errors.New(chunk.Error)
+			}
+		}
+		r.buf = chunk.Data
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+// Reader returns data of chunks the other side sends as a reader, it ends with the error of the last chunk
+func (s *ChannelStream) Reader() io.Reader {
+	return &channelStreamReader{stream: s}
+}
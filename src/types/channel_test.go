@@ -0,0 +1,155 @@
+package types
+
+import (
+	"encoding/json"
+	"io"
+	"testing"
+	"time"
+)
+
+// channelStreamPair connects two streams as the readers of both channels would
+func channelStreamPair() (*ChannelStream, *ChannelStream) {
+	var a, b *ChannelStream
+	route := func(to func() *ChannelStream) func(ChannelMessage) error {
+		return func(message ChannelMessage) error {
+			switch message.Type {
+			case CHANNEL_MESSAGE_STREAM:
+				to().Deliver(message.Payload)
+			case CHANNEL_MESSAGE_STREAM_ACK:
+				to().Acked(message.Payload)
+			case CHANNEL_MESSAGE_STREAM_CLOSE:
+				to().End()
+			}
+			return nil
+		}
+	}
+	a = NewChannelStream("1", route(func() *ChannelStream { return b }), nil)
+	b = NewChannelStream("1", route(func() *ChannelStream { return a }), nil)
+	return a, b
+}
+
+func TestChannelStreamWindow(t *testing.T) {
+	a, b := channelStreamPair()
+
+	for i := 0; i < CHANNEL_STREAM_WINDOW; i++ {
+		if err := a.Send(i); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the window is full, the next send waits for acks instead of blocking the reader
+	sent := make(chan error)
+	go func() {
+		sent <- a.Send(CHANNEL_STREAM_WINDOW)
+	}()
+	select {
+	case <-sent:
+		t.Fatal("send beyond the window should wait")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	for i := 0; i <= CHANNEL_STREAM_WINDOW; i++ {
+		var v int
+		if err := b.Recv(&v); err != nil {
+			t.Fatal(err)
+		}
+		if v != i {
+			t.Fatalf("expected %d, got %d", i, v)
+		}
+	}
+	if err := <-sent; err != nil {
+		t.Fatal(err)
+	}
+
+	// payloads sent before close are still read
+	a.Send(-1)
+	a.Close()
+	var v int
+	if err := b.Recv(&v); err != nil || v != -1 {
+		t.Fatalf("unexpected payload %d, %v", v, err)
+	}
+	if err := b.Recv(&v); err != io.EOF {
+		t.Fatalf("expected EOF, got %v", err)
+	}
+}
+
+func TestChannelStreamDeliverBeyondWindow(t *testing.T) {
+	closed := make(chan struct{}, 1)
+	stream := NewChannelStream("1", func(message ChannelMessage) error {
+		if message.Type == CHANNEL_MESSAGE_STREAM_CLOSE {
+			closed <- struct{}{}
+		}
+		return nil
+	}, nil)
+
+	payload := json.RawMessage("0")
+	for i := 0; i < CHANNEL_STREAM_WINDOW; i++ {
+		stream.Deliver(payload)
+	}
+
+	// a side ignoring acks resets its stream, the reader returns at once
+	returned := make(chan struct{})
+	go func() {
+		stream.Deliver(payload)
+		close(returned)
+	}()
+	select {
+	case <-returned:
+	case <-time.After(time.Second):
+		t.Fatal("deliver beyond the window blocks")
+	}
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("stream is not closed")
+	}
+	if err := stream.Send(0); err != io.ErrClosedPipe {
+		t.Fatalf("expected closed pipe, got %v", err)
+	}
+}
+
+func TestChannelStreamChunks(t *testing.T) {
+	a, b := channelStreamPair()
+
+	// a payload larger than a chunk is split and read back in order
+	data := make([]byte, CHANNEL_STREAM_CHUNK_SIZE*2+10)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	go func() {
+		a.Writer("").Write(data)
+		a.Finish(nil)
+	}()
+	received, err := io.ReadAll(b.Reader())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(received) != string(data) {
+		t.Fatalf("received %d bytes differ from %d sent", len(received), len(data))
+	}
+
+	// the error of the last chunk is returned after the data before it
+	go func() {
+		a.Writer("stdout").Write([]byte("out"))
+		a.Writer("stderr").Write([]byte("err"))
+		a.Finish(io.ErrShortWrite)
+	}()
+	streams := map[string]string{}
+	err = b.ReadChunks(func(stream string, data []byte) error {
+		streams[stream] += string(data)
+		return nil
+	})
+	if err == nil || err.Error() != io.ErrShortWrite.Error() {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if streams["stdout"] != "out" || streams["stderr"] != "err" {
+		t.Fatalf("unexpected streams %v", streams)
+	}
+
+	// a stream closed without the last chunk is cut
+	a.Writer("").Write([]byte("partial"))
+	a.Close()
+	if _, err := io.ReadAll(b.Reader()); err != io.ErrUnexpectedEOF {
+		t.Fatalf("expected unexpected EOF, got %v", err)
+	}
+}
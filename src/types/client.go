@@ -11,25 +11,61 @@ type Client struct {
 	ClientPort int `json:"client_port"`
 	// Token
 	ClientToken string `json:"client_token"`
+	// Labels are used by scheduler to select nodes
+	Labels map[string]string `json:"labels"`
 }
 
 func (c *Client) GenerateClientURI(path string) string {
 	return "http://" + c.ClientIp + ":" + strconv.Itoa(c.ClientPort) + path
 }
 
+func (c *Client) GenerateClientWebsocketURI(path string) string {
+	return "ws://" + c.ClientIp + ":" + strconv.Itoa(c.ClientPort) + path
+}
+
 type ClientStatus struct {
 	// ClientID is the unique ID of the client
 	ClientID string `json:"client_id"`
+	// usages are fractions in [0, 1]
 	// CPUUsage is the CPU usage of the client
 	CPUUsage float64 `json:"cpu_usage"`
 	// MemoryUsage is the memory usage of the client
 	MemoryUsage float64 `json:"memory_usage"`
 	// DiskUsage is the disk usage of the client
 	DiskUsage float64 `json:"disk_usage"`
-	// NetworkUsage is the network usage of the client
+	// NetworkUsage is the bandwidth usage of the client, the larger one of in and out
 	NetworkUsage float64 `json:"network_usage"`
 	// ContainerNum is the number of containers of the client
 	ContainerNum int `json:"container_num"`
 	// ContainerUsage is the usage of containers of the client
 	ContainerUsage float64 `json:"container_usage"`
+	// Images are tags of images on the client, normalized by NormalizeImageName
+	Images []string `json:"images"`
+}
+
+// ResourceSample is the average resource usage in a step of a time series
+type ResourceSample struct {
+	// Time is the unix time the step starts at
+	Time int64 `json:"time"`
+	// CPUUsage is in percent of all cpus of the node, so usages of containers add up to the node
+	CPUUsage float64 `json:"cpu_usage"`
+	// MemUsage is in bytes
+	MemUsage uint64 `json:"mem_usage"`
+	// rates of network and block I/O are in bytes per second
+	NetRx    float64 `json:"net_rx"`
+	NetTx    float64 `json:"net_tx"`
+	BlkRead  float64 `json:"blk_read"`
+	BlkWrite float64 `json:"blk_write"`
+}
+
+// ResourceSeries is the resource usage history of a node or a container
+type ResourceSeries struct {
+	// ClientID is the node, empty for the aggregate of the cluster
+	ClientID string `json:"client_id"`
+	// ContainerID is empty for the node itself
+	ContainerID string           `json:"container_id"`
+	Image       string           `json:"image"`
+	Owner       string           `json:"owner"`
+	Module      string           `json:"module"`
+	Samples     []ResourceSample `json:"samples"`
 }
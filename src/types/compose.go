@@ -1,6 +1,8 @@
 package types
 
 import (
+	"errors"
+	"sort"
 	"strings"
 
 	"gopkg.in/yaml.v3"
@@ -10,10 +12,13 @@ type DockerComposeFile struct {
 	Services map[string]DockerComposeFileService `yaml:"services"`
 	Networks map[string]DockerComposeFileNetwork `yaml:"networks"`
 	Volumes  map[string]struct{}                 `yaml:"volumes"`
+	// keys kisara does not know, reported as warnings when converting
+	Extra map[string]interface{} `yaml:",inline"`
 }
 
 type DockerComposeFileNetwork struct {
-	IPAM DockerComposeFileNetworkIPAM `yaml:"ipam"`
+	IPAM  DockerComposeFileNetworkIPAM `yaml:"ipam"`
+	Extra map[string]interface{}       `yaml:",inline"`
 }
 
 type DockerComposeFileNetworkIPAM struct {
@@ -28,10 +33,258 @@ type DockerComposeFileNetworkIPAMConfig struct {
 }
 
 type DockerComposeFileService struct {
-	Image    string                                     `yaml:"image"`
-	Build    string                                     `yaml:"build"`
-	Networks map[string]DockerComposeFileServiceNetwork `yaml:"networks"`
-	Ports    []string                                   `yaml:"ports"`
+	Image       string                               `yaml:"image"`
+	Build       *DockerComposeFileServiceBuild       `yaml:"build,omitempty"`
+	Networks    ComposeServiceNetworks               `yaml:"networks"`
+	Ports       []string                             `yaml:"ports"`
+	Environment ComposeMapOrList                     `yaml:"environment,omitempty"`
+	Command     ComposeCommand                       `yaml:"command,omitempty"`
+	Entrypoint  ComposeCommand                       `yaml:"entrypoint,omitempty"`
+	Volumes     []DockerComposeFileServiceVolume     `yaml:"volumes,omitempty"`
+	DependsOn   ComposeDependsOn                     `yaml:"depends_on,omitempty"`
+	CapAdd      []string                             `yaml:"cap_add,omitempty"`
+	Healthcheck *DockerComposeFileServiceHealthcheck `yaml:"healthcheck,omitempty"`
+	// readiness probe of kisara, docker-compose ignores keys start with x-
+	Readiness *ServiceConfigContainerProbe `yaml:"x-kisara-readiness,omitempty"`
+	// keys kisara does not know, reported as warnings when converting
+	Extra map[string]interface{} `yaml:",inline"`
+}
+
+// build could be a path of context or a mapping
+type DockerComposeFileServiceBuild struct {
+	Context    string           `yaml:"context"`
+	Dockerfile string           `yaml:"dockerfile,omitempty"`
+	Args       ComposeMapOrList `yaml:"args,omitempty"`
+}
+
+func (c *DockerComposeFileServiceBuild) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		c.Context = value.Value
+		return nil
+	}
+	type plain DockerComposeFileServiceBuild
+	return value.Decode((*plain)(c))
+}
+
+// volume could be short syntax like "data:/var/lib/mysql:ro" or a mapping
+type DockerComposeFileServiceVolume struct {
+	Type     string `yaml:"type,omitempty"`
+	Source   string `yaml:"source,omitempty"`
+	Target   string `yaml:"target"`
+	ReadOnly bool   `yaml:"read_only,omitempty"`
+}
+
+func (c *DockerComposeFileServiceVolume) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind != yaml.ScalarNode {
+		type plain DockerComposeFileServiceVolume
+		return value.Decode((*plain)(c))
+	}
+
+	parts := strings.Split(value.Value, ":")
+	switch len(parts) {
+	case 1:
+		c.Target = parts[0]
+	case 2, 3:
+		c.Source, c.Target = parts[0], parts[1]
+		if len(parts) == 3 {
+			// mode is a comma separated list like "ro,z", ro must be a whole option
+			for _, option := range strings.Split(parts[2], ",") {
+				switch option {
+				case "ro":
+					c.ReadOnly = true
+				case "rw":
+					c.ReadOnly = false
+				}
+			}
+		}
+	default:
+		return errors.New("invalid volume " + value.Value)
+	}
+
+	c.Type = "volume"
+	if strings.HasPrefix(c.Source, "/") || strings.HasPrefix(c.Source, ".") || strings.HasPrefix(c.Source, "~") {
+		c.Type = "bind"
+	}
+	return nil
+}
+
+type DockerComposeFileServiceHealthcheck struct {
+	Test        ComposeCommand `yaml:"test,omitempty"`
+	Interval    string         `yaml:"interval,omitempty"`
+	Timeout     string         `yaml:"timeout,omitempty"`
+	StartPeriod string         `yaml:"start_period,omitempty"`
+	Retries     int            `yaml:"retries,omitempty"`
+	Disable     bool           `yaml:"disable,omitempty"`
+}
+
+// ComposeServiceNetworks are networks of a service, they could also be written as a list of names
+type ComposeServiceNetworks map[string]DockerComposeFileServiceNetwork
+
+func (c *ComposeServiceNetworks) UnmarshalYAML(value *yaml.Node) error {
+	result := make(map[string]DockerComposeFileServiceNetwork)
+	if value.Kind == yaml.SequenceNode {
+		var list []string
+		if err := value.Decode(&list); err != nil {
+			return err
+		}
+		for _, name := range list {
+			result[name] = DockerComposeFileServiceNetwork{}
+		}
+	} else {
+		var m map[string]*DockerComposeFileServiceNetwork
+		if err := value.Decode(&m); err != nil {
+			return err
+		}
+		for name, network := range m {
+			if network != nil {
+				result[name] = *network
+			} else {
+				result[name] = DockerComposeFileServiceNetwork{}
+			}
+		}
+	}
+	*c = result
+	return nil
+}
+
+// ComposeMapOrList is a mapping which could also be written as a list of KEY=VALUE
+type ComposeMapOrList map[string]string
+
+func (c *ComposeMapOrList) UnmarshalYAML(value *yaml.Node) error {
+	result := make(map[string]string)
+	if value.Kind == yaml.SequenceNode {
+		var list []string
+		if err := value.Decode(&list); err != nil {
+			return err
+		}
+		for _, item := range list {
+			kv := strings.SplitN(item, "=", 2)
+			if len(kv) == 2 {
+				result[kv[0]] = kv[1]
+			} else {
+				result[kv[0]] = ""
+			}
+		}
+	} else {
+		var m map[string]*string
+		if err := value.Decode(&m); err != nil {
+			return err
+		}
+		for k, v := range m {
+			if v != nil {
+				result[k] = *v
+			} else {
+				result[k] = ""
+			}
+		}
+	}
+	*c = result
+	return nil
+}
+
+/*
+ComposeCommand is a command written as a list or a string, a string is kept as ["CMD-SHELL", string]
+as healthcheck runs it by shell, command and entrypoint split it like shell does by Args
+*/
+type ComposeCommand []string
+
+func (c *ComposeCommand) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*c = nil
+		if value.Value != "" {
+			*c = ComposeCommand{"CMD-SHELL", value.Value}
+		}
+		return nil
+	}
+	var list []string
+	if err := value.Decode(&list); err != nil {
+		return err
+	}
+	*c = list
+	return nil
+}
+
+// Args returns arguments of the command, a string command is split like shell does
+func (c ComposeCommand) Args() []string {
+	if len(c) == 2 && c[0] == "CMD-SHELL" {
+		return SplitCommand(c[1])
+	}
+	return c
+}
+
+// SplitCommand splits a command line like shell does, quotes are supported but not escapes in them
+func SplitCommand(command string) []string {
+	args := []string{}
+	current := strings.Builder{}
+	has_current := false
+	quote := rune(0)
+	for _, r := range command {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			has_current = true
+		case r == ' ' || r == '\t' || r == '\n':
+			if has_current {
+				args = append(args, current.String())
+				current.Reset()
+				has_current = false
+			}
+		default:
+			current.WriteRune(r)
+			has_current = true
+		}
+	}
+	if has_current {
+		args = append(args, current.String())
+	}
+	return args
+}
+
+// ComposeDependsOn maps service to the condition, it could also be written as a list of services
+type ComposeDependsOn map[string]string
+
+func (c *ComposeDependsOn) UnmarshalYAML(value *yaml.Node) error {
+	result := make(map[string]string)
+	if value.Kind == yaml.SequenceNode {
+		var list []string
+		if err := value.Decode(&list); err != nil {
+			return err
+		}
+		for _, name := range list {
+			result[name] = "service_started"
+		}
+	} else {
+		var m map[string]struct {
+			Condition string `yaml:"condition"`
+		}
+		if err := value.Decode(&m); err != nil {
+			return err
+		}
+		for name, v := range m {
+			if v.Condition == "" {
+				v.Condition = "service_started"
+			}
+			result[name] = v.Condition
+		}
+	}
+	*c = result
+	return nil
+}
+
+// Names returns services depended on in order
+func (c ComposeDependsOn) Names() []string {
+	names := []string{}
+	for name := range c {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
 }
 
 type DockerComposeFileServiceNetwork struct {
@@ -0,0 +1,124 @@
+package types
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func loadComposeFixture(t *testing.T, name string) *DockerComposeFile {
+	text, err := os.ReadFile("testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compose := &DockerComposeFile{}
+	if err := compose.FromYaml(string(text)); err != nil {
+		t.Fatal(err)
+	}
+	return compose
+}
+
+func TestComposeUnmarshal(t *testing.T) {
+	compose := loadComposeFixture(t, "compose-syntax.yaml")
+	web, db, cache := compose.Services["web"], compose.Services["db"], compose.Services["cache"]
+
+	if _, ok := compose.Extra["x-unknown"]; !ok {
+		t.Errorf("unknown top-level key is not kept in Extra: %v", compose.Extra)
+	}
+	if _, ok := web.Extra["restart"]; !ok {
+		t.Errorf("unknown service key is not kept in Extra: %v", web.Extra)
+	}
+
+	cases := []struct {
+		name     string
+		got      interface{}
+		expected interface{}
+	}{
+		{"build scalar", *web.Build, DockerComposeFileServiceBuild{Context: "./web"}},
+		{"build mapping", *db.Build, DockerComposeFileServiceBuild{
+			Context:    "./db",
+			Dockerfile: "Dockerfile.db",
+			Args:       ComposeMapOrList{"VERSION": "5.7"},
+		}},
+		{"networks list", web.Networks, ComposeServiceNetworks{"front": {}, "back": {}}},
+		{"networks mapping", db.Networks, ComposeServiceNetworks{"back": {Ipv4Address: "10.10.0.10"}}},
+		{"networks mapping without value", cache.Networks, ComposeServiceNetworks{"back": {}}},
+		{"environment list", web.Environment, ComposeMapOrList{"FLAG": "flag{test}", "DEBUG": ""}},
+		{"environment mapping", db.Environment, ComposeMapOrList{"MYSQL_ROOT_PASSWORD": "root", "EMPTY": ""}},
+		{"command string", web.Command, ComposeCommand{"CMD-SHELL", `python app.py --name "kisara web"`}},
+		{"command string args", web.Command.Args(), []string{"python", "app.py", "--name", "kisara web"}},
+		{"command list", db.Command.Args(), []string{"mysqld", "--skip-name-resolve"}},
+		{"entrypoint list", web.Entrypoint, ComposeCommand{"/entrypoint.sh", "--wait"}},
+		{"healthcheck string", web.Healthcheck.Test, ComposeCommand{"CMD-SHELL", "curl -f http://localhost/"}},
+		{"healthcheck list", db.Healthcheck.Test, ComposeCommand{"CMD", "mysqladmin", "ping"}},
+		{"depends_on list", web.DependsOn, ComposeDependsOn{"db": "service_started"}},
+		{"depends_on mapping", db.DependsOn, ComposeDependsOn{"cache": "service_healthy", "other": "service_started"}},
+		{"depends_on names", db.DependsOn.Names(), []string{"cache", "other"}},
+		{"subnet", compose.Networks["back"].IPAM.Config, []DockerComposeFileNetworkIPAMConfig{{Subnet: "10.10.0.0/24"}}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if !reflect.DeepEqual(c.got, c.expected) {
+				t.Errorf("expected %#v, got %#v", c.expected, c.got)
+			}
+		})
+	}
+}
+
+func TestComposeVolumes(t *testing.T) {
+	compose := loadComposeFixture(t, "compose-syntax.yaml")
+	expected := []DockerComposeFileServiceVolume{
+		{Type: "volume", Source: "data", Target: "/data"},
+		{Type: "volume", Source: "data", Target: "/readonly", ReadOnly: true},
+		{Type: "volume", Source: "data", Target: "/relabeled", ReadOnly: true},
+		// "cached" contains neither ro nor rw as a whole option
+		{Type: "volume", Source: "data", Target: "/cached"},
+		{Type: "volume", Source: "data", Target: "/writable"},
+		{Type: "bind", Source: "./static", Target: "/static"},
+		{Type: "volume", Target: "/anonymous"},
+		{Type: "volume", Source: "logs", Target: "/logs", ReadOnly: true},
+	}
+
+	volumes := compose.Services["web"].Volumes
+	if len(volumes) != len(expected) {
+		t.Fatalf("expected %d volumes, got %d", len(expected), len(volumes))
+	}
+	for i := range expected {
+		if volumes[i] != expected[i] {
+			t.Errorf("volume %d: expected %+v, got %+v", i, expected[i], volumes[i])
+		}
+	}
+
+	var volume DockerComposeFileServiceVolume
+	if err := yaml.Unmarshal([]byte(`"a:b:c:d"`), &volume); err == nil {
+		t.Errorf("volume with too many parts is accepted")
+	}
+}
+
+func TestSplitCommand(t *testing.T) {
+	cases := []struct {
+		command  string
+		expected []string
+	}{
+		{"", []string{}},
+		{"   ", []string{}},
+		{"ls", []string{"ls"}},
+		{"ls -la /tmp", []string{"ls", "-la", "/tmp"}},
+		{"  ls \t -la\n/tmp  ", []string{"ls", "-la", "/tmp"}},
+		{`echo "hello world"`, []string{"echo", "hello world"}},
+		{`echo 'hello "world"'`, []string{"echo", `hello "world"`}},
+		{`echo ""`, []string{"echo", ""}},
+		{`echo a"b c"d`, []string{"echo", "ab cd"}},
+		{`sh -c 'echo $FLAG > /flag'`, []string{"sh", "-c", "echo $FLAG > /flag"}},
+		{`echo "unterminated`, []string{"echo", "unterminated"}},
+	}
+
+	for _, c := range cases {
+		if got := SplitCommand(c.command); !reflect.DeepEqual(got, c.expected) {
+			t.Errorf("SplitCommand(%q) = %#v, expected %#v", c.command, got, c.expected)
+		}
+	}
+}
@@ -15,6 +15,7 @@ type DBContainer struct {
 	Labels        string `gorm:"type:varchar(2048);not null"`
 	Image         string `gorm:"type:varchar(255);not null"`
 	Uid           int    `gorm:"type:int;not null"`
+	ExpireAt      int64  `gorm:"type:bigint;not null;default:0;index"`
 }
 
 type DBService struct {
@@ -25,12 +26,15 @@ type DBService struct {
 	Containers  string `gorm:"type:varchar(2048);not null"`
 	Networks    string `gorm:"type:varchar(2048);not null"`
 	Flags       string `gorm:"type:varchar(2048);not null"`
+	ExpireAt    int64  `gorm:"type:bigint;not null;default:0;index"`
+	Volumes     string `gorm:"type:varchar(2048);not null;default:'[]'"`
 }
 
 func (c *DBService) GetService() (Service, error) {
 	var service Service
 	service.Id = c.ServiceId
 	service.Name = c.ServiceName
+	service.ExpireAt = c.ExpireAt
 
 	var containers []Container
 	err := json.Unmarshal([]byte(c.Containers), &containers)
@@ -54,12 +58,20 @@ func (c *DBService) GetService() (Service, error) {
 	service.Networks = networks
 	service.Flags = flags
 
+	// records before volumes were supported have no volumes
+	if c.Volumes != "" {
+		if err := json.Unmarshal([]byte(c.Volumes), &service.Volumes); err != nil {
+			return service, err
+		}
+	}
+
 	return service, nil
 }
 
 func (c *DBService) InjectService(service Service) {
 	c.ServiceId = service.Id
 	c.ServiceName = service.Name
+	c.ExpireAt = service.ExpireAt
 
 	containers, _ := json.Marshal(service.Containers)
 	c.Containers = string(containers)
@@ -69,6 +81,9 @@ func (c *DBService) InjectService(service Service) {
 
 	flags, _ := json.Marshal(service.Flags)
 	c.Flags = string(flags)
+
+	volumes, _ := json.Marshal(service.Volumes)
+	c.Volumes = string(volumes)
 }
 
 type DBImage struct {
@@ -77,8 +92,158 @@ type DBImage struct {
 	ImageName string    `gorm:"type:varchar(255);not null"`
 	ImageId   string    `gorm:"type:varchar(255);not null;index"`
 	LastUsage time.Time `gorm:"type:datetime;not null"`
+	// RefreshedAt is the last time the image is known to be the same as its registry
+	RefreshedAt time.Time `gorm:"type:datetime"`
+}
+
+// DBContainerLog keeps logs of a removed container for post-mortem debugging, it has no soft delete
+// so expired logs are really purged
+type DBContainerLog struct {
+	Id          int    `gorm:"primaryKey;autoIncrement;not null"`
+	ContainerId string `gorm:"type:varchar(255);not null;index"`
+	Stdout      string `gorm:"type:text"`
+	Stderr      string `gorm:"type:text"`
+	RemovedAt   int64  `gorm:"type:bigint;not null;index"`
 }
 
 func (c *DBImage) IsExpired(duration time.Duration) bool {
 	return time.Since(c.LastUsage) > duration
 }
+
+// DBNode is the record of a client node kept by server
+type DBNode struct {
+	gorm.Model
+	Id         int       `gorm:"primaryKey;autoIncrement;not null"`
+	ClientId   string    `gorm:"type:varchar(255);not null;index"`
+	ClientIp   string    `gorm:"type:varchar(255);not null"`
+	ClientPort int       `gorm:"type:int;not null"`
+	LastSeen   time.Time `gorm:"type:datetime;not null"`
+	Cordoned   bool      `gorm:"type:boolean;not null;default:false"`
+}
+
+// DBNodeContainer is the record of a container running on a client node kept by server
+type DBNodeContainer struct {
+	gorm.Model
+	Id          int    `gorm:"primaryKey;autoIncrement;not null"`
+	ClientId    string `gorm:"type:varchar(255);not null;index"`
+	ContainerId string `gorm:"type:varchar(255);not null;index"`
+	Container   string `gorm:"type:text;not null"`
+	// Request is the launch request, used to relaunch the container on another node
+	Request string `gorm:"type:text"`
+}
+
+func (c *DBNodeContainer) GetContainer() (Container, error) {
+	var container Container
+	err := json.Unmarshal([]byte(c.Container), &container)
+	return container, err
+}
+
+func (c *DBNodeContainer) InjectContainer(client_id string, container Container) {
+	c.ClientId = client_id
+	c.ContainerId = container.Id
+	text, _ := json.Marshal(container)
+	c.Container = string(text)
+}
+
+func (c *DBNodeContainer) GetRequest() (RequestLaunchContainer, error) {
+	var request RequestLaunchContainer
+	err := json.Unmarshal([]byte(c.Request), &request)
+	return request, err
+}
+
+func (c *DBNodeContainer) InjectRequest(request RequestLaunchContainer) {
+	text, _ := json.Marshal(request)
+	c.Request = string(text)
+}
+
+// DBNodeService is the record of a service running on a client node kept by server
+type DBNodeService struct {
+	gorm.Model
+	Id        int    `gorm:"primaryKey;autoIncrement;not null"`
+	ClientId  string `gorm:"type:varchar(255);not null;index"`
+	ServiceId string `gorm:"type:varchar(255);not null;index"`
+	Service   string `gorm:"type:text;not null"`
+	// Request is the launch request, used to relaunch the service on another node
+	Request string `gorm:"type:text"`
+}
+
+func (c *DBNodeService) GetService() (Service, error) {
+	var service Service
+	err := json.Unmarshal([]byte(c.Service), &service)
+	return service, err
+}
+
+func (c *DBNodeService) InjectService(client_id string, service Service) {
+	c.ClientId = client_id
+	c.ServiceId = service.Id
+	text, _ := json.Marshal(service)
+	c.Service = string(text)
+}
+
+func (c *DBNodeService) GetRequest() (RequestLaunchService, error) {
+	var request RequestLaunchService
+	err := json.Unmarshal([]byte(c.Request), &request)
+	return request, err
+}
+
+func (c *DBNodeService) InjectRequest(request RequestLaunchService) {
+	text, _ := json.Marshal(request)
+	c.Request = string(text)
+}
+
+// DBGame is the record of a game played by server
+type DBGame struct {
+	gorm.Model
+	Id     int    `gorm:"primaryKey;autoIncrement;not null"`
+	GameId string `gorm:"type:varchar(255);not null;index"`
+	Game   string `gorm:"type:text;not null"`
+	// Request is the start request, rounds of a restored game are played by it
+	Request string `gorm:"type:text;not null"`
+	// Timeout of requests sent to clients in seconds
+	Timeout int64 `gorm:"type:int;not null"`
+}
+
+func (c *DBGame) GetGame() (Game, error) {
+	var game Game
+	err := json.Unmarshal([]byte(c.Game), &game)
+	return game, err
+}
+
+func (c *DBGame) InjectGame(game Game) {
+	c.GameId = game.Id
+	text, _ := json.Marshal(game)
+	c.Game = string(text)
+}
+
+func (c *DBGame) GetRequest() (RequestStartGame, error) {
+	var request RequestStartGame
+	err := json.Unmarshal([]byte(c.Request), &request)
+	return request, err
+}
+
+func (c *DBGame) InjectRequest(request RequestStartGame) {
+	text, _ := json.Marshal(request)
+	c.Request = string(text)
+}
+
+// DBGameRound is the result of a round of a game, flags included
+type DBGameRound struct {
+	gorm.Model
+	Id     int    `gorm:"primaryKey;autoIncrement;not null"`
+	GameId string `gorm:"type:varchar(255);not null;index"`
+	Round  int    `gorm:"type:int;not null"`
+	Result string `gorm:"type:text;not null"`
+}
+
+func (c *DBGameRound) GetRound() (GameRound, error) {
+	var round GameRound
+	err := json.Unmarshal([]byte(c.Result), &round)
+	return round, err
+}
+
+func (c *DBGameRound) InjectRound(round GameRound) {
+	c.GameId = round.GameId
+	c.Round = round.Round
+	text, _ := json.Marshal(round)
+	c.Result = string(text)
+}
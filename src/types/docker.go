@@ -1,11 +1,17 @@
 package types
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"net"
+	"sort"
 	"strconv"
 	"strings"
 
+	"github.com/docker/distribution/reference"
 	"gopkg.in/yaml.v3"
 )
 
@@ -31,6 +37,23 @@ type Container struct {
 	CPUUsage float64           `json:"cpu_usage"`
 	MemUsage float64           `json:"mem_usage"`
 	Networks []Network         `json:"networks"`
+	ExpireAt int64             `json:"expire_at"` // unix time the container expires at, 0 means never
+}
+
+// ContainerUsage is the resource usage of a running container, read from its stats
+type ContainerUsage struct {
+	ContainerId string  `json:"container_id"`
+	Image       string  `json:"image"`
+	Owner       string  `json:"owner"`
+	Module      string  `json:"module"`
+	CPUUsage    float64 `json:"cpu_usage"` // percent of one cpu times cpus, as docker stats shows
+	MemUsage    uint64  `json:"mem_usage"` // bytes
+	MemLimit    uint64  `json:"mem_limit"` // bytes
+	// cumulative bytes of network and block I/O
+	NetRx    uint64 `json:"net_rx"`
+	NetTx    uint64 `json:"net_tx"`
+	BlkRead  uint64 `json:"blk_read"`
+	BlkWrite uint64 `json:"blk_write"`
 }
 
 func (c *Container) IsRunning() bool {
@@ -50,10 +73,28 @@ type Network struct {
 	Scope    string `json:"scope"`
 }
 
+// NormalizeImageName returns image name in the short form with its tag, e.g. nginx:latest for docker.io/library/nginx
+func NormalizeImageName(image_name string) string {
+	named, err := reference.ParseNormalizedNamed(image_name)
+	if err != nil {
+		return image_name
+	}
+	return reference.FamiliarString(reference.TagNameOnly(named))
+}
+
 // ServiceFlag Contains the flag kisara generated for the service, it's not the part of service config
 type ServiceFlag struct {
-	FlagUuid string `json:"flag_uuid"`
-	Flag     string `json:"flag"`
+	FlagUuid    string `json:"flag_uuid"`
+	Flag        string `json:"flag"`
+	ContainerId string `json:"container_id"` // container the flag is written into
+	FlagCommand string `json:"flag_command"` // command writing the flag, used to rotate it
+}
+
+// ServiceFlagFailure is a flag which could not be rotated, the old flag is kept
+type ServiceFlagFailure struct {
+	FlagUuid    string `json:"flag_uuid"`
+	ContainerId string `json:"container_id"`
+	Error       string `json:"error"`
 }
 
 // Service is the service kisara generated for the user
@@ -64,6 +105,8 @@ type Service struct {
 	Networks   []Network     `json:"networks"`
 	Flags      []ServiceFlag `json:"flags"`
 	Status     string        `json:"status"`
+	ExpireAt   int64         `json:"expire_at"` // unix time the service expires at, 0 means never
+	Volumes    []string      `json:"volumes"`   // docker volumes created for the service
 }
 
 const (
@@ -87,14 +130,301 @@ type ServiceConfigContainerPortMapping struct {
 type ServiceConfigContainerNetwork struct {
 	Network    string `json:"network" yaml:"network"`        // network to be used, if random_network is true, this field should be a string of network name
 	RandomCIDR bool   `json:"random_cidr" yaml:"RandomCIDR"` // whether to generate random container
+	Subnet     string `json:"subnet" yaml:"subnet"`          // fixed subnet like 10.10.0.0/24, required if random_cidr is false
+	// address of the container in this network, at most one of them could be set, a random one is assigned if neither is set
+	IPv4Address string `json:"ipv4_address" yaml:"ipv4_address"` // fixed address, only for fixed subnet
+	HostOffset  int    `json:"host_offset" yaml:"host_offset"`   // offset from the network address, 10 means x.x.x.10 in a /24, works with random CIDR
+}
+
+/*
+	GetAddress returns the address of the container in subnet, subnet is the one allocated to the network,
+	empty if the address is assigned by docker, .1 is taken by gateway so offset should be at least 2
+*/
+func (c *ServiceConfigContainerNetwork) GetAddress(subnet string) (string, error) {
+	_, ipnet, err := net.ParseCIDR(subnet)
+	if err != nil {
+		return "", err
+	}
+	network_ip := ipnet.IP.To4()
+	if network_ip == nil {
+		return "", fmt.Errorf("subnet %s is not ipv4", subnet)
+	}
+	ones, bits := ipnet.Mask.Size()
+	size := uint64(1) << uint(bits-ones)
+
+	if c.IPv4Address != "" {
+		ip := net.ParseIP(c.IPv4Address).To4()
+		if ip == nil {
+			return "", fmt.Errorf("invalid ipv4 address %s", c.IPv4Address)
+		}
+		if !ipnet.Contains(ip) {
+			return "", fmt.Errorf("address %s is not in subnet %s", c.IPv4Address, subnet)
+		}
+		offset := uint64(ipToUint32(ip) - ipToUint32(network_ip))
+		if offset < 2 || offset >= size-1 {
+			return "", fmt.Errorf("address %s is reserved in subnet %s", c.IPv4Address, subnet)
+		}
+		return ip.String(), nil
+	}
+
+	if c.HostOffset != 0 {
+		if c.HostOffset < 2 || uint64(c.HostOffset) >= size-1 {
+			return "", fmt.Errorf("host offset %d is out of subnet %s", c.HostOffset, subnet)
+		}
+		return uint32ToIp(ipToUint32(network_ip) + uint32(c.HostOffset)).String(), nil
+	}
+
+	return "", nil
+}
+
+func ipToUint32(ip net.IP) uint32 {
+	ip = ip.To4()
+	return uint32(ip[0])<<24 | uint32(ip[1])<<16 | uint32(ip[2])<<8 | uint32(ip[3])
+}
+
+func uint32ToIp(n uint32) net.IP {
+	return net.IPv4(byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+}
+
+// GetHostOffset returns the offset of address from the network address of subnet
+func GetHostOffset(subnet string, address string) (int, error) {
+	_, ipnet, err := net.ParseCIDR(subnet)
+	if err != nil {
+		return 0, err
+	}
+	ip := net.ParseIP(address).To4()
+	if ip == nil || ipnet.IP.To4() == nil {
+		return 0, fmt.Errorf("invalid ipv4 address %s", address)
+	}
+	if !ipnet.Contains(ip) {
+		return 0, fmt.Errorf("address %s is not in subnet %s", address, subnet)
+	}
+	return int(ipToUint32(ip) - ipToUint32(ipnet.IP)), nil
+}
+
+// SubnetOverlaps checks whether two CIDR overlap
+func SubnetOverlaps(a string, b string) bool {
+	_, net_a, err := net.ParseCIDR(a)
+	if err != nil {
+		return false
+	}
+	_, net_b, err := net.ParseCIDR(b)
+	if err != nil {
+		return false
+	}
+	return net_a.Contains(net_b.IP) || net_b.Contains(net_a.IP)
 }
 
 type ServiceConfigContainer struct {
+	Name     string                              `json:"name" yaml:"name"` // name used by depends_on, also the hostname other containers reach it by
 	Image    string                              `json:"image" yaml:"image"`
 	Ports    []ServiceConfigContainerPortMapping `json:"ports" yaml:"ports"`
 	Networks []ServiceConfigContainerNetwork     `json:"networks" yaml:"networks"`
 	Flags    []ServiceConfigContainerFlag        `json:"flags" yaml:"flags"`
 	Env      map[string]string                   `json:"env" yaml:"env"`
+	// Build builds Image on the node before launching if set
+	Build       *ServiceConfigContainerBuild       `json:"build,omitempty" yaml:"build,omitempty"`
+	Command     []string                           `json:"command" yaml:"command"`
+	Entrypoint  []string                           `json:"entrypoint" yaml:"entrypoint"`
+	Volumes     []ServiceConfigContainerVolume     `json:"volumes" yaml:"volumes"`
+	DependsOn   []string                           `json:"depends_on" yaml:"depends_on"` // names of containers launched before this one
+	CapAdd      []string                           `json:"cap_add" yaml:"cap_add"`
+	Healthcheck *ServiceConfigContainerHealthcheck `json:"healthcheck,omitempty" yaml:"healthcheck,omitempty"`
+	// Readiness is checked before flags are written and containers depending on it are launched
+	Readiness *ServiceConfigContainerProbe `json:"readiness,omitempty" yaml:"readiness,omitempty"`
+	// resource limits, zero values fall back to the defaults of node
+	CpuLimit     float64 `json:"cpu_limit" yaml:"cpu_limit"`
+	MemoryLimit  int64   `json:"memory_limit" yaml:"memory_limit"`
+	PidsLimit    int64   `json:"pids_limit" yaml:"pids_limit"`
+	DiskQuota    int64   `json:"disk_quota" yaml:"disk_quota"`
+	BandwidthIn  int64   `json:"bandwidth_in" yaml:"bandwidth_in"`
+	BandwidthOut int64   `json:"bandwidth_out" yaml:"bandwidth_out"`
+}
+
+type ServiceConfigContainerBuild struct {
+	Context    string            `json:"context" yaml:"context"` // key of the context tar in RequestLaunchService.BuildContexts
+	Dockerfile string            `json:"dockerfile" yaml:"dockerfile"`
+	Args       map[string]string `json:"args" yaml:"args"`
+}
+
+/*
+	ImageName returns the image a build is tagged as, in repository, or kisara-build-<container> if
+	it's empty, with a tag hashed from the context, Dockerfile and args, so services having
+	containers of the same name never overwrite images of each other unless they are built the same
+*/
+func (b *ServiceConfigContainerBuild) ImageName(repository string, container string, context []byte) string {
+	// a tag given to repository is replaced, a port of registry is not a tag
+	if i := strings.LastIndex(repository, ":"); i > strings.LastIndex(repository, "/") {
+		repository = repository[:i]
+	}
+	if repository == "" {
+		repository = "kisara-build-" + strings.ToLower(container)
+	}
+
+	hash := sha256.New()
+	context_hash := sha256.Sum256(context)
+	hash.Write(context_hash[:])
+	hash.Write([]byte(b.Dockerfile))
+	keys := make([]string, 0, len(b.Args))
+	for key := range b.Args {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		hash.Write([]byte{0})
+		hash.Write([]byte(key + "=" + b.Args[key]))
+	}
+	return repository + ":" + hex.EncodeToString(hash.Sum(nil))[:16]
+}
+
+// volumes are docker volumes, bind mounts of node paths are not allowed
+type ServiceConfigContainerVolume struct {
+	Source   string `json:"source" yaml:"source"` // volume shared by containers of the same service, anonymous if empty
+	Target   string `json:"target" yaml:"target"`
+	ReadOnly bool   `json:"read_only" yaml:"read_only"`
+}
+
+type ServiceConfigContainerHealthcheck struct {
+	Test        []string `json:"test" yaml:"test"`                 // like ["CMD", "curl", "-f", "http://localhost"] or ["CMD-SHELL", "curl -f http://localhost"]
+	Interval    int      `json:"interval" yaml:"interval"`         // seconds
+	Timeout     int      `json:"timeout" yaml:"timeout"`           // seconds
+	StartPeriod int      `json:"start_period" yaml:"start_period"` // seconds
+	Retries     int      `json:"retries" yaml:"retries"`
+}
+
+const (
+	PROBE_TCP         = "tcp"         // port accepts connections
+	PROBE_HTTP        = "http"        // GET path returns 2xx or 3xx
+	PROBE_EXEC        = "exec"        // command exits with 0 in container
+	PROBE_HEALTHCHECK = "healthcheck" // healthcheck of docker reports healthy
+)
+
+type ServiceConfigContainerProbe struct {
+	Type     string `json:"type" yaml:"type"`
+	Port     int    `json:"port" yaml:"port"`         // port of tcp and http probe
+	Path     string `json:"path" yaml:"path"`         // path of http probe, / if empty
+	Command  string `json:"command" yaml:"command"`   // command of exec probe, run by sh -c
+	Interval int    `json:"interval" yaml:"interval"` // seconds between attempts, 1 if 0
+	Timeout  int    `json:"timeout" yaml:"timeout"`   // seconds to wait for the probe to pass, 60 if 0
+}
+
+func (p *ServiceConfigContainerProbe) check() error {
+	switch p.Type {
+	case PROBE_TCP, PROBE_HTTP:
+		if p.Port <= 0 || p.Port > 65535 {
+			return fmt.Errorf("%s probe needs a valid port", p.Type)
+		}
+	case PROBE_EXEC:
+		if p.Command == "" {
+			return errors.New("exec probe needs a command")
+		}
+	case PROBE_HEALTHCHECK:
+	default:
+		return fmt.Errorf("unknown probe type %s", p.Type)
+	}
+	if p.Interval < 0 || p.Timeout < 0 {
+		return errors.New("interval and timeout of probe cannot be negative")
+	}
+	return nil
+}
+
+// capabilities which break the isolation of node, they could not be added
+var forbiddenCapabilities = map[string]bool{
+	"ALL": true, "SYS_ADMIN": true, "SYS_MODULE": true, "SYS_RAWIO": true, "SYS_BOOT": true,
+	"SYS_TIME": true, "DAC_READ_SEARCH": true, "MAC_ADMIN": true, "MAC_OVERRIDE": true,
+	"SYSLOG": true, "BPF": true, "PERFMON": true,
+}
+
+// ContainerOptions are optional settings of a container launched by a service
+type ContainerOptions struct {
+	IPv4Addresses map[string]string // static address in each network, keyed by network name
+	Aliases       []string          // names other containers in the same networks reach it by
+	Cmd           []string
+	Entrypoint    []string
+	CapAdd        []string
+	Volumes       []ServiceConfigContainerVolume // Source is the name of docker volume
+	Healthcheck   *ServiceConfigContainerHealthcheck
+	ImageRefresh  ImageRefresh
+	Registry      *RegistryCredential // credential of the registry of image, the node's one if nil
+}
+
+// RegistryCredential is the login of a private registry, it's sealed by kisara.token when sent
+type RegistryCredential struct {
+	Username      string `json:"username"`
+	Password      string `json:"password"`
+	IdentityToken string `json:"identity_token"`
+}
+
+const (
+	IMAGE_REFRESH_ALWAYS        = "always"        // check registry every time the image is required
+	IMAGE_REFRESH_IF_OLDER_THAN = "if-older-than" // check registry if the image is not refreshed in MaxAge
+	IMAGE_REFRESH_NEVER         = "never"
+)
+
+// ImageRefresh decides whether a cached image tagged latest is refreshed from its registry
+type ImageRefresh struct {
+	Policy string `json:"policy"`  // empty means the policy of the node
+	MaxAge int64  `json:"max_age"` // seconds, used by if-older-than
+}
+
+func (r *ImageRefresh) Check() error {
+	switch r.Policy {
+	case "", IMAGE_REFRESH_ALWAYS, IMAGE_REFRESH_NEVER:
+		return nil
+	case IMAGE_REFRESH_IF_OLDER_THAN:
+		if r.MaxAge <= 0 {
+			return errors.New("max age of image refresh should be positive")
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown image refresh policy: %s", r.Policy)
+}
+
+// ImageRefreshResult is an image pulled again as its tag moved in registry
+type ImageRefreshResult struct {
+	ImageName  string `json:"image_name"`
+	OldImageId string `json:"old_image_id"`
+	NewImageId string `json:"new_image_id"`
+	Digest     string `json:"digest"`
+}
+
+const (
+	IMAGE_PRUNE_EXPIRED = "expired" // not used for longer than max age
+	IMAGE_PRUNE_DISK    = "disk"    // least recently used while disk is above the high watermark
+)
+
+// PrunedImage is an image removed by image garbage collection, or to be removed in a dry run
+type PrunedImage struct {
+	ImageId   string   `json:"image_id"`
+	ImageTags []string `json:"image_tags"`
+	Size      int64    `json:"size"`
+	// Reason is one of IMAGE_PRUNE_*
+	Reason string `json:"reason"`
+	// LastUsage is the unix time the image was last required
+	LastUsage int64 `json:"last_usage"`
+	// Error occurred while removing the image
+	Error string `json:"error,omitempty"`
+}
+
+func (c *ServiceConfigContainer) GetResources() ContainerResources {
+	return ContainerResources{
+		CpuLimit:     c.CpuLimit,
+		MemoryLimit:  c.MemoryLimit,
+		PidsLimit:    c.PidsLimit,
+		DiskQuota:    c.DiskQuota,
+		BandwidthIn:  c.BandwidthIn,
+		BandwidthOut: c.BandwidthOut,
+	}
+}
+
+// ContainerResources limits what a container could use, zero values fall back to the defaults of node
+type ContainerResources struct {
+	CpuLimit     float64 `json:"cpu_limit"`     // cpus, 0.5 means half of one core
+	MemoryLimit  int64   `json:"memory_limit"`  // bytes
+	PidsLimit    int64   `json:"pids_limit"`    // max number of processes
+	DiskQuota    int64   `json:"disk_quota"`    // bytes of the writable layer, needs overlay2 on xfs with pquota
+	BandwidthIn  int64   `json:"bandwidth_in"`  // bits per second received by container
+	BandwidthOut int64   `json:"bandwidth_out"` // bits per second sent by container
 }
 
 type ServiceConfigContainerFlag struct {
@@ -118,7 +448,9 @@ func (c *KisaraService) GetConfig() (ServiceConfig, error) {
 		return config, err
 	}
 
-	networks := make(map[string]bool)
+	networks := make(map[string]ServiceConfigContainerNetwork)
+	// addresses taken in each network, fixed address for fixed subnet, offset for random CIDR
+	addresses := make(map[string]map[string]bool)
 
 	total_score := config.TotalScore
 	for _, container := range config.Containers {
@@ -133,15 +465,68 @@ func (c *KisaraService) GetConfig() (ServiceConfig, error) {
 				if !strings.Contains("ABCDEFGHIJKLMNOPQRSTUVWXYZ", network.Network) {
 					return config, errors.New("random CIDR network should be one character like 'A' or 'B'")
 				}
+				if network.IPv4Address != "" {
+					return config, fmt.Errorf("network %s has random CIDR, use host_offset instead of ipv4_address", network.Network)
+				}
 			} else {
-				return config, errors.New("currently only support random CIDR network")
+				if network.Subnet == "" {
+					return config, fmt.Errorf("network %s should have a subnet", network.Network)
+				}
+				if _, _, err := net.ParseCIDR(network.Subnet); err != nil {
+					return config, fmt.Errorf("network %s has invalid subnet: %s", network.Network, err.Error())
+				}
+			}
+			if network.IPv4Address != "" && network.HostOffset != 0 {
+				return config, fmt.Errorf("network %s: ipv4_address and host_offset cannot be both set", network.Network)
+			}
+
+			if declared, ok := networks[network.Network]; ok {
+				if declared.RandomCIDR != network.RandomCIDR || declared.Subnet != network.Subnet {
+					return config, fmt.Errorf("network %s is declared differently in containers", network.Network)
+				}
+			} else {
+				for name, declared := range networks {
+					if !declared.RandomCIDR && !network.RandomCIDR && SubnetOverlaps(declared.Subnet, network.Subnet) {
+						return config, fmt.Errorf("subnet of network %s overlaps with network %s", network.Network, name)
+					}
+				}
+				networks[network.Network] = network
+				addresses[network.Network] = make(map[string]bool)
+			}
+
+			address := ""
+			if network.RandomCIDR {
+				if network.HostOffset != 0 {
+					if network.HostOffset < 2 {
+						return config, fmt.Errorf("host offset %d is reserved", network.HostOffset)
+					}
+					address = strconv.Itoa(network.HostOffset)
+				}
+			} else {
+				address, err = network.GetAddress(network.Subnet)
+				if err != nil {
+					return config, err
+				}
+			}
+			if address != "" {
+				if addresses[network.Network][address] {
+					return config, fmt.Errorf("address %s is used twice in network %s", address, network.Network)
+				}
+				addresses[network.Network][address] = true
 			}
-			networks[network.Network] = true
 		}
 
 		for _, flag := range container.Flags {
 			total_score -= flag.FlagScore
 		}
+
+		if err := container.check(); err != nil {
+			return config, err
+		}
+	}
+
+	if err := config.checkDependencies(); err != nil {
+		return config, err
 	}
 
 	if total_score != 0 {
@@ -159,6 +544,110 @@ func (c *KisaraService) GetConfig() (ServiceConfig, error) {
 	return config, nil
 }
 
+func (c *ServiceConfigContainer) check() error {
+	if c.Build != nil && c.Build.Context == "" {
+		return fmt.Errorf("container %s has build without context", c.Name)
+	}
+	if c.Readiness != nil {
+		if err := c.Readiness.check(); err != nil {
+			return fmt.Errorf("container %s: %s", c.Name, err.Error())
+		}
+	}
+	for _, volume := range c.Volumes {
+		if !strings.HasPrefix(volume.Target, "/") {
+			return fmt.Errorf("volume target %s of container %s should be an absolute path", volume.Target, c.Name)
+		}
+		if strings.ContainsAny(volume.Source, "/\\") || strings.HasPrefix(volume.Source, ".") || strings.HasPrefix(volume.Source, "~") {
+			return fmt.Errorf("volume %s of container %s is a bind mount, which is not allowed", volume.Source, c.Name)
+		}
+	}
+	for _, capability := range c.CapAdd {
+		if forbiddenCapabilities[strings.TrimPrefix(strings.ToUpper(capability), "CAP_")] {
+			return fmt.Errorf("capability %s is not allowed", capability)
+		}
+	}
+	return nil
+}
+
+// checkDependencies checks names are unique and depends_on has no unknown name or cycle
+func (c *ServiceConfig) checkDependencies() error {
+	names := make(map[string]int)
+	for i, container := range c.Containers {
+		if container.Name == "" {
+			continue
+		}
+		if _, ok := names[container.Name]; ok {
+			return fmt.Errorf("container name %s is used twice", container.Name)
+		}
+		names[container.Name] = i
+	}
+
+	for _, container := range c.Containers {
+		for _, name := range container.DependsOn {
+			if _, ok := names[name]; !ok {
+				return fmt.Errorf("container %s depends on unknown container %s", container.Name, name)
+			}
+		}
+	}
+
+	if _, err := c.LaunchOrder(); err != nil {
+		return err
+	}
+	return nil
+}
+
+/*
+	LaunchOrder returns indexes of containers in the order they should be launched, containers come
+	after those they depend on, containers with static addresses are preferred so that their addresses
+	are not taken by others, the order of config is kept otherwise
+*/
+func (c *ServiceConfig) LaunchOrder() ([]int, error) {
+	names := make(map[string]int)
+	for i, container := range c.Containers {
+		if container.Name != "" {
+			names[container.Name] = i
+		}
+	}
+
+	launched := make([]bool, len(c.Containers))
+	order := make([]int, 0, len(c.Containers))
+	for len(order) < len(c.Containers) {
+		next := -1
+		for i, container := range c.Containers {
+			if launched[i] {
+				continue
+			}
+			ready := true
+			for _, name := range container.DependsOn {
+				if index, ok := names[name]; ok && !launched[index] {
+					ready = false
+				}
+			}
+			if !ready {
+				continue
+			}
+			if next == -1 || (container.hasStaticAddress() && !c.Containers[next].hasStaticAddress()) {
+				next = i
+			}
+		}
+		if next == -1 {
+			return nil, errors.New("depends_on of containers has a cycle")
+		}
+		launched[next] = true
+		order = append(order, next)
+	}
+	return order, nil
+}
+
+func (c *ServiceConfigContainer) hasStaticAddress() bool {
+	for _, network := range c.Networks {
+		if network.IPv4Address != "" || network.HostOffset != 0 {
+			return true
+		}
+	}
+	return false
+}
+
 func (c *ServiceConfig) RandomCIDRCount() int {
 	count := 0
 	for _, container := range c.Containers {
@@ -182,9 +671,24 @@ func (c *ServiceConfig) GetNetworks() []ServiceConfigContainerNetwork {
 	for _, network := range networks {
 		networks_list = append(networks_list, network)
 	}
+	// sorted by name, networks of a launched service are in the same order
+	sort.Slice(networks_list, func(i, j int) bool {
+		return networks_list[i].Network < networks_list[j].Network
+	})
 	return networks_list
 }
 
+// GetImages returns images the service pulls, images built by the service are not included
+func (c *ServiceConfig) GetImages() []string {
+	images := make([]string, 0)
+	for _, container := range c.Containers {
+		if container.Build == nil {
+			images = append(images, container.Image)
+		}
+	}
+	return images
+}
+
 func (c *ServiceConfig) GetFlagCount() int {
 	count := 0
 	for _, container := range c.Containers {
@@ -0,0 +1,339 @@
+package types
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBuildImageName(t *testing.T) {
+	build := &ServiceConfigContainerBuild{Context: "./web", Args: map[string]string{"A": "1", "B": "2"}}
+	name := build.ImageName("", "Web", []byte("context"))
+	if !strings.HasPrefix(name, "kisara-build-web:") || len(name) != len("kisara-build-web:")+16 {
+		t.Fatalf("unexpected name %s", name)
+	}
+
+	// same build gives the same tag, a different context, Dockerfile or args does not
+	if build.ImageName("", "web", []byte("context")) != name {
+		t.Fatalf("tag of the same build changes")
+	}
+	if build.ImageName("", "web", []byte("other")) == name {
+		t.Fatalf("different contexts share a tag")
+	}
+	dockerfile := &ServiceConfigContainerBuild{Context: "./web", Dockerfile: "Dockerfile.prod", Args: build.Args}
+	if dockerfile.ImageName("", "web", []byte("context")) == name {
+		t.Fatalf("different dockerfiles share a tag")
+	}
+	args := &ServiceConfigContainerBuild{Context: "./web", Args: map[string]string{"A": "12"}}
+	if args.ImageName("", "web", []byte("context")) == name {
+		t.Fatalf("different args share a tag")
+	}
+
+	// the tag of repository is replaced, the port of a registry is kept
+	for repository, expected := range map[string]string{
+		"chall/web:1.0":             "chall/web:",
+		"registry.local:5000/web":   "registry.local:5000/web:",
+		"registry.local:5000/web:v": "registry.local:5000/web:",
+	} {
+		if name := build.ImageName(repository, "web", nil); !strings.HasPrefix(name, expected) || strings.Count(name[len(expected):], ":") != 0 {
+			t.Errorf("unexpected name %s of %s", name, repository)
+		}
+	}
+}
+
+func TestGetAddress(t *testing.T) {
+	cases := []struct {
+		name     string
+		network  ServiceConfigContainerNetwork
+		subnet   string
+		expected string
+		fails    bool
+	}{
+		{name: "assigned by docker", subnet: "10.10.0.0/24", expected: ""},
+		{name: "fixed address", network: ServiceConfigContainerNetwork{IPv4Address: "10.10.0.10"}, subnet: "10.10.0.0/24", expected: "10.10.0.10"},
+		{name: "host offset", network: ServiceConfigContainerNetwork{HostOffset: 10}, subnet: "172.16.4.0/22", expected: "172.16.4.10"},
+		{name: "host offset beyond the last byte", network: ServiceConfigContainerNetwork{HostOffset: 300}, subnet: "172.16.4.0/22", expected: "172.16.5.44"},
+		{name: "address out of subnet", network: ServiceConfigContainerNetwork{IPv4Address: "10.10.1.10"}, subnet: "10.10.0.0/24", fails: true},
+		{name: "network address", network: ServiceConfigContainerNetwork{IPv4Address: "10.10.0.0"}, subnet: "10.10.0.0/24", fails: true},
+		{name: "gateway address", network: ServiceConfigContainerNetwork{IPv4Address: "10.10.0.1"}, subnet: "10.10.0.0/24", fails: true},
+		{name: "broadcast address", network: ServiceConfigContainerNetwork{IPv4Address: "10.10.0.255"}, subnet: "10.10.0.0/24", fails: true},
+		{name: "invalid address", network: ServiceConfigContainerNetwork{IPv4Address: "10.10.0"}, subnet: "10.10.0.0/24", fails: true},
+		{name: "ipv6 address", network: ServiceConfigContainerNetwork{IPv4Address: "fd00::10"}, subnet: "10.10.0.0/24", fails: true},
+		{name: "offset of gateway", network: ServiceConfigContainerNetwork{HostOffset: 1}, subnet: "10.10.0.0/24", fails: true},
+		{name: "offset of broadcast", network: ServiceConfigContainerNetwork{HostOffset: 255}, subnet: "10.10.0.0/24", fails: true},
+		{name: "invalid subnet", network: ServiceConfigContainerNetwork{HostOffset: 10}, subnet: "10.10.0.0", fails: true},
+		{name: "ipv6 subnet", network: ServiceConfigContainerNetwork{HostOffset: 10}, subnet: "fd00::/64", fails: true},
+	}
+
+	for _, c := range cases {
+		address, err := c.network.GetAddress(c.subnet)
+		if c.fails {
+			if err == nil {
+				t.Errorf("%s: expected an error, got %s", c.name, address)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", c.name, err.Error())
+		} else if address != c.expected {
+			t.Errorf("%s: expected %s, got %s", c.name, c.expected, address)
+		}
+	}
+}
+
+func TestGetHostOffset(t *testing.T) {
+	cases := []struct {
+		name     string
+		subnet   string
+		address  string
+		expected int
+		fails    bool
+	}{
+		{name: "offset in the last byte", subnet: "10.10.0.0/24", address: "10.10.0.10", expected: 10},
+		{name: "offset across bytes", subnet: "172.16.4.0/22", address: "172.16.5.44", expected: 300},
+		{name: "subnet given by a host address", subnet: "10.10.0.7/24", address: "10.10.0.10", expected: 10},
+		{name: "address out of subnet", subnet: "10.10.0.0/24", address: "10.10.1.10", fails: true},
+		{name: "invalid address", subnet: "10.10.0.0/24", address: "host", fails: true},
+		{name: "invalid subnet", subnet: "10.10.0.0", address: "10.10.0.10", fails: true},
+	}
+
+	for _, c := range cases {
+		offset, err := GetHostOffset(c.subnet, c.address)
+		if c.fails {
+			if err == nil {
+				t.Errorf("%s: expected an error, got %d", c.name, offset)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", c.name, err.Error())
+		} else if offset != c.expected {
+			t.Errorf("%s: expected %d, got %d", c.name, c.expected, offset)
+		}
+	}
+}
+
+// serviceOf makes a service of containers whose counts and score match them
+func serviceOf(t *testing.T, containers ...ServiceConfigContainer) KisaraService {
+	config := ServiceConfig{Containers: containers, ContainerCount: len(containers)}
+	networks := map[string]bool{}
+	for _, container := range containers {
+		for _, network := range container.Networks {
+			networks[network.Network] = true
+		}
+		for _, flag := range container.Flags {
+			config.TotalScore += flag.FlagScore
+		}
+	}
+	config.NetworkCount = len(networks)
+
+	text, err := json.Marshal(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return KisaraService{Config: string(text)}
+}
+
+func TestGetConfig(t *testing.T) {
+	fixed := func(network string, subnet string, address string) ServiceConfigContainerNetwork {
+		return ServiceConfigContainerNetwork{Network: network, Subnet: subnet, IPv4Address: address}
+	}
+	random := func(network string, offset int) ServiceConfigContainerNetwork {
+		return ServiceConfigContainerNetwork{Network: network, RandomCIDR: true, HostOffset: offset}
+	}
+	container := func(name string, networks ...ServiceConfigContainerNetwork) ServiceConfigContainer {
+		return ServiceConfigContainer{Name: name, Image: "nginx", Networks: networks}
+	}
+
+	cases := []struct {
+		name       string
+		containers []ServiceConfigContainer
+		fails      bool
+	}{
+		{
+			name: "fixed and random networks",
+			containers: []ServiceConfigContainer{
+				container("web", fixed("front", "10.10.0.0/24", "10.10.0.10"), random("A", 10)),
+				container("db", fixed("front", "10.10.0.0/24", "10.10.0.11"), random("A", 11)),
+			},
+		},
+		{
+			name:       "random network named by more than a letter",
+			containers: []ServiceConfigContainer{container("web", random("AB", 0))},
+			fails:      true,
+		},
+		{
+			name:       "fixed address in a random network",
+			containers: []ServiceConfigContainer{container("web", ServiceConfigContainerNetwork{Network: "A", RandomCIDR: true, IPv4Address: "10.0.0.2"})},
+			fails:      true,
+		},
+		{
+			name:       "fixed network without subnet",
+			containers: []ServiceConfigContainer{container("web", fixed("front", "", ""))},
+			fails:      true,
+		},
+		{
+			name:       "address out of subnet",
+			containers: []ServiceConfigContainer{container("web", fixed("front", "10.10.0.0/24", "10.10.1.10"))},
+			fails:      true,
+		},
+		{
+			name:       "address and offset both set",
+			containers: []ServiceConfigContainer{container("web", ServiceConfigContainerNetwork{Network: "front", Subnet: "10.10.0.0/24", IPv4Address: "10.10.0.10", HostOffset: 10})},
+			fails:      true,
+		},
+		{
+			name:       "reserved offset in a random network",
+			containers: []ServiceConfigContainer{container("web", random("A", 1))},
+			fails:      true,
+		},
+		{
+			name: "duplicated address",
+			containers: []ServiceConfigContainer{
+				container("web", fixed("front", "10.10.0.0/24", "10.10.0.10")),
+				container("db", fixed("front", "10.10.0.0/24", "10.10.0.10")),
+			},
+			fails: true,
+		},
+		{
+			name: "address given as an offset of the same address",
+			containers: []ServiceConfigContainer{
+				container("web", fixed("front", "10.10.0.0/24", "10.10.0.10")),
+				container("db", ServiceConfigContainerNetwork{Network: "front", Subnet: "10.10.0.0/24", HostOffset: 10}),
+			},
+			fails: true,
+		},
+		{
+			name: "duplicated offset in a random network",
+			containers: []ServiceConfigContainer{
+				container("web", random("A", 10)),
+				container("db", random("A", 10)),
+			},
+			fails: true,
+		},
+		{
+			name: "network declared differently",
+			containers: []ServiceConfigContainer{
+				container("web", fixed("front", "10.10.0.0/24", "")),
+				container("db", fixed("front", "10.10.1.0/24", "")),
+			},
+			fails: true,
+		},
+		{
+			name: "overlapping subnets",
+			containers: []ServiceConfigContainer{
+				container("web", fixed("front", "10.10.0.0/16", "")),
+				container("db", fixed("back", "10.10.1.0/24", "")),
+			},
+			fails: true,
+		},
+		{
+			name: "duplicated container name",
+			containers: []ServiceConfigContainer{
+				container("web", random("A", 0)),
+				container("web", random("A", 0)),
+			},
+			fails: true,
+		},
+		{
+			name: "unknown dependency",
+			containers: []ServiceConfigContainer{
+				{Name: "web", Image: "nginx", DependsOn: []string{"db"}},
+			},
+			fails: true,
+		},
+		{
+			name: "dependency cycle",
+			containers: []ServiceConfigContainer{
+				{Name: "web", Image: "nginx", DependsOn: []string{"db"}},
+				{Name: "db", Image: "mysql", DependsOn: []string{"web"}},
+			},
+			fails: true,
+		},
+	}
+
+	for _, c := range cases {
+		service := serviceOf(t, c.containers...)
+		_, err := service.GetConfig()
+		if c.fails && err == nil {
+			t.Errorf("%s: expected an error", c.name)
+		} else if !c.fails && err != nil {
+			t.Errorf("%s: %s", c.name, err.Error())
+		}
+	}
+
+	// counts and score have to match the containers
+	service := serviceOf(t, container("web", random("A", 0)))
+	var config ServiceConfig
+	json.Unmarshal([]byte(service.Config), &config)
+	config.NetworkCount = 2
+	text, _ := json.Marshal(config)
+	if _, err := (&KisaraService{Config: string(text)}).GetConfig(); err == nil {
+		t.Errorf("network count is not checked")
+	}
+}
+
+func TestLaunchOrder(t *testing.T) {
+	static := []ServiceConfigContainerNetwork{{Network: "A", RandomCIDR: true, HostOffset: 10}}
+
+	cases := []struct {
+		name       string
+		containers []ServiceConfigContainer
+		expected   []int
+	}{
+		{
+			name:       "order of config is kept",
+			containers: []ServiceConfigContainer{{Name: "a"}, {Name: "b"}, {Name: "c"}},
+			expected:   []int{0, 1, 2},
+		},
+		{
+			name: "dependencies come first",
+			containers: []ServiceConfigContainer{
+				{Name: "web", DependsOn: []string{"api"}},
+				{Name: "api", DependsOn: []string{"db"}},
+				{Name: "db"},
+			},
+			expected: []int{2, 1, 0},
+		},
+		{
+			name: "static addresses come first",
+			containers: []ServiceConfigContainer{
+				{Name: "a"},
+				{Name: "b", Networks: static},
+				{Name: "c"},
+			},
+			expected: []int{1, 0, 2},
+		},
+		{
+			name: "dependencies of a static container are not skipped",
+			containers: []ServiceConfigContainer{
+				{Name: "a"},
+				{Name: "b", Networks: static, DependsOn: []string{"c"}},
+				{Name: "c"},
+			},
+			expected: []int{0, 2, 1},
+		},
+	}
+
+	for _, c := range cases {
+		config := ServiceConfig{Containers: c.containers}
+		order, err := config.LaunchOrder()
+		if err != nil {
+			t.Errorf("%s: %s", c.name, err.Error())
+		} else if !reflect.DeepEqual(order, c.expected) {
+			t.Errorf("%s: expected %v, got %v", c.name, c.expected, order)
+		}
+	}
+
+	// a cycle has no order
+	config := ServiceConfig{Containers: []ServiceConfigContainer{
+		{Name: "a", DependsOn: []string{"c"}},
+		{Name: "b", DependsOn: []string{"a"}},
+		{Name: "c", DependsOn: []string{"b"}},
+		{Name: "d"},
+	}}
+	if order, err := config.LaunchOrder(); err == nil {
+		t.Errorf("cycle is not detected, got %v", order)
+	}
+}
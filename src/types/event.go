@@ -0,0 +1,93 @@
+package types
+
+import "encoding/json"
+
+/*
+	events describe activities of the cluster, they are published by server and could be
+	subscribed through /events, a subscriber could filter them by type or its prefix, e.g.
+	"container" matches both "container.launch" and "container.stop"
+*/
+
+const (
+	EVENT_NODE_CONNECT    = "node.connect"    // payload is EventNode
+	EVENT_NODE_DISCONNECT = "node.disconnect" // payload is EventNode
+	EVENT_NODE_HEARTBEAT  = "node.heartbeat"  // payload is ClientStatus
+	EVENT_NODE_CORDON     = "node.cordon"     // payload is EventNode
+	EVENT_NODE_UNCORDON   = "node.uncordon"   // payload is EventNode
+	EVENT_NODE_DRAIN      = "node.drain"      // payload is DrainItem
+	EVENT_NODE_EVENT      = "node.event"      // payload is EventNodeEvent, pushed by client through channel
+
+	EVENT_CONTAINER_LAUNCH = "container.launch" // payload is Container
+	EVENT_CONTAINER_STOP   = "container.stop"   // payload is Container
+	EVENT_CONTAINER_EXTEND = "container.extend" // payload is Container
+
+	EVENT_SERVICE_START = "service.start" // payload is Service, flags are not included
+	EVENT_SERVICE_STOP  = "service.stop"  // payload is Service, flags are not included
+	EVENT_SERVICE_FLAGS = "service.flags" // payload is EventServiceFlags, flags are not included
+
+	EVENT_IMAGE_PULL    = "image.pull"    // payload is EventImage
+	EVENT_IMAGE_DELETE  = "image.delete"  // payload is EventImage
+	EVENT_IMAGE_BUILD   = "image.build"   // payload is EventImage
+	EVENT_IMAGE_REFRESH = "image.refresh" // payload is ImageRefreshResult, pushed by client after refreshing
+
+	EVENT_MONITOR_RUN  = "monitor.run"  // payload is EventMonitor
+	EVENT_MONITOR_STOP = "monitor.stop" // payload is EventMonitor
+
+	EVENT_GAME_START  = "game.start"  // payload is Game
+	EVENT_GAME_PAUSE  = "game.pause"  // payload is Game
+	EVENT_GAME_RESUME = "game.resume" // payload is Game
+	EVENT_GAME_STOP   = "game.stop"   // payload is Game
+	EVENT_GAME_ROUND  = "game.round"  // payload is GameRound, flags are not included
+
+	// only sent to a subscriber resuming from an event which is no longer kept, it should reload its state
+	EVENT_RESET = "events.reset" // payload is EventReset
+)
+
+type KisaraEvent struct {
+	// Id increases for every event and keeps increasing after server restarts, used to resume a subscription
+	Id uint64 `json:"id"`
+	// Type is one of EVENT_*
+	Type string `json:"type"`
+	// Time is the unix time in milliseconds the event happened at
+	Time int64 `json:"time"`
+	// ClientID is the node the event happened on, empty if it's not about a node
+	ClientID string `json:"client_id,omitempty"`
+	// Payload depends on Type
+	Payload json.RawMessage `json:"payload"`
+}
+
+// EventNode is a node without its token
+type EventNode struct {
+	ClientID   string            `json:"client_id"`
+	ClientIp   string            `json:"client_ip"`
+	ClientPort int               `json:"client_port"`
+	Labels     map[string]string `json:"labels"`
+}
+
+type EventNodeEvent struct {
+	Event   string          `json:"event"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+type EventReset struct {
+	// LastId is the id the subscriber resumed from
+	LastId uint64 `json:"last_id"`
+	// OldestId is the oldest event still kept, events between them are lost
+	OldestId uint64 `json:"oldest_id"`
+}
+
+type EventImage struct {
+	ImageName string `json:"image_name,omitempty"`
+	ImageId   string `json:"image_id,omitempty"`
+}
+
+type EventMonitor struct {
+	NetworkName               string `json:"network_name,omitempty"`
+	NetworkMonitorContainerId string `json:"network_monitor_container_id"`
+}
+
+type EventServiceFlags struct {
+	ServiceId string               `json:"service_id"`
+	Rotated   int                  `json:"rotated"`
+	Failed    []ServiceFlagFailure `json:"failed"`
+}
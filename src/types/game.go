@@ -0,0 +1,79 @@
+package types
+
+const (
+	GAME_STATUS_RUNNING = "running"
+	GAME_STATUS_PAUSED  = "paused"
+	GAME_STATUS_STOPPED = "stopped"
+)
+
+/*
+	SLA status of a team in a round is decided by the exit code of the checker script,
+	the worst status of all checked containers is the status of the team
+*/
+const (
+	SLA_UP     = "up"     // checker exited with 0
+	SLA_MUMBLE = "mumble" // checker exited with 1, the service answers but wrongly
+	SLA_DOWN   = "down"   // checker exited with others, timed out or could not run at all
+)
+
+const (
+	GAME_CHECKER_EXIT_UP     = 0
+	GAME_CHECKER_EXIT_MUMBLE = 1
+)
+
+type GameTeam struct {
+	// Name of the team
+	Name string `json:"name"`
+	// ClientID is the node the service of the team runs on
+	ClientID string `json:"client_id"`
+	// ServiceId is the service launched for the team
+	ServiceId string `json:"service_id"`
+	// CheckerContainerId is the network monitor checking the service, empty if there's no checker
+	CheckerContainerId string `json:"checker_container_id"`
+}
+
+type Game struct {
+	Id     string `json:"id"`
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	// Round is the number of the last played round, rounds start from 1
+	Round int `json:"round"`
+	// RoundInterval is the length of a round in seconds
+	RoundInterval int64      `json:"round_interval"`
+	Teams         []GameTeam `json:"teams"`
+	StartedAt     int64      `json:"started_at"`
+}
+
+type GameCheck struct {
+	// ContainerId is the checked container
+	ContainerId string `json:"container_id"`
+	// Status is one of SLA_*
+	Status string `json:"status"`
+	// Output of the checker script
+	Output string `json:"output"`
+	// Error occurred while running the checker script
+	Error string `json:"error"`
+}
+
+type GameRoundTeam struct {
+	Team      string `json:"team"`
+	ServiceId string `json:"service_id"`
+	// Status is one of SLA_*
+	Status string `json:"status"`
+	// Flags of the service in this round, not included in events
+	Flags []ServiceFlag `json:"flags,omitempty"`
+	// FlagsFailed are flags which could not be rotated in this round
+	FlagsFailed []ServiceFlagFailure `json:"flags_failed"`
+	// Checks are results of the checker script, one for each container on the checker network
+	Checks []GameCheck `json:"checks"`
+	// Error occurred while playing the round for the team
+	Error string `json:"error"`
+}
+
+type GameRound struct {
+	GameId     string          `json:"game_id"`
+	Round      int             `json:"round"`
+	StartedAt  int64           `json:"started_at"`
+	FinishedAt int64           `json:"finished_at"`
+	Teams      []GameRoundTeam `json:"teams"`
+}
@@ -15,6 +15,8 @@ type KisaraNetworkTest struct {
 	TestContainerId string `json:"test_container_id"`
 	// The test cmd like "python3 test.py $ip", the $ip will be replaced by the container's ip
 	Script string `json:"script"`
+	// The $flag in Script will be replaced by it
+	Flag string `json:"flag"`
 }
 
 type KisaraNetworkTestSet struct {
@@ -26,6 +28,8 @@ type KisaraNetworkTestResult struct {
 	ContainerId string `json:"container_id"`
 	// Result of the test, bytewise
 	Result []byte `json:"result"`
+	// Exit code of the test cmd
+	ExitCode int `json:"exit_code"`
 }
 
 type KisaraNetworkTestResultSet struct {
@@ -3,6 +3,7 @@ package types
 import (
 	"io"
 	"mime/multipart"
+	"time"
 )
 
 type KisaraResponse struct {
@@ -48,6 +49,8 @@ type RequestConnect struct {
 	ClientIp string `json:"client_ip" form:"client_ip" binding:"required"`
 	// ClientPort
 	ClientPort int `json:"client_port" form:"client_port" binding:"required"`
+	// Labels of the node, used by scheduler
+	Labels map[string]string `json:"labels" form:"labels"`
 	// callback
 	Callback func(ResponseConnect) `json:"-"`
 }
@@ -72,18 +75,21 @@ type ResponseDisconnect struct {
 type RequestStatus struct {
 	// ClientID is the unique ID of the client
 	ClientID string `json:"client_id" form:"client_id" binding:"required"`
+	// usages are fractions in [0, 1], zero is a valid value so they are not required
 	// CPUUsage is the CPU usage of the client
-	CPUUsage float64 `json:"cpu_usage" form:"cpu_usage" binding:"required"`
+	CPUUsage float64 `json:"cpu_usage" form:"cpu_usage"`
 	// MemoryUsage is the memory usage of the client
-	MemoryUsage float64 `json:"memory_usage" form:"memory_usage" binding:"required"`
+	MemoryUsage float64 `json:"memory_usage" form:"memory_usage"`
 	// DiskUsage is the disk usage of the client
-	DiskUsage float64 `json:"disk_usage" form:"disk_usage" binding:"required"`
+	DiskUsage float64 `json:"disk_usage" form:"disk_usage"`
 	// NetworkUsage is the network usage of the client
-	NetworkUsage float64 `json:"network_usage" form:"network_usage" binding:"required"`
+	NetworkUsage float64 `json:"network_usage" form:"network_usage"`
 	// ContainerNum is the number of containers of the client
-	ContainerNum int `json:"container_num" form:"container_num" binding:"required"`
+	ContainerNum int `json:"container_num" form:"container_num"`
 	// ContainerUsage is the usage of containers of the client
-	ContainerUsage float64 `json:"container_usage" form:"container_usage" binding:"required"`
+	ContainerUsage float64 `json:"container_usage" form:"container_usage"`
+	// Images are tags of images on the client
+	Images []string `json:"images" form:"images"`
 }
 
 type ResponseStatus struct {
@@ -119,6 +125,60 @@ type RequestLaunchContainer struct {
 	Module string `json:"module" form:"module"`
 	// EnvMount is the env mount of the container
 	EnvMount []map[string]string `json:"env_mount" form:"env_mount"`
+	// Policy is the scheduler used when ClientID is empty, default scheduler if empty
+	Policy string `json:"policy" form:"policy"`
+	// NodeSelector is the labels the node must have when ClientID is empty
+	NodeSelector map[string]string `json:"node_selector" form:"node_selector"`
+	// NodeAffinity is the labels the node is preferred to have, used by affinity policy
+	NodeAffinity map[string]string `json:"node_affinity" form:"node_affinity"`
+	// TTL is the lifetime of the container in seconds, 0 means forever
+	TTL int64 `json:"ttl" form:"ttl"`
+	// ExpireAt is the unix time the container expires at, it overrides TTL
+	ExpireAt int64 `json:"expire_at" form:"expire_at"`
+	// ImageRefresh overrides the image refresh policy of the node if it's set
+	ImageRefresh ImageRefresh `json:"image_refresh" form:"image_refresh"`
+	// Registry is the credential of the registry of the image, server seals it into RegistryAuth
+	Registry *RegistryCredential `json:"-" form:"-"`
+	// RegistryAuth is Registry sealed by kisara.token, credential of the node is used if it's empty
+	RegistryAuth string `json:"registry_auth" form:"registry_auth"`
+	// CpuLimit is the cpus the container could use, 0.5 means half of one core
+	CpuLimit float64 `json:"cpu_limit" form:"cpu_limit"`
+	// MemoryLimit is the memory the container could use in bytes
+	MemoryLimit int64 `json:"memory_limit" form:"memory_limit"`
+	// PidsLimit is the max number of processes in the container
+	PidsLimit int64 `json:"pids_limit" form:"pids_limit"`
+	// DiskQuota is the size of the writable layer in bytes
+	DiskQuota int64 `json:"disk_quota" form:"disk_quota"`
+	// BandwidthIn is the bits per second the container could receive
+	BandwidthIn int64 `json:"bandwidth_in" form:"bandwidth_in"`
+	// BandwidthOut is the bits per second the container could send
+	BandwidthOut int64 `json:"bandwidth_out" form:"bandwidth_out"`
+}
+
+// GetExpireAt returns the unix time the container expires at if it's launched now, 0 means never
+func (r *RequestLaunchContainer) GetExpireAt() int64 {
+	return expireAt(r.TTL, r.ExpireAt)
+}
+
+func (r *RequestLaunchContainer) GetResources() ContainerResources {
+	return ContainerResources{
+		CpuLimit:     r.CpuLimit,
+		MemoryLimit:  r.MemoryLimit,
+		PidsLimit:    r.PidsLimit,
+		DiskQuota:    r.DiskQuota,
+		BandwidthIn:  r.BandwidthIn,
+		BandwidthOut: r.BandwidthOut,
+	}
+}
+
+func expireAt(ttl int64, expire_at int64) int64 {
+	if expire_at > 0 {
+		return expire_at
+	}
+	if ttl > 0 {
+		return time.Now().Unix() + ttl
+	}
+	return 0
 }
 
 type ResponseLaunchContainer struct {
@@ -162,6 +222,29 @@ type RequestStopContainer struct {
 	ContainerID string `json:"container_id" form:"container_id" binding:"required"`
 }
 
+type RequestExtendContainer struct {
+	// ClientID is the unique ID of the client
+	ClientID string `json:"client_id" form:"client_id" binding:"required"`
+	// ContainerID is the container ID of the container
+	ContainerID string `json:"container_id" form:"container_id" binding:"required"`
+	// TTL is the new lifetime of the container in seconds from now
+	TTL int64 `json:"ttl" form:"ttl"`
+	// ExpireAt is the new unix time the container expires at, it overrides TTL
+	ExpireAt int64 `json:"expire_at" form:"expire_at"`
+}
+
+// GetExpireAt returns the new unix time the container expires at, 0 means never
+func (r *RequestExtendContainer) GetExpireAt() int64 {
+	return expireAt(r.TTL, r.ExpireAt)
+}
+
+type ResponseExtendContainer struct {
+	// ClientID is the unique ID of the client
+	ClientID string `json:"client_id"`
+	// ExpireAt is the unix time the container expires at now
+	ExpireAt int64 `json:"expire_at"`
+}
+
 type ResponseStopContainer struct {
 	// ClientID is the unique ID of the client
 	ClientID string `json:"client_id"`
@@ -211,10 +294,69 @@ type RequestExecContainer struct {
 type ResponseExecContainer struct {
 	// ClientID is the unique ID of the client
 	ClientID string `json:"client_id"`
+	// Stdout is the stdout of the command
+	Stdout string `json:"stdout"`
+	// Stderr is the stderr of the command
+	Stderr string `json:"stderr"`
+	// ExitCode is the exit code of the command
+	ExitCode int `json:"exit_code"`
 	// Error is the error of the container
 	Error string `json:"error"`
 }
 
+// the first message of an exec io websocket, streams start after it
+type RequestExecContainerIO struct {
+	// ClientID is the unique ID of the client
+	ClientID string `json:"client_id" binding:"required"`
+	// ContainerID is the container ID of the container
+	ContainerID string `json:"container_id" binding:"required"`
+	// Cmd is the command to run, /bin/sh if empty
+	Cmd []string `json:"cmd"`
+	// Tty allocates a pseudo terminal, stderr is merged into stdout then
+	Tty bool `json:"tty"`
+	// Rows is the initial height of tty
+	Rows uint `json:"rows"`
+	// Cols is the initial width of tty
+	Cols uint `json:"cols"`
+}
+
+type ResponseExecContainerIO struct {
+	// ClientID is the unique ID of the client
+	ClientID string `json:"client_id"`
+	// ExitCode is the exit code of the command
+	ExitCode int `json:"exit_code"`
+}
+
+const (
+	EXEC_IO_STDIN       = "stdin"
+	EXEC_IO_STDIN_CLOSE = "stdin_close"
+	EXEC_IO_STDOUT      = "stdout"
+	EXEC_IO_STDERR      = "stderr"
+	EXEC_IO_RESIZE      = "resize"
+	EXEC_IO_EXIT        = "exit"
+	EXEC_IO_ERROR       = "error"
+)
+
+// messages of an exec io websocket after the request
+type ExecIOMessage struct {
+	// Type is one of EXEC_IO_*
+	Type string `json:"type"`
+	// Data of stdin, stdout or stderr
+	Data []byte `json:"data,omitempty"`
+	// Rows and Cols of resize
+	Rows uint `json:"rows,omitempty"`
+	Cols uint `json:"cols,omitempty"`
+	// ExitCode of exit
+	ExitCode int `json:"exit_code"`
+	// Error of error
+	Error string `json:"error,omitempty"`
+}
+
+type ExecIOResize struct {
+	Rows uint
+	Cols uint
+}
+
 type RequestInspectContainer struct {
 	// ClientID is the unique ID of the client
 	ClientID string `json:"client_id" form:"client_id" binding:"required"`
@@ -270,10 +412,14 @@ type RequestPullImage struct {
 	// func HandleControllerRequestPullImage(request_id string, image_name string, port_protocol string, user string)
 	// ImageName is the image name of the container
 	ImageName string `json:"image_name" form:"image_name" binding:"required"`
-	// PortProtocol is the port protocol of the container
-	PortProtocol string `json:"port_protocol" form:"port_protocol" binding:"required"`
-	// User is the user of the container
-	User string `json:"user" form:"user" binding:"required"`
+	// PortProtocol is the port protocol of the container, not used by pulling
+	PortProtocol string `json:"port_protocol" form:"port_protocol"`
+	// User is the user of the container, not used by pulling
+	User string `json:"user" form:"user"`
+	// Registry is the credential of the registry of the image, server seals it into RegistryAuth
+	Registry *RegistryCredential `json:"-" form:"-"`
+	// RegistryAuth is Registry sealed by kisara.token, credential of the node is used if it's empty
+	RegistryAuth string `json:"registry_auth" form:"registry_auth"`
 }
 
 type ResponsePullImage struct {
@@ -371,6 +517,25 @@ type RequestLaunchService struct {
 	ClientID string `json:"client_id" form:"client_id" binding:"required"`
 	// ServiceConfig
 	ServiceConfig KisaraService `json:"service_config" form:"service_config" binding:"required"`
+	// Policy is the scheduler used when ClientID is empty, default scheduler if empty
+	Policy string `json:"policy" form:"policy"`
+	// NodeSelector is the labels the node must have when ClientID is empty
+	NodeSelector map[string]string `json:"node_selector" form:"node_selector"`
+	// NodeAffinity is the labels the node is preferred to have, used by affinity policy
+	NodeAffinity map[string]string `json:"node_affinity" form:"node_affinity"`
+	// TTL is the lifetime of the service in seconds, 0 means forever
+	TTL int64 `json:"ttl" form:"ttl"`
+	// ExpireAt is the unix time the service expires at, it overrides TTL
+	ExpireAt int64 `json:"expire_at" form:"expire_at"`
+	// BuildContexts are tar archives of build contexts keyed by ServiceConfigContainerBuild.Context
+	BuildContexts map[string][]byte `json:"build_contexts" form:"build_contexts"`
+	// ImageRefresh overrides the image refresh policy of the node for all images of the service
+	ImageRefresh ImageRefresh `json:"image_refresh" form:"image_refresh"`
+}
+
+// GetExpireAt returns the unix time the service expires at if it's launched now, 0 means never
+func (r *RequestLaunchService) GetExpireAt() int64 {
+	return expireAt(r.TTL, r.ExpireAt)
 }
 
 type ResponseLaunchService struct {
@@ -445,6 +610,22 @@ type ResponseStopService struct {
 	ResponseID string `json:"response_id"`
 }
 
+type RequestRotateServiceFlags struct {
+	// ClientID is the unique ID of the client
+	ClientID string `json:"client_id" form:"client_id" binding:"required"`
+	// ServiceID
+	ServiceID string `json:"service_id" form:"service_id" binding:"required"`
+}
+
+type ResponseRotateServiceFlags struct {
+	// ClientID is the unique ID of the client
+	ClientID string `json:"client_id"`
+	// Flags are all flags of the service after rotation, failed ones keep their old flag
+	Flags []ServiceFlag `json:"flags"`
+	// Failed are flags which could not be rotated
+	Failed []ServiceFlagFailure `json:"failed"`
+}
+
 type RequestCheckStopService struct {
 	// ClientID is the unique ID of the client
 	ClientID string `json:"client_id" form:"client_id" binding:"required"`
@@ -625,3 +806,320 @@ type ResponseNetworkMonitorRunScript struct {
 	// Containers to be tested
 	Result KisaraNetworkTestResultSet `json:"result"`
 }
+
+type RequestDrainNode struct {
+	// ClientID is the unique ID of the node to be drained
+	ClientID string `json:"client_id" form:"client_id" binding:"required"`
+	// Relaunch workloads on other nodes, they are stopped if it's false or relaunch failed
+	Relaunch bool `json:"relaunch" form:"relaunch"`
+}
+
+const (
+	DRAIN_KIND_CONTAINER = "container"
+	DRAIN_KIND_SERVICE   = "service"
+)
+
+type DrainItem struct {
+	// Kind is container or service
+	Kind string `json:"kind"`
+	// Id of the drained workload
+	Id string `json:"id"`
+	// NewClientID is the node the workload relaunched on, empty if it's stopped
+	NewClientID string `json:"new_client_id"`
+	// NewId of the relaunched workload
+	NewId string `json:"new_id"`
+	// Error occurred while draining the workload
+	Error string `json:"error"`
+}
+
+type ResponseDrainNode struct {
+	// ClientID is the unique ID of the drained node
+	ClientID string `json:"client_id"`
+	// Items are the workloads drained
+	Items []DrainItem `json:"items"`
+}
+
+type RequestStartGame struct {
+	// Name of the game
+	Name string `json:"name" form:"name"`
+	// Service is the template launched once for every team
+	Service KisaraService `json:"service" form:"service" binding:"required"`
+	// Teams are names of the teams
+	Teams []string `json:"teams" form:"teams" binding:"required"`
+	// RoundInterval is the length of a round in seconds
+	RoundInterval int64 `json:"round_interval" form:"round_interval" binding:"required"`
+	// Checker is a tar archive of the build context of the checker image, no check is run if it's empty
+	Checker []byte `json:"checker" form:"checker"`
+	// CheckerNetwork is the network of the service the checker joins, the first one by name if empty
+	CheckerNetwork string `json:"checker_network" form:"checker_network"`
+	// CheckerScript is run in the checker against every container on its network, $ip and $flag are replaced
+	CheckerScript string `json:"checker_script" form:"checker_script"`
+	// Policy is the scheduler used to place services of teams, default scheduler if empty
+	Policy string `json:"policy" form:"policy"`
+	// NodeSelector is the labels the nodes must have
+	NodeSelector map[string]string `json:"node_selector" form:"node_selector"`
+}
+
+type ImageDistributionItem struct {
+	ImageName string `json:"image_name"`
+	// Ready is true if the image is pulled on the node
+	Ready bool `json:"ready"`
+	// Error occurred while pulling the image
+	Error string `json:"error"`
+}
+
+type ImageDistributionNode struct {
+	ClientID string `json:"client_id"`
+	// Ready is true if all images are pulled on the node
+	Ready  bool                    `json:"ready"`
+	Images []ImageDistributionItem `json:"images"`
+}
+
+type ResponseDistributeImages struct {
+	// Ready is true if all images are pulled on all nodes
+	Ready bool                    `json:"ready"`
+	Nodes []ImageDistributionNode `json:"nodes"`
+}
+
+// ImagePeer is a node an image can be copied from
+type ImagePeer struct {
+	ClientID   string `json:"client_id"`
+	ClientIp   string `json:"client_ip"`
+	ClientPort int    `json:"client_port"`
+	// Channel is true if the node has a control channel, it's reached through server instead of its address
+	Channel bool `json:"channel"`
+}
+
+type RequestSaveImage struct {
+	// ClientID is the unique ID of the client
+	ClientID string `json:"client_id" form:"client_id" binding:"required"`
+	// ImageName is the image to be saved as a tar stream
+	ImageName string `json:"image_name" form:"image_name" binding:"required"`
+}
+
+type RequestFetchImage struct {
+	// ClientID is the unique ID of the client
+	ClientID string `json:"client_id" form:"client_id" binding:"required"`
+	// ImageName is the image to be copied
+	ImageName string `json:"image_name" form:"image_name" binding:"required"`
+	// Peers are tried in order until one of them sends the image
+	Peers []ImagePeer `json:"peers" form:"peers"`
+}
+
+type ResponseFetchImage struct {
+	// ClientID is the unique ID of the client
+	ClientID string `json:"client_id"`
+	// Source is the node the image was copied from
+	Source string `json:"source"`
+	// ImageId is the id of the loaded image
+	ImageId string `json:"image_id"`
+}
+
+type RequestImagePeers struct {
+	// ClientID is the unique ID of the client
+	ClientID string `json:"client_id" form:"client_id" binding:"required"`
+	// ImageName is the image the client wants
+	ImageName string `json:"image_name" form:"image_name" binding:"required"`
+}
+
+type ResponseImagePeers struct {
+	// ClientID is the unique ID of the client
+	ClientID string      `json:"client_id"`
+	Peers    []ImagePeer `json:"peers"`
+}
+
+type RequestTransferImage struct {
+	ImageName string `json:"image_name"`
+	// FromClientID is the node to copy from, every node having the image is tried if it's empty
+	FromClientID string `json:"from_client_id"`
+	// ToClientID is the node to copy to
+	ToClientID string `json:"to_client_id"`
+}
+
+type RequestBuildImage struct {
+	// ClientID is the unique ID of the client
+	ClientID string `json:"client_id" form:"client_id" binding:"required"`
+	// ImageName is the tag of the built image
+	ImageName string `json:"image_name" form:"image_name" binding:"required"`
+	// BuildArgs are passed to the Dockerfile, it's a json object in a multipart upload
+	BuildArgs map[string]string `json:"build_args" form:"-"`
+}
+
+/*
+	the tar archive of the build context is the file of a multipart upload over http, over channel
+	it's the chunks of the stream, the client answers with build logs and the id of the image
+*/
+const (
+	BUILD_STREAM_LOG   = "log"
+	BUILD_STREAM_IMAGE = "image"
+)
+
+type ResponseBuildImage struct {
+	// ClientID is the unique ID of the client
+	ClientID string `json:"client_id"`
+	// MessageResponseId is the request ID of build logs
+	MessageResponseId string `json:"message_resposne_id"`
+	// FinishResponseID is the request ID of the result
+	FinishResponseID string `json:"finish_response_id"`
+}
+
+type RequestCheckBuildImage struct {
+	// ClientID is the unique ID of the client
+	ClientID string `json:"client_id" form:"client_id" binding:"required"`
+	// MessageResponseId is the request ID of build logs
+	MessageResponseId string `json:"message_resposne_id" form:"message_resposne_id" binding:"required"`
+	// FinishResponseID is the request ID of the result
+	FinishResponseID string `json:"finish_response_id" form:"finish_response_id" binding:"required"`
+	// Offset is the number of build logs already received
+	Offset int `json:"offset" form:"offset"`
+}
+
+type ResponseCheckBuildImage struct {
+	// ClientID is the unique ID of the client
+	ClientID string `json:"client_id"`
+	// Error is the error of the build
+	Error string `json:"error"`
+	// Finished is true if the build is finished
+	Finished bool `json:"finished"`
+	// Message is the latest build log
+	Message string `json:"message"`
+	// Logs are build logs from Offset of the request, all of them are included once Finished is true
+	Logs []string `json:"logs"`
+	// Offset is the offset to request the next logs from
+	Offset int `json:"offset"`
+	// ImageId is the id of the built image
+	ImageId string `json:"image_id"`
+}
+
+type ImageBuildNode struct {
+	ClientID string `json:"client_id"`
+	// ImageId is the id of the built image, empty if the build failed
+	ImageId string `json:"image_id"`
+	// Error occurred while building the image
+	Error string `json:"error"`
+}
+
+type ResponseFinalBuildImage struct {
+	ImageName string           `json:"image_name"`
+	Nodes     []ImageBuildNode `json:"nodes"`
+}
+
+type RequestPruneImages struct {
+	// ClientID is the unique ID of the client
+	ClientID string `json:"client_id" form:"client_id" binding:"required"`
+	// DryRun only reports images which would be removed
+	DryRun bool `json:"dry_run" form:"dry_run"`
+}
+
+type ResponsePruneImages struct {
+	// ClientID is the unique ID of the client
+	ClientID string `json:"client_id"`
+	DryRun   bool   `json:"dry_run"`
+	// Images are removed, or would be removed in a dry run
+	Images []PrunedImage `json:"images"`
+}
+
+type RequestCopyToContainer struct {
+	// ClientID is the unique ID of the client
+	ClientID string `json:"client_id" form:"client_id" binding:"required"`
+	// ContainerID is the container files are copied into
+	ContainerID string `json:"container_id" form:"container_id" binding:"required"`
+	// Path is an existing directory in the container the tar archive is extracted to
+	Path string `json:"path" form:"path" binding:"required"`
+}
+
+type ResponseCopyToContainer struct {
+	// ClientID is the unique ID of the client
+	ClientID    string `json:"client_id"`
+	ContainerID string `json:"container_id"`
+	Path        string `json:"path"`
+	// Size is the size of the copied tar archive
+	Size int64 `json:"size"`
+}
+
+type RequestCopyFromContainer struct {
+	// ClientID is the unique ID of the client
+	ClientID string `json:"client_id" form:"client_id" binding:"required"`
+	// ContainerID is the container files are copied from
+	ContainerID string `json:"container_id" form:"container_id" binding:"required"`
+	// Path is a file or directory in the container, it's copied as a tar archive
+	Path string `json:"path" form:"path" binding:"required"`
+}
+
+type ResponseCopyFromContainer struct {
+	// ClientID is the unique ID of the client
+	ClientID    string `json:"client_id"`
+	ContainerID string `json:"container_id"`
+	Path        string `json:"path"`
+	// Size is the size of the copied tar archive
+	Size int64 `json:"size"`
+}
+
+type RequestContainerLogs struct {
+	// ClientID is the unique ID of the client
+	ClientID string `json:"client_id" form:"client_id" binding:"required"`
+	// ContainerID is the container whose logs are read
+	ContainerID string `json:"container_id" form:"container_id" binding:"required"`
+	// Since is a unix time, only logs after it are returned, 0 means from the beginning
+	Since int64 `json:"since" form:"since"`
+	// Tail is the number of lines from the end, 0 means all
+	Tail int `json:"tail" form:"tail"`
+}
+
+type ResponseContainerLogs struct {
+	// ClientID is the unique ID of the client
+	ClientID    string `json:"client_id"`
+	ContainerID string `json:"container_id"`
+	Stdout      string `json:"stdout"`
+	Stderr      string `json:"stderr"`
+	// Retained is true if the container was removed and logs are captured when it was stopped
+	Retained bool `json:"retained"`
+	// Truncated is true if the beginning of the logs is dropped by kisaraClient.log_max_size
+	Truncated bool `json:"truncated"`
+}
+
+type RequestResourceHistory struct {
+	// ClientID is the node, history of every node and their aggregate is returned if it's empty
+	// and ContainerID is not set
+	ClientID string `json:"client_id" form:"client_id"`
+	// ContainerID selects a container instead of the node, it may have been removed
+	ContainerID string `json:"container_id" form:"container_id"`
+	// AllContainers returns history of every container of the node too, including removed ones
+	AllContainers bool `json:"all_containers" form:"all_containers"`
+	// From and To are unix times, To defaults to now and From to an hour before To
+	From int64 `json:"from" form:"from"`
+	To   int64 `json:"to" form:"to"`
+	// Step is the resolution in seconds, it's raised to the sampling interval of nodes and to keep
+	// at most 1000 samples in a series
+	Step int64 `json:"step" form:"step"`
+}
+
+type ResponseResourceHistory struct {
+	// Step is the resolution actually used
+	Step   int64            `json:"step"`
+	Series []ResourceSeries `json:"series"`
+}
+
+const (
+	RESOURCE_HISTORY_DEFAULT_RANGE = 3600 // seconds
+	RESOURCE_HISTORY_MAX_SAMPLES   = 1000
+)
+
+// Normalize fills the default range and raises Step to min_step and to keep at most RESOURCE_HISTORY_MAX_SAMPLES
+func (r *RequestResourceHistory) Normalize(now int64, min_step int64) {
+	if r.To <= 0 {
+		r.To = now
+	}
+	if r.From <= 0 || r.From >= r.To {
+		r.From = r.To - RESOURCE_HISTORY_DEFAULT_RANGE
+	}
+	if r.Step < min_step {
+		r.Step = min_step
+	}
+	if r.Step <= 0 {
+		r.Step = 1
+	}
+	if min_samples_step := (r.To - r.From + RESOURCE_HISTORY_MAX_SAMPLES - 1) / RESOURCE_HISTORY_MAX_SAMPLES; r.Step < min_samples_step {
+		r.Step = min_samples_step
+	}
+}